@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// defaultRunCycles limits continue when no cycle count is given.
+const defaultRunCycles = 100_000
+
+// debugger runs the commands of a debugging session on an emulated state machine.
+type debugger struct {
+	sm          *emu.StateMachine
+	dis         pio.Disassembler
+	offset      uint8
+	length      uint8
+	wrapTarget  uint8
+	wrap        uint8
+	breakpoints map[uint8]bool
+	cycle       uint64
+	out         io.Writer
+}
+
+func newDebugger(sm *emu.StateMachine, prog *pio.AssembledProgram, offset uint8, out io.Writer) *debugger {
+	return &debugger{
+		sm:          sm,
+		dis:         prog.Disassembler(),
+		offset:      offset,
+		length:      uint8(len(prog.Instructions)),
+		wrapTarget:  offset + prog.WrapTarget,
+		wrap:        offset + prog.Wrap,
+		breakpoints: map[uint8]bool{},
+		out:         out,
+	}
+}
+
+var commands = []struct {
+	name, alias, args, help string
+	run                     func(d *debugger, args []string) error
+}{
+	{"step", "s", "[cycles]", "step system clock cycles, 1 by default, stopping at breakpoints", (*debugger).step},
+	{"continue", "c", "[cycles]", fmt.Sprintf("run until a breakpoint, for at most %d cycles by default", defaultRunCycles), (*debugger).cont},
+	{"break", "b", "[addr]", "set a breakpoint on an instruction memory address, or list them", (*debugger).setBreak},
+	{"delete", "d", "[addr]", "delete a breakpoint, or all of them", (*debugger).deleteBreak},
+	{"list", "l", "", "disassemble the program, marking the PC with => and breakpoints with *", (*debugger).list},
+	{"regs", "r", "", "show the PC, scratch and shift registers, FIFOs, IRQ flags and pins", (*debugger).regs},
+	{"tx", "", "<word>...", "push words to the TX FIFO", (*debugger).tx},
+	{"rx", "", "", "pop a word from the RX FIFO", (*debugger).rx},
+	{"pin", "", "<pin> <0|1>", "drive an input pin level", (*debugger).pin},
+}
+
+// exec runs a command line, returning io.EOF for the quit command.
+func (d *debugger) exec(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	switch fields[0] {
+	case "quit", "q":
+		return io.EOF
+	case "help", "h":
+		d.help()
+		return nil
+	}
+	for _, cmd := range commands {
+		if fields[0] == cmd.name || fields[0] == cmd.alias {
+			return cmd.run(d, fields[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %q, try help", fields[0])
+}
+
+func (d *debugger) help() {
+	for _, cmd := range commands {
+		name := cmd.name
+		if cmd.alias != "" {
+			name += ", " + cmd.alias
+		}
+		fmt.Fprintf(d.out, "  %-22s %s\n", name+" "+cmd.args, cmd.help)
+	}
+	fmt.Fprintf(d.out, "  %-22s %s\n", "help, h", "list the commands")
+	fmt.Fprintf(d.out, "  %-22s %s\n", "quit, q", "exit the debugger")
+}
+
+// run steps up to cycles cycles, stopping when the state machine starts an instruction with a
+// breakpoint, and prints where it stopped.
+func (d *debugger) run(cycles int) {
+	for i := 0; i < cycles; i++ {
+		pc := d.sm.PC()
+		d.sm.Step()
+		d.cycle++
+		if d.sm.Err() != nil {
+			break
+		}
+		if next := d.sm.PC(); next != pc && d.breakpoints[next] {
+			fmt.Fprintf(d.out, "breakpoint at %d\n", next)
+			break
+		}
+	}
+	d.where()
+}
+
+// where prints the cycle count and the instruction at the PC.
+func (d *debugger) where() {
+	pc := d.sm.PC()
+	fmt.Fprintf(d.out, "cycle %d pc %d: %s", d.cycle, pc, d.dis.Disassemble(d.sm.Memory()[pc]))
+	if d.sm.Stalled() {
+		fmt.Fprint(d.out, " (stalled)")
+	}
+	fmt.Fprintln(d.out)
+	if err := d.sm.Err(); err != nil {
+		fmt.Fprintln(d.out, "error:", err)
+	}
+}
+
+func (d *debugger) step(args []string) error {
+	cycles, err := optionalCount(args, 1)
+	if err != nil {
+		return err
+	}
+	d.run(cycles)
+	return nil
+}
+
+func (d *debugger) cont(args []string) error {
+	cycles, err := optionalCount(args, defaultRunCycles)
+	if err != nil {
+		return err
+	}
+	d.run(cycles)
+	return nil
+}
+
+func (d *debugger) setBreak(args []string) error {
+	if len(args) == 0 {
+		for _, addr := range d.sortedBreakpoints() {
+			fmt.Fprintf(d.out, "%d: %s\n", addr, d.dis.Disassemble(d.sm.Memory()[addr]))
+		}
+		return nil
+	} else if len(args) != 1 {
+		return errors.New("usage: break [addr]")
+	}
+	addr, err := d.address(args[0])
+	if err != nil {
+		return err
+	}
+	d.breakpoints[addr] = true
+	return nil
+}
+
+func (d *debugger) deleteBreak(args []string) error {
+	switch len(args) {
+	case 0:
+		clear(d.breakpoints)
+	case 1:
+		addr, err := d.address(args[0])
+		if err != nil {
+			return err
+		} else if !d.breakpoints[addr] {
+			return fmt.Errorf("no breakpoint at %d", addr)
+		}
+		delete(d.breakpoints, addr)
+	default:
+		return errors.New("usage: delete [addr]")
+	}
+	return nil
+}
+
+// address parses an instruction memory address within the loaded program.
+func (d *debugger) address(s string) (uint8, error) {
+	addr, err := strconv.ParseUint(s, 0, 8)
+	if err != nil || uint8(addr) < d.offset || uint8(addr) >= d.offset+d.length {
+		return 0, fmt.Errorf("address %s is not in the program at %d to %d", s, d.offset, d.offset+d.length-1)
+	}
+	return uint8(addr), nil
+}
+
+func (d *debugger) list(args []string) error {
+	for addr := d.offset; addr < d.offset+d.length; addr++ {
+		if addr == d.wrapTarget {
+			fmt.Fprintln(d.out, "        .wrap_target")
+		}
+		marker := "  "
+		if addr == d.sm.PC() {
+			marker = "=>"
+		}
+		bp := " "
+		if d.breakpoints[addr] {
+			bp = "*"
+		}
+		instr := d.sm.Memory()[addr]
+		fmt.Fprintf(d.out, "%s%s %2d: %04x  %s\n", marker, bp, addr, instr, d.dis.Disassemble(instr))
+		if addr == d.wrap {
+			fmt.Fprintln(d.out, "        .wrap")
+		}
+	}
+	return nil
+}
+
+func (d *debugger) regs(args []string) error {
+	isr, isrCount := d.sm.ISR()
+	osr, osrCount := d.sm.OSR()
+	pins := d.sm.Pins()
+	fmt.Fprintf(d.out, "pc  %d\nx   0x%08x\ny   0x%08x\n", d.sm.PC(), d.sm.GetX(), d.sm.GetY())
+	fmt.Fprintf(d.out, "isr 0x%08x (%d bits shifted in)\nosr 0x%08x (%d bits shifted out)\n", isr, isrCount, osr, osrCount)
+	fmt.Fprintf(d.out, "tx  %s\nrx  %s\n", words(d.sm.TxFIFO()), words(d.sm.RxFIFO()))
+	fmt.Fprintf(d.out, "irq 0x%02x\n", d.sm.IRQ())
+	fmt.Fprintf(d.out, "pins levels 0x%08x out 0x%08x oe 0x%08x in 0x%08x\n", pins.Levels(), pins.Out, pins.OE, pins.In)
+	fmt.Fprintf(d.out, "stalled %t\n", d.sm.Stalled())
+	return nil
+}
+
+// words formats FIFO contents, oldest first.
+func words(fifo []uint32) string {
+	list := make([]string, len(fifo))
+	for i, w := range fifo {
+		list[i] = fmt.Sprintf("%#x", w)
+	}
+	return "[" + strings.Join(list, " ") + "]"
+}
+
+func (d *debugger) tx(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: tx <word>...")
+	}
+	for _, arg := range args {
+		w, err := strconv.ParseUint(arg, 0, 32)
+		if err != nil {
+			return err
+		} else if d.sm.IsTxFIFOFull() {
+			return fmt.Errorf("TX FIFO full, %s not pushed", arg)
+		}
+		d.sm.TxPut(uint32(w))
+	}
+	return nil
+}
+
+func (d *debugger) rx(args []string) error {
+	if d.sm.IsRxFIFOEmpty() {
+		return errors.New("RX FIFO empty")
+	}
+	fmt.Fprintf(d.out, "%#x\n", d.sm.RxGet())
+	return nil
+}
+
+func (d *debugger) pin(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: pin <pin> <0|1>")
+	}
+	pin, err := strconv.ParseUint(args[0], 0, 8)
+	if err != nil || pin > 31 {
+		return fmt.Errorf("invalid pin %s", args[0])
+	}
+	switch args[1] {
+	case "0":
+		d.sm.Pins().In &^= 1 << pin
+	case "1":
+		d.sm.Pins().In |= 1 << pin
+	default:
+		return fmt.Errorf("invalid level %s", args[1])
+	}
+	return nil
+}
+
+// optionalCount parses an optional positive count argument.
+func optionalCount(args []string, def int) (int, error) {
+	switch len(args) {
+	case 0:
+		return def, nil
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid cycle count %s", args[0])
+		}
+		return n, nil
+	}
+	return 0, errors.New("expected at most one cycle count")
+}
+
+// sortedBreakpoints returns the breakpoint addresses in increasing order.
+func (d *debugger) sortedBreakpoints() []uint8 {
+	var addrs []uint8
+	for addr := range d.breakpoints {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
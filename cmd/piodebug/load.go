@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// loadProgram reads the program named name from a .pio source file, a Go source file or package
+// directory holding piogen output, or a program container written by `piogen -o bin` or
+// `piogen -o json`. An empty name selects the only program of the input.
+func loadProgram(path, name string) (*pio.AssembledProgram, error) {
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() || strings.HasSuffix(path, ".go") {
+		return loadGoProgram(path, name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".pio") {
+		return pio.DecodeProgram(data)
+	}
+	asm, err := pio.ParseAssembly(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if name != "" {
+		prog := asm.Program(name)
+		if prog == nil {
+			return nil, fmt.Errorf("program %q not found", name)
+		}
+		return prog, nil
+	} else if len(asm.Programs) != 1 {
+		return nil, fmt.Errorf("input has %d programs, select one with -p", len(asm.Programs))
+	}
+	return &asm.Programs[0], nil
+}
+
+// loadGoProgram reads the <name>Instructions slice of a Go source file or of the non-test files of
+// a package directory, along with the wrap, origin and PIO version constants piogen generates next
+// to it and the side-set, shift and clock divider settings of <name>ProgramDefaultConfig.
+func loadGoProgram(path, name string) (*pio.AssembledProgram, error) {
+	files := []string{path}
+	if !strings.HasSuffix(path, ".go") {
+		var err error
+		files, err = filepath.Glob(filepath.Join(path, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	fset := token.NewFileSet()
+	instructions := map[string]*ast.CompositeLit{}
+	consts := map[string]ast.Expr{}
+	calls := map[string][]ast.Expr{} // Arguments of the cfg method calls by default config and method.
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					vs, ok := spec.(*ast.ValueSpec)
+					if !ok || len(vs.Names) != 1 || len(vs.Values) != 1 {
+						continue
+					}
+					ident := vs.Names[0].Name
+					if prog, ok := strings.CutSuffix(ident, "Instructions"); ok && decl.Tok == token.VAR {
+						if lit, ok := vs.Values[0].(*ast.CompositeLit); ok {
+							instructions[prog] = lit
+						}
+					} else if decl.Tok == token.CONST {
+						consts[ident] = vs.Values[0]
+					}
+				}
+			case *ast.FuncDecl:
+				if !strings.HasSuffix(decl.Name.Name, "ProgramDefaultConfig") || decl.Body == nil {
+					continue
+				}
+				ast.Inspect(decl.Body, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+							calls[decl.Name.Name+"."+sel.Sel.Name] = call.Args
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+
+	if name == "" {
+		var names []string
+		for n := range instructions {
+			names = append(names, n)
+		}
+		if len(names) != 1 {
+			sort.Strings(names)
+			return nil, fmt.Errorf("%s has %d programs %v, select one with -p", path, len(names), names)
+		}
+		name = names[0]
+	}
+	lit := instructions[name]
+	if lit == nil {
+		return nil, fmt.Errorf("%s: %sInstructions not found", path, name)
+	}
+	prog := &pio.AssembledProgram{Name: name, Origin: -1, SetCount: -1}
+	for _, elt := range lit.Elts {
+		v, err := intValue(elt)
+		if err != nil || v < 0 || v > 0xffff {
+			return nil, fmt.Errorf("%s: invalid instruction in %sInstructions", fset.Position(elt.Pos()), name)
+		}
+		prog.Instructions = append(prog.Instructions, uint16(v))
+	}
+	prog.Wrap = uint8(len(prog.Instructions) - 1)
+
+	var err error
+	constValue := func(suffix string) int64 {
+		expr := consts[name+suffix]
+		if expr == nil || err != nil {
+			return -1
+		}
+		var v int64
+		v, err = intValue(expr)
+		if err != nil {
+			err = fmt.Errorf("%s: %s%s: %w", fset.Position(expr.Pos()), name, suffix, err)
+		}
+		return v
+	}
+	if v := constValue("WrapTarget"); v >= 0 {
+		prog.WrapTarget = uint8(v)
+	}
+	if v := constValue("Wrap"); v >= 0 {
+		prog.Wrap = uint8(v)
+	}
+	prog.Origin = int8(constValue("Origin"))
+	if v := constValue("PIOVersion"); v >= 0 {
+		prog.PIOVersion = uint8(v)
+	}
+	args := func(method string, n int) []int64 {
+		list := calls[name+"ProgramDefaultConfig."+method]
+		if len(list) != n || err != nil {
+			return nil
+		}
+		v := make([]int64, n)
+		for i, arg := range list {
+			if ident, ok := arg.(*ast.Ident); ok && (ident.Name == "true" || ident.Name == "false") {
+				if ident.Name == "true" {
+					v[i] = 1
+				}
+				continue
+			}
+			v[i], err = intValue(arg)
+			if err != nil {
+				err = fmt.Errorf("%s: %s: %w", fset.Position(arg.Pos()), method, err)
+				return nil
+			}
+		}
+		return v
+	}
+	if v := args("SetSidesetParams", 3); v != nil {
+		prog.SidesetOptional, prog.SidesetPindirs = v[1] != 0, v[2] != 0
+		prog.SidesetBits = uint8(v[0] - v[1])
+	}
+	if v := args("SetInShift", 3); v != nil {
+		prog.In = &pio.ShiftDirective{ShiftRight: v[0] != 0, Auto: v[1] != 0, Threshold: uint8(v[2])}
+	}
+	if v := args("SetOutShift", 3); v != nil {
+		prog.Out = &pio.ShiftDirective{ShiftRight: v[0] != 0, Auto: v[1] != 0, Threshold: uint8(v[2])}
+	}
+	if v := args("SetClkDivIntFrac", 2); v != nil {
+		prog.ClkDiv = float32(v[0]) + float32(v[1])/256
+	}
+	return prog, err
+}
+
+// intValue evaluates an integer literal, optionally negated.
+func intValue(expr ast.Expr) (int64, error) {
+	neg := false
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == token.SUB {
+		neg, expr = true, u.X
+	}
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		return 0, fmt.Errorf("not an integer literal")
+	}
+	v, ok := constant.Int64Val(constant.MakeFromLiteral(lit.Value, lit.Kind, 0))
+	if !ok {
+		return 0, fmt.Errorf("integer %s out of range", lit.Value)
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
@@ -0,0 +1,167 @@
+// Command piodebug is an interactive step debugger for PIO programs. It loads a program into an
+// emulated state machine and reads commands from standard input to step system clock cycles, stop
+// at breakpoints on instruction addresses, inspect the scratch and shift registers, FIFOs, IRQ
+// flags and pins, and push TX FIFO words or drive input pins:
+//
+//	piodebug -set 25 blink.pio
+//	piodebug -set 25 ./rp2-pio/examples/blinky
+//
+// Programs are read from .pio source files, from program containers written by `piogen -o bin`
+// or `piogen -o json`, or from the <name>Instructions slice generated by piogen in a Go source
+// file or package directory. Pins in the OUT, SET and side-set ranges start as outputs. Type help
+// for the list of commands; an empty line repeats the previous command.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+const toolName = "piodebug"
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, toolName+":", err)
+		os.Exit(1)
+	}
+}
+
+// pinRange is a flag holding a base pin and an optional pin count, as "base" or "base,count".
+type pinRange struct {
+	base, count uint8
+	hasCount    bool // The count was given rather than defaulting to 1.
+}
+
+func (r *pinRange) String() string {
+	if r == nil || r.count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d", r.base, r.count)
+}
+
+func (r *pinRange) Set(s string) error {
+	base, count, hasCount := strings.Cut(s, ",")
+	b, err := strconv.ParseUint(base, 10, 8)
+	if err != nil || b > 31 {
+		return errors.New("invalid base pin")
+	}
+	c := uint64(1)
+	if hasCount {
+		c, err = strconv.ParseUint(count, 10, 8)
+		if err != nil || c < 1 || c > 32 {
+			return errors.New("invalid pin count")
+		}
+	}
+	r.base, r.count, r.hasCount = uint8(b), uint8(c), hasCount
+	return nil
+}
+
+// mask returns the pins of the range, wrapping around from 31 to 0 as the PIO does.
+func (r *pinRange) mask() uint32 {
+	var m uint32
+	for i := uint8(0); i < r.count; i++ {
+		m |= 1 << ((r.base + i) & 31)
+	}
+	return m
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet(toolName, flag.ContinueOnError)
+	name := flags.String("p", "", "program to debug if the input holds several")
+	version := flags.Int("v", -1, "PIO version to emulate (0 for RP2040, 1 for RP2350), the program's by default")
+	offset := flags.Int("offset", -1, "instruction memory offset to load the program at, its origin or 0 by default")
+	var out, set, in, sideset pinRange
+	flags.Var(&out, "out", "OUT pins as base,count")
+	flags.Var(&set, "set", "SET pins as base,count")
+	flags.Var(&in, "in", "IN pins as base,count, the count of the program's .in directive or 32 by default")
+	flags.Var(&sideset, "sideset", "base of the side-set pins")
+	jmpPin := flags.Uint("jmp", 0, "JMP PIN condition pin")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] <program.pio|program.bin|program.json|file.go|package dir>\n", toolName)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected input file")
+	}
+	prog, err := loadProgram(flags.Arg(0), *name)
+	if err != nil {
+		return err
+	}
+	if *version < 0 {
+		*version = int(prog.RequiredVersion())
+	}
+	if *offset < 0 {
+		*offset = max(int(prog.Origin), 0)
+	}
+	if *offset > 31 || *jmpPin > 31 {
+		return errors.New("offset and JMP pin must be 0 to 31")
+	}
+
+	sm := emu.NewStateMachine(uint8(*version))
+	cfg, err := sm.Load(prog, uint8(*offset))
+	if err != nil {
+		return err
+	}
+	if out.count > 0 {
+		cfg.SetOutPins(pio.Pin(out.base), out.count)
+	}
+	if set.count > 0 {
+		cfg.SetSetPins(pio.Pin(set.base), set.count)
+	}
+	if in.count > 0 {
+		if !in.hasCount {
+			in.count = 32
+			if prog.In != nil {
+				in.count = prog.In.PinCount
+			}
+		}
+		cfg.SetInPins(pio.Pin(in.base), in.count)
+	}
+	if sideset.count > 0 {
+		cfg.SetSidesetPins(pio.Pin(sideset.base))
+		sideset.count = prog.SidesetBits
+	}
+	cfg.SetJmpPin(pio.Pin(*jmpPin))
+	sm.Init(uint8(*offset), cfg)
+	sm.Pins().OE = out.mask() | set.mask() | sideset.mask()
+	sm.SetEnabled(true)
+
+	d := newDebugger(sm, prog, uint8(*offset), stdout)
+	fmt.Fprintf(stdout, "loaded %s at %d, PIO version %d\n", prog.Name, *offset, *version)
+	d.where()
+	sc := bufio.NewScanner(stdin)
+	var last string
+	for {
+		fmt.Fprint(stdout, "(piodebug) ")
+		if !sc.Scan() {
+			fmt.Fprintln(stdout)
+			return sc.Err()
+		}
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			line = last
+		}
+		last = line
+		err := d.exec(line)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			fmt.Fprintln(stdout, "error:", err)
+		}
+	}
+}
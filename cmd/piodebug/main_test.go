@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+func TestSession(t *testing.T) {
+	const src = `
+.program echo
+.side_set 1 opt
+	pull side 1
+	mov x, ~osr
+	in x, 32
+	push side 0
+`
+	input := filepath.Join(t.TempDir(), "echo.pio")
+	if err := os.WriteFile(input, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	script := strings.Join([]string{"b 3", "tx 0xf0", "c", "r", "s", "", "rx", "rx", "b 9", "q"}, "\n")
+	var out bytes.Buffer
+	err := run([]string{"-offset", "1", "-sideset", "4", input}, strings.NewReader(script), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"loaded echo at 1, PIO version 0\ncycle 0 pc 1: pull   block           side 1\n",
+		"breakpoint at 3\ncycle 2 pc 3: in     x, 32\n",
+		"x   0xffffff0f\n",
+		"osr 0x000000f0 (0 bits shifted out)\n",
+		"pins levels 0x00000010 out 0x00000010 oe 0x00000010",
+		"cycle 3 pc 4: push   block           side 0\n",
+		"cycle 4 pc 1: pull   block           side 1\n",
+		"0xffffff0f\n(piodebug) error: RX FIFO empty\n",
+		"error: address 9 is not in the program at 1 to 4\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestInPins(t *testing.T) {
+	for _, tc := range []struct {
+		directive, in string
+		want          string
+	}{
+		{"", "2,2", "x   0x00000003\n"},
+		{".in 3", "2", "x   0x00000007\n"},
+		{"", "2", "x   0x0000003f\n"},
+	} {
+		src := ".program sample\n" + tc.directive + "\n\tmov x, pins\n"
+		input := filepath.Join(t.TempDir(), "sample.pio")
+		if err := os.WriteFile(input, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+		script := "pin 2 1\npin 3 1\npin 4 1\npin 5 1\npin 6 1\npin 7 1\ns\nr\nq"
+		var out bytes.Buffer
+		if err := run([]string{"-v", "1", "-in", tc.in, input}, strings.NewReader(script), &out); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), tc.want) {
+			t.Errorf("%q with -in %s: output does not contain %q:\n%s", tc.directive, tc.in, tc.want, out.String())
+		}
+	}
+}
+
+func TestLoadProgram(t *testing.T) {
+	const examples = "../../rp2-pio/examples"
+	src, err := os.ReadFile(filepath.Join(examples, "blinky/blink.pio"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asm, err := pio.ParseAssembly(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &asm.Programs[0]
+	container, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(t.TempDir(), "blink.bin")
+	if err := os.WriteFile(bin, container, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(examples, "blinky"), filepath.Join(examples, "blinky/blink_pio.go"), bin} {
+		prog, err := loadProgram(path, "")
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if !reflect.DeepEqual(prog.Instructions, want.Instructions) || prog.WrapTarget != want.WrapTarget ||
+			prog.Wrap != want.Wrap || prog.Origin != want.Origin || prog.SidesetBits != want.SidesetBits {
+			t.Errorf("%s: got program %+v, want %+v", path, prog, want)
+		}
+	}
+
+	if _, err := loadProgram(filepath.Join(examples, "blinky/blink.pio"), "missing"); err == nil {
+		t.Error("expected an error for a missing program")
+	}
+}
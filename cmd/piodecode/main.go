@@ -0,0 +1,209 @@
+// Command piodecode decodes the protocol transactions in a logic analyzer capture, the way the
+// protocol decoders of a logic analyzer do. Captures are read in the Value Change Dump format
+// written by PulseView, GTKWave and [emu.Waveform.WriteVCD], with pins named gpioN, gpN, pinN,
+// DN or N:
+//
+//	piodecode spi -sck 2 -sdo 3 -sdi 4 -mode 1 capture.vcd
+//
+// Each transaction is printed on its own line, prefixed with the time of its first edge. Protocol
+// errors such as UART framing errors are printed along with the transaction they affect.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tinygo-org/pio/rp2-pio/decode"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+const toolName = "piodecode"
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, toolName+":", err)
+		os.Exit(1)
+	}
+}
+
+// transaction is a decoded transaction of any protocol.
+type transaction struct {
+	cycle uint64
+	fmt.Stringer
+}
+
+// decoder decodes the transactions of a waveform.
+type decoder func(w *emu.Waveform) ([]transaction, error)
+
+// transactions converts the transactions returned by a package decode function.
+func transactions[T fmt.Stringer](decoded []T, err error, cycle func(T) uint64) ([]transaction, error) {
+	if err != nil {
+		return nil, err
+	}
+	list := make([]transaction, len(decoded))
+	for i, d := range decoded {
+		list[i] = transaction{cycle(d), d}
+	}
+	return list, nil
+}
+
+// protocols maps each protocol name to a function that defines its flags and returns its decoder.
+var protocols = map[string]func(flags *flag.FlagSet) decoder{
+	"spi": func(flags *flag.FlagSet) decoder {
+		var cfg decode.SPIConfig
+		pinVar(flags, &cfg.SCK, "sck", 0, "clock pin")
+		pinVar(flags, &cfg.SDO, "sdo", 1, "controller data out pin")
+		pinVar(flags, &cfg.SDI, "sdi", 2, "controller data in pin")
+		cs := flags.Int("cs", -1, "active low chip select pin, -1 if unused")
+		mode := flags.Uint("mode", 0, "SPI mode, 0 to 3")
+		bits := flags.Uint("bits", 8, "word size")
+		flags.BoolVar(&cfg.LSBFirst, "lsb", false, "least significant bit first")
+		return func(w *emu.Waveform) ([]transaction, error) {
+			cfg.Mode, cfg.Bits = uint8(*mode), uint8(*bits)
+			cfg.UseCS, cfg.CS = *cs >= 0, uint8(*cs)
+			words, err := decode.SPI(w, cfg)
+			return transactions(words, err, func(w decode.SPIWord) uint64 { return w.Cycle })
+		}
+	},
+	"i2s": func(flags *flag.FlagSet) decoder {
+		var cfg decode.I2SConfig
+		pinVar(flags, &cfg.BCLK, "bclk", 0, "bit clock pin")
+		pinVar(flags, &cfg.LRCLK, "lrclk", 1, "word select pin")
+		pinVar(flags, &cfg.Data, "data", 2, "data pin")
+		bits := flags.Uint("bits", 16, "sample width")
+		flags.BoolVar(&cfg.LeftHigh, "lefthigh", false, "left channel on LRCLK high")
+		return func(w *emu.Waveform) ([]transaction, error) {
+			cfg.Bits = uint8(*bits)
+			frames, err := decode.I2S(w, cfg)
+			return transactions(frames, err, func(f decode.I2SFrame) uint64 { return f.Cycle })
+		}
+	},
+	"ws2812": func(flags *flag.FlagSet) decoder {
+		var cfg decode.WS2812Config
+		pinVar(flags, &cfg.Pin, "pin", 0, "data pin")
+		flags.DurationVar(&cfg.Threshold, "threshold", 625*time.Nanosecond, "high time separating 0 and 1 bits")
+		flags.DurationVar(&cfg.Reset, "reset", 50*time.Microsecond, "low time latching a frame")
+		return func(w *emu.Waveform) ([]transaction, error) {
+			pixels, err := decode.WS2812(w, cfg)
+			return transactions(pixels, err, func(p decode.WS2812Pixel) uint64 { return p.Cycle })
+		}
+	},
+	"uart": func(flags *flag.FlagSet) decoder {
+		var cfg decode.UARTConfig
+		pinVar(flags, &cfg.Pin, "pin", 0, "receive pin")
+		baud := flags.Uint("baud", 115200, "baud rate")
+		bits := flags.Uint("bits", 8, "data bits")
+		parity := flags.String("parity", "none", "parity bit: none, even or odd")
+		stop := flags.Uint("stop", 1, "stop bits")
+		return func(w *emu.Waveform) ([]transaction, error) {
+			cfg.Baud, cfg.DataBits, cfg.StopBits = uint32(*baud), uint8(*bits), uint8(*stop)
+			switch *parity {
+			case "none":
+				cfg.Parity = decode.ParityNone
+			case "even":
+				cfg.Parity = decode.ParityEven
+			case "odd":
+				cfg.Parity = decode.ParityOdd
+			default:
+				return nil, fmt.Errorf("unsupported parity %q", *parity)
+			}
+			frames, err := decode.UART(w, cfg)
+			return transactions(frames, err, func(f decode.UARTFrame) uint64 { return f.Cycle })
+		}
+	},
+	"i2c": func(flags *flag.FlagSet) decoder {
+		var cfg decode.I2CConfig
+		pinVar(flags, &cfg.SCL, "scl", 0, "clock pin")
+		pinVar(flags, &cfg.SDA, "sda", 1, "data pin")
+		return func(w *emu.Waveform) ([]transaction, error) {
+			msgs, err := decode.I2C(w, cfg)
+			return transactions(msgs, err, func(m decode.I2CMessage) uint64 { return m.Cycle })
+		}
+	},
+	"parallel": func(flags *flag.FlagSet) decoder {
+		var cfg decode.ParallelConfig
+		pinVar(flags, &cfg.Clock, "clk", 0, "clock strobe pin")
+		pinVar(flags, &cfg.DataBase, "base", 1, "first data pin")
+		pinVar(flags, &cfg.Width, "width", 8, "number of data pins")
+		flags.BoolVar(&cfg.Falling, "falling", false, "latch data on falling clock edges")
+		return func(w *emu.Waveform) ([]transaction, error) {
+			words, err := decode.Parallel(w, cfg)
+			return transactions(words, err, func(w decode.ParallelWord) uint64 { return w.Cycle })
+		}
+	},
+}
+
+// pinVar defines a flag holding a pin number from 0 to 31.
+func pinVar(flags *flag.FlagSet, p *uint8, name string, value uint8, usage string) {
+	*p = value
+	flags.Func(name, fmt.Sprintf("%s (default %d)", usage, value), func(s string) error {
+		var n uint
+		if _, err := fmt.Sscan(s, &n); err != nil {
+			return err
+		} else if n > 31 {
+			return errors.New("pin out of range 0 to 31")
+		}
+		*p = uint8(n)
+		return nil
+	})
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "usage: %s <protocol> [flags] <capture.vcd>\nprotocols: %s\n", toolName, strings.Join(names, ", "))
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 || protocols[args[0]] == nil {
+		usage(os.Stderr)
+		if len(args) == 0 {
+			return errors.New("expected protocol and capture file")
+		}
+		return fmt.Errorf("unsupported protocol %q", args[0])
+	}
+	flags := flag.NewFlagSet(toolName+" "+args[0], flag.ContinueOnError)
+	clock := flags.Uint("clock", 125_000_000, "sample clock frequency in Hz that capture times are rounded to")
+	dec := protocols[args[0]](flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s %s [flags] <capture.vcd>\n", toolName, args[0])
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected capture file")
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := emu.ReadVCD(f, uint32(*clock))
+	if err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(0), err)
+	}
+	list, err := dec(w)
+	if err != nil {
+		return err
+	}
+	for _, t := range list {
+		if _, err := fmt.Fprintf(stdout, "%v\t%v\n", w.Time(t.cycle), t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeUART(t *testing.T) {
+	// 'A' and 'b' at 1 Mbaud on D3, the second one with a low stop bit.
+	var vcd strings.Builder
+	vcd.WriteString("$timescale 1 ns $end\n$var wire 1 ! D3 $end\n$enddefinitions $end\n#0\n1!\n")
+	t0 := 1000
+	for _, frame := range []uint16{'A'<<1 | 1<<9, 'b' << 1} {
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(&vcd, "#%d\n%d!\n", t0+i*1000, frame>>i&1)
+		}
+		fmt.Fprintf(&vcd, "#%d\n1!\n", t0+10000)
+		t0 += 12000
+	}
+	fmt.Fprintf(&vcd, "#%d\n", t0)
+	capture := filepath.Join(t.TempDir(), "capture.vcd")
+	if err := os.WriteFile(capture, []byte(vcd.String()), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{"uart", "-pin", "3", "-baud", "1000000", capture}, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "1µs\tdata=0x41\n13µs\tdata=0x62 framing-error\n"
+	if out.String() != want {
+		t.Errorf("got output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	for _, args := range [][]string{nil, {"can"}, {"uart", "-pin", "32", capture}, {"uart", "-parity", "mark", capture}} {
+		if err := run(args, &out); err == nil {
+			t.Errorf("expected an error for arguments %q", args)
+		}
+	}
+}
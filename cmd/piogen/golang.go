@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// generateGo generates Go source for all programs in src in the format of `pioasm -o go`,
+// additionally configuring side-set, FIFO, shift, pin count and MOV STATUS directives in the
+// <name>ProgramDefaultConfig function.
+func generateGo(src *pio.AssemblySource, tool string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by %s; DO NOT EDIT.\n\n", tool)
+	writeCodeBlocks(&b, src.CodeBlocks)
+	for i := range src.Programs {
+		writeCodeBlocks(&b, src.Programs[i].CodeBlocks)
+	}
+	for _, sym := range src.Symbols {
+		if sym.Public {
+			fmt.Fprintf(&b, "const %s = %d\n", sym.Name, sym.Value)
+		}
+	}
+	for i := range src.Programs {
+		writeGoProgram(&b, &src.Programs[i])
+	}
+	out, err := format.Source(b.Bytes())
+	if err != nil {
+		return b.Bytes(), fmt.Errorf("formatting generated code: %w", err)
+	}
+	return out, nil
+}
+
+func writeCodeBlocks(b *bytes.Buffer, blocks []pio.CodeBlock) {
+	for _, block := range blocks {
+		if block.Lang == "go" {
+			b.WriteString(block.Code)
+		}
+	}
+}
+
+func writeGoProgram(b *bytes.Buffer, prog *pio.AssembledProgram) {
+	name := prog.Name
+	fmt.Fprintf(b, "\n// %s\n\n", name)
+	fmt.Fprintf(b, "const %sWrapTarget = %d\n", name, prog.WrapTarget)
+	fmt.Fprintf(b, "const %sWrap = %d\n", name, prog.Wrap)
+	if prog.PIOVersion > 0 {
+		fmt.Fprintf(b, "const %sPIOVersion = %d\n", name, prog.PIOVersion)
+	}
+	for _, sym := range prog.Symbols {
+		if sym.Public {
+			fmt.Fprintf(b, "const %s%s = %d\n", name, exportedName(sym.Name), sym.Value)
+		}
+	}
+
+	dis := prog.Disassembler()
+	fmt.Fprintf(b, "\nvar %sInstructions = []uint16{\n", name)
+	for i, instr := range prog.Instructions {
+		if i == int(prog.WrapTarget) {
+			b.WriteString("\t//     .wrap_target\n")
+		}
+		fmt.Fprintf(b, "\t0x%04x, // %2d: %s\n", instr, i, dis.Disassemble(instr))
+		if i == int(prog.Wrap) {
+			b.WriteString("\t//     .wrap\n")
+		}
+	}
+	b.WriteString("}\n\n")
+	fmt.Fprintf(b, "const %sOrigin = %d\n\n", name, prog.Origin)
+
+	fmt.Fprintf(b, "func %sProgramDefaultConfig(offset uint8) pio.StateMachineConfig {\n", name)
+	b.WriteString("\tcfg := pio.DefaultStateMachineConfig()\n")
+	fmt.Fprintf(b, "\tcfg.SetWrap(offset+%sWrapTarget, offset+%sWrap)\n", name, name)
+	if prog.SidesetBits > 0 {
+		fmt.Fprintf(b, "\tcfg.SetSidesetParams(%d, %t, %t)\n", prog.SidesetFieldBits(), prog.SidesetOptional, prog.SidesetPindirs)
+	}
+	if prog.FifoJoin != pio.FifoJoinNone {
+		fmt.Fprintf(b, "\tcfg.SetFIFOJoin(pio.%s)\n", fifoJoinName(prog.FifoJoin))
+	}
+	if in := prog.In; in != nil {
+		if prog.PIOVersion > 0 {
+			fmt.Fprintf(b, "\tcfg.SetInPinCount(%d)\n", in.PinCount)
+		}
+		fmt.Fprintf(b, "\tcfg.SetInShift(%t, %t, %d)\n", in.ShiftRight, in.Auto, in.Threshold)
+	}
+	if out := prog.Out; out != nil {
+		fmt.Fprintf(b, "\tcfg.SetOutPinCount(%d)\n", out.PinCount)
+		fmt.Fprintf(b, "\tcfg.SetOutShift(%t, %t, %d)\n", out.ShiftRight, out.Auto, out.Threshold)
+	}
+	if prog.SetCount >= 0 {
+		fmt.Fprintf(b, "\tcfg.SetSetPinCount(%d)\n", prog.SetCount)
+	}
+	if st := prog.MovStatus; st != nil {
+		fmt.Fprintf(b, "\tcfg.SetMovStatus(pio.%s, %d)\n", movStatusName(st.Sel), st.N)
+	}
+	if prog.ClkDiv >= 1 {
+		whole := uint16(prog.ClkDiv)
+		frac := uint8((prog.ClkDiv - float32(uint32(prog.ClkDiv))) * 256)
+		fmt.Fprintf(b, "\tcfg.SetClkDivIntFrac(%d, %d)\n", whole, frac)
+	}
+	b.WriteString("\treturn cfg\n}\n")
+}
+
+func exportedName(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func fifoJoinName(join pio.FifoJoin) string {
+	switch join {
+	case pio.FifoJoinNone:
+		return "FifoJoinNone"
+	case pio.FifoJoinTx:
+		return "FifoJoinTx"
+	case pio.FifoJoinRx:
+		return "FifoJoinRx"
+	case pio.FifoJoinRxGet:
+		return "FifoJoinRxGet"
+	case pio.FifoJoinRxPut:
+		return "FifoJoinRxPut"
+	case pio.FifoJoinRxPutGet:
+		return "FifoJoinRxPutGet"
+	}
+	return "FifoJoin(" + strconv.Itoa(int(join)) + ")"
+}
+
+func movStatusName(sel pio.MovStatus) string {
+	switch sel {
+	case pio.MovStatusTxLessthan:
+		return "MovStatusTxLessthan"
+	case pio.MovStatusRxLessthan:
+		return "MovStatusRxLessthan"
+	case pio.MovStatusIRQ:
+		return "MovStatusIRQ"
+	}
+	return "MovStatus(" + strconv.Itoa(int(sel)) + ")"
+}
@@ -0,0 +1,110 @@
+// Command piogen assembles PIO programs written in pioasm syntax and generates Go source
+// to load and configure them, without requiring the pico-sdk's pioasm tool or a C++ toolchain.
+// It is a drop-in replacement for `pioasm -o go` in go:generate directives:
+//
+//	//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go blink.pio blink_pio.go
+//
+// If the output file is omitted the generated code is written to standard output.
+//
+// The bin and json output formats write a single program in the container format read by
+// [pio.DecodeProgram], for loading programs at runtime with [pio.PIO.LoadProgramData].
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+const toolName = "piogen"
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, toolName+":", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet(toolName, flag.ContinueOnError)
+	format := flags.String("o", "go", "output format. Supported formats: go, bin, json")
+	version := flags.Int("v", -1, "override PIO version of all programs (0 for RP2040, 1 for RP2350)")
+	program := flags.String("p", "", "program to output for the bin and json container formats, which hold a single program")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] <input.pio> [output]\n", toolName)
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return fmt.Errorf("expected input file and optional output file")
+	}
+	input := flags.Arg(0)
+	src, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	asm, err := pio.ParseAssembly(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", input, err)
+	}
+	if *version > 1 {
+		return fmt.Errorf("unsupported PIO version %d", *version)
+	} else if *version >= 0 {
+		for i := range asm.Programs {
+			prog := &asm.Programs[i]
+			if required := prog.RequiredVersion(); required > uint8(*version) {
+				return fmt.Errorf("%s: program %q requires PIO version %d, not %d", input, prog.Name, required, *version)
+			}
+			prog.PIOVersion = uint8(*version)
+		}
+	}
+
+	var out []byte
+	switch *format {
+	case "go":
+		out, err = generateGo(asm, toolName)
+	case "bin", "json":
+		var prog *pio.AssembledProgram
+		prog, err = selectProgram(asm, *program)
+		if err != nil {
+			break
+		} else if *format == "bin" {
+			out, err = prog.MarshalBinary()
+		} else {
+			out, err = prog.MarshalJSON()
+			out = append(out, '\n')
+		}
+	default:
+		return fmt.Errorf("unsupported output format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 1 {
+		_, err = stdout.Write(out)
+		return err
+	}
+	return os.WriteFile(flags.Arg(1), out, 0666)
+}
+
+// selectProgram returns the program named name, or the only program in src if name is empty.
+func selectProgram(src *pio.AssemblySource, name string) (*pio.AssembledProgram, error) {
+	if name != "" {
+		prog := src.Program(name)
+		if prog == nil {
+			return nil, fmt.Errorf("program %q not found", name)
+		}
+		return prog, nil
+	} else if len(src.Programs) != 1 {
+		return nil, fmt.Errorf("input has %d programs, select one with -p", len(src.Programs))
+	}
+	return &src.Programs[0], nil
+}
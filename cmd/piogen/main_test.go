@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// TestGenerateExamples checks the generated example files are up to date.
+func TestGenerateExamples(t *testing.T) {
+	var tests = []struct {
+		pio    string
+		output string
+	}{
+		{pio: "blinky/blink.pio", output: "blinky/blink_pio.go"},
+		{pio: "rxfifoput/rxfifoput.pio", output: "rxfifoput/rxfifoput_pio.go"},
+		{pio: "rxfifoputget/rxfifoputget.pio", output: "rxfifoputget/rxfifoputget_pio.go"},
+	}
+	const examples = "../../rp2-pio/examples"
+	for _, test := range tests {
+		t.Run(test.pio, func(t *testing.T) {
+			var got bytes.Buffer
+			err := run([]string{"-o", "go", filepath.Join(examples, test.pio)}, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join(examples, test.output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("generated code mismatch, run go generate:\n%s", got.String())
+			}
+		})
+	}
+}
+
+func TestGenerateDirectives(t *testing.T) {
+	const src = `
+.pio_version 1
+.program spi
+.side_set 1 opt pindirs
+.fifo tx
+.in 3 left auto 8
+.out 2 right
+.set 2
+.mov_status rxfifo < 2
+.clock_div 2.5
+.define public T1 2
+public entry:
+	out pins, 1 side 0 [1]
+	in pins, 1 side 1
+% go {
+package spi
+%}
+`
+	dir := t.TempDir()
+	input := filepath.Join(dir, "spi.pio")
+	output := filepath.Join(dir, "spi_pio.go")
+	err := os.WriteFile(input, []byte(src), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run([]string{input, output}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package spi\n",
+		"const spiT1 = 2\n",
+		"const spiEntry = 0\n",
+		"0x7101, //  0: out    pins, 1         side 0 [1]\n",
+		"0x5801, //  1: in     pins, 1         side 1\n",
+		"cfg.SetSidesetParams(2, true, true)\n",
+		"cfg.SetFIFOJoin(pio.FifoJoinTx)\n",
+		"cfg.SetInPinCount(3)\n",
+		"cfg.SetInShift(false, true, 8)\n",
+		"cfg.SetOutPinCount(2)\n",
+		"cfg.SetOutShift(true, false, 32)\n",
+		"cfg.SetSetPinCount(2)\n",
+		"cfg.SetMovStatus(pio.MovStatusRxLessthan, 2)\n",
+		"cfg.SetClkDivIntFrac(2, 128)\n",
+	} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("generated code missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestContainerOutput(t *testing.T) {
+	const input = "../../rp2-pio/examples/blinky/blink.pio"
+	for _, format := range []string{"bin", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var got bytes.Buffer
+			err := run([]string{"-o", format, input}, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prog, err := pio.DecodeProgram(got.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prog.Name != "blink" || len(prog.Instructions) != 8 || prog.WrapTarget != 2 || prog.Wrap != 7 {
+				t.Errorf("unexpected program %+v", prog)
+			}
+		})
+	}
+	err := run([]string{"-o", "bin", "-p", "missing", input}, new(bytes.Buffer))
+	if err == nil {
+		t.Error("expected error for missing program")
+	}
+}
+
+func TestVersionOverride(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "v1.pio")
+	src := ".pio_version 1\n.program putget\n.fifo putget\n\tmov osr, rxfifo[0]\n.program plain\n\tnop\n"
+	if err := os.WriteFile(input, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-v", "0", input},
+		{"-v", "0", "-o", "json", "-p", "putget", input},
+		{"-v", "2", input},
+	} {
+		if err := run(args, new(bytes.Buffer)); err == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+	var got bytes.Buffer
+	if err := run([]string{"-v", "1", "-o", "json", "-p", "plain", input}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if prog, err := pio.DecodeProgram(got.Bytes()); err != nil || prog.PIOVersion != 1 {
+		t.Errorf("got program %+v, %v, want version 1", prog, err)
+	}
+}
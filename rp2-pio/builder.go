@@ -0,0 +1,204 @@
+package pio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Program builds a PIO program from instructions created with [AssemblerV0] or [AssemblerV1],
+// resolving jump targets from labels so programs need not maintain instruction offsets by hand.
+// Jumps may reference labels declared later in the program.
+//
+// The first error encountered while building is retained and returned by [Program.Assemble].
+//
+//	asm := pio.AssemblerV0{}
+//	prog := pio.NewProgram("ws2812b", asm)
+//	prog.WrapTarget()
+//	prog.Add(asm.Pull(true, true))
+//	prog.Label("bitloop")
+//	prog.Add(asm.Set(pio.SetDestPins, 1))
+//	prog.Add(asm.Out(pio.OutDestY, 1))
+//	prog.Jmp(pio.JmpYZero, "lolo")
+//	prog.Jmp(pio.JmpAlways, "hilo").Delay(2)
+//	prog.Label("lolo")
+//	// ...
+//	program, err := prog.Assemble()
+type Program struct {
+	name       string
+	asm        AssemblerV0
+	version    uint8
+	origin     int8
+	instrs     []instructionV0
+	jumps      []programJump
+	labels     map[string]uint8
+	labelOrder []string
+	wrapTarget int
+	wrap       int
+	err        error
+}
+
+type programJump struct {
+	index int
+	label string
+}
+
+// NewProgram returns a builder for a PIO version 0 program assembled with asm.
+func NewProgram(name string, asm AssemblerV0) *Program {
+	return &Program{
+		name:       name,
+		asm:        asm,
+		origin:     -1,
+		labels:     make(map[string]uint8),
+		wrapTarget: -1,
+		wrap:       -1,
+	}
+}
+
+// NewProgramV1 returns a builder for a PIO version 1 program assembled with asm.
+func NewProgramV1(name string, asm AssemblerV1) *Program {
+	p := NewProgram(name, asm.v0())
+	p.version = 1
+	return p
+}
+
+// Origin sets the fixed offset the program must be loaded at. By default programs are relocatable.
+func (p *Program) Origin(origin int8) *Program {
+	if origin > 31 {
+		p.setErr(fmt.Errorf("pio: program origin %d out of range", origin))
+	}
+	p.origin = origin
+	return p
+}
+
+// Label declares a label at the address of the next instruction added.
+func (p *Program) Label(name string) *Program {
+	if name == "" {
+		p.setErr(errors.New("pio: empty label name"))
+	} else if _, ok := p.labels[name]; ok {
+		p.setErr(fmt.Errorf("pio: duplicate label %q", name))
+	} else if len(p.instrs) > 31 {
+		p.setErr(fmt.Errorf("pio: label %q out of range", name))
+	} else {
+		p.labels[name] = uint8(len(p.instrs))
+		p.labelOrder = append(p.labelOrder, name)
+	}
+	return p
+}
+
+// Add appends instructions to the program.
+func (p *Program) Add(instrs ...instructionV0) *Program {
+	p.instrs = append(p.instrs, instrs...)
+	return p
+}
+
+// Jmp appends a jump to label, which may be declared before or after the jump.
+// The jump address is resolved by [Program.Assemble].
+func (p *Program) Jmp(cond JmpCond, label string) *Program {
+	p.jumps = append(p.jumps, programJump{index: len(p.instrs), label: label})
+	return p.Add(p.asm.Jmp(cond, 0))
+}
+
+// Side sets the side-set value of the last added instruction.
+func (p *Program) Side(value uint8) *Program {
+	if last := p.last(); last != nil {
+		*last = last.Side(value)
+	}
+	return p
+}
+
+// Delay sets the delay cycles of the last added instruction.
+func (p *Program) Delay(cycles uint8) *Program {
+	if last := p.last(); last != nil {
+		*last = last.Delay(cycles)
+	}
+	return p
+}
+
+func (p *Program) last() *instructionV0 {
+	if len(p.instrs) == 0 {
+		p.setErr(errors.New("pio: side-set or delay before first instruction"))
+		return nil
+	}
+	return &p.instrs[len(p.instrs)-1]
+}
+
+// WrapTarget marks the next instruction added as the wrap target. Defaults to the first instruction.
+func (p *Program) WrapTarget() *Program {
+	if p.wrapTarget >= 0 {
+		p.setErr(errors.New("pio: duplicate wrap target"))
+	}
+	p.wrapTarget = len(p.instrs)
+	return p
+}
+
+// Wrap marks the last added instruction as the wrap source. Defaults to the last instruction of the program.
+func (p *Program) Wrap() *Program {
+	if p.wrap >= 0 {
+		p.setErr(errors.New("pio: duplicate wrap"))
+	} else if len(p.instrs) == 0 {
+		p.setErr(errors.New("pio: wrap before first instruction"))
+	}
+	p.wrap = len(p.instrs) - 1
+	return p
+}
+
+func (p *Program) setErr(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// Assemble resolves jumps to labels and returns the finished program. Use
+// [AssembledProgram.DefaultStateMachineConfig] to obtain its state machine configuration.
+func (p *Program) Assemble() (*AssembledProgram, error) {
+	n := len(p.instrs)
+	switch {
+	case p.err != nil:
+		return nil, p.err
+	case n == 0:
+		return nil, errors.New("pio: program has no instructions")
+	case n > 32:
+		return nil, fmt.Errorf("pio: program has %d instructions, exceeding the 32 available", n)
+	case p.origin >= 0 && int(p.origin)+n > 32:
+		return nil, fmt.Errorf("pio: program does not fit in instruction memory at origin %d", p.origin)
+	case p.wrapTarget >= n:
+		return nil, errors.New("pio: wrap target after last instruction")
+	}
+	prog := &AssembledProgram{
+		Name:            p.name,
+		Instructions:    make([]uint16, n),
+		Origin:          p.origin,
+		PIOVersion:      p.version,
+		Wrap:            uint8(n - 1),
+		SidesetBits:     p.asm.SidesetBits,
+		SidesetOptional: p.asm.SidesetOptional,
+		SidesetPindirs:  p.asm.SidesetPindirs,
+		SetCount:        -1,
+	}
+	if p.wrapTarget >= 0 {
+		prog.WrapTarget = uint8(p.wrapTarget)
+	}
+	if p.wrap >= 0 {
+		prog.Wrap = uint8(p.wrap)
+	}
+	for i, instr := range p.instrs {
+		encoded, err := instr.EncodeChecked()
+		if err != nil {
+			return nil, fmt.Errorf("%w (instruction %d)", err, i)
+		}
+		prog.Instructions[i] = encoded
+	}
+	for _, jmp := range p.jumps {
+		addr, ok := p.labels[jmp.label]
+		if !ok {
+			return nil, fmt.Errorf("pio: undefined label %q", jmp.label)
+		} else if int(addr) >= n {
+			return nil, fmt.Errorf("pio: label %q points past the end of the program", jmp.label)
+		}
+		prog.Instructions[jmp.index] |= uint16(addr)
+	}
+	for _, name := range p.labelOrder {
+		prog.Symbols = append(prog.Symbols, Symbol{Name: name, Value: int(p.labels[name]), Label: true})
+	}
+	return prog, nil
+}
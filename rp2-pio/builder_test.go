@@ -0,0 +1,174 @@
+package pio
+
+import (
+	"testing"
+)
+
+func TestProgramBuilder(t *testing.T) {
+	asm0 := AssemblerV0{SidesetBits: 0}
+	ws := NewProgram("ws2812b", asm0)
+	ws.Add(asm0.Pull(true, true))
+	ws.Label("bitloop")
+	ws.Add(asm0.Set(SetDestPins, 1), asm0.Out(OutDestY, 1))
+	ws.Jmp(JmpYZero, "lolo")
+	ws.Jmp(JmpAlways, "hilo").Delay(2)
+	ws.Label("lolo")
+	ws.Add(asm0.Set(SetDestPins, 0)).Delay(2)
+	ws.Label("hilo")
+	ws.Add(asm0.Set(SetDestPins, 0))
+	ws.Jmp(JmpOSRNotEmpty, "bitloop").Delay(1)
+
+	asm1 := AssemblerV0{SidesetBits: 1}
+	spi := NewProgram("spi3w", asm1)
+	spi.WrapTarget()
+	spi.Label("wloop")
+	spi.Add(asm1.Out(OutDestPins, 1).Side(0))
+	spi.Jmp(JmpXNZeroDec, "wloop").Side(1)
+	spi.Jmp(JmpYZero, "end").Side(0)
+	spi.Add(asm1.Set(SetDestPindirs, 0).Side(0), asm1.Nop().Side(0))
+	spi.Label("rloop")
+	spi.Add(asm1.In(InSrcPins, 1).Side(1))
+	spi.Jmp(JmpYNZeroDec, "rloop").Side(0)
+	spi.Label("end")
+	spi.Add(asm1.WaitPin(true, 0).Side(0), asm1.IRQSet(false, 0).Side(0))
+	spi.Wrap()
+
+	var tests = []struct {
+		name       string
+		prog       *Program
+		expectprog []uint16
+		wrapTarget uint8
+		wrap       uint8
+		label      string
+		labelAddr  int
+	}{
+		{
+			name: "ws2812b",
+			prog: ws,
+			expectprog: []uint16{
+				0x80e0, //  0: pull   ifempty block
+				0xe001, //  1: set    pins, 1
+				0x6041, //  2: out    y, 1
+				0x0065, //  3: jmp    !y, 5
+				0x0206, //  4: jmp    6                      [2]
+				0xe200, //  5: set    pins, 0                [2]
+				0xe000, //  6: set    pins, 0
+				0x01e1, //  7: jmp    !osre, 1               [1]
+			},
+			wrap:      7,
+			label:     "hilo",
+			labelAddr: 6,
+		},
+		{
+			name: "spi3w",
+			prog: spi,
+			expectprog: []uint16{
+				0x6001, //  0: out    pins, 1         side 0
+				0x1040, //  1: jmp    x--, 0          side 1
+				0x0067, //  2: jmp    !y, 7           side 0
+				0xe080, //  3: set    pindirs, 0      side 0
+				0xa042, //  4: nop                    side 0
+				0x5001, //  5: in     pins, 1         side 1
+				0x0085, //  6: jmp    y--, 5          side 0
+				0x20a0, //  7: wait   1 pin, 0        side 0
+				0xc000, //  8: irq    nowait 0        side 0
+			},
+			wrap:      8,
+			label:     "end",
+			labelAddr: 7,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prog, err := test.prog.Assemble()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(prog.Instructions) != len(test.expectprog) {
+				t.Fatal("mismatched program length")
+			}
+			for i, got := range prog.Instructions {
+				want := test.expectprog[i]
+				if got != want {
+					t.Errorf("mismatched program instruction @%d want %02x, got %02x", i, want, got)
+				}
+			}
+			if prog.WrapTarget != test.wrapTarget || prog.Wrap != test.wrap {
+				t.Errorf("wrap mismatch got!=expected: %d..%d != %d..%d", prog.WrapTarget, prog.Wrap, test.wrapTarget, test.wrap)
+			}
+			sym, ok := prog.Symbol(test.label)
+			if !ok || sym.Value != test.labelAddr {
+				t.Errorf("label %q got!=expected: %d != %d", test.label, sym.Value, test.labelAddr)
+			}
+			cfg := prog.DefaultStateMachineConfig(4)
+			want := DefaultStateMachineConfig()
+			want.SetWrap(4+test.wrapTarget, 4+test.wrap)
+			if prog.SidesetBits > 0 {
+				want.SetSidesetParams(prog.SidesetBits, false, false)
+			}
+			if cfg != want {
+				t.Errorf("config mismatch got!=expected: %+v != %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestProgramBuilderErrors(t *testing.T) {
+	asm := AssemblerV0{}
+	var tests = []struct {
+		name   string
+		build  func(p *Program)
+		expect string
+	}{
+		{
+			name:   "undefined label",
+			build:  func(p *Program) { p.Jmp(JmpAlways, "nowhere") },
+			expect: `pio: undefined label "nowhere"`,
+		},
+		{
+			name: "duplicate label",
+			build: func(p *Program) {
+				p.Label("a").Add(asm.Nop()).Label("a").Add(asm.Nop())
+			},
+			expect: `pio: duplicate label "a"`,
+		},
+		{
+			name: "label past end",
+			build: func(p *Program) {
+				p.Jmp(JmpAlways, "end").Label("end")
+			},
+			expect: `pio: label "end" points past the end of the program`,
+		},
+		{
+			name: "too long",
+			build: func(p *Program) {
+				for i := 0; i < 33; i++ {
+					p.Add(asm.Nop())
+				}
+			},
+			expect: "pio: program has 33 instructions, exceeding the 32 available",
+		},
+		{
+			name: "origin overflow",
+			build: func(p *Program) {
+				p.Origin(30).Add(asm.Nop(), asm.Nop(), asm.Nop())
+			},
+			expect: "pio: program does not fit in instruction memory at origin 30",
+		},
+		{
+			name:   "empty",
+			build:  func(p *Program) {},
+			expect: "pio: program has no instructions",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewProgram(test.name, asm)
+			test.build(p)
+			_, err := p.Assemble()
+			if err == nil || err.Error() != test.expect {
+				t.Errorf("error mismatch got!=expected: %v != %q", err, test.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !rp2040 && !rp2350
+
+package pio
+
+import "sync"
+
+// claimMu serialises claims between goroutines off-target.
+var claimMu sync.Mutex
+
+type claimState struct{}
+
+// lockClaims takes the claim lock, making claims atomic with respect to other goroutines.
+func lockClaims() claimState {
+	claimMu.Lock()
+	return claimState{}
+}
+
+// unlockClaims releases the claim lock.
+func unlockClaims(claimState) {
+	claimMu.Unlock()
+}
@@ -0,0 +1,22 @@
+//go:build rp2040 || rp2350
+
+package pio
+
+import "runtime/interrupt"
+
+// claimState is the interrupt state to restore when releasing the claim lock.
+type claimState = interrupt.State
+
+// lockClaims disables interrupts on the calling core and takes the claim lock, making claims
+// atomic with respect to interrupt handlers and the other core. Hold it only briefly.
+func lockClaims() claimState {
+	state := interrupt.Disable()
+	acquireClaimLock()
+	return state
+}
+
+// unlockClaims releases the claim lock and restores the interrupt state.
+func unlockClaims(state claimState) {
+	releaseClaimLock()
+	interrupt.Restore(state)
+}
@@ -0,0 +1,18 @@
+//go:build rp2040
+
+package pio
+
+import "device/rp"
+
+// claimSpinlock serialises claims between the two cores. It is spinlock 11, the one the
+// pico-sdk reserves for claiming hardware.
+var claimSpinlock = &rp.SIO.SPINLOCK11
+
+func acquireClaimLock() {
+	for claimSpinlock.Get() == 0 {
+	}
+}
+
+func releaseClaimLock() {
+	claimSpinlock.Set(0)
+}
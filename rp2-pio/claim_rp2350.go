@@ -0,0 +1,20 @@
+//go:build rp2350
+
+package pio
+
+import "sync/atomic"
+
+// claimLock serialises claims between the two cores. The SIO spinlocks are not used: RP2350
+// erratum E2 lets writes to some other SIO registers release them. Like the pico-sdk's
+// software spinlocks, the lock is taken with exclusive load/store instructions, which
+// sync/atomic compiles to on the Cortex-M33.
+var claimLock atomic.Uint32
+
+func acquireClaimLock() {
+	for !claimLock.CompareAndSwap(0, 1) {
+	}
+}
+
+func releaseClaimLock() {
+	claimLock.Store(0)
+}
@@ -1,12 +1,5 @@
-//go:build rp2040 || rp2350
-
 package pio
 
-import (
-	"device/rp"
-	"machine"
-)
-
 // DefaultStateMachineConfig returns the default configuration
 // for a PIO state machine.
 //
@@ -29,7 +22,7 @@ func (asm AssemblerV0) DefaultStateMachineConfig(progOffset uint8, program []uin
 	cfg := DefaultStateMachineConfig()
 	cfg.SetWrap(progOffset, progOffset+uint8(len(program))-1)
 	if asm.SidesetBits > 0 {
-		cfg.SetSidesetParams(asm.SidesetBits, false, false)
+		cfg.SetSidesetParams(asm.sidesetFieldBits(), asm.SidesetOptional, asm.SidesetPindirs)
 	}
 	return cfg
 }
@@ -66,8 +59,8 @@ func (cfg *StateMachineConfig) SetClkDivIntFrac(whole uint16, frac uint8) {
 }
 
 func clkDiv(whole uint16, frac uint8) uint32 {
-	return (uint32(frac) << rp.PIO0_SM0_CLKDIV_FRAC_Pos) |
-		(uint32(whole) << rp.PIO0_SM0_CLKDIV_INT_Pos)
+	return (uint32(frac) << pio0_SM0_CLKDIV_FRAC_Pos) |
+		(uint32(whole) << pio0_SM0_CLKDIV_INT_Pos)
 }
 
 // SetWrap sets the wrapping configuration for the state machine
@@ -75,9 +68,9 @@ func clkDiv(whole uint16, frac uint8) uint32 {
 // Note: Function used by pico-sdk's pioasm tool so signature MUST remain the same.
 func (cfg *StateMachineConfig) SetWrap(wrapTarget uint8, wrap uint8) {
 	cfg.ExecCtrl =
-		(cfg.ExecCtrl & ^uint32(rp.PIO0_SM0_EXECCTRL_WRAP_TOP_Msk|rp.PIO0_SM0_EXECCTRL_WRAP_BOTTOM_Msk)) |
-			(uint32(wrapTarget) << rp.PIO0_SM0_EXECCTRL_WRAP_BOTTOM_Pos) |
-			(uint32(wrap) << rp.PIO0_SM0_EXECCTRL_WRAP_TOP_Pos)
+		(cfg.ExecCtrl & ^uint32(pio0_SM0_EXECCTRL_WRAP_TOP_Msk|pio0_SM0_EXECCTRL_WRAP_BOTTOM_Msk)) |
+			(uint32(wrapTarget) << pio0_SM0_EXECCTRL_WRAP_BOTTOM_Pos) |
+			(uint32(wrap) << pio0_SM0_EXECCTRL_WRAP_TOP_Pos)
 }
 
 // SetInShift sets the 'in' shifting parameters in a state machine configuration
@@ -86,12 +79,12 @@ func (cfg *StateMachineConfig) SetWrap(wrapTarget uint8, wrap uint8) {
 //   - pushThreshold is threshold in bits to shift in before auto/conditional re-pushing of the ISR.
 func (cfg *StateMachineConfig) SetInShift(shiftRight bool, autoPush bool, pushThreshold uint16) {
 	cfg.ShiftCtrl = cfg.ShiftCtrl &
-		^uint32(rp.PIO0_SM0_SHIFTCTRL_IN_SHIFTDIR_Msk|
-			rp.PIO0_SM0_SHIFTCTRL_AUTOPUSH_Msk|
-			rp.PIO0_SM0_SHIFTCTRL_PUSH_THRESH_Msk) |
-		(boolToBit(shiftRight) << rp.PIO0_SM0_SHIFTCTRL_IN_SHIFTDIR_Pos) |
-		(boolToBit(autoPush) << rp.PIO0_SM0_SHIFTCTRL_AUTOPUSH_Pos) |
-		(uint32(pushThreshold&0x1f) << rp.PIO0_SM0_SHIFTCTRL_PUSH_THRESH_Pos)
+		^uint32(pio0_SM0_SHIFTCTRL_IN_SHIFTDIR_Msk|
+			pio0_SM0_SHIFTCTRL_AUTOPUSH_Msk|
+			pio0_SM0_SHIFTCTRL_PUSH_THRESH_Msk) |
+		(boolToBit(shiftRight) << pio0_SM0_SHIFTCTRL_IN_SHIFTDIR_Pos) |
+		(boolToBit(autoPush) << pio0_SM0_SHIFTCTRL_AUTOPUSH_Pos) |
+		(uint32(pushThreshold&0x1f) << pio0_SM0_SHIFTCTRL_PUSH_THRESH_Pos)
 }
 
 // SetOutShift sets the 'out' shifting parameters in a state machine configuration
@@ -100,12 +93,12 @@ func (cfg *StateMachineConfig) SetInShift(shiftRight bool, autoPush bool, pushTh
 //   - pushThreshold is threshold in bits to shift out before auto/conditional re-pulling of the OSR.
 func (cfg *StateMachineConfig) SetOutShift(shiftRight bool, autoPull bool, pushThreshold uint16) {
 	cfg.ShiftCtrl = cfg.ShiftCtrl &
-		^uint32(rp.PIO0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Msk|
-			rp.PIO0_SM0_SHIFTCTRL_AUTOPULL_Msk|
-			rp.PIO0_SM0_SHIFTCTRL_PULL_THRESH_Msk) |
-		(boolToBit(shiftRight) << rp.PIO0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Pos) |
-		(boolToBit(autoPull) << rp.PIO0_SM0_SHIFTCTRL_AUTOPULL_Pos) |
-		(uint32(pushThreshold&0x1f) << rp.PIO0_SM0_SHIFTCTRL_PULL_THRESH_Pos)
+		^uint32(pio0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Msk|
+			pio0_SM0_SHIFTCTRL_AUTOPULL_Msk|
+			pio0_SM0_SHIFTCTRL_PULL_THRESH_Msk) |
+		(boolToBit(shiftRight) << pio0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Pos) |
+		(boolToBit(autoPull) << pio0_SM0_SHIFTCTRL_AUTOPULL_Pos) |
+		(uint32(pushThreshold&0x1f) << pio0_SM0_SHIFTCTRL_PULL_THRESH_Pos)
 }
 
 // SetSidesetParams sets the side-set parameters in a state machine configuration.
@@ -118,93 +111,12 @@ func (cfg *StateMachineConfig) SetSidesetParams(bitCount uint8, optional bool, p
 	if bitCount > 5 {
 		panic("SetSideSet: bitCount")
 	}
-	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(rp.PIO0_SM0_PINCTRL_SIDESET_COUNT_Msk)) |
-		(uint32(bitCount) << uint32(rp.PIO0_SM0_PINCTRL_SIDESET_COUNT_Pos))
-
-	cfg.ExecCtrl = (cfg.ExecCtrl & ^uint32(rp.PIO0_SM0_EXECCTRL_SIDE_EN_Msk|rp.PIO0_SM0_EXECCTRL_SIDE_PINDIR_Msk)) |
-		(boolToBit(optional) << rp.PIO0_SM0_EXECCTRL_SIDE_EN_Pos) |
-		(boolToBit(pindirs) << rp.PIO0_SM0_EXECCTRL_SIDE_PINDIR_Pos)
-}
+	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(pio0_SM0_PINCTRL_SIDESET_COUNT_Msk)) |
+		(uint32(bitCount) << uint32(pio0_SM0_PINCTRL_SIDESET_COUNT_Pos))
 
-// SetSidesetPins sets the lowest-numbered pin that will be affected by a side-set
-// operation.
-//
-// Remember to also set the pindir of the pin(s).
-func (cfg *StateMachineConfig) SetSidesetPins(firstPin machine.Pin) {
-	checkPinBaseAndCount(firstPin, 1)
-	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(rp.PIO0_SM0_PINCTRL_SIDESET_BASE_Msk)) |
-		(uint32(firstPin) << rp.PIO0_SM0_PINCTRL_SIDESET_BASE_Pos)
-}
-
-// SetOutPins sets the pins a PIO 'out' instruction modifies. Can overlap with pins in IN, SET and SIDESET.
-// `out` instructions receive data from the OSR (output shift register) and write it to the GPIO pins in bitwise format,
-// thus OUT pins are best suited for driving data protocols with multiple data wires.
-//   - Base defines the lowest-numbered pin that will be affected by an OUT PINS,
-//     OUT PINDIRS or MOV PINS instruction. The data written to this pin will always be
-//     the least-significant bit of the OUT or MOV data.
-//   - Count defines the number of pins that will be affected by an OUT PINS, 0..32 inclusive.
-//
-// Remember to also set the pindir of the pin(s).
-func (cfg *StateMachineConfig) SetOutPins(base machine.Pin, count uint8) {
-	checkPinBaseAndCount(base, count)
-	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(rp.PIO0_SM0_PINCTRL_OUT_BASE_Msk|rp.PIO0_SM0_PINCTRL_OUT_COUNT_Msk)) |
-		(uint32(base) << rp.PIO0_SM0_PINCTRL_OUT_BASE_Pos) |
-		(uint32(count) << rp.PIO0_SM0_PINCTRL_OUT_COUNT_Pos)
-}
-
-// SetSetPins sets the pins a PIO 'set' instruction modifies.
-// Can overlap with pins in IN, OUT and SIDESET.
-// Set pins are best suited to assert control signals such as clock/chip-selects.
-//
-// The mapping of SET and OUT onto pins is configured independently. They may be mapped to distinct locations, for example
-// if one pin is to be used as a clock signal, and another for data. They may also be overlapping ranges of pins: a UART
-// transmitter might use SET to assert start and stop bits, and OUT instructions to shift out FIFO data to the same pins.
-//
-// Remember to also set the pindir of the pin(s).
-func (cfg *StateMachineConfig) SetSetPins(base machine.Pin, count uint8) {
-	checkPinBaseAndCount(base, count)
-	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(rp.PIO0_SM0_PINCTRL_SET_BASE_Msk|rp.PIO0_SM0_PINCTRL_SET_COUNT_Msk)) |
-		(uint32(base) << rp.PIO0_SM0_PINCTRL_SET_BASE_Pos) |
-		(uint32(count) << rp.PIO0_SM0_PINCTRL_SET_COUNT_Pos)
-}
-
-const (
-	// RP2350-only, redefined here for RP2040 compatibility.
-	pio0_SM0_SHIFTCTRL_IN_COUNT_Msk uint32 = 0x1f
-)
-
-// SetInPins in a state machine configuration. Can overlap with OUT, SET and SIDESET pins.
-//
-// On RP2350, pin count sets remaining bits to 0 in instructions such as `MOV x, PINS` that
-// would otherwise return a full 32-bit value of pin states. On RP2040 this has no effect.
-// Remember to also set the pindir of the pin(s).
-func (cfg *StateMachineConfig) SetInPins(base machine.Pin, count uint8) {
-	checkPinBaseAndCount(base, count)
-	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(rp.PIO0_SM0_PINCTRL_IN_BASE_Msk)) | (uint32(base) << rp.PIO0_SM0_PINCTRL_IN_BASE_Pos)
-	// Set pin count. These bits are unused on RP2040
-	cfg.ShiftCtrl = (cfg.ShiftCtrl & ^pio0_SM0_SHIFTCTRL_IN_COUNT_Msk) | uint32(count)
-}
-
-// SetJmpPin sets the gpio pin to use as the source for a `jmp pin` instruction.
-func (cfg *StateMachineConfig) SetJmpPin(pin machine.Pin) {
-	checkPinBaseAndCount(pin, 1)
-	cfg.ExecCtrl = (cfg.ExecCtrl & ^uint32(rp.PIO0_SM0_EXECCTRL_JMP_PIN_Msk)) | (uint32(pin) << rp.PIO0_SM0_EXECCTRL_JMP_PIN_Pos)
-}
-
-// SetOutSpecial set special 'out' operations in a state machine configuration.
-//   - sticky to enable 'sticky' output (i.e. re-asserting most recent OUT/SET pin values on subsequent cycles).
-//   - hasEnablePin true to enable auxiliary OUT enable pin.
-//   - enable pin for auxiliary OUT enable.
-func (cfg *StateMachineConfig) SetOutSpecial(sticky, hasEnablePin bool, enable machine.Pin) {
-	if hasEnablePin {
-		checkPinBaseAndCount(enable, 1)
-	}
-	cfg.ExecCtrl = (cfg.ExecCtrl &
-		^uint32(rp.PIO0_SM0_EXECCTRL_OUT_STICKY_Msk|rp.PIO0_SM0_EXECCTRL_INLINE_OUT_EN_Msk|
-			rp.PIO0_SM0_EXECCTRL_OUT_EN_SEL_Msk)) |
-		(boolToBit(sticky) << rp.PIO0_SM0_EXECCTRL_OUT_STICKY_Pos) |
-		(boolToBit(hasEnablePin) << rp.PIO0_SM0_EXECCTRL_INLINE_OUT_EN_Pos) |
-		((uint32(enable) << rp.PIO0_SM0_EXECCTRL_OUT_EN_SEL_Pos) & rp.PIO0_SM0_EXECCTRL_OUT_EN_SEL_Msk)
+	cfg.ExecCtrl = (cfg.ExecCtrl & ^uint32(pio0_SM0_EXECCTRL_SIDE_EN_Msk|pio0_SM0_EXECCTRL_SIDE_PINDIR_Msk)) |
+		(boolToBit(optional) << pio0_SM0_EXECCTRL_SIDE_EN_Pos) |
+		(boolToBit(pindirs) << pio0_SM0_EXECCTRL_SIDE_PINDIR_Pos)
 }
 
 // SetMovStatus sets source for 'mov status' in a state machine configuration.
@@ -212,17 +124,9 @@ func (cfg *StateMachineConfig) SetOutSpecial(sticky, hasEnablePin bool, enable m
 //   - statusN parameter for the mov status operation (currently a bit count).
 func (cfg *StateMachineConfig) SetMovStatus(statusSel MovStatus, statusN uint32) {
 	cfg.ExecCtrl = (cfg.ExecCtrl &
-		^uint32(rp.PIO0_SM0_EXECCTRL_STATUS_SEL_Msk|rp.PIO0_SM0_EXECCTRL_STATUS_N_Msk)) |
-		((uint32(statusSel) << rp.PIO0_SM0_EXECCTRL_STATUS_SEL_Pos) & rp.PIO0_SM0_EXECCTRL_STATUS_SEL_Msk) |
-		((statusN << rp.PIO0_SM0_EXECCTRL_STATUS_N_Pos) & rp.PIO0_SM0_EXECCTRL_STATUS_N_Msk)
-}
-
-func checkPinBaseAndCount(base machine.Pin, count uint8) {
-	if base >= 32 {
-		panic("pio:bad pin")
-	} else if count > 32 {
-		panic("pio:count too large")
-	}
+		^uint32(pio0_SM0_EXECCTRL_STATUS_SEL_Msk|pio0_SM0_EXECCTRL_STATUS_N_Msk)) |
+		((uint32(statusSel) << pio0_SM0_EXECCTRL_STATUS_SEL_Pos) & pio0_SM0_EXECCTRL_STATUS_SEL_Msk) |
+		((statusN << pio0_SM0_EXECCTRL_STATUS_N_Pos) & pio0_SM0_EXECCTRL_STATUS_N_Msk)
 }
 
 type FifoJoin uint8
@@ -252,16 +156,13 @@ type MovStatus uint8
 const (
 	MovStatusTxLessthan MovStatus = iota
 	MovStatusRxLessthan
+	// MovStatusIRQ selects a state machine IRQ flag as status source. RP2350-only.
+	MovStatusIRQ
 )
 
 const (
-	fifoJoinMask = rp.PIO0_SM0_SHIFTCTRL_FJOIN_TX_Msk | rp.PIO0_SM0_SHIFTCTRL_FJOIN_RX_Msk |
+	fifoJoinMask = pio0_SM0_SHIFTCTRL_FJOIN_TX_Msk | pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk |
 		pio0_SM0_SHIFTCTRL_FJOIN_RX_PUT_Msk | pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Msk
-
-	// RP2350-only, redefined here for RP2040 compatibility
-	pio0_SM0_SHIFTCTRL_FJOIN_RX_PUT_Msk uint32 = 0x8000
-	pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Msk uint32 = 0x4000
-	pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Pos uint32 = 14 // 0xe
 )
 
 // SetFIFOJoin sets FIFO joining or RX FIFO random access on a state machine.
@@ -273,7 +174,7 @@ func (cfg *StateMachineConfig) SetFIFOJoin(join FifoJoin) {
 	var newBits uint32
 	switch join {
 	case FifoJoinRx, FifoJoinTx:
-		newBits = uint32(join&0b11) << rp.PIO0_SM0_SHIFTCTRL_FJOIN_TX_Pos
+		newBits = uint32(join&0b11) << pio0_SM0_SHIFTCTRL_FJOIN_TX_Pos
 	case FifoJoinRxGet, FifoJoinRxPut, FifoJoinRxPutGet:
 		// These bits are unused on RP2040 and will have no effect.
 		newBits = (uint32(join-FifoJoinRx) & 0b11) << pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Pos
@@ -0,0 +1,109 @@
+package pio
+
+// SetSidesetPins sets the lowest-numbered pin that will be affected by a side-set
+// operation.
+//
+// Remember to also set the pindir of the pin(s).
+func (cfg *StateMachineConfig) SetSidesetPins(firstPin Pin) {
+	checkPinBaseAndCount(firstPin, 1)
+	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(pio0_SM0_PINCTRL_SIDESET_BASE_Msk)) |
+		(uint32(firstPin) << pio0_SM0_PINCTRL_SIDESET_BASE_Pos)
+}
+
+// SetOutPins sets the pins a PIO 'out' instruction modifies. Can overlap with pins in IN, SET and SIDESET.
+// `out` instructions receive data from the OSR (output shift register) and write it to the GPIO pins in bitwise format,
+// thus OUT pins are best suited for driving data protocols with multiple data wires.
+//   - Base defines the lowest-numbered pin that will be affected by an OUT PINS,
+//     OUT PINDIRS or MOV PINS instruction. The data written to this pin will always be
+//     the least-significant bit of the OUT or MOV data.
+//   - Count defines the number of pins that will be affected by an OUT PINS, 0..32 inclusive.
+//
+// Remember to also set the pindir of the pin(s).
+func (cfg *StateMachineConfig) SetOutPins(base Pin, count uint8) {
+	checkPinBaseAndCount(base, count)
+	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(pio0_SM0_PINCTRL_OUT_BASE_Msk|pio0_SM0_PINCTRL_OUT_COUNT_Msk)) |
+		(uint32(base) << pio0_SM0_PINCTRL_OUT_BASE_Pos) |
+		(uint32(count) << pio0_SM0_PINCTRL_OUT_COUNT_Pos)
+}
+
+// SetSetPins sets the pins a PIO 'set' instruction modifies.
+// Can overlap with pins in IN, OUT and SIDESET.
+// Set pins are best suited to assert control signals such as clock/chip-selects.
+//
+// The mapping of SET and OUT onto pins is configured independently. They may be mapped to distinct locations, for example
+// if one pin is to be used as a clock signal, and another for data. They may also be overlapping ranges of pins: a UART
+// transmitter might use SET to assert start and stop bits, and OUT instructions to shift out FIFO data to the same pins.
+//
+// Remember to also set the pindir of the pin(s).
+func (cfg *StateMachineConfig) SetSetPins(base Pin, count uint8) {
+	checkPinBaseAndCount(base, count)
+	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(pio0_SM0_PINCTRL_SET_BASE_Msk|pio0_SM0_PINCTRL_SET_COUNT_Msk)) |
+		(uint32(base) << pio0_SM0_PINCTRL_SET_BASE_Pos) |
+		(uint32(count) << pio0_SM0_PINCTRL_SET_COUNT_Pos)
+}
+
+// SetInPins in a state machine configuration. Can overlap with OUT, SET and SIDESET pins.
+//
+// On RP2350, pin count sets remaining bits to 0 in instructions such as `MOV x, PINS` that
+// would otherwise return a full 32-bit value of pin states. On RP2040 this has no effect,
+// so a count below 32 makes the configuration require PIO version 1, see [StateMachineConfig.RequiredVersion].
+// Remember to also set the pindir of the pin(s).
+func (cfg *StateMachineConfig) SetInPins(base Pin, count uint8) {
+	checkPinBaseAndCount(base, count)
+	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(pio0_SM0_PINCTRL_IN_BASE_Msk)) | (uint32(base) << pio0_SM0_PINCTRL_IN_BASE_Pos)
+	// A count of 32 is encoded as 0.
+	cfg.ShiftCtrl = (cfg.ShiftCtrl & ^pio0_SM0_SHIFTCTRL_IN_COUNT_Msk) | uint32(count)&pio0_SM0_SHIFTCTRL_IN_COUNT_Msk
+}
+
+// SetOutPinCount sets the number of pins an OUT PINS instruction modifies, 0..32 inclusive,
+// leaving the base pin unchanged.
+func (cfg *StateMachineConfig) SetOutPinCount(count uint8) {
+	checkPinBaseAndCount(0, count)
+	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(pio0_SM0_PINCTRL_OUT_COUNT_Msk)) | (uint32(count) << pio0_SM0_PINCTRL_OUT_COUNT_Pos)
+}
+
+// SetSetPinCount sets the number of pins a SET PINS instruction modifies, 0..5 inclusive,
+// leaving the base pin unchanged.
+func (cfg *StateMachineConfig) SetSetPinCount(count uint8) {
+	if count > 5 {
+		panic("pio:count too large")
+	}
+	cfg.PinCtrl = (cfg.PinCtrl & ^uint32(pio0_SM0_PINCTRL_SET_COUNT_Msk)) | (uint32(count) << pio0_SM0_PINCTRL_SET_COUNT_Pos)
+}
+
+// SetInPinCount sets the number of IN pins visible to the state machine, 1..32 inclusive,
+// leaving the base pin unchanged. See [StateMachineConfig.SetInPins].
+func (cfg *StateMachineConfig) SetInPinCount(count uint8) {
+	checkPinBaseAndCount(0, count)
+	cfg.ShiftCtrl = (cfg.ShiftCtrl & ^pio0_SM0_SHIFTCTRL_IN_COUNT_Msk) | uint32(count)&pio0_SM0_SHIFTCTRL_IN_COUNT_Msk
+}
+
+// SetJmpPin sets the gpio pin to use as the source for a `jmp pin` instruction.
+func (cfg *StateMachineConfig) SetJmpPin(pin Pin) {
+	checkPinBaseAndCount(pin, 1)
+	cfg.ExecCtrl = (cfg.ExecCtrl & ^uint32(pio0_SM0_EXECCTRL_JMP_PIN_Msk)) | (uint32(pin) << pio0_SM0_EXECCTRL_JMP_PIN_Pos)
+}
+
+// SetOutSpecial set special 'out' operations in a state machine configuration.
+//   - sticky to enable 'sticky' output (i.e. re-asserting most recent OUT/SET pin values on subsequent cycles).
+//   - hasEnablePin true to enable auxiliary OUT enable pin.
+//   - enable pin for auxiliary OUT enable.
+func (cfg *StateMachineConfig) SetOutSpecial(sticky, hasEnablePin bool, enable Pin) {
+	if hasEnablePin {
+		checkPinBaseAndCount(enable, 1)
+	}
+	cfg.ExecCtrl = (cfg.ExecCtrl &
+		^uint32(pio0_SM0_EXECCTRL_OUT_STICKY_Msk|pio0_SM0_EXECCTRL_INLINE_OUT_EN_Msk|
+			pio0_SM0_EXECCTRL_OUT_EN_SEL_Msk)) |
+		(boolToBit(sticky) << pio0_SM0_EXECCTRL_OUT_STICKY_Pos) |
+		(boolToBit(hasEnablePin) << pio0_SM0_EXECCTRL_INLINE_OUT_EN_Pos) |
+		((uint32(enable) << pio0_SM0_EXECCTRL_OUT_EN_SEL_Pos) & pio0_SM0_EXECCTRL_OUT_EN_SEL_Msk)
+}
+
+func checkPinBaseAndCount(base Pin, count uint8) {
+	if base >= 32 {
+		panic("pio:bad pin")
+	} else if count > 32 {
+		panic("pio:count too large")
+	}
+}
@@ -0,0 +1,327 @@
+package pio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// Program container format. Programs are shipped as data in a binary or JSON container
+// holding everything needed to load them and build their state machine configuration.
+// Symbols, code blocks and language options are not stored.
+//
+// Binary layout, multi-byte values are little endian:
+//
+//	magic        [4]byte "PIO\x00"
+//	format       uint8   containerFormat
+//	name length  uint8
+//	name         [name length]byte
+//	flags        uint8   containerFlag*
+//	origin       int8
+//	pio version  uint8
+//	wrap target  uint8
+//	wrap         uint8
+//	side-set     uint8   value bits, not including the optional enable bit
+//	fifo join    uint8
+//	set count    int8
+//	in, out      [2][3]uint8 pin count, shift right|auto<<1, threshold. Zero if not present.
+//	mov status   [2]uint8 selector, N. Zero if not present.
+//	clock div    float32
+//	length       uint8
+//	instructions [length]uint16
+//	crc          uint32 CRC-32 (IEEE) of all preceding bytes.
+const (
+	containerMagic  = "PIO\x00"
+	containerFormat = 1
+)
+
+const (
+	containerFlagSidesetOpt = 1 << iota
+	containerFlagSidesetPindirs
+	containerFlagIn
+	containerFlagOut
+	containerFlagMovStatus
+)
+
+// ErrInvalidContainer is returned when decoding a malformed program container.
+var ErrInvalidContainer = errors.New("pio: invalid program container")
+
+// MarshalBinary encodes the program in the binary container format.
+func (p *AssembledProgram) MarshalBinary() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	} else if len(p.Name) > math.MaxUint8 {
+		return nil, fmt.Errorf("pio: program name longer than %d bytes", math.MaxUint8)
+	}
+	var b bytes.Buffer
+	b.WriteString(containerMagic)
+	b.WriteByte(containerFormat)
+	b.WriteByte(uint8(len(p.Name)))
+	b.WriteString(p.Name)
+	var flags uint8
+	if p.SidesetOptional {
+		flags |= containerFlagSidesetOpt
+	}
+	if p.SidesetPindirs {
+		flags |= containerFlagSidesetPindirs
+	}
+	if p.In != nil {
+		flags |= containerFlagIn
+	}
+	if p.Out != nil {
+		flags |= containerFlagOut
+	}
+	if p.MovStatus != nil {
+		flags |= containerFlagMovStatus
+	}
+	b.Write([]byte{flags, uint8(p.Origin), p.PIOVersion, p.WrapTarget, p.Wrap, p.SidesetBits, uint8(p.FifoJoin), uint8(p.SetCount)})
+	for _, sd := range [2]*ShiftDirective{p.In, p.Out} {
+		if sd == nil {
+			sd = &ShiftDirective{}
+		}
+		b.Write([]byte{sd.PinCount, boolAsU8(sd.ShiftRight) | boolAsU8(sd.Auto)<<1, sd.Threshold})
+	}
+	if p.MovStatus != nil {
+		b.Write([]byte{uint8(p.MovStatus.Sel), p.MovStatus.N})
+	} else {
+		b.Write([]byte{0, 0})
+	}
+	b.Write(binary.LittleEndian.AppendUint32(nil, math.Float32bits(p.ClkDiv)))
+	b.WriteByte(uint8(len(p.Instructions)))
+	for _, instr := range p.Instructions {
+		b.Write(binary.LittleEndian.AppendUint16(nil, instr))
+	}
+	b.Write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(b.Bytes())))
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a program in the binary container format and validates it.
+func (p *AssembledProgram) UnmarshalBinary(data []byte) error {
+	const crcLen = 4
+	if len(data) < len(containerMagic)+2+crcLen || string(data[:len(containerMagic)]) != containerMagic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidContainer)
+	}
+	body, crc := data[:len(data)-crcLen], binary.LittleEndian.Uint32(data[len(data)-crcLen:])
+	if crc32.ChecksumIEEE(body) != crc {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidContainer)
+	}
+	r := containerReader{buf: body[len(containerMagic):]}
+	if format := r.byte(); format != containerFormat {
+		return fmt.Errorf("%w: unsupported format %d", ErrInvalidContainer, format)
+	}
+	prog := AssembledProgram{Name: string(r.bytes(int(r.byte())))}
+	flags := r.byte()
+	prog.SidesetOptional = flags&containerFlagSidesetOpt != 0
+	prog.SidesetPindirs = flags&containerFlagSidesetPindirs != 0
+	prog.Origin = int8(r.byte())
+	prog.PIOVersion = r.byte()
+	prog.WrapTarget = r.byte()
+	prog.Wrap = r.byte()
+	prog.SidesetBits = r.byte()
+	prog.FifoJoin = FifoJoin(r.byte())
+	prog.SetCount = int8(r.byte())
+	for i, flag := range [2]uint8{containerFlagIn, containerFlagOut} {
+		fields := r.bytes(3)
+		if flags&flag == 0 || fields == nil {
+			continue
+		}
+		sd := &ShiftDirective{PinCount: fields[0], ShiftRight: fields[1]&1 != 0, Auto: fields[1]&2 != 0, Threshold: fields[2]}
+		if i == 0 {
+			prog.In = sd
+		} else {
+			prog.Out = sd
+		}
+	}
+	if st := r.bytes(2); flags&containerFlagMovStatus != 0 && st != nil {
+		prog.MovStatus = &MovStatusDirective{Sel: MovStatus(st[0]), N: st[1]}
+	}
+	if clkdiv := r.bytes(4); clkdiv != nil {
+		prog.ClkDiv = math.Float32frombits(binary.LittleEndian.Uint32(clkdiv))
+	}
+	n := int(r.byte())
+	instrs := r.bytes(2 * n)
+	if r.short {
+		return fmt.Errorf("%w: truncated", ErrInvalidContainer)
+	} else if len(r.buf) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidContainer, len(r.buf))
+	}
+	prog.Instructions = make([]uint16, n)
+	for i := range prog.Instructions {
+		prog.Instructions[i] = binary.LittleEndian.Uint16(instrs[2*i:])
+	}
+	if err := prog.Validate(); err != nil {
+		return err
+	}
+	*p = prog
+	return nil
+}
+
+type containerReader struct {
+	buf   []byte
+	short bool
+}
+
+func (r *containerReader) bytes(n int) []byte {
+	if n > len(r.buf) {
+		r.short = true
+		r.buf = nil
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *containerReader) byte() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// programJSON is the JSON container format.
+type programJSON struct {
+	Format       int                 `json:"format"`
+	Name         string              `json:"name"`
+	Instructions []uint16            `json:"instructions"`
+	Origin       int8                `json:"origin"`
+	PIOVersion   uint8               `json:"pio_version"`
+	WrapTarget   uint8               `json:"wrap_target"`
+	Wrap         uint8               `json:"wrap"`
+	Sideset      *sidesetJSON        `json:"side_set,omitempty"`
+	FifoJoin     FifoJoin            `json:"fifo_join,omitempty"`
+	In           *ShiftDirective     `json:"in,omitempty"`
+	Out          *ShiftDirective     `json:"out,omitempty"`
+	SetCount     int8                `json:"set_count"`
+	MovStatus    *MovStatusDirective `json:"mov_status,omitempty"`
+	ClkDiv       float32             `json:"clock_div,omitempty"`
+}
+
+type sidesetJSON struct {
+	Bits     uint8 `json:"bits"`
+	Optional bool  `json:"optional,omitempty"`
+	Pindirs  bool  `json:"pindirs,omitempty"`
+}
+
+// MarshalJSON encodes the program in the JSON container format.
+// Its fields mirror the binary format.
+func (p *AssembledProgram) MarshalJSON() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	pj := programJSON{
+		Format:       containerFormat,
+		Name:         p.Name,
+		Instructions: p.Instructions,
+		Origin:       p.Origin,
+		PIOVersion:   p.PIOVersion,
+		WrapTarget:   p.WrapTarget,
+		Wrap:         p.Wrap,
+		FifoJoin:     p.FifoJoin,
+		In:           p.In,
+		Out:          p.Out,
+		SetCount:     p.SetCount,
+		MovStatus:    p.MovStatus,
+		ClkDiv:       p.ClkDiv,
+	}
+	if p.SidesetBits > 0 {
+		pj.Sideset = &sidesetJSON{Bits: p.SidesetBits, Optional: p.SidesetOptional, Pindirs: p.SidesetPindirs}
+	}
+	return json.Marshal(pj)
+}
+
+// UnmarshalJSON decodes a program in the JSON container format and validates it.
+func (p *AssembledProgram) UnmarshalJSON(data []byte) error {
+	pj := programJSON{Origin: -1, SetCount: -1}
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidContainer, err)
+	} else if pj.Format != containerFormat {
+		return fmt.Errorf("%w: unsupported format %d", ErrInvalidContainer, pj.Format)
+	}
+	prog := AssembledProgram{
+		Name:         pj.Name,
+		Instructions: pj.Instructions,
+		Origin:       pj.Origin,
+		PIOVersion:   pj.PIOVersion,
+		WrapTarget:   pj.WrapTarget,
+		Wrap:         pj.Wrap,
+		FifoJoin:     pj.FifoJoin,
+		In:           pj.In,
+		Out:          pj.Out,
+		SetCount:     pj.SetCount,
+		MovStatus:    pj.MovStatus,
+		ClkDiv:       pj.ClkDiv,
+	}
+	if pj.Sideset != nil {
+		prog.SidesetBits = pj.Sideset.Bits
+		prog.SidesetOptional = pj.Sideset.Optional
+		prog.SidesetPindirs = pj.Sideset.Pindirs
+	}
+	if err := prog.Validate(); err != nil {
+		return err
+	}
+	*p = prog
+	return nil
+}
+
+// DecodeProgram decodes a program container in binary or JSON format, detected from its first byte.
+func DecodeProgram(data []byte) (*AssembledProgram, error) {
+	prog := new(AssembledProgram)
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = prog.UnmarshalJSON(data)
+	} else {
+		err = prog.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// Validate checks the program can be loaded into instruction memory and its configuration is well formed.
+// It is called when encoding and decoding program containers.
+func (p *AssembledProgram) Validate() error {
+	n := len(p.Instructions)
+	switch {
+	case n == 0:
+		return errors.New("pio: program has no instructions")
+	case n > 32:
+		return fmt.Errorf("pio: program has %d instructions, exceeding the 32 available", n)
+	case p.Origin < -1 || p.Origin > 31:
+		return fmt.Errorf("pio: program origin %d out of range", p.Origin)
+	case p.Origin >= 0 && int(p.Origin)+n > 32:
+		return fmt.Errorf("pio: program does not fit in instruction memory at origin %d", p.Origin)
+	case p.PIOVersion > 1:
+		return fmt.Errorf("pio: unsupported PIO version %d", p.PIOVersion)
+	case p.WrapTarget > p.Wrap || int(p.Wrap) >= n:
+		return fmt.Errorf("pio: wrap %d..%d out of range", p.WrapTarget, p.Wrap)
+	case p.SidesetFieldBits() > 5:
+		return fmt.Errorf("pio: %d side-set bits exceed the delay/side-set field", p.SidesetFieldBits())
+	case p.FifoJoin > FifoJoinRxPutGet:
+		return fmt.Errorf("pio: invalid FIFO join %d", p.FifoJoin)
+	case p.SetCount < -1 || p.SetCount > 5:
+		return fmt.Errorf("pio: SET pin count %d out of range", p.SetCount)
+	case p.MovStatus != nil && p.MovStatus.Sel > MovStatusIRQ:
+		return fmt.Errorf("pio: invalid MOV STATUS selector %d", p.MovStatus.Sel)
+	case p.ClkDiv != 0 && !(p.ClkDiv >= 1 && p.ClkDiv <= 65536):
+		return fmt.Errorf("pio: clock divider %g out of range", p.ClkDiv)
+	}
+	for _, sd := range [2]*ShiftDirective{p.In, p.Out} {
+		if sd != nil && (sd.PinCount > 32 || sd.Threshold < 1 || sd.Threshold > 32) {
+			return fmt.Errorf("pio: shift threshold %d or pin count %d out of range", sd.Threshold, sd.PinCount)
+		}
+	}
+	_, err := p.decode()
+	if err != nil {
+		return err
+	} else if p.RequiredVersion() > p.PIOVersion {
+		return fmt.Errorf("pio: program configuration requires PIO version %d", p.RequiredVersion())
+	}
+	return nil
+}
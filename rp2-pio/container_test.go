@@ -0,0 +1,119 @@
+package pio
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestProgramContainer(t *testing.T) {
+	srcs := map[string]string{
+		"blink": "", // Read from examples.
+		"full": `
+.program full
+.side_set 2 opt pindirs
+.origin 3
+.fifo tx
+.in 3 left auto 8
+.out 2 right 16
+.set 4
+.mov_status rxfifo < 2
+.clock_div 2.5
+	set pins, 1 side 3 [1]
+	jmp x-- 0
+.wrap_target
+	out pins, 2 side 0
+.wrap
+`,
+		"v1": `
+.pio_version 1
+.program v1
+.fifo putget
+	mov rxfifo[0], isr
+	mov osr, rxfifo[0]
+`,
+	}
+	for name, src := range srcs {
+		t.Run(name, func(t *testing.T) {
+			data := []byte(src)
+			if src == "" {
+				var err error
+				data, err = os.ReadFile("examples/blinky/blink.pio")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			asm, err := ParseAssembly(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := asm.Programs[0]
+			// Symbols, code blocks and language options are not stored in containers.
+			want.Symbols, want.CodeBlocks, want.LangOpts = nil, nil, nil
+
+			bin, err := want.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			js, err := want.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, encoded := range [][]byte{bin, js} {
+				got, err := DecodeProgram(encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(*got, want) {
+					t.Errorf("round trip mismatch:\n%+v\n%+v", *got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProgramContainerErrors(t *testing.T) {
+	asm := AssemblerV0{}
+	prog := AssembledProgram{
+		Name:         "p",
+		Instructions: []uint16{asm.Nop().Encode(), asm.Jmp(JmpAlways, 0).Encode()},
+		Origin:       -1,
+		Wrap:         1,
+		SetCount:     -1,
+	}
+	bin, err := prog.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := append([]byte(nil), bin...)
+	corrupt[len(corrupt)-6] ^= 1
+	if _, err := DecodeProgram(corrupt); !errors.Is(err, ErrInvalidContainer) {
+		t.Errorf("corrupt data: expected ErrInvalidContainer, got %v", err)
+	}
+	if _, err := DecodeProgram(bin[:8]); !errors.Is(err, ErrInvalidContainer) {
+		t.Errorf("truncated data: expected ErrInvalidContainer, got %v", err)
+	}
+	if _, err := DecodeProgram([]byte(`{"format":2}`)); !errors.Is(err, ErrInvalidContainer) {
+		t.Errorf("unknown format: expected ErrInvalidContainer, got %v", err)
+	}
+	if _, err := DecodeProgram([]byte(`{"format":1,"instructions":[40960],"wrap":3}`)); err == nil {
+		t.Error("expected error for wrap out of range")
+	}
+	if _, err := DecodeProgram([]byte(`{"format":1,"instructions":[31]}`)); err == nil {
+		t.Error("expected error for jump past end of program")
+	}
+
+	bad := prog
+	bad.Instructions = make([]uint16, 33)
+	if _, err := bad.MarshalBinary(); err == nil {
+		t.Error("expected error for program too long")
+	}
+	bad = prog
+	bad.Instructions = []uint16{0xa063} // mov pindirs, null
+	bad.Wrap = 0
+	if _, err := bad.MarshalJSON(); !errors.Is(err, ErrRequiresV1) {
+		t.Errorf("expected ErrRequiresV1, got %v", err)
+	}
+}
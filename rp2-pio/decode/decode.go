@@ -0,0 +1,53 @@
+// Package decode turns pin traces into protocol transactions: SPI words, I2S frames, WS2812
+// pixels, UART frames, I2C messages and parallel bus words.
+//
+// All decoders read an [emu.Waveform], the trace type recorded by [emu.Recorder] from emulated
+// PIO programs and read by [emu.ReadVCD] from logic analyzer captures, so the same assertions
+// apply to emulator output and on-device captures. Pin levels are taken from [emu.Sample.Levels].
+// Clocked protocols are latched with the levels just before each latching clock edge.
+//
+// Decoders return an error only for invalid configurations. Protocol errors such as UART framing
+// errors or words cut short by the end of the capture are reported in the decoded transactions.
+package decode
+
+import (
+	"errors"
+
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+var errNoClock = errors.New("decode: waveform has no system clock frequency")
+
+// level returns the level of pin in s.
+func level(s emu.Sample, pin uint8) bool {
+	return s.Levels()>>(pin&31)&1 != 0
+}
+
+// latch returns the pad state seen by a receiver latching on the rising or falling edges of clk:
+// the state just before each edge, with Cycle set to the cycle of the edge.
+func latch(w *emu.Waveform, clk uint8, rising bool) []emu.Sample {
+	var latched []emu.Sample
+	edges := w.Edges(clk)
+	for i := 1; i < len(edges); i++ { // The first edge is the initial level.
+		e := edges[i]
+		if e.Level != rising {
+			continue
+		}
+		s := w.At(e.Cycle - 1)
+		s.Cycle = e.Cycle
+		latched = append(latched, s)
+	}
+	return latched
+}
+
+// shiftIn adds bit to a word that already holds n bits.
+func shiftIn(word uint32, bit bool, n uint8, lsbFirst bool) uint32 {
+	var b uint32
+	if bit {
+		b = 1
+	}
+	if lsbFirst {
+		return word | b<<n
+	}
+	return word<<1 | b
+}
@@ -0,0 +1,64 @@
+package decode
+
+import (
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// testClockHz is the system clock of synthesized waveforms.
+const testClockHz = 125_000_000
+
+// trace synthesizes a waveform of input levels for decoders to read.
+type trace struct {
+	w emu.Waveform
+}
+
+func newTrace(initial uint32) *trace {
+	return &trace{w: emu.Waveform{SysClockHz: testClockHz, Samples: []emu.Sample{{In: initial}}}}
+}
+
+// set drives pin to level from the current cycle on.
+func (tr *trace) set(pin uint8, level bool) {
+	s := tr.w.Samples[len(tr.w.Samples)-1]
+	if level {
+		s.In |= 1 << pin
+	} else {
+		s.In &^= 1 << pin
+	}
+	if s.Cycle == tr.w.End {
+		tr.w.Samples[len(tr.w.Samples)-1] = s
+		return
+	}
+	s.Cycle = tr.w.End
+	tr.w.Samples = append(tr.w.Samples, s)
+}
+
+// wait advances the current cycle.
+func (tr *trace) wait(cycles uint64) {
+	tr.w.End += cycles
+}
+
+// emulate records the pads of the PIO program in src, with the pins in pinMask as outputs, until
+// it has consumed the words in tx and stalled, and then for tail more cycles.
+func emulate(t *testing.T, src string, pinMask uint32, configure func(cfg *pio.StateMachineConfig), tx []uint32, tail int) *emu.Waveform {
+	t.Helper()
+	sm := emu.NewStateMachine(0)
+	if err := sm.LoadAndRun(src, 0, pinMask, configure); err != nil {
+		t.Fatal(err)
+	}
+	const maxCycles = 1_000_000
+	rec := emu.NewRecorder(sm, testClockHz)
+	for _, word := range tx {
+		if !rec.RunUntil(maxCycles, func() bool { return !sm.IsTxFIFOFull() }) {
+			t.Fatal("TX FIFO did not drain")
+		}
+		sm.TxPut(word)
+	}
+	if !rec.RunUntil(maxCycles, func() bool { return sm.IsTxFIFOEmpty() && sm.Stalled() }) {
+		t.Fatal("program did not stall")
+	}
+	rec.Run(tail)
+	return rec.Waveform()
+}
@@ -0,0 +1,120 @@
+package decode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// I2CConfig selects the pins of an I2C bus.
+type I2CConfig struct {
+	SCL, SDA uint8
+}
+
+// I2CByte is a byte transferred on an I2C bus along with its acknowledge bit.
+type I2CByte struct {
+	Value uint8
+	Ack   bool
+}
+
+// I2CMessage is the transfer between a START condition and the next START or STOP condition.
+type I2CMessage struct {
+	// Cycle is the cycle of the START condition.
+	Cycle uint64
+	// Addr is the 7-bit target address and Read the direction bit of the address byte.
+	Addr uint8
+	Read bool
+	// Nack is set when the target did not acknowledge its address.
+	Nack bool
+	// Data holds the bytes transferred after the address.
+	Data []I2CByte
+	// Stop is set when the message ended with a STOP condition rather than a repeated START.
+	Stop bool
+	// Bits is the number of bits of an unfinished byte, cut short by a START or STOP condition
+	// or by the end of the capture.
+	Bits uint8
+}
+
+func (m I2CMessage) String() string {
+	var b strings.Builder
+	dir := "write"
+	if m.Read {
+		dir = "read"
+	}
+	fmt.Fprintf(&b, "%s addr=%#02x", dir, m.Addr)
+	if m.Nack {
+		b.WriteString(" nack")
+	}
+	for _, d := range m.Data {
+		fmt.Fprintf(&b, " %#02x", d.Value)
+		if !d.Ack {
+			b.WriteString("~")
+		}
+	}
+	if m.Bits != 0 {
+		fmt.Fprintf(&b, " +%d bits", m.Bits)
+	}
+	if !m.Stop {
+		b.WriteString(" no-stop")
+	}
+	return b.String()
+}
+
+// I2C decodes the messages transferred on an I2C bus with 7-bit addresses. Bits are latched on
+// the rising edges of SCL and complete on the falling edges, and SDA changes while SCL is high are
+// START and STOP conditions. In the string form of a message, bytes that were not acknowledged
+// are followed by a tilde.
+func I2C(w *emu.Waveform, cfg I2CConfig) ([]I2CMessage, error) {
+	var msgs []I2CMessage
+	var cur *I2CMessage
+	var shift uint32
+	var n uint8
+	var addressed, pending, bit bool
+	end := func(stop bool) {
+		if cur == nil {
+			return
+		}
+		cur.Stop = stop
+		cur.Bits = n
+		msgs = append(msgs, *cur)
+		cur = nil
+	}
+	for i := 1; i < len(w.Samples); i++ {
+		prev, s := w.Samples[i-1], w.Samples[i]
+		sclPrev, sdaPrev := level(prev, cfg.SCL), level(prev, cfg.SDA)
+		scl, sda := level(s, cfg.SCL), level(s, cfg.SDA)
+		switch {
+		case sclPrev && scl && sdaPrev != sda:
+			// The clock pulse ending with a START or STOP condition carries no bit.
+			pending = false
+			if sda {
+				end(true)
+				continue
+			}
+			end(false)
+			cur = &I2CMessage{Cycle: s.Cycle}
+			shift, n, addressed = 0, 0, false
+		case !sclPrev && scl:
+			// Latch SDA as it was set up during the low period.
+			pending, bit = cur != nil, sdaPrev
+		case sclPrev && !scl && pending:
+			pending = false
+			shift = shiftIn(shift, bit, n, false)
+			n++
+			if n < 9 {
+				continue
+			}
+			value, ack := uint8(shift>>1), shift&1 == 0
+			if !addressed {
+				cur.Addr, cur.Read, cur.Nack = value>>1, value&1 != 0, !ack
+				addressed = true
+			} else {
+				cur.Data = append(cur.Data, I2CByte{Value: value, Ack: ack})
+			}
+			shift, n = 0, 0
+		}
+	}
+	end(false)
+	return msgs, nil
+}
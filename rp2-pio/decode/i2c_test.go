@@ -0,0 +1,93 @@
+package decode
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	i2cSCL = 0
+	i2cSDA = 1
+)
+
+// i2cBus drives I2C traffic onto a trace as a controller would.
+type i2cBus struct{ tr *trace }
+
+func (b i2cBus) start() {
+	b.tr.set(i2cSDA, true)
+	b.tr.wait(5)
+	b.tr.set(i2cSCL, true)
+	b.tr.wait(5)
+	b.tr.set(i2cSDA, false)
+	b.tr.wait(5)
+	b.tr.set(i2cSCL, false)
+}
+
+func (b i2cBus) stop() {
+	b.tr.set(i2cSDA, false)
+	b.tr.wait(5)
+	b.tr.set(i2cSCL, true)
+	b.tr.wait(5)
+	b.tr.set(i2cSDA, true)
+	b.tr.wait(5)
+}
+
+// byte sends value followed by the acknowledge bit.
+func (b i2cBus) byte(value uint8, ack bool) {
+	bits := uint16(value)<<1 | 1
+	if ack {
+		bits &^= 1
+	}
+	for i := 8; i >= 0; i-- {
+		b.tr.set(i2cSDA, bits>>i&1 != 0)
+		b.tr.wait(5)
+		b.tr.set(i2cSCL, true)
+		b.tr.wait(5)
+		b.tr.set(i2cSCL, false)
+	}
+}
+
+func TestI2C(t *testing.T) {
+	tr := newTrace(1<<i2cSCL | 1<<i2cSDA)
+	tr.wait(10)
+	bus := i2cBus{tr}
+	bus.start()
+	bus.byte(0x50<<1, true)
+	bus.byte(0x12, true)
+	bus.start() // Repeated START.
+	bus.byte(0x50<<1|1, true)
+	bus.byte(0x34, false)
+	bus.stop()
+	bus.start()
+	bus.byte(0x20<<1, false)
+	bus.stop()
+	bus.start()
+	bus.byte(0x21<<1, true)
+	bus.tr.set(i2cSDA, true)
+	bus.tr.wait(5)
+	bus.tr.set(i2cSCL, true) // Cut short after one bit.
+	bus.tr.wait(5)
+	bus.tr.set(i2cSCL, false)
+	bus.tr.wait(5)
+
+	msgs, err := I2C(&tr.w, I2CConfig{SCL: i2cSCL, SDA: i2cSDA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range msgs {
+		got = append(got, m.String())
+	}
+	want := []string{
+		"write addr=0x50 0x12 no-stop",
+		"read addr=0x50 0x34~",
+		"write addr=0x20 nack",
+		"write addr=0x21 +1 bits no-stop",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got messages %q, want %q", got, want)
+	}
+	if msgs[1].Data[0] != (I2CByte{Value: 0x34}) || msgs[0].Cycle != 20 {
+		t.Errorf("got messages %+v", msgs)
+	}
+}
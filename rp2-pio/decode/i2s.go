@@ -0,0 +1,83 @@
+package decode
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// I2SConfig selects the pins and sample width of an I2S bus.
+type I2SConfig struct {
+	BCLK, LRCLK, Data uint8
+	// Bits is the sample width, 16 if zero. Bits beyond it are ignored and missing bits read
+	// as zero, as I2S receivers do.
+	Bits uint8
+	// LeftHigh selects LRCLK high for the left channel. The I2S standard uses LRCLK low.
+	LeftHigh bool
+}
+
+// I2SFrame is a stereo sample transferred on an I2S bus.
+type I2SFrame struct {
+	// Cycle is the cycle of the BCLK edge latching the MSB of the left channel.
+	Cycle       uint64
+	Left, Right uint32
+}
+
+func (f I2SFrame) String() string {
+	return fmt.Sprintf("left=%#x right=%#x", f.Left, f.Right)
+}
+
+// I2S decodes the stereo samples transferred on an I2S bus. Data is latched on the rising edges
+// of BCLK and the MSB of each channel follows the LRCLK change by one BCLK period. Frames are
+// decoded from the first left channel word following an LRCLK change.
+func I2S(w *emu.Waveform, cfg I2SConfig) ([]I2SFrame, error) {
+	if cfg.Bits == 0 {
+		cfg.Bits = 16
+	} else if cfg.Bits > 32 {
+		return nil, errors.New("decode: I2S samples are at most 32 bits")
+	}
+	var frames []I2SFrame
+	var cur I2SFrame
+	var word uint32
+	var n uint8
+	var start uint64
+	synced, haveLeft := false, false
+	latched := latch(w, cfg.BCLK, true)
+	for i := 1; i < len(latched); i++ {
+		s := latched[i]
+		// The bit belongs to the channel selected during the previous BCLK period.
+		left := level(latched[i-1], cfg.LRCLK) == cfg.LeftHigh
+		if n == 0 {
+			start = s.Cycle
+		}
+		if n < cfg.Bits {
+			word = shiftIn(word, level(s, cfg.Data), n, false)
+		}
+		n++
+		if level(s, cfg.LRCLK) == level(latched[i-1], cfg.LRCLK) {
+			continue
+		}
+		// LRCLK changed: this was the last bit of the word. The word before the first change may
+		// have started before the capture.
+		if !synced {
+			synced = true
+			word, n = 0, 0
+			continue
+		}
+		if n < cfg.Bits {
+			word <<= cfg.Bits - n
+		}
+		switch {
+		case left:
+			cur = I2SFrame{Cycle: start, Left: word}
+			haveLeft = true
+		case haveLeft:
+			cur.Right = word
+			frames = append(frames, cur)
+			haveLeft = false
+		}
+		word, n = 0, 0
+	}
+	return frames, nil
+}
@@ -0,0 +1,66 @@
+package decode
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	i2sBCLK  = 0
+	i2sLRCLK = 1
+	i2sData  = 2
+)
+
+// i2sTrace synthesizes an I2S stream of the given frames with bits per channel, LRCLK changing
+// on the falling BCLK edge before the last bit of each word.
+func i2sTrace(bits uint8, leftHigh bool, frames [][2]uint32) *trace {
+	tr := newTrace(0)
+	tr.set(i2sLRCLK, leftHigh)
+	tr.wait(8)
+	for _, f := range frames {
+		for ch, word := range f {
+			for j := uint8(0); j < bits; j++ {
+				tr.set(i2sBCLK, false)
+				tr.set(i2sData, word>>(bits-1-j)&1 != 0)
+				if j == bits-1 {
+					tr.set(i2sLRCLK, (ch == 0) != leftHigh) // Select the other channel.
+				}
+				tr.wait(2)
+				tr.set(i2sBCLK, true)
+				tr.wait(2)
+			}
+		}
+	}
+	tr.set(i2sBCLK, false)
+	tr.wait(8)
+	return tr
+}
+
+func TestI2S(t *testing.T) {
+	frames := [][2]uint32{{0x1234, 0xfedc}, {0x8001, 0x7ffe}, {0, 0xffff}}
+	for _, leftHigh := range []bool{false, true} {
+		// The decoder synchronizes on the first LRCLK change, so a frame of padding is sent first.
+		tr := i2sTrace(16, leftHigh, append([][2]uint32{{0xdead, 0xdead}}, frames...))
+		got, err := I2S(&tr.w, I2SConfig{BCLK: i2sBCLK, LRCLK: i2sLRCLK, Data: i2sData, LeftHigh: leftHigh})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded [][2]uint32
+		for _, f := range got {
+			decoded = append(decoded, [2]uint32{f.Left, f.Right})
+		}
+		if !reflect.DeepEqual(decoded, frames) {
+			t.Errorf("leftHigh=%v: got frames %v, want %v", leftHigh, got, frames)
+		}
+	}
+
+	// 24-bit samples read as 16 bits keep their most significant bits.
+	tr := i2sTrace(24, false, [][2]uint32{{0, 0}, {0x123456, 0xabcdef}})
+	got, err := I2S(&tr.w, I2SConfig{BCLK: i2sBCLK, LRCLK: i2sLRCLK, Data: i2sData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Left != 0x1234 || got[0].Right != 0xabcd {
+		t.Errorf("got frames %v for 24-bit samples, want [left=0x1234 right=0xabcd]", got)
+	}
+}
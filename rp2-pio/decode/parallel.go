@@ -0,0 +1,41 @@
+package decode
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// ParallelConfig selects the pins of a parallel bus with a clock strobe.
+type ParallelConfig struct {
+	Clock uint8
+	// DataBase is the first of Width consecutive data pins, least significant bit first.
+	DataBase, Width uint8
+	// Falling latches data on the falling edges of Clock instead of the rising edges.
+	Falling bool
+}
+
+// ParallelWord is a word latched on a parallel bus.
+type ParallelWord struct {
+	// Cycle is the cycle of the latching clock edge.
+	Cycle uint64
+	Data  uint32
+}
+
+func (w ParallelWord) String() string {
+	return fmt.Sprintf("data=%#x", w.Data)
+}
+
+// Parallel decodes the words latched on a parallel bus by its clock strobe.
+func Parallel(w *emu.Waveform, cfg ParallelConfig) ([]ParallelWord, error) {
+	if cfg.Width == 0 || cfg.Width > 32 || int(cfg.DataBase)+int(cfg.Width) > 32 {
+		return nil, errors.New("decode: parallel data pins must be 1 to 32 pins within 0 to 31")
+	}
+	mask := uint32(1<<cfg.Width - 1)
+	var words []ParallelWord
+	for _, s := range latch(w, cfg.Clock, !cfg.Falling) {
+		words = append(words, ParallelWord{Cycle: s.Cycle, Data: s.Levels() >> cfg.DataBase & mask})
+	}
+	return words, nil
+}
@@ -0,0 +1,44 @@
+package decode
+
+import (
+	"reflect"
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// parallelTx writes 4-bit words on pins 1 to 4 with a clock strobe on pin 0, setting up the data
+// with the clock low and raising it for one cycle.
+const parallelTx = `
+.program parallel_tx
+.side_set 1
+	out pins, 4 side 0 [1]
+	nop side 1
+`
+
+func TestParallel(t *testing.T) {
+	data := []uint32{0x3210, 0xfedc}
+	w := emulate(t, parallelTx, 0x1f, func(cfg *pio.StateMachineConfig) {
+		cfg.SetOutPins(1, 4)
+		cfg.SetSidesetPins(0)
+		cfg.SetOutShift(true, true, 16)
+	}, data, 4)
+	for _, falling := range []bool{false, true} {
+		words, err := Parallel(w, ParallelConfig{Clock: 0, DataBase: 1, Width: 4, Falling: falling})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint32
+		for _, word := range words {
+			got = append(got, word.Data)
+		}
+		want := []uint32{0, 1, 2, 3, 0xc, 0xd, 0xe, 0xf}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("falling=%v: got words %#x, want %#x", falling, got, want)
+		}
+	}
+
+	if _, err := Parallel(w, ParallelConfig{DataBase: 30, Width: 4}); err == nil {
+		t.Error("expected an error for data pins beyond 31")
+	}
+}
@@ -0,0 +1,100 @@
+package decode
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// SPIConfig selects the pins and framing of an SPI bus.
+type SPIConfig struct {
+	SCK, SDO, SDI uint8
+	// Mode is the SPI mode, 0 to 3: bit 1 is the clock polarity and bit 0 the clock phase.
+	// Data is latched on the rising edges of SCK in modes 0 and 3 and on the falling edges in
+	// modes 1 and 2.
+	Mode uint8
+	// Bits is the word size, 8 if zero.
+	Bits uint8
+	// LSBFirst selects least significant bit first transfers.
+	LSBFirst bool
+	// UseCS enables framing by the active low chip select pin CS: edges while CS is high are
+	// ignored and releasing CS ends the current word.
+	UseCS bool
+	CS    uint8
+}
+
+// SPIWord is a word transferred on an SPI bus.
+type SPIWord struct {
+	// Cycle is the cycle of the first latching clock edge of the word.
+	Cycle uint64
+	// Bits is the number of bits transferred, less than the word size if chip select was
+	// released or the capture ended mid-word.
+	Bits uint8
+	// SDO and SDI hold the bits latched on each data line.
+	SDO, SDI uint32
+}
+
+func (w SPIWord) String() string {
+	return fmt.Sprintf("sdo=%#x sdi=%#x bits=%d", w.SDO, w.SDI, w.Bits)
+}
+
+// SPI decodes the words transferred on an SPI bus.
+func SPI(w *emu.Waveform, cfg SPIConfig) ([]SPIWord, error) {
+	if cfg.Mode > 3 {
+		return nil, errors.New("decode: SPI mode must be 0 to 3")
+	}
+	if cfg.Bits == 0 {
+		cfg.Bits = 8
+	} else if cfg.Bits > 32 {
+		return nil, errors.New("decode: SPI words are at most 32 bits")
+	}
+	cpol, cpha := cfg.Mode>>1, cfg.Mode&1
+	// session returns the number of times CS was asserted up to cycle, which changes when a
+	// new transfer starts.
+	var selects []uint64
+	if cfg.UseCS {
+		for _, e := range w.Edges(cfg.CS) {
+			if !e.Level {
+				selects = append(selects, e.Cycle)
+			}
+		}
+	}
+	session := func(cycle uint64) int {
+		return sort.Search(len(selects), func(i int) bool { return selects[i] > cycle })
+	}
+
+	var words []SPIWord
+	var cur SPIWord
+	curSession := -1
+	flush := func() {
+		if cur.Bits == 0 {
+			return
+		}
+		words = append(words, cur)
+		cur = SPIWord{}
+	}
+	for _, s := range latch(w, cfg.SCK, cpol == cpha) {
+		if cfg.UseCS {
+			if level(s, cfg.CS) {
+				continue
+			}
+			if n := session(s.Cycle); n != curSession {
+				flush()
+				curSession = n
+			}
+		}
+		if cur.Bits == 0 {
+			cur.Cycle = s.Cycle
+		}
+		cur.SDO = shiftIn(cur.SDO, level(s, cfg.SDO), cur.Bits, cfg.LSBFirst)
+		cur.SDI = shiftIn(cur.SDI, level(s, cfg.SDI), cur.Bits, cfg.LSBFirst)
+		cur.Bits++
+		if cur.Bits == cfg.Bits {
+			flush()
+		}
+	}
+	flush()
+	return words, nil
+}
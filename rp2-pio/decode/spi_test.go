@@ -0,0 +1,105 @@
+package decode
+
+import (
+	"fmt"
+	"testing"
+)
+
+const (
+	spiSCK = 0
+	spiSDO = 1
+	spiSDI = 2
+	spiCS  = 3
+)
+
+// spiTrace synthesizes an SPI transfer of the given number of bits of each of sdo and sdi, with
+// chip select asserted around it.
+func spiTrace(mode uint8, lsbFirst bool, bits uint8, sdo, sdi []uint32) *trace {
+	cpol, cpha := mode>>1 != 0, mode&1 != 0
+	tr := newTrace(1 << spiCS)
+	tr.set(spiSCK, cpol)
+	tr.wait(10)
+	tr.set(spiCS, false)
+	tr.wait(5)
+	for i := range sdo {
+		for j := uint8(0); j < bits; j++ {
+			shift := bits - 1 - j
+			if lsbFirst {
+				shift = j
+			}
+			setData := func() {
+				tr.set(spiSDO, sdo[i]>>shift&1 != 0)
+				tr.set(spiSDI, sdi[i]>>shift&1 != 0)
+			}
+			if !cpha {
+				setData()
+				tr.wait(4)
+			}
+			tr.set(spiSCK, !cpol) // Leading edge.
+			if cpha {
+				setData()
+			}
+			tr.wait(4)
+			tr.set(spiSCK, cpol) // Trailing edge.
+			if cpha {
+				tr.wait(4)
+			}
+		}
+	}
+	tr.wait(4)
+	tr.set(spiCS, true)
+	tr.wait(10)
+	return tr
+}
+
+func TestSPI(t *testing.T) {
+	sdo, sdi := []uint32{0xa5, 0x01, 0x80}, []uint32{0x3c, 0xfe, 0x7f}
+	for mode := uint8(0); mode < 4; mode++ {
+		for _, lsbFirst := range []bool{false, true} {
+			t.Run(fmt.Sprintf("mode%d/lsb=%v", mode, lsbFirst), func(t *testing.T) {
+				tr := spiTrace(mode, lsbFirst, 8, sdo, sdi)
+				words, err := SPI(&tr.w, SPIConfig{SCK: spiSCK, SDO: spiSDO, SDI: spiSDI, Mode: mode, LSBFirst: lsbFirst, UseCS: true, CS: spiCS})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(words) != len(sdo) {
+					t.Fatalf("got %d words %v, want %d", len(words), words, len(sdo))
+				}
+				for i, w := range words {
+					if w.SDO != sdo[i] || w.SDI != sdi[i] || w.Bits != 8 {
+						t.Errorf("word %d: got %v, want sdo=%#x sdi=%#x bits=8", i, w, sdo[i], sdi[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSPIChipSelect(t *testing.T) {
+	// 12 bits in one transfer make a full word and a partial one, then a second transfer starts
+	// a new word.
+	tr := spiTrace(0, false, 12, []uint32{0xabc}, []uint32{0})
+	second := spiTrace(0, false, 8, []uint32{0x5a}, []uint32{0})
+	for _, s := range second.w.Samples[1:] {
+		s.Cycle += tr.w.End
+		tr.w.Samples = append(tr.w.Samples, s)
+	}
+	tr.w.End += second.w.End
+	words, err := SPI(&tr.w, SPIConfig{SCK: spiSCK, SDO: spiSDO, SDI: spiSDI, UseCS: true, CS: spiCS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SPIWord{{SDO: 0xab, Bits: 8}, {SDO: 0xc, Bits: 4}, {SDO: 0x5a, Bits: 8}}
+	if len(words) != len(want) {
+		t.Fatalf("got words %v, want %v", words, want)
+	}
+	for i, w := range words {
+		if w.SDO != want[i].SDO || w.Bits != want[i].Bits {
+			t.Errorf("word %d: got %v, want %v", i, w, want[i])
+		}
+	}
+
+	if _, err := SPI(&tr.w, SPIConfig{Mode: 4}); err == nil {
+		t.Error("expected an error for SPI mode 4")
+	}
+}
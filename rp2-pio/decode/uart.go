@@ -0,0 +1,123 @@
+package decode
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// Parity is the parity bit setting of a UART.
+type Parity uint8
+
+const (
+	ParityNone Parity = iota
+	ParityEven
+	ParityOdd
+)
+
+// UARTConfig selects the pin and framing of a UART line.
+type UARTConfig struct {
+	Pin  uint8
+	Baud uint32
+	// DataBits is the number of data bits, 8 if zero.
+	DataBits uint8
+	Parity   Parity
+	// StopBits is the number of stop bits, 1 if zero.
+	StopBits uint8
+}
+
+// UARTFrame is a character received on a UART line.
+type UARTFrame struct {
+	// Cycle is the cycle of the falling edge of the start bit.
+	Cycle uint64
+	Data  uint16
+	// ParityError is set when the parity bit does not match the data.
+	ParityError bool
+	// FramingError is set when a stop bit was low.
+	FramingError bool
+}
+
+func (f UARTFrame) String() string {
+	s := fmt.Sprintf("data=%#02x", f.Data)
+	if f.ParityError {
+		s += " parity-error"
+	}
+	if f.FramingError {
+		s += " framing-error"
+	}
+	return s
+}
+
+// UART decodes the characters received on an idle high UART line, sampling each bit in its middle.
+// A start bit that is high again at its middle is treated as a glitch. Characters cut short by the
+// end of the capture are dropped.
+func UART(w *emu.Waveform, cfg UARTConfig) ([]UARTFrame, error) {
+	if w.SysClockHz == 0 {
+		return nil, errNoClock
+	}
+	if cfg.Baud == 0 || cfg.Baud > w.SysClockHz {
+		return nil, errors.New("decode: UART baud rate must be between 1 and the system clock frequency")
+	}
+	if cfg.DataBits == 0 {
+		cfg.DataBits = 8
+	} else if cfg.DataBits > 16 {
+		return nil, errors.New("decode: UART characters are at most 16 bits")
+	}
+	if cfg.Parity > ParityOdd {
+		return nil, errors.New("decode: invalid UART parity")
+	}
+	if cfg.StopBits == 0 {
+		cfg.StopBits = 1
+	}
+	bitCycles := float64(w.SysClockHz) / float64(cfg.Baud)
+	nbits := 1 + int(cfg.DataBits) + int(cfg.StopBits)
+	if cfg.Parity != ParityNone {
+		nbits++
+	}
+
+	var frames []UARTFrame
+	var resume uint64
+	edges := w.Edges(cfg.Pin)
+	for i := 1; i < len(edges); i++ { // The first edge is the initial level.
+		e := edges[i]
+		if e.Level || e.Cycle < resume {
+			continue
+		}
+		// sample returns the level in the middle of a bit, counting the start bit as 0.
+		sample := func(bit int) bool {
+			return level(w.At(e.Cycle+uint64((float64(bit)+0.5)*bitCycles)), cfg.Pin)
+		}
+		last := e.Cycle + uint64((float64(nbits)-0.5)*bitCycles)
+		if last >= w.End {
+			break
+		}
+		if sample(0) {
+			continue
+		}
+		f := UARTFrame{Cycle: e.Cycle}
+		ones := 0
+		for i := 0; i < int(cfg.DataBits); i++ {
+			if sample(1 + i) {
+				f.Data |= 1 << i
+				ones++
+			}
+		}
+		bit := 1 + int(cfg.DataBits)
+		if cfg.Parity != ParityNone {
+			if sample(bit) {
+				ones++
+			}
+			f.ParityError = (ones%2 == 1) != (cfg.Parity == ParityOdd)
+			bit++
+		}
+		for ; bit < nbits; bit++ {
+			if !sample(bit) {
+				f.FramingError = true
+			}
+		}
+		frames = append(frames, f)
+		resume = last
+	}
+	return frames, nil
+}
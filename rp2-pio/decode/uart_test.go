@@ -0,0 +1,81 @@
+package decode
+
+import (
+	"reflect"
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// uartTx is the pico-examples 8n1 UART transmitter, running at 8 cycles per bit.
+const uartTx = `
+.program uart_tx
+.side_set 1 opt
+	pull side 1 [7]
+	set x, 7 side 0 [7]
+bitloop:
+	out pins, 1
+	jmp x-- bitloop [6]
+`
+
+func TestUART(t *testing.T) {
+	const baud = 115200
+	data := []uint32{0x55, 0x00, 0xff, 'A'}
+	w := emulate(t, uartTx, 1, func(cfg *pio.StateMachineConfig) {
+		cfg.SetOutPins(0, 1)
+		cfg.SetSidesetPins(0)
+		cfg.SetOutShift(true, false, 32)
+		whole, frac, err := pio.ClkDivFromFrequency(8*baud, testClockHz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.SetClkDivIntFrac(whole, frac)
+	}, data, testClockHz/baud*2)
+	frames, err := UART(w, UARTConfig{Pin: 0, Baud: baud})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []uint32
+	for _, f := range frames {
+		if f.ParityError || f.FramingError {
+			t.Errorf("got frame %v, want no errors", f)
+		}
+		got = append(got, uint32(f.Data))
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("got bytes %#x, want %#x", got, data)
+	}
+}
+
+func TestUARTErrors(t *testing.T) {
+	// 7 data bits with even parity: 0x41 is sent with a wrong parity bit, 0x03 with a low stop
+	// bit, and a 1-cycle glitch precedes them. Bits are 10 cycles long.
+	tr := newTrace(1)
+	tr.wait(20)
+	tr.set(0, false)
+	tr.wait(1)
+	tr.set(0, true)
+	tr.wait(20)
+	send := func(bits ...bool) {
+		for _, b := range bits {
+			tr.set(0, b)
+			tr.wait(10)
+		}
+	}
+	send(false, true, false, false, false, false, false, true, true, true)   // 0x41, parity 1.
+	send(false, true, true, false, false, false, false, false, false, false) // 0x03, stop 0.
+	tr.set(0, true)
+	tr.wait(30)
+	frames, err := UART(&tr.w, UARTConfig{Pin: 0, Baud: testClockHz / 10, DataBits: 7, Parity: ParityEven})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []UARTFrame{{Cycle: 41, Data: 0x41, ParityError: true}, {Cycle: 141, Data: 0x03, FramingError: true}}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("got frames %v, want %v", frames, want)
+	}
+
+	if _, err := UART(&tr.w, UARTConfig{Pin: 0}); err == nil {
+		t.Error("expected an error for a zero baud rate")
+	}
+}
@@ -0,0 +1,93 @@
+package decode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// WS2812Config selects the data pin and timing thresholds of a WS2812 LED strip.
+type WS2812Config struct {
+	Pin uint8
+	// Threshold separates 0 bits from 1 bits by the length of their high pulse, 625ns if zero.
+	Threshold time.Duration
+	// Reset is the low time latching a frame, 50µs if zero.
+	Reset time.Duration
+}
+
+// WS2812Pixel is the colour sent to one LED.
+type WS2812Pixel struct {
+	// Cycle is the cycle of the rising edge starting the first bit of the pixel.
+	Cycle uint64
+	// Frame counts the resets before the pixel.
+	Frame int
+	// GRB holds the colour in transmission order, green in bits 23:16.
+	GRB uint32
+	// Bits is 24, or less if the frame ended mid-pixel.
+	Bits uint8
+}
+
+// RGB returns the colour of the pixel.
+func (p WS2812Pixel) RGB() (r, g, b uint8) {
+	return uint8(p.GRB >> 8), uint8(p.GRB >> 16), uint8(p.GRB)
+}
+
+func (p WS2812Pixel) String() string {
+	r, g, b := p.RGB()
+	s := fmt.Sprintf("frame=%d rgb=#%02x%02x%02x", p.Frame, r, g, b)
+	if p.Bits != 24 {
+		s += fmt.Sprintf(" bits=%d", p.Bits)
+	}
+	return s
+}
+
+// WS2812 decodes the colours sent to a WS2812 LED strip.
+func WS2812(w *emu.Waveform, cfg WS2812Config) ([]WS2812Pixel, error) {
+	if w.SysClockHz == 0 {
+		return nil, errNoClock
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = 625 * time.Nanosecond
+	}
+	if cfg.Reset == 0 {
+		cfg.Reset = 50 * time.Microsecond
+	}
+	var pixels []WS2812Pixel
+	var cur WS2812Pixel
+	frame := 0
+	flush := func() {
+		if cur.Bits != 0 {
+			pixels = append(pixels, cur)
+		}
+		cur = WS2812Pixel{Frame: frame}
+	}
+	edges := w.Edges(cfg.Pin)
+	for i := 1; i < len(edges); i++ {
+		rise := edges[i]
+		if !rise.Level {
+			continue
+		}
+		if i > 1 && w.Time(rise.Cycle)-w.Time(edges[i-1].Cycle) >= cfg.Reset {
+			flush()
+			if len(pixels) > 0 {
+				frame++
+				cur.Frame = frame
+			}
+		}
+		if i+1 == len(edges) {
+			break // The capture ended during the high pulse.
+		}
+		high := w.Time(edges[i+1].Cycle) - w.Time(rise.Cycle)
+		if cur.Bits == 0 {
+			cur.Cycle = rise.Cycle
+		}
+		cur.GRB = shiftIn(cur.GRB, high > cfg.Threshold, cur.Bits, false)
+		cur.Bits++
+		if cur.Bits == 24 {
+			flush()
+		}
+	}
+	flush()
+	return pixels, nil
+}
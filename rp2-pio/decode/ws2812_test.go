@@ -0,0 +1,58 @@
+package decode
+
+import (
+	"fmt"
+	"testing"
+)
+
+// ws2812Trace synthesizes frames of GRB pixels on pin 0 with the datasheet bit timings at 125 MHz:
+// 0 bits are high for 400ns and 1 bits for 800ns out of 1.25µs, and frames are separated by 60µs.
+func ws2812Trace(frames [][]uint32) *trace {
+	tr := newTrace(0)
+	tr.wait(100)
+	for _, pixels := range frames {
+		for _, grb := range pixels {
+			for i := 23; i >= 0; i-- {
+				high := uint64(50)
+				if grb>>i&1 != 0 {
+					high = 100
+				}
+				tr.set(0, true)
+				tr.wait(high)
+				tr.set(0, false)
+				tr.wait(156 - high)
+			}
+		}
+		tr.wait(7500)
+	}
+	return tr
+}
+
+func TestWS2812(t *testing.T) {
+	frames := [][]uint32{{0xff0000, 0x00ff00, 0x0000ff}, {0x123456}}
+	tr := ws2812Trace(frames)
+	pixels, err := WS2812(&tr.w, WS2812Config{Pin: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want []string
+	for _, p := range pixels {
+		got = append(got, p.String())
+	}
+	for i, pixels := range frames {
+		for _, grb := range pixels {
+			want = append(want, WS2812Pixel{Frame: i, GRB: grb, Bits: 24}.String())
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got pixels %v, want %v", got, want)
+	}
+	if r, g, b := pixels[0].RGB(); r != 0 || g != 0xff || b != 0 {
+		t.Errorf("got RGB %#x %#x %#x for GRB 0xff0000, want green", r, g, b)
+	}
+
+	tr.w.SysClockHz = 0
+	if _, err := WS2812(&tr.w, WS2812Config{}); err == nil {
+		t.Error("expected an error for a waveform without a system clock")
+	}
+}
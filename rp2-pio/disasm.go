@@ -0,0 +1,38 @@
+package pio
+
+// Disassembler converts encoded PIO instructions back into pioasm syntax.
+// The output is formatted like the listings pioasm emits in generated code
+// and can be parsed back with [ParseAssembly].
+type Disassembler struct {
+	// SidesetBits is the number of side-set value bits, not including the optional enable bit.
+	SidesetBits uint8
+	// SidesetOptional is true if the side-set field has an enable bit in its most significant position.
+	SidesetOptional bool
+	// PIOVersion selects the instruction set. Version 0 (RP2040) reports version 1 (RP2350) encodings as reserved.
+	PIOVersion uint8
+}
+
+// Disassembler returns a disassembler for instructions encoded by asm.
+func (asm AssemblerV0) Disassembler() Disassembler {
+	return Disassembler{SidesetBits: asm.SidesetBits, SidesetOptional: asm.SidesetOptional}
+}
+
+// Disassembler returns a disassembler for instructions encoded by asm.
+func (asm AssemblerV1) Disassembler() Disassembler {
+	return Disassembler{SidesetBits: asm.SidesetBits, SidesetOptional: asm.SidesetOptional, PIOVersion: 1}
+}
+
+// Disassembler returns a disassembler matching the program's side-set configuration and PIO version.
+func (p *AssembledProgram) Disassembler() Disassembler {
+	return Disassembler{SidesetBits: p.SidesetBits, SidesetOptional: p.SidesetOptional, PIOVersion: p.PIOVersion}
+}
+
+// Disassemble returns the pioasm representation of instr, including side-set and delay,
+// or "reserved" if instr is a reserved encoding for the disassembler's PIO version.
+func (d Disassembler) Disassemble(instr uint16) string {
+	var in Instruction
+	if err := in.Decode(instr, d.SidesetBits, d.SidesetOptional, d.PIOVersion); err != nil {
+		return "reserved"
+	}
+	return in.String()
+}
@@ -0,0 +1,93 @@
+package pio
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	asm0 := AssemblerV0{SidesetBits: 0}
+	asm1 := AssemblerV0{SidesetBits: 1}
+	asm2 := AssemblerV0{SidesetBits: 2}
+	v1 := AssemblerV1{SidesetBits: 0}
+	v1side := AssemblerV1{SidesetBits: 1}
+	opt := Disassembler{SidesetBits: 1, SidesetOptional: true}
+	var tests = []struct {
+		dis    Disassembler
+		instr  uint16
+		expect string
+	}{
+		{asm0.Disassembler(), asm0.Set(SetDestPindirs, 1).Encode(), "set    pindirs, 1"},
+		{asm0.Disassembler(), asm0.Pull(false, true).Encode(), "pull   block"},
+		{asm0.Disassembler(), asm0.Pull(true, true).Encode(), "pull   ifempty block"},
+		{asm0.Disassembler(), asm0.Push(true, false).Encode(), "push   iffull noblock"},
+		{asm0.Disassembler(), asm0.Mov(MovDestX, MovSrcOSR).Encode(), "mov    x, osr"},
+		{asm0.Disassembler(), asm0.MovInvert(MovDestISR, MovSrcX).Encode(), "mov    isr, !x"},
+		{asm0.Disassembler(), asm0.MovReverse(MovDestPins, MovSrcStatus).Encode(), "mov    pins, ::status"},
+		{asm0.Disassembler(), asm0.Set(SetDestPins, 1).Delay(1).Encode(), "set    pins, 1                [1]"},
+		{asm0.Disassembler(), asm0.Jmp(JmpXNZeroDec, 3).Encode(), "jmp    x--, 3"},
+		{asm0.Disassembler(), asm0.Jmp(JmpXNotEqualY, 3).Encode(), "jmp    x != y, 3"},
+		{asm0.Disassembler(), asm0.Jmp(JmpAlways, 6).Delay(2).Encode(), "jmp    6                      [2]"},
+		{asm0.Disassembler(), asm0.Jmp(JmpOSRNotEmpty, 1).Delay(31).Encode(), "jmp    !osre, 1               [31]"},
+		{asm0.Disassembler(), asm0.Out(OutDestY, 32).Encode(), "out    y, 32"},
+		{asm0.Disassembler(), asm0.In(InSrcNull, 7).Encode(), "in     null, 7"},
+		{asm0.Disassembler(), asm0.WaitGPIO(false, 20).Encode(), "wait   0 gpio, 20"},
+		{asm0.Disassembler(), asm0.WaitIRQ(true, true, 3).Encode(), "wait   1 irq, 3 rel"},
+		{asm0.Disassembler(), asm0.IRQWait(false, 2).Encode(), "irq    wait 2"},
+		{asm0.Disassembler(), asm0.IRQClear(true, 1).Encode(), "irq    clear 1 rel"},
+		{asm1.Disassembler(), asm1.Out(OutDestPins, 1).Side(0).Encode(), "out    pins, 1         side 0"},
+		{asm1.Disassembler(), asm1.Nop().Side(0).Encode(), "nop                    side 0"},
+		{asm1.Disassembler(), asm1.WaitPin(true, 0).Side(0).Encode(), "wait   1 pin, 0        side 0"},
+		{asm1.Disassembler(), asm1.IRQSet(false, 0).Side(0).Encode(), "irq    nowait 0        side 0"},
+		{asm1.Disassembler(), asm1.In(InSrcPins, 1).Side(1).Delay(1).Encode(), "in     pins, 1         side 1 [1]"},
+		{asm2.Disassembler(), asm2.Jmp(JmpXNZeroDec, 0).Side(3).Encode(), "jmp    x--, 0          side 3"},
+		{asm2.Disassembler(), asm2.Set(SetDestX, 14).Side(1).Delay(7).Encode(), "set    x, 14           side 1 [7]"},
+		{opt, 0xfb27, "set    x, 7            side 1 [3]"},
+		{opt, 0xa742, "nop                           [7]"},
+		{v1.Disassembler(), v1.MovOSRFromRx(true, 2).Encode(), "mov    osr, rxfifo[2]"},
+		{v1.Disassembler(), v1.MovISRToRx(false, 0).Encode(), "mov    rxfifo[y], isr"},
+		{v1.Disassembler(), v1.Mov(MovDestPindirs, MovSrcNull).Encode(), "mov    pindirs, null"},
+		{v1.Disassembler(), v1.IRQSet(3, IRQNext).Encode(), "irq    next nowait 3"},
+		{v1.Disassembler(), v1.IRQClear(1, IRQPrev).Encode(), "irq    prev clear 1"},
+		{v1.Disassembler(), v1.IRQWait(1, IRQRel).Encode(), "irq    wait 1 rel"},
+		{v1.Disassembler(), v1.WaitIRQMode(false, 4, IRQPrev).Encode(), "wait   0 irq, prev 4"},
+		{v1.Disassembler(), v1.WaitJmpPin(true, 2).Encode(), "wait   1 jmppin + 2"},
+		{v1side.Disassembler(), v1side.MovOSRFromRx(false, 0).Side(0).Encode(), "mov    osr, rxfifo[y]  side 0"},
+		{v1side.Disassembler(), v1side.Set(SetDestX, 31).Side(0).Delay(15).Encode(), "set    x, 31           side 0 [15]"},
+		// Version 1 encodings and reserved encodings.
+		{asm0.Disassembler(), v1.MovISRToRx(true, 1).Encode(), "reserved"},
+		{asm0.Disassembler(), v1.Mov(MovDestPindirs, MovSrcNull).Encode(), "reserved"},
+		{asm0.Disassembler(), v1.IRQSet(3, IRQNext).Encode(), "reserved"},
+		{asm0.Disassembler(), v1.WaitJmpPin(true, 0).Encode(), "reserved"},
+		{v1.Disassembler(), asm0.In(4, 1).Encode(), "reserved"},
+		{v1.Disassembler(), asm0.Set(3, 1).Encode(), "reserved"},
+		{v1.Disassembler(), asm0.Mov(MovDestX, 4).Encode(), "reserved"},
+		{v1.Disassembler(), 0xc080, "reserved"}, // irq with bit 7 set.
+	}
+	for _, test := range tests {
+		got := test.dis.Disassemble(test.instr)
+		if got != test.expect {
+			t.Errorf("%#04x: got!=expected: %q != %q", test.instr, got, test.expect)
+			continue
+		}
+		if got == "reserved" {
+			continue
+		}
+		// Round trip through the parser.
+		src := ".pio_version " + strconv.Itoa(int(test.dis.PIOVersion)) + "\n.program t\n"
+		if test.dis.SidesetBits > 0 {
+			src += ".side_set " + strconv.Itoa(int(test.dis.SidesetBits))
+			if test.dis.SidesetOptional {
+				src += " opt"
+			}
+			src += "\n"
+		}
+		src += got + "\n"
+		parsed, err := ParseAssembly([]byte(src))
+		if err != nil {
+			t.Errorf("%q: %s", got, err)
+		} else if parsed.Programs[0].Instructions[0] != test.instr {
+			t.Errorf("%q: round trip got!=expected: %#04x != %#04x", got, parsed.Programs[0].Instructions[0], test.instr)
+		}
+	}
+}
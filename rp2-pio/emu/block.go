@@ -0,0 +1,333 @@
+package emu
+
+import (
+	"errors"
+	"fmt"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+var errOutOfProgramSpace = errors.New("emu: out of program space")
+
+// Block is an emulated PIO block: four state machines sharing instruction memory, the IRQ flags
+// and the GPIOs. Its methods mirror those of [pio.PIO] and its registers.
+//
+// All state machines of a block advance in lockstep with [Block.Step]. Within a cycle they sample
+// the pins and IRQ flags as they were at the start of the cycle, IRQ flags set or cleared by one
+// state machine become visible to the others on the next cycle and when several state machines
+// write the same pin the highest numbered one wins, as on hardware.
+type Block struct {
+	version uint8
+	index   uint8
+	sys     *System
+	mem     [32]uint16
+	used    uint32 // Instruction memory allocated by AddProgram.
+	irq     irqFlags
+	pins    *Pins
+	sm      [4]StateMachine
+}
+
+// irqFlags holds the IRQ flags of a block along with the changes made during the current cycle.
+type irqFlags struct {
+	flags    uint8
+	set, clr uint8
+}
+
+// test reports whether the flag bit was set at the start of the cycle. A nil irq reads as clear.
+func (irq *irqFlags) test(bit uint8) bool { return irq != nil && irq.flags&bit != 0 }
+
+// raise sets bit at the end of the cycle.
+func (irq *irqFlags) raise(bit uint8) {
+	if irq != nil {
+		irq.set |= bit
+	}
+}
+
+// lower clears bit at the end of the cycle.
+func (irq *irqFlags) lower(bit uint8) {
+	if irq != nil {
+		irq.clr |= bit
+	}
+}
+
+// commit applies the changes made during the cycle. A flag both set and cleared ends up set.
+func (irq *irqFlags) commit() {
+	irq.flags = irq.flags&^irq.clr | irq.set
+	irq.set, irq.clr = 0, 0
+}
+
+// NewBlock returns a PIO block emulating the given PIO version, 0 for RP2040 and 1 for RP2350,
+// with cleared instruction memory, its own pins and all state machines disabled.
+func NewBlock(version uint8) *Block {
+	return newBlock(version, 0, nil, new(Pins))
+}
+
+func newBlock(version, index uint8, sys *System, pins *Pins) *Block {
+	b := &Block{version: version, index: index, sys: sys, pins: pins}
+	for i := range b.sm {
+		b.sm[i].reset(b, uint8(i))
+	}
+	return b
+}
+
+// Version returns the emulated PIO version.
+func (b *Block) Version() uint8 { return b.version }
+
+// BlockIndex returns 0, 1 or 2 depending on the position of the block in its [System].
+func (b *Block) BlockIndex() uint8 { return b.index }
+
+// StateMachine returns the state machine with the given index, 0 to 3.
+func (b *Block) StateMachine(index uint8) *StateMachine {
+	if index > 3 {
+		panic("emu: invalid state machine index")
+	}
+	return &b.sm[index]
+}
+
+// Memory returns the instruction memory shared by the state machines.
+func (b *Block) Memory() *[32]uint16 { return &b.mem }
+
+// Pins returns the GPIOs the state machines read and drive.
+func (b *Block) Pins() *Pins { return b.pins }
+
+// AddProgram mirrors [pio.PIO.AddProgram]: it loads instructions at origin, or at the highest free
+// offset if origin is -1, relocating jumps, and returns the offset the program was loaded at.
+func (b *Block) AddProgram(instructions []uint16, origin int8) (offset uint8, err error) {
+	if v := pio.RequiredPIOVersion(instructions); v > b.version {
+		return 0, fmt.Errorf("%w, emulating version %d", pio.ErrRequiresV1, b.version)
+	}
+	n := len(instructions)
+	if n == 0 || n > len(b.mem) {
+		return 0, errOutOfProgramSpace
+	}
+	mask := uint32(1<<n - 1)
+	fits := func(offset int) bool { return offset+n <= len(b.mem) && b.used&(mask<<offset) == 0 }
+	start := len(b.mem) - n
+	if origin >= 0 {
+		start = int(origin)
+	}
+	for i := start; i >= 0; i-- {
+		if fits(i) {
+			for j, instr := range instructions {
+				b.mem[i+j] = relocate(instr, uint8(i))
+			}
+			b.used |= mask << i
+			return uint8(i), nil
+		}
+		if origin >= 0 {
+			break
+		}
+	}
+	return 0, errOutOfProgramSpace
+}
+
+// GPIOStates returns the output levels driven by the block, as read from the DBG_PADOUT register.
+func (b *Block) GPIOStates() uint32 { return b.pins.Out }
+
+// GPIODirections returns the output enables of the block, as read from the DBG_PADOE register.
+func (b *Block) GPIODirections() uint32 { return b.pins.OE }
+
+// IRQ returns the IRQ flags, as read from the IRQ register.
+func (b *Block) IRQ() uint8 { return b.irq.flags }
+
+// ClearIRQ clears the IRQ flags in irqMask, as a write to the IRQ register.
+func (b *Block) ClearIRQ(irqMask uint8) { b.irq.flags &^= irqMask }
+
+// ForceIRQ sets the IRQ flags in irqMask, as a write to the IRQ_FORCE register.
+func (b *Block) ForceIRQ(irqMask uint8) { b.irq.flags |= irqMask }
+
+// INTR returns the raw interrupt sources of the block in the layout of the INTR register and
+// [pio.IRQSource]: RX FIFO not empty, TX FIFO not full and the IRQ flags. PIO version 0 only
+// routes IRQ flags 0 to 3 to interrupts.
+func (b *Block) INTR() uint32 {
+	var intr uint32
+	for i := range b.sm {
+		sm := &b.sm[i]
+		if !sm.rx.empty() {
+			intr |= 1 << (pio0_INTR_SM0_RXNEMPTY_Pos + i)
+		}
+		if !sm.tx.full() {
+			intr |= 1 << (pio0_INTR_SM0_TXNFULL_Pos + i)
+		}
+	}
+	flags := uint32(b.irq.flags)
+	if b.version == 0 {
+		flags &= 0xf
+	}
+	return intr | flags<<pio0_INTR_SM0_Pos
+}
+
+// CTRL returns the SM_ENABLE bits of the CTRL register.
+func (b *Block) CTRL() uint32 {
+	var ctrl uint32
+	for i := range b.sm {
+		if b.sm[i].enabled {
+			ctrl |= 1 << (pio0_CTRL_SM_ENABLE_Pos + i)
+		}
+	}
+	return ctrl
+}
+
+// SetCTRL writes the CTRL register: SM_ENABLE sets which state machines run and the SM_RESTART
+// and CLKDIV_RESTART bits restart state machines and their clock dividers.
+//
+// On PIO version 1 the NEXTPREV_SM_ENABLE, NEXTPREV_SM_DISABLE and NEXTPREV_CLKDIV_RESTART bits
+// apply the same operations to the state machines selected by PREV_PIO_MASK and NEXT_PIO_MASK in
+// the neighbouring blocks of the [System], in the same write. State machines started this way run
+// in exact lockstep with each other.
+func (b *Block) SetCTRL(ctrl uint32) {
+	enable := uint8(ctrl>>pio0_CTRL_SM_ENABLE_Pos) & 0xf
+	restart := uint8(ctrl>>pio0_CTRL_SM_RESTART_Pos) & 0xf
+	clkdivRestart := uint8(ctrl>>pio0_CTRL_CLKDIV_RESTART_Pos) & 0xf
+	for i := range b.sm {
+		sm := &b.sm[i]
+		bit := uint8(1) << i
+		if restart&bit != 0 {
+			sm.Restart()
+		}
+		if clkdivRestart&bit != 0 {
+			sm.ClkDivRestart()
+		}
+		sm.SetEnabled(enable&bit != 0)
+	}
+	if b.version == 0 {
+		return
+	}
+	for _, n := range []struct {
+		dir int
+		pos uint8
+	}{{-1, pio0_CTRL_PREV_PIO_MASK_Pos}, {1, pio0_CTRL_NEXT_PIO_MASK_Pos}} {
+		mask := uint8(ctrl>>n.pos) & 0xf
+		nb := b.neighbour(n.dir)
+		if mask == 0 || nb == nil {
+			continue
+		}
+		for i := range nb.sm {
+			sm := &nb.sm[i]
+			if mask&(1<<i) == 0 {
+				continue
+			}
+			if ctrl&pio0_CTRL_NEXTPREV_CLKDIV_RESTART_Msk != 0 {
+				sm.ClkDivRestart()
+			}
+			switch {
+			case ctrl&pio0_CTRL_NEXTPREV_SM_ENABLE_Msk != 0:
+				sm.SetEnabled(true)
+			case ctrl&pio0_CTRL_NEXTPREV_SM_DISABLE_Msk != 0:
+				sm.SetEnabled(false)
+			}
+		}
+	}
+}
+
+// EnableInSync enables the state machines in mask and those in prevMask and nextMask in the
+// previous and next blocks of the [System] with a single CTRL write, restarting their clock
+// dividers so they run in lockstep. prevMask and nextMask require PIO version 1.
+func (b *Block) EnableInSync(prevMask, mask, nextMask uint8) {
+	b.SetCTRL(b.CTRL() | uint32(mask&0xf)<<pio0_CTRL_SM_ENABLE_Pos |
+		uint32(mask&0xf)<<pio0_CTRL_CLKDIV_RESTART_Pos |
+		uint32(prevMask&0xf)<<pio0_CTRL_PREV_PIO_MASK_Pos |
+		uint32(nextMask&0xf)<<pio0_CTRL_NEXT_PIO_MASK_Pos |
+		pio0_CTRL_NEXTPREV_CLKDIV_RESTART_Msk | pio0_CTRL_NEXTPREV_SM_ENABLE_Msk)
+}
+
+// DisableInSync disables the state machines in mask and those in prevMask and nextMask in the
+// previous and next blocks of the [System] with a single CTRL write.
+func (b *Block) DisableInSync(prevMask, mask, nextMask uint8) {
+	b.SetCTRL(b.CTRL()&^(uint32(mask&0xf)<<pio0_CTRL_SM_ENABLE_Pos) |
+		uint32(prevMask&0xf)<<pio0_CTRL_PREV_PIO_MASK_Pos |
+		uint32(nextMask&0xf)<<pio0_CTRL_NEXT_PIO_MASK_Pos |
+		pio0_CTRL_NEXTPREV_SM_DISABLE_Msk)
+}
+
+// Run steps the block by the given number of system clock cycles.
+func (b *Block) Run(cycles int) {
+	for i := 0; i < cycles; i++ {
+		b.Step()
+	}
+}
+
+// Step advances all state machines of the block by one system clock cycle.
+func (b *Block) Step() {
+	b.sample()
+	b.step()
+	b.commit()
+}
+
+func (b *Block) sample() {
+	levels := b.pins.Levels()
+	for i := range b.sm {
+		b.sm[i].levels = levels
+	}
+}
+
+func (b *Block) step() {
+	for i := range b.sm {
+		b.sm[i].step()
+	}
+}
+
+// commit applies the IRQ flag changes of the cycle, including those made to neighbouring blocks.
+func (b *Block) commit() {
+	if b.sys == nil {
+		b.irq.commit()
+		return
+	}
+	for _, nb := range b.sys.blocks {
+		nb.irq.commit()
+	}
+}
+
+// neighbour returns the block dir positions away in the system, wrapping around, or nil if the
+// block is not part of a system.
+func (b *Block) neighbour(dir int) *Block {
+	if b.sys == nil {
+		return nil
+	}
+	n := len(b.sys.blocks)
+	return b.sys.blocks[(int(b.index)+dir+n)%n]
+}
+
+// System is a set of emulated PIO blocks sharing the GPIOs, such as the two PIO blocks of an
+// RP2040 or the three of an RP2350. On PIO version 1, IRQ instructions and waits with the prev
+// and next index modes reach the flags of the neighbouring blocks: the previous block of PIO0 is
+// the last one and the next block of the last one is PIO0.
+type System struct {
+	blocks []*Block
+	pins   Pins
+}
+
+// NewSystem returns a system of n PIO blocks emulating the given PIO version.
+func NewSystem(version uint8, n int) *System {
+	s := &System{blocks: make([]*Block, n)}
+	for i := range s.blocks {
+		s.blocks[i] = newBlock(version, uint8(i), s, &s.pins)
+	}
+	return s
+}
+
+// Block returns the PIO block with the given index.
+func (s *System) Block(index uint8) *Block { return s.blocks[index] }
+
+// Pins returns the GPIOs shared by all blocks.
+func (s *System) Pins() *Pins { return &s.pins }
+
+// Run steps all blocks by the given number of system clock cycles.
+func (s *System) Run(cycles int) {
+	for i := 0; i < cycles; i++ {
+		s.Step()
+	}
+}
+
+// Step advances all state machines of all blocks by one system clock cycle.
+func (s *System) Step() {
+	for _, b := range s.blocks {
+		b.sample()
+	}
+	for _, b := range s.blocks {
+		b.step()
+	}
+	for _, b := range s.blocks {
+		b.irq.commit()
+	}
+}
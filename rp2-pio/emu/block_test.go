@@ -0,0 +1,151 @@
+package emu
+
+import (
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// loadAt loads the first program of src at offset and initializes sm without enabling it.
+func loadAt(t *testing.T, sm *StateMachine, src string, offset uint8) {
+	t.Helper()
+	if err := sm.LoadAndRun(src, offset, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	sm.SetEnabled(false)
+}
+
+func TestBlockIRQ(t *testing.T) {
+	b := NewBlock(0)
+	for i := uint8(0); i < 4; i++ {
+		loadAt(t, b.StateMachine(i), ".program rel\n\tirq set 4 rel", 0)
+	}
+	b.SetCTRL(0xf)
+	b.Step()
+	if got := b.IRQ(); got != 0xf0 {
+		t.Errorf("got IRQ flags %#x after relative IRQ 4 from all state machines, want 0xf0", got)
+	}
+
+	b = NewBlock(0)
+	loadAt(t, b.StateMachine(0), ".program waiter\n\twait 1 irq 2\n\tset x, 1", 0)
+	loadAt(t, b.StateMachine(1), ".program setter\n\tirq set 2\n\tjmp 1", 2)
+	b.SetCTRL(0b11)
+	b.Step()
+	if b.StateMachine(0).PC() != 0 || b.IRQ() != 1<<2 {
+		t.Fatalf("expected IRQ set in the same cycle to become visible on the next, pc %d flags %#x", b.StateMachine(0).PC(), b.IRQ())
+	}
+	b.Step()
+	if b.StateMachine(0).PC() != 1 || b.IRQ() != 0 {
+		t.Fatalf("expected wait to proceed and clear the flag, pc %d flags %#x", b.StateMachine(0).PC(), b.IRQ())
+	}
+
+	b.ForceIRQ(0b1010_0001)
+	if got, want := b.INTR(), uint32(0b0001_1111_0000); got != want {
+		t.Errorf("got INTR %#b, want %#b", got, want)
+	}
+	b.ClearIRQ(0xff)
+	if b.IRQ() != 0 {
+		t.Errorf("expected IRQ flags to be cleared, got %#x", b.IRQ())
+	}
+}
+
+func TestBlockPinPriority(t *testing.T) {
+	b := NewBlock(0)
+	loadAt(t, b.StateMachine(0), ".program high\n\tset pins, 1", 0)
+	loadAt(t, b.StateMachine(2), ".program low\n\tset pins, 0", 1)
+	for _, i := range []uint8{0, 2} {
+		sm := b.StateMachine(i)
+		cfg := sm.Config()
+		cfg.PinCtrl |= 1 << pio0_SM0_PINCTRL_SET_COUNT_Pos
+		sm.SetConfig(cfg)
+	}
+	b.Pins().OE = 1
+	b.SetCTRL(0b101)
+	b.Step()
+	if b.Pins().Out&1 != 0 {
+		t.Error("expected state machine 2 to win the write to pin 0")
+	}
+}
+
+func TestSystemPrevNext(t *testing.T) {
+	s := NewSystem(1, 3)
+	loadAt(t, s.Block(0).StateMachine(0), ".pio_version 1\n.program signal\n\tirq next set 1\n\tirq prev set 3", 0)
+	loadAt(t, s.Block(1).StateMachine(0), ".pio_version 1\n.program follow\n\twait 1 irq 1\n\tirq prev wait 0", 0)
+	s.Block(1).SetCTRL(1)
+	s.Block(0).SetCTRL(1)
+	s.Run(2)
+	if got := s.Block(2).IRQ(); got != 1<<3 {
+		t.Errorf("expected prev of PIO0 to be PIO2, got PIO2 flags %#x", got)
+	}
+	if got := s.Block(1).StateMachine(0).PC(); got != 1 {
+		t.Fatalf("expected PIO1 to see the IRQ set by PIO0, pc %d", got)
+	}
+	s.Step()
+	if s.Block(0).IRQ() != 1 || !s.Block(1).StateMachine(0).Stalled() {
+		t.Fatalf("expected PIO1 to set flag 0 of PIO0 and wait, flags %#x", s.Block(0).IRQ())
+	}
+	s.Block(0).ClearIRQ(1)
+	s.Step()
+	if s.Block(1).StateMachine(0).Stalled() {
+		t.Error("expected irq wait prev to complete once PIO0 flag 0 is cleared")
+	}
+}
+
+func TestSystemMovStatusIRQ(t *testing.T) {
+	s := NewSystem(1, 3)
+	for i, src := range []string{"irq next set 2", "irq prev set 5", "irq set 1"} {
+		sm := s.Block(0).StateMachine(uint8(i))
+		loadAt(t, sm, ".pio_version 1\n.program status\n.mov_status "+src+"\n\tmov x, status", 0)
+		sm.SetX(0x55)
+	}
+	s.Block(1).ForceIRQ(1 << 2)
+	s.Block(2).ForceIRQ(1 << 5)
+	s.Block(0).ForceIRQ(1 << 1)
+	s.Block(0).SetCTRL(0b111)
+	s.Step()
+	for i, want := range []uint32{0xffffffff, 0xffffffff, 0xffffffff} {
+		if got := s.Block(0).StateMachine(uint8(i)).GetX(); got != want {
+			t.Errorf("state machine %d: got x %#x, want %#x", i, got, want)
+		}
+	}
+
+	// Only the flag of the selected block counts.
+	s.Block(1).ClearIRQ(1 << 2)
+	s.Block(0).ForceIRQ(1 << 2)
+	sm := s.Block(0).StateMachine(0)
+	sm.Exec(pio.AssemblerV1{}.Mov(pio.MovDestX, pio.MovSrcStatus).Encode())
+	if got := sm.GetX(); got != 0 {
+		t.Errorf("got x %#x with only flag 2 of this block set, want 0", got)
+	}
+}
+
+func TestSystemEnableInSync(t *testing.T) {
+	s := NewSystem(1, 3)
+	for _, i := range []uint8{0, 1, 2} {
+		loadAt(t, s.Block(i).StateMachine(0), ".program count\n.clock_div 3\n\tjmp y-- 0", 0)
+		s.Block(i).StateMachine(0).SetY(100)
+	}
+	s.Block(1).SetCTRL(1)
+	s.Run(2) // Desynchronize the clock divider of PIO1.
+	s.Block(1).SetCTRL(0)
+
+	s.Block(0).EnableInSync(1<<0, 0, 1<<0)
+	if s.Block(0).CTRL() != 0 || s.Block(1).CTRL() != 1 || s.Block(2).CTRL() != 1 {
+		t.Fatalf("expected only the neighbouring state machines to be enabled, got %d %d %d",
+			s.Block(0).CTRL(), s.Block(1).CTRL(), s.Block(2).CTRL())
+	}
+	s.Run(30)
+	if y1, y2 := s.Block(1).StateMachine(0).GetY(), s.Block(2).StateMachine(0).GetY(); y1 != y2 || y1 != 90 {
+		t.Errorf("expected state machines to run in lockstep, got y %d and %d", y1, y2)
+	}
+	s.Block(0).DisableInSync(1<<0, 0, 1<<0)
+	if s.Block(1).CTRL() != 0 || s.Block(2).CTRL() != 0 {
+		t.Error("expected neighbouring state machines to be disabled")
+	}
+
+	b := NewSystem(0, 2).Block(0)
+	b.EnableInSync(0, 0, 1)
+	if b.neighbour(1).CTRL() != 0 {
+		t.Error("expected PIO version 0 to ignore NEXT_PIO_MASK")
+	}
+}
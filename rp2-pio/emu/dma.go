@@ -0,0 +1,419 @@
+package emu
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Bus is the address space DMA channels transfer through. Accesses are 1, 2 or 4 bytes wide and
+// naturally aligned. An error halts the channel with its READ_ERROR or WRITE_ERROR flag set.
+type Bus interface {
+	Read(addr uint32, size uint8) (uint32, error)
+	Write(addr uint32, size uint8, value uint32) error
+}
+
+// Memory is a [Bus] backed by Data mapped at Base, in the little-endian byte order of the RP2040
+// and RP2350.
+type Memory struct {
+	Base uint32
+	Data []byte
+}
+
+func (m *Memory) slice(addr uint32, size uint8) ([]byte, error) {
+	off := uint64(addr) - uint64(m.Base)
+	if addr < m.Base || off+uint64(size) > uint64(len(m.Data)) {
+		return nil, fmt.Errorf("emu: bus access to unmapped address %#x", addr)
+	}
+	return m.Data[off : off+uint64(size)], nil
+}
+
+func (m *Memory) Read(addr uint32, size uint8) (uint32, error) {
+	b, err := m.slice(addr, size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint32(b[0]), nil
+	case 2:
+		return uint32(binary.LittleEndian.Uint16(b)), nil
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (m *Memory) Write(addr uint32, size uint8, value uint32) error {
+	b, err := m.slice(addr, size)
+	if err != nil {
+		return err
+	}
+	switch size {
+	case 1:
+		b[0] = uint8(value)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(value))
+	default:
+		binary.LittleEndian.PutUint32(b, value)
+	}
+	return nil
+}
+
+// dmaCtrlLayout holds the bit positions of the CTRL_TRIG register fields, which moved between the
+// RP2040 and the RP2350. The *Rev fields are zero on RP2040, which cannot decrement addresses.
+type dmaCtrlLayout struct {
+	incrRead, incrReadRev, incrWrite, incrWriteRev uint8
+	ringSize, ringSel, chainTo, treqSel            uint8
+	irqQuiet, bswap, busy                          uint8
+}
+
+var (
+	dmaCtrlRP2040 = dmaCtrlLayout{incrRead: 4, incrWrite: 5, ringSize: 6, ringSel: 10, chainTo: 11,
+		treqSel: 15, irqQuiet: 21, bswap: 22, busy: 24}
+	dmaCtrlRP2350 = dmaCtrlLayout{incrRead: 4, incrReadRev: 5, incrWrite: 6, incrWriteRev: 7, ringSize: 8,
+		ringSel: 12, chainTo: 13, treqSel: 17, irqQuiet: 23, bswap: 24, busy: 26}
+)
+
+// CTRL_TRIG fields at the same position on both chips.
+const (
+	dma_CTRL_EN_Msk            = 0x1
+	dma_CTRL_HIGH_PRIORITY_Msk = 0x2
+	dma_CTRL_DATA_SIZE_Pos     = 2
+	dma_CTRL_WRITE_ERROR_Msk   = 1 << 29
+	dma_CTRL_READ_ERROR_Msk    = 1 << 30
+	dma_CTRL_AHB_ERROR_Msk     = 1 << 31
+
+	// dma_TREQ_PERMANENT is the TREQ_SEL value for unpaced transfers.
+	dma_TREQ_PERMANENT = 0x3f
+
+	// RP2350 TRANS_COUNT fields.
+	dma_TRANS_COUNT_MODE_Pos          = 28
+	dma_TRANS_COUNT_MODE_TRIGGER_SELF = 0x1
+	dma_TRANS_COUNT_MODE_ENDLESS      = 0xf
+	dma_TRANS_COUNT_COUNT_Msk         = 0x0fffffff
+)
+
+// pioFIFOBase is the address of the TXF0 register of PIO0. The RXF registers follow the TXF ones
+// and each block is 1MiB above the previous one.
+const pioFIFOBase = 0x50200010
+
+// DMA is an emulated DMA controller. Its channels are programmed through the same registers as
+// the hardware ones, with the CTRL_TRIG layout of the emulated chip, and transfer through a
+// [Bus]. Transfers are paced by the DREQ selected with TREQ_SEL: the TX and RX DREQs of the PIO
+// blocks connected with [DMA.ConnectPIO], others registered with [DMA.SetDREQ], or none for the
+// permanent request 0x3f. Other DREQs are never asserted.
+//
+// Each [DMA.Step] is a system clock cycle in which at most one transfer completes, picking high
+// priority channels first and then the others in round robin order. Writes narrower than 32 bits
+// to a PIO TX FIFO are replicated across the word, as the bus fabric does.
+type DMA struct {
+	version  uint8
+	bus      Bus
+	layout   *dmaCtrlLayout
+	channels []DMAChannel
+	dreqs    [dma_TREQ_PERMANENT]func() bool
+	pio      [3]*Block
+	intr     uint32
+	next     int // Channel the round robin starts at.
+}
+
+// DMAChannel is a channel of an emulated DMA controller.
+type DMAChannel struct {
+	dma       *DMA
+	index     uint8
+	readAddr  uint32
+	writeAddr uint32
+	transfers uint32 // TRANS_COUNT as written, reloaded on each trigger.
+	remaining uint32 // TRANS_COUNT as read.
+	ctrl      uint32
+}
+
+// NewDMA returns a DMA controller of the chip with the given PIO version, 0 for the 12 channels of
+// the RP2040 and 1 for the 16 channels of the RP2350, transferring through bus. bus may be nil if
+// the channels only access connected PIO FIFOs.
+func NewDMA(version uint8, bus Bus) *DMA {
+	d := &DMA{version: version, bus: bus, layout: &dmaCtrlRP2040, channels: make([]DMAChannel, 12)}
+	if version > 0 {
+		d.layout, d.channels = &dmaCtrlRP2350, make([]DMAChannel, 16)
+	}
+	for i := range d.channels {
+		ch := &d.channels[i]
+		ch.dma, ch.index = d, uint8(i)
+		ch.ctrl = uint32(i) << d.layout.chainTo // Chaining to itself disables chaining.
+	}
+	return d
+}
+
+// Channel returns the channel with the given index.
+func (d *DMA) Channel(index uint8) *DMAChannel { return &d.channels[index] }
+
+// SetDREQ sets the function reporting whether the DREQ with the given number is asserted.
+func (d *DMA) SetDREQ(dreq uint8, asserted func() bool) {
+	d.dreqs[dreq] = asserted
+}
+
+// ConnectPIO maps the TXF and RXF registers of b at the addresses of its block index and routes
+// its DREQs: the TX DREQ of a state machine is asserted while its TX FIFO is not full and the RX
+// DREQ while its RX FIFO is not empty.
+func (d *DMA) ConnectPIO(b *Block) {
+	d.pio[b.index] = b
+	for i := range b.sm {
+		sm := &b.sm[i]
+		d.SetDREQ(b.index*8+uint8(i), func() bool { return !sm.IsTxFIFOFull() })
+		d.SetDREQ(b.index*8+4+uint8(i), func() bool { return !sm.IsRxFIFOEmpty() })
+	}
+}
+
+// fifo returns the state machine whose TX or RX FIFO register is at addr.
+func (d *DMA) fifo(addr uint32) (sm *StateMachine, rx bool) {
+	off := addr - pioFIFOBase
+	block, reg := off>>20, off&0xfffff
+	if off&3 != 0 || block >= 3 || reg >= 0x20 || d.pio[block] == nil {
+		return nil, false
+	}
+	return &d.pio[block].sm[reg>>2&3], reg >= 0x10
+}
+
+func (d *DMA) read(addr uint32, size uint8) (uint32, error) {
+	if sm, rx := d.fifo(addr &^ 3); sm != nil {
+		if !rx {
+			return 0, fmt.Errorf("emu: DMA read from PIO TX FIFO register %#x", addr)
+		}
+		// A narrow read selects a byte lane of the popped word.
+		return sm.RxGet() >> (8 * (addr & 3)) & (1<<(8*uint32(size)) - 1), nil
+	}
+	if d.bus == nil {
+		return 0, fmt.Errorf("emu: bus access to unmapped address %#x", addr)
+	}
+	return d.bus.Read(addr, size)
+}
+
+func (d *DMA) write(addr uint32, size uint8, value uint32) error {
+	if sm, rx := d.fifo(addr &^ 3); sm != nil {
+		if rx {
+			return fmt.Errorf("emu: DMA write to PIO RX FIFO register %#x", addr)
+		}
+		switch size {
+		case 1:
+			value = value & 0xff * 0x01010101
+		case 2:
+			value = value & 0xffff * 0x00010001
+		}
+		sm.TxPut(value)
+		return nil
+	}
+	if d.bus == nil {
+		return fmt.Errorf("emu: bus access to unmapped address %#x", addr)
+	}
+	return d.bus.Write(addr, size, value)
+}
+
+// Step advances the DMA controller by one system clock cycle, performing at most one transfer.
+func (d *DMA) Step() {
+	n := len(d.channels)
+	for _, high := range []bool{true, false} {
+		for i := 0; i < n; i++ {
+			ch := &d.channels[(d.next+i)%n]
+			if ch.ctrl&dma_CTRL_HIGH_PRIORITY_Msk != 0 == high && ch.ready() {
+				d.next = (int(ch.index) + 1) % n
+				ch.transfer()
+				return
+			}
+		}
+	}
+}
+
+// Stimulus returns a stimulus stepping the DMA controller once per cycle, so that a [Recorder]
+// runs it alongside the PIO blocks it feeds.
+func (d *DMA) Stimulus() Stimulus {
+	return func(cycle uint64, pins *Pins) { d.Step() }
+}
+
+// Abort aborts the transfers of the channels in mask, as a write to the CHAN_ABORT register.
+// Transfers complete within a cycle in the emulation, so the register would read back as 0.
+func (d *DMA) Abort(mask uint32) {
+	for i := range d.channels {
+		if mask&(1<<i) != 0 {
+			d.channels[i].ctrl &^= 1 << d.layout.busy
+		}
+	}
+}
+
+// INTR returns the raw interrupt status of the channels, as read from the INTR register.
+func (d *DMA) INTR() uint32 { return d.intr }
+
+// ClearINTR clears the interrupt flags in mask, as a write to the INTR register.
+func (d *DMA) ClearINTR(mask uint32) { d.intr &^= mask }
+
+// ReadAddr returns the address of the next read, as read from the READ_ADDR register.
+func (ch *DMAChannel) ReadAddr() uint32 { return ch.readAddr }
+
+// SetReadAddr writes the READ_ADDR register.
+func (ch *DMAChannel) SetReadAddr(addr uint32) { ch.readAddr = addr }
+
+// WriteAddr returns the address of the next write, as read from the WRITE_ADDR register.
+func (ch *DMAChannel) WriteAddr() uint32 { return ch.writeAddr }
+
+// SetWriteAddr writes the WRITE_ADDR register.
+func (ch *DMAChannel) SetWriteAddr(addr uint32) { ch.writeAddr = addr }
+
+// TransCount returns the number of transfers left, as read from the TRANS_COUNT register.
+func (ch *DMAChannel) TransCount() uint32 { return ch.remaining }
+
+// SetTransCount writes the TRANS_COUNT register, the number of transfers of the next trigger.
+// On the RP2350 its top 4 bits select the normal, TRIGGER_SELF or ENDLESS mode.
+func (ch *DMAChannel) SetTransCount(count uint32) { ch.transfers = count }
+
+// CTRL returns the CTRL_TRIG register, including the BUSY and error flags.
+func (ch *DMAChannel) CTRL() uint32 { return ch.ctrl }
+
+// SetCTRL writes the control register through its AL1_CTRL alias, which does not trigger the
+// channel. Writing 1 to an error flag clears it.
+func (ch *DMAChannel) SetCTRL(ctrl uint32) {
+	busy := uint32(1) << ch.dma.layout.busy
+	errs := ch.ctrl & (dma_CTRL_READ_ERROR_Msk | dma_CTRL_WRITE_ERROR_Msk) &^ ctrl
+	ch.ctrl = ctrl&^(busy|dma_CTRL_READ_ERROR_Msk|dma_CTRL_WRITE_ERROR_Msk|dma_CTRL_AHB_ERROR_Msk) | ch.ctrl&busy | errs
+	if errs != 0 {
+		ch.ctrl |= dma_CTRL_AHB_ERROR_Msk
+	}
+}
+
+// SetCTRLTrig writes the CTRL_TRIG register, starting the channel if EN is set.
+func (ch *DMAChannel) SetCTRLTrig(ctrl uint32) {
+	ch.SetCTRL(ctrl)
+	ch.trigger()
+}
+
+// Busy reports whether the channel has transfers left, the BUSY flag of CTRL_TRIG.
+func (ch *DMAChannel) Busy() bool { return ch.ctrl&(1<<ch.dma.layout.busy) != 0 }
+
+// Err returns the bus error that halted the channel, or nil.
+func (ch *DMAChannel) Err() error {
+	switch {
+	case ch.ctrl&dma_CTRL_READ_ERROR_Msk != 0:
+		return errDMARead
+	case ch.ctrl&dma_CTRL_WRITE_ERROR_Msk != 0:
+		return errDMAWrite
+	}
+	return nil
+}
+
+var (
+	errDMARead  = errors.New("emu: DMA read bus error")
+	errDMAWrite = errors.New("emu: DMA write bus error")
+)
+
+func (ch *DMAChannel) field(pos, width uint8) uint32 {
+	return ch.ctrl >> pos & (1<<width - 1)
+}
+
+func (ch *DMAChannel) flag(pos uint8) bool {
+	return pos != 0 && ch.ctrl&(1<<pos) != 0
+}
+
+// mode returns the RP2350 TRANS_COUNT mode, always normal on the RP2040.
+func (ch *DMAChannel) mode() uint32 {
+	if ch.dma.version == 0 {
+		return 0
+	}
+	return ch.transfers >> dma_TRANS_COUNT_MODE_Pos
+}
+
+// trigger starts the channel if it is enabled. Triggering with a zero transfer count does nothing.
+func (ch *DMAChannel) trigger() {
+	if ch.ctrl&dma_CTRL_EN_Msk == 0 {
+		return
+	}
+	ch.remaining = ch.transfers
+	if ch.dma.version > 0 {
+		ch.remaining &= dma_TRANS_COUNT_COUNT_Msk
+	}
+	if ch.remaining != 0 || ch.mode() == dma_TRANS_COUNT_MODE_ENDLESS {
+		ch.ctrl |= 1 << ch.dma.layout.busy
+	}
+}
+
+func (ch *DMAChannel) ready() bool {
+	if !ch.Busy() || ch.ctrl&dma_CTRL_EN_Msk == 0 {
+		return false
+	}
+	treq := ch.field(ch.dma.layout.treqSel, 6)
+	if treq == dma_TREQ_PERMANENT {
+		return true
+	}
+	dreq := ch.dma.dreqs[treq]
+	return dreq != nil && dreq()
+}
+
+func (ch *DMAChannel) transfer() {
+	l := ch.dma.layout
+	size := uint8(1) << ch.field(dma_CTRL_DATA_SIZE_Pos, 2)
+	if size > 4 {
+		size = 4
+	}
+	ringBits := ch.field(l.ringSize, 4)
+	ringWrite := ch.flag(l.ringSel)
+	value, err := ch.dma.read(ch.readAddr, size)
+	if err != nil {
+		ch.halt(dma_CTRL_READ_ERROR_Msk)
+		return
+	}
+	if ch.flag(l.bswap) {
+		switch size {
+		case 2:
+			value = uint32(bits.ReverseBytes16(uint16(value)))
+		case 4:
+			value = bits.ReverseBytes32(value)
+		}
+	}
+	if err := ch.dma.write(ch.writeAddr, size, value); err != nil {
+		ch.halt(dma_CTRL_WRITE_ERROR_Msk)
+		return
+	}
+	ch.readAddr = advance(ch.readAddr, size, ch.flag(l.incrRead), ch.flag(l.incrReadRev), ringBits, !ringWrite)
+	ch.writeAddr = advance(ch.writeAddr, size, ch.flag(l.incrWrite), ch.flag(l.incrWriteRev), ringBits, ringWrite)
+	if ch.mode() == dma_TRANS_COUNT_MODE_ENDLESS {
+		return
+	}
+	ch.remaining--
+	if ch.remaining == 0 {
+		ch.complete()
+	}
+}
+
+// advance returns the address following addr, wrapping within the 1<<ringBits byte ring if ring
+// is set. On RP2350 setting rev along with incr decrements the address.
+func advance(addr uint32, size uint8, incr, rev bool, ringBits uint32, ring bool) uint32 {
+	if !incr {
+		return addr
+	}
+	next := addr + uint32(size)
+	if rev {
+		next = addr - uint32(size)
+	}
+	if ring && ringBits != 0 {
+		mask := uint32(1)<<ringBits - 1
+		next = addr&^mask | next&mask
+	}
+	return next
+}
+
+// complete ends the transfers of the channel, raising its interrupt and triggering the channel
+// it chains to.
+func (ch *DMAChannel) complete() {
+	ch.ctrl &^= 1 << ch.dma.layout.busy
+	if !ch.flag(ch.dma.layout.irqQuiet) {
+		ch.dma.intr |= 1 << ch.index
+	}
+	if ch.mode() == dma_TRANS_COUNT_MODE_TRIGGER_SELF {
+		ch.trigger()
+	}
+	if chain := uint8(ch.field(ch.dma.layout.chainTo, 4)); chain != ch.index && int(chain) < len(ch.dma.channels) {
+		ch.dma.channels[chain].trigger()
+	}
+}
+
+// halt stops the channel on a bus error.
+func (ch *DMAChannel) halt(errFlag uint32) {
+	ch.ctrl = ch.ctrl&^(1<<ch.dma.layout.busy) | errFlag | dma_CTRL_AHB_ERROR_Msk
+}
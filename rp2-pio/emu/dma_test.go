@@ -0,0 +1,184 @@
+package emu
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// ctrlFields describes a CTRL_TRIG value, encoded with the layout of a chip by value.
+type ctrlFields struct {
+	size                     uint32 // 0 for bytes, 1 for halfwords, 2 for words.
+	incrRead, incrWrite, rev bool
+	ringSize                 uint32
+	ringWrite, bswap, quiet  bool
+	chainTo                  uint32
+	paced                    bool // Pace by treq rather than the permanent request.
+	treq                     uint32
+}
+
+func (f ctrlFields) value(d *DMA, channel uint8) uint32 {
+	l := d.layout
+	flag := func(set bool, pos uint8) uint32 {
+		if set {
+			return 1 << pos
+		}
+		return 0
+	}
+	treq := f.treq
+	if !f.paced {
+		treq = dma_TREQ_PERMANENT
+	}
+	chain := f.chainTo
+	if chain == 0 {
+		chain = uint32(channel)
+	}
+	return dma_CTRL_EN_Msk | f.size<<dma_CTRL_DATA_SIZE_Pos |
+		flag(f.incrRead, l.incrRead) | flag(f.incrWrite, l.incrWrite) |
+		flag(f.rev && f.incrRead, l.incrReadRev) | flag(f.rev && f.incrWrite, l.incrWriteRev) |
+		f.ringSize<<l.ringSize | flag(f.ringWrite, l.ringSel) | chain<<l.chainTo | treq<<l.treqSel |
+		flag(f.quiet, l.irqQuiet) | flag(f.bswap, l.bswap)
+}
+
+func start(d *DMA, channel uint8, read, write, count uint32, f ctrlFields) {
+	ch := d.Channel(channel)
+	ch.SetReadAddr(read)
+	ch.SetWriteAddr(write)
+	ch.SetTransCount(count)
+	ch.SetCTRLTrig(f.value(d, channel))
+}
+
+func TestDMAMemoryTransfers(t *testing.T) {
+	const base = 0x20000000
+	for _, test := range []struct {
+		name    string
+		version uint8
+		count   uint32
+		read    uint32 // Offset of the first read.
+		ctrl    ctrlFields
+		want    []byte // Destination after the transfers.
+	}{
+		{"words", 0, 2, 0, ctrlFields{size: 2, incrRead: true, incrWrite: true},
+			[]byte{0, 1, 2, 3, 4, 5, 6, 7, 0, 0}},
+		{"halfwords bswap", 0, 2, 0, ctrlFields{size: 1, incrRead: true, incrWrite: true, bswap: true},
+			[]byte{1, 0, 3, 2, 0, 0, 0, 0, 0, 0}},
+		{"read ring", 0, 5, 0, ctrlFields{size: 1, incrRead: true, incrWrite: true, ringSize: 2},
+			[]byte{0, 1, 2, 3, 0, 1, 2, 3, 0, 1}},
+		{"no write increment", 0, 3, 0, ctrlFields{size: 0, incrRead: true}, []byte{2, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"reverse", 1, 4, 3, ctrlFields{size: 0, incrRead: true, rev: true}, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"words rp2350", 1, 1, 4, ctrlFields{size: 2, incrRead: true, incrWrite: true, bswap: true},
+			[]byte{7, 6, 5, 4, 0, 0, 0, 0, 0, 0}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mem := &Memory{Base: base, Data: make([]byte, 32)}
+			for i := 0; i < 16; i++ {
+				mem.Data[i] = byte(i)
+			}
+			d := NewDMA(test.version, mem)
+			start(d, 0, base+test.read, base+16, test.count, test.ctrl)
+			for i := 0; i < 20; i++ {
+				d.Step()
+			}
+			ch := d.Channel(0)
+			if ch.Busy() || ch.TransCount() != 0 || d.INTR() != 1 {
+				t.Fatalf("got busy %t count %d INTR %#x after the transfers", ch.Busy(), ch.TransCount(), d.INTR())
+			}
+			if got := mem.Data[16:26]; string(got) != string(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+	// Reverse reads walk down the source.
+	mem := &Memory{Base: base, Data: []byte{0, 1, 2, 3, 0}}
+	d := NewDMA(1, mem)
+	start(d, 0, base+3, base+4, 4, ctrlFields{size: 0, incrRead: true, rev: true})
+	d.Step()
+	d.Step()
+	if ch := d.Channel(0); ch.ReadAddr() != base+1 || mem.Data[4] != 2 {
+		t.Errorf("got read address %#x and value %d after two reverse transfers", ch.ReadAddr(), mem.Data[4])
+	}
+}
+
+func TestDMAPacedByPIO(t *testing.T) {
+	const base = 0x20000000
+	for _, version := range []uint8{0, 1} {
+		b := NewBlock(version)
+		loadAt(t, b.StateMachine(0), ".program echo\n\tpull\n\tmov isr, osr\n\tpush", 0)
+		b.SetCTRL(1)
+		mem := &Memory{Base: base, Data: make([]byte, 8+8*4)}
+		copy(mem.Data, "\x01\x02\x03\x04\x05\x06\x07\x08")
+		d := NewDMA(version, mem)
+		d.ConnectPIO(b)
+		start(d, 0, base, pioFIFOBase, 8, ctrlFields{size: 0, incrRead: true, paced: true, treq: 0})
+		start(d, 1, pioFIFOBase+0x10, base+8, 8, ctrlFields{size: 2, incrWrite: true, paced: true, treq: 4})
+		for i := 0; i < 100; i++ {
+			d.Step()
+			b.Step()
+		}
+		if d.Channel(0).Busy() || d.Channel(1).Busy() {
+			t.Fatalf("version %d: transfers did not complete, %d and %d left", version, d.Channel(0).TransCount(), d.Channel(1).TransCount())
+		}
+		for i := 0; i < 8; i++ {
+			if got, want := binary.LittleEndian.Uint32(mem.Data[8+4*i:]), uint32(i+1)*0x01010101; got != want {
+				t.Errorf("version %d: word %d is %#x, want the replicated byte %#x", version, i, got, want)
+			}
+		}
+	}
+
+	// Without a state machine draining it the TX FIFO fills and the DREQ holds the channel back.
+	b := NewBlock(0)
+	d := NewDMA(0, &Memory{Base: base, Data: make([]byte, 4)})
+	d.ConnectPIO(b)
+	start(d, 0, base, pioFIFOBase+4, 10, ctrlFields{size: 2, paced: true, treq: 1})
+	for i := 0; i < 20; i++ {
+		d.Step()
+	}
+	if got := d.Channel(0).TransCount(); got != 6 || !d.Channel(0).Busy() {
+		t.Errorf("got %d transfers left, want 6 with the TX FIFO full", got)
+	}
+	d.Abort(1)
+	if d.Channel(0).Busy() || d.INTR() != 0 {
+		t.Errorf("expected abort to stop the channel without raising its interrupt")
+	}
+}
+
+func TestDMAChainAndErrors(t *testing.T) {
+	const base = 0x20000000
+	mem := &Memory{Base: base, Data: make([]byte, 16)}
+	mem.Data[0] = 0xaa
+	d := NewDMA(0, mem)
+	ch1 := d.Channel(1)
+	ch1.SetReadAddr(base)
+	ch1.SetWriteAddr(base + 8)
+	ch1.SetTransCount(1)
+	ch1.SetCTRL(ctrlFields{size: 0, quiet: true}.value(d, 1))
+	if ch1.Busy() {
+		t.Fatal("expected a write to AL1_CTRL not to trigger the channel")
+	}
+	start(d, 0, base, base+4, 1, ctrlFields{size: 0, chainTo: 1})
+	for i := 0; i < 4; i++ {
+		d.Step()
+	}
+	if mem.Data[4] != 0xaa || mem.Data[8] != 0xaa || d.INTR() != 1 {
+		t.Errorf("got %#x %#x INTR %#x, want both copies and only the interrupt of channel 0", mem.Data[4], mem.Data[8], d.INTR())
+	}
+	d.ClearINTR(1)
+
+	// A channel paced by a DREQ nothing asserts never transfers.
+	start(d, 2, base, base+4, 1, ctrlFields{size: 0, paced: true, treq: 20})
+	d.Step()
+	if !d.Channel(2).Busy() || d.Channel(2).TransCount() != 1 {
+		t.Error("expected the channel to wait for its DREQ")
+	}
+	d.Abort(1 << 2)
+
+	start(d, 3, base+15, base+16, 2, ctrlFields{size: 0, incrRead: true, incrWrite: true})
+	d.Step()
+	ch := d.Channel(3)
+	if ch.Busy() || ch.Err() != errDMAWrite || ch.CTRL()&dma_CTRL_AHB_ERROR_Msk == 0 {
+		t.Fatalf("got busy %t error %v CTRL %#x, want a halt on the write error", ch.Busy(), ch.Err(), ch.CTRL())
+	}
+	ch.SetCTRL(ch.CTRL())
+	if ch.Err() != nil || ch.CTRL()&dma_CTRL_AHB_ERROR_Msk != 0 {
+		t.Errorf("expected writing the error flags back to clear them, CTRL %#x", ch.CTRL())
+	}
+}
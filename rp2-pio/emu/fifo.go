@@ -0,0 +1,45 @@
+package emu
+
+// fifo is a state machine TX or RX FIFO. Its depth depends on the FIFO join configuration.
+type fifo struct {
+	buf   [8]uint32
+	head  uint8
+	n     uint8
+	depth uint8
+}
+
+func (f *fifo) reset(depth uint8) {
+	*f = fifo{depth: depth}
+}
+
+func (f *fifo) level() uint8 { return f.n }
+func (f *fifo) empty() bool  { return f.n == 0 }
+func (f *fifo) full() bool   { return f.n >= f.depth }
+
+func (f *fifo) push(v uint32) bool {
+	if f.full() {
+		return false
+	}
+	f.buf[(f.head+f.n)%8] = v
+	f.n++
+	return true
+}
+
+func (f *fifo) pop() (uint32, bool) {
+	if f.empty() {
+		return 0, false
+	}
+	v := f.buf[f.head]
+	f.head = (f.head + 1) % 8
+	f.n--
+	return v, true
+}
+
+// contents returns the FIFO entries from oldest to newest.
+func (f *fifo) contents() []uint32 {
+	s := make([]uint32, f.n)
+	for i := range s {
+		s[i] = f.buf[(f.head+uint8(i))%8]
+	}
+	return s
+}
@@ -0,0 +1,157 @@
+package emu
+
+// CTRL register fields. The PREV/NEXT fields exist on RP2350 only.
+const (
+	pio0_CTRL_SM_ENABLE_Pos               = 0x0
+	pio0_CTRL_SM_RESTART_Pos              = 0x4
+	pio0_CTRL_CLKDIV_RESTART_Pos          = 0x8
+	pio0_CTRL_PREV_PIO_MASK_Pos           = 0x10
+	pio0_CTRL_NEXT_PIO_MASK_Pos           = 0x14
+	pio0_CTRL_NEXTPREV_SM_ENABLE_Msk      = 0x1000000
+	pio0_CTRL_NEXTPREV_SM_DISABLE_Msk     = 0x2000000
+	pio0_CTRL_NEXTPREV_CLKDIV_RESTART_Msk = 0x4000000
+)
+
+// INTR register fields.
+const (
+	pio0_INTR_SM0_RXNEMPTY_Pos = 0x0
+	pio0_INTR_SM0_TXNFULL_Pos  = 0x4
+	pio0_INTR_SM0_Pos          = 0x8
+)
+
+// State machine register fields. They follow the RP2350 layout used by [pio.StateMachineConfig]
+// when built off-target, which is a superset of the RP2040 one except for the widened MOV STATUS fields.
+// Fields only present on RP2350 are ignored when emulating PIO version 0.
+const (
+	pio0_SM0_CLKDIV_INT_Pos  = 0x10
+	pio0_SM0_CLKDIV_FRAC_Pos = 0x8
+	pio0_SM0_CLKDIV_FRAC_Msk = 0xff00
+
+	pio0_SM0_EXECCTRL_SIDE_EN_Msk       = 0x40000000
+	pio0_SM0_EXECCTRL_SIDE_PINDIR_Msk   = 0x20000000
+	pio0_SM0_EXECCTRL_JMP_PIN_Pos       = 0x18
+	pio0_SM0_EXECCTRL_OUT_EN_SEL_Pos    = 0x13
+	pio0_SM0_EXECCTRL_INLINE_OUT_EN_Msk = 0x40000
+	pio0_SM0_EXECCTRL_OUT_STICKY_Msk    = 0x20000
+	pio0_SM0_EXECCTRL_WRAP_TOP_Pos      = 0xc
+	pio0_SM0_EXECCTRL_WRAP_BOTTOM_Pos   = 0x7
+	pio0_SM0_EXECCTRL_STATUS_SEL_Pos    = 0x5
+	pio0_SM0_EXECCTRL_STATUS_SEL_Msk    = 0x60
+	pio0_SM0_EXECCTRL_STATUS_N_Msk      = 0x1f
+
+	pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk     = 0x80000000
+	pio0_SM0_SHIFTCTRL_FJOIN_TX_Msk     = 0x40000000
+	pio0_SM0_SHIFTCTRL_PULL_THRESH_Pos  = 0x19
+	pio0_SM0_SHIFTCTRL_PUSH_THRESH_Pos  = 0x14
+	pio0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Msk = 0x80000
+	pio0_SM0_SHIFTCTRL_IN_SHIFTDIR_Msk  = 0x40000
+	pio0_SM0_SHIFTCTRL_AUTOPULL_Msk     = 0x20000
+	pio0_SM0_SHIFTCTRL_AUTOPUSH_Msk     = 0x10000
+	pio0_SM0_SHIFTCTRL_FJOIN_RX_PUT_Msk = 0x8000
+	pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Msk = 0x4000
+	pio0_SM0_SHIFTCTRL_IN_COUNT_Msk     = 0x1f
+
+	pio0_SM0_PINCTRL_SIDESET_COUNT_Pos = 0x1d
+	pio0_SM0_PINCTRL_SET_COUNT_Pos     = 0x1a
+	pio0_SM0_PINCTRL_OUT_COUNT_Pos     = 0x14
+	pio0_SM0_PINCTRL_OUT_COUNT_Msk     = 0x3f00000
+	pio0_SM0_PINCTRL_IN_BASE_Pos       = 0xf
+	pio0_SM0_PINCTRL_SIDESET_BASE_Pos  = 0xa
+	pio0_SM0_PINCTRL_SET_BASE_Pos      = 0x5
+	pio0_SM0_PINCTRL_OUT_BASE_Pos      = 0x0
+)
+
+// smConfig is a decoded [pio.StateMachineConfig].
+type smConfig struct {
+	div uint32 // Clock divider in 1/256ths of a system clock cycle.
+
+	sideEn, sidePindir bool
+	jmpPin             uint8
+	outEnSel           uint8
+	inlineOutEn        bool
+	outSticky          bool
+	wrapTop            uint8
+	wrapBottom         uint8
+	statusSel          uint8
+	statusN            uint8
+
+	joinTx, joinRx bool
+	rxPut, rxGet   bool
+	pullThresh     uint8 // 1..32.
+	pushThresh     uint8 // 1..32.
+	outShiftRight  bool
+	inShiftRight   bool
+	autopull       bool
+	autopush       bool
+	inCount        uint8 // 1..32.
+
+	sidesetCount uint8 // Including the side-set enable bit.
+	setCount     uint8
+	outCount     uint8
+	inBase       uint8
+	sidesetBase  uint8
+	setBase      uint8
+	outBase      uint8
+}
+
+func decodeConfig(version uint8, clkdiv, execctrl, shiftctrl, pinctrl uint32) (c smConfig) {
+	field := func(reg uint32, pos, bits uint8) uint8 { return uint8(reg>>pos) & (1<<bits - 1) }
+	threshold := func(v uint8) uint8 {
+		if v == 0 {
+			return 32
+		}
+		return v
+	}
+
+	c.div = (clkdiv >> pio0_SM0_CLKDIV_INT_Pos) << 8
+	if c.div == 0 {
+		c.div = 1 << 24 // An integer divider of 0 is interpreted as 65536.
+	}
+	c.div += (clkdiv & pio0_SM0_CLKDIV_FRAC_Msk) >> pio0_SM0_CLKDIV_FRAC_Pos
+
+	c.sideEn = execctrl&pio0_SM0_EXECCTRL_SIDE_EN_Msk != 0
+	c.sidePindir = execctrl&pio0_SM0_EXECCTRL_SIDE_PINDIR_Msk != 0
+	c.jmpPin = field(execctrl, pio0_SM0_EXECCTRL_JMP_PIN_Pos, 5)
+	c.outEnSel = field(execctrl, pio0_SM0_EXECCTRL_OUT_EN_SEL_Pos, 5)
+	c.inlineOutEn = execctrl&pio0_SM0_EXECCTRL_INLINE_OUT_EN_Msk != 0
+	c.outSticky = execctrl&pio0_SM0_EXECCTRL_OUT_STICKY_Msk != 0
+	c.wrapTop = field(execctrl, pio0_SM0_EXECCTRL_WRAP_TOP_Pos, 5)
+	c.wrapBottom = field(execctrl, pio0_SM0_EXECCTRL_WRAP_BOTTOM_Pos, 5)
+	c.statusSel = uint8((execctrl & pio0_SM0_EXECCTRL_STATUS_SEL_Msk) >> pio0_SM0_EXECCTRL_STATUS_SEL_Pos)
+	c.statusN = uint8(execctrl & pio0_SM0_EXECCTRL_STATUS_N_Msk)
+
+	c.joinRx = shiftctrl&pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk != 0
+	c.joinTx = shiftctrl&pio0_SM0_SHIFTCTRL_FJOIN_TX_Msk != 0
+	c.pullThresh = threshold(field(shiftctrl, pio0_SM0_SHIFTCTRL_PULL_THRESH_Pos, 5))
+	c.pushThresh = threshold(field(shiftctrl, pio0_SM0_SHIFTCTRL_PUSH_THRESH_Pos, 5))
+	c.outShiftRight = shiftctrl&pio0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Msk != 0
+	c.inShiftRight = shiftctrl&pio0_SM0_SHIFTCTRL_IN_SHIFTDIR_Msk != 0
+	c.autopull = shiftctrl&pio0_SM0_SHIFTCTRL_AUTOPULL_Msk != 0
+	c.autopush = shiftctrl&pio0_SM0_SHIFTCTRL_AUTOPUSH_Msk != 0
+	c.inCount = 32
+	if version >= 1 {
+		c.rxPut = shiftctrl&pio0_SM0_SHIFTCTRL_FJOIN_RX_PUT_Msk != 0
+		c.rxGet = shiftctrl&pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Msk != 0
+		c.inCount = threshold(uint8(shiftctrl & pio0_SM0_SHIFTCTRL_IN_COUNT_Msk))
+	} else if c.statusSel > 1 {
+		c.statusSel &= 1 // The IRQ status source does not exist on RP2040.
+	}
+
+	c.sidesetCount = field(pinctrl, pio0_SM0_PINCTRL_SIDESET_COUNT_Pos, 3)
+	c.setCount = field(pinctrl, pio0_SM0_PINCTRL_SET_COUNT_Pos, 3)
+	c.outCount = uint8((pinctrl & pio0_SM0_PINCTRL_OUT_COUNT_Msk) >> pio0_SM0_PINCTRL_OUT_COUNT_Pos)
+	c.inBase = field(pinctrl, pio0_SM0_PINCTRL_IN_BASE_Pos, 5)
+	c.sidesetBase = field(pinctrl, pio0_SM0_PINCTRL_SIDESET_BASE_Pos, 5)
+	c.setBase = field(pinctrl, pio0_SM0_PINCTRL_SET_BASE_Pos, 5)
+	c.outBase = field(pinctrl, pio0_SM0_PINCTRL_OUT_BASE_Pos, 5)
+	return c
+}
+
+// sidesetBits returns the number of side-set data bits and whether side-set is optional.
+func (c *smConfig) sidesetBits() (bits uint8, optional bool) {
+	bits = c.sidesetCount
+	if c.sideEn && bits > 0 {
+		bits--
+	}
+	return bits, c.sideEn && c.sidesetCount > 0
+}
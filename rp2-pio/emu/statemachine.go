@@ -0,0 +1,726 @@
+// Package emu emulates RP2040 and RP2350 PIO state machines on the host, cycle by cycle,
+// so that PIO programs and the [pio.StateMachineConfig] they run with can be tested without a board.
+//
+// A [StateMachine] executes encoded instructions as the hardware does: X, Y, ISR and OSR with their
+// shift counters and directions, autopush and autopull thresholds, 4 or 8 deep FIFOs and their joins,
+// program wrap, delays, side-set, `exec` via OUT and MOV and the fractional clock divider.
+//
+//	src, _ := pio.ParseAssembly(blinkPIO)
+//	sm := emu.NewStateMachine(0)
+//	cfg, err := sm.Load(&src.Programs[0], 0)
+//	// Configure pins in cfg...
+//	sm.Init(0, cfg)
+//	sm.SetEnabled(true)
+//	sm.Run(1000)
+//
+// [StateMachine.LoadAndRun] does the same from assembly source in one call.
+//
+// A [Block] runs four state machines in lockstep over shared instruction memory, IRQ flags and
+// pins, and a [System] connects several blocks so the RP2350 prev/next IRQ modes and synchronized
+// enables across blocks can be tested.
+//
+// GPIO inputs are sampled as if the input synchronizers were bypassed.
+package emu
+
+import (
+	"fmt"
+	"math/bits"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// Pins holds the state of the 32 GPIOs visible to a PIO block, relative to its GPIO base.
+type Pins struct {
+	// In holds the levels driven onto the pins externally.
+	In uint32
+	// Out holds the output levels written by the PIO.
+	Out uint32
+	// OE holds the output enables (pin directions) written by the PIO, 1 for output.
+	OE uint32
+}
+
+// Levels returns the pin levels seen by the PIO: Out for pins the PIO drives and In for the rest.
+func (p *Pins) Levels() uint32 { return p.Out&p.OE | p.In&^p.OE }
+
+// StateMachine is an emulated PIO state machine. Its methods mirror those of [pio.StateMachine].
+type StateMachine struct {
+	version uint8
+	index   uint8
+	block   *Block
+	levels  uint32 // Pin levels sampled at the start of the cycle.
+
+	cfg pio.StateMachineConfig
+	c   smConfig
+
+	enabled            bool
+	pc                 uint8
+	x, y               uint32
+	isr, osr           uint32
+	isrCount, osrCount uint8
+	tx, rx             fifo
+	rxRegs             [4]uint32 // RX FIFO storage accessed randomly with FJOIN_RX_PUT or FJOIN_RX_GET.
+	delay              uint8     // Remaining delay cycles of the last instruction.
+	stalled            bool      // The current instruction stalled and is retried on the next cycle.
+	exec               uint16    // Instruction to execute in place of the next one from memory.
+	execPending        bool
+	divAcc             uint32 // Clock divider accumulator in 1/256ths of a system clock cycle.
+	txStall            bool
+	err                error
+
+	// Effects of the instruction being executed.
+	jumped bool
+	queued bool
+}
+
+// NewStateMachine returns a disabled state machine emulating the given PIO version, 0 for RP2040
+// and 1 for RP2350, with the default configuration. It is state machine 0 of a new [Block].
+func NewStateMachine(version uint8) *StateMachine {
+	return NewBlock(version).StateMachine(0)
+}
+
+func (sm *StateMachine) reset(b *Block, index uint8) {
+	*sm = StateMachine{version: b.version, index: index, block: b}
+	sm.SetConfig(pio.DefaultStateMachineConfig())
+	sm.ClearFIFOs()
+	sm.Restart()
+}
+
+// Block returns the PIO block the state machine belongs to.
+func (sm *StateMachine) Block() *Block { return sm.block }
+
+// Index returns the index of the state machine in its PIO block.
+func (sm *StateMachine) Index() uint8 { return sm.index }
+
+// Memory returns the instruction memory the state machine executes from, shared by its PIO block.
+func (sm *StateMachine) Memory() *[32]uint16 { return &sm.block.mem }
+
+// Pins returns the GPIOs the state machine reads and drives.
+func (sm *StateMachine) Pins() *Pins { return sm.block.pins }
+
+// Load writes prog to instruction memory at offset, relocating jumps, and returns its default
+// configuration. It fails if prog is invalid, must be loaded at a different origin or uses
+// features of a newer PIO version than the one emulated.
+func (sm *StateMachine) Load(prog *pio.AssembledProgram, offset uint8) (cfg pio.StateMachineConfig, err error) {
+	err = prog.Validate()
+	if err != nil {
+		return cfg, err
+	}
+	switch {
+	case prog.Origin >= 0 && uint8(prog.Origin) != offset:
+		return cfg, fmt.Errorf("emu: program %q must be loaded at offset %d", prog.Name, prog.Origin)
+	case int(offset)+len(prog.Instructions) > len(sm.block.mem):
+		return cfg, fmt.Errorf("emu: program %q does not fit at offset %d", prog.Name, offset)
+	case prog.RequiredVersion() > sm.version:
+		return cfg, fmt.Errorf("emu: program %q requires PIO version %d", prog.Name, prog.RequiredVersion())
+	}
+	for i, instr := range prog.Instructions {
+		sm.block.mem[int(offset)+i] = relocate(instr, offset)
+	}
+	return prog.DefaultStateMachineConfig(offset), nil
+}
+
+// relocate offsets the address of JMP instructions.
+func relocate(instr uint16, offset uint8) uint16 {
+	if instr&0xe000 != 0 {
+		return instr
+	}
+	return instr&^0x1f | (instr+uint16(offset))&0x1f
+}
+
+// Init mirrors [pio.StateMachine.Init]: it disables the state machine, applies cfg, clears the
+// FIFOs, restarts the state machine and its clock divider and jumps to initialPC.
+func (sm *StateMachine) Init(initialPC uint8, cfg pio.StateMachineConfig) {
+	sm.SetEnabled(false)
+	if cfg == (pio.StateMachineConfig{}) {
+		cfg = pio.DefaultStateMachineConfig()
+	}
+	sm.SetConfig(cfg)
+	sm.ClearFIFOs()
+	sm.txStall = false
+	sm.Restart()
+	sm.ClkDivRestart()
+	sm.pc = initialPC & 31
+}
+
+// Start initializes the state machine as [StateMachine.Init] does, makes the pins in outputMask
+// outputs and enables it.
+func (sm *StateMachine) Start(initialPC uint8, cfg pio.StateMachineConfig, outputMask uint32) {
+	sm.Init(initialPC, cfg)
+	sm.Pins().OE |= outputMask
+	sm.SetEnabled(true)
+}
+
+// LoadAndRun assembles src, loads its first program at offset and starts the state machine at
+// offset with the program's default configuration, modified by configure if not nil, and the
+// pins in outputMask as outputs. It is the usual setup of tests running a program in isolation.
+func (sm *StateMachine) LoadAndRun(src string, offset uint8, outputMask uint32, configure func(cfg *pio.StateMachineConfig)) error {
+	asm, err := pio.ParseAssembly([]byte(src))
+	if err != nil {
+		return err
+	}
+	if len(asm.Programs) == 0 {
+		return fmt.Errorf("emu: no program in source")
+	}
+	cfg, err := sm.Load(&asm.Programs[0], offset)
+	if err != nil {
+		return err
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	sm.Start(offset, cfg, outputMask)
+	return nil
+}
+
+// SetConfig applies the register values of cfg. Changing the FIFO join clears the FIFOs.
+func (sm *StateMachine) SetConfig(cfg pio.StateMachineConfig) {
+	old := sm.c
+	sm.cfg = cfg
+	sm.c = decodeConfig(sm.version, cfg.ClkDiv, cfg.ExecCtrl, cfg.ShiftCtrl, cfg.PinCtrl)
+	if old.joinTx != sm.c.joinTx || old.joinRx != sm.c.joinRx || old.rxPut != sm.c.rxPut || old.rxGet != sm.c.rxGet {
+		sm.ClearFIFOs()
+	}
+}
+
+// Config returns the configuration last applied with [StateMachine.SetConfig].
+func (sm *StateMachine) Config() pio.StateMachineConfig { return sm.cfg }
+
+// SetEnabled controls whether the state machine is running.
+func (sm *StateMachine) SetEnabled(enabled bool) { sm.enabled = enabled }
+
+// IsEnabled returns true if the state machine is running.
+func (sm *StateMachine) IsEnabled() bool { return sm.enabled }
+
+// Restart clears the ISR, the shift counters, the delay counter and any stalled or pending
+// instruction. The PC, X, Y and OSR are not affected.
+func (sm *StateMachine) Restart() {
+	sm.isr, sm.isrCount = 0, 0
+	sm.osrCount = 32 // Empty, so autopull refills it.
+	sm.delay = 0
+	sm.stalled = false
+	sm.execPending = false
+}
+
+// ClkDivRestart restarts the clock divider, zeroing its fractional phase.
+func (sm *StateMachine) ClkDivRestart() { sm.divAcc = 0 }
+
+// ClearFIFOs clears the TX and RX FIFOs.
+func (sm *StateMachine) ClearFIFOs() {
+	txDepth, rxDepth := uint8(4), uint8(4)
+	switch {
+	case sm.c.joinTx && !sm.c.joinRx:
+		txDepth, rxDepth = 8, 0
+	case sm.c.joinRx && !sm.c.joinTx:
+		txDepth, rxDepth = 0, 8
+	}
+	if sm.c.rxPut || sm.c.rxGet {
+		rxDepth = 0 // RX FIFO storage is used as registers.
+	}
+	sm.tx.reset(txDepth)
+	sm.rx.reset(rxDepth)
+}
+
+// TxPut puts a value into the TX FIFO. The value is dropped if the FIFO is full.
+func (sm *StateMachine) TxPut(data uint32) { sm.tx.push(data) }
+
+// RxGet reads a word from the RX FIFO, returning 0 if it is empty.
+func (sm *StateMachine) RxGet() uint32 {
+	v, _ := sm.rx.pop()
+	return v
+}
+
+// TxFIFOLevel returns the number of words in the TX FIFO.
+func (sm *StateMachine) TxFIFOLevel() uint32 { return uint32(sm.tx.level()) }
+
+// RxFIFOLevel returns the number of words in the RX FIFO.
+func (sm *StateMachine) RxFIFOLevel() uint32 { return uint32(sm.rx.level()) }
+
+// IsTxFIFOEmpty returns true if the TX FIFO is empty.
+func (sm *StateMachine) IsTxFIFOEmpty() bool { return sm.tx.empty() }
+
+// IsTxFIFOFull returns true if the TX FIFO is full.
+func (sm *StateMachine) IsTxFIFOFull() bool { return sm.tx.full() }
+
+// IsRxFIFOEmpty returns true if the RX FIFO is empty.
+func (sm *StateMachine) IsRxFIFOEmpty() bool { return sm.rx.empty() }
+
+// IsRxFIFOFull returns true if the RX FIFO is full.
+func (sm *StateMachine) IsRxFIFOFull() bool { return sm.rx.full() }
+
+// TxFIFO returns the contents of the TX FIFO, oldest first.
+func (sm *StateMachine) TxFIFO() []uint32 { return sm.tx.contents() }
+
+// RxFIFO returns the contents of the RX FIFO, oldest first.
+func (sm *StateMachine) RxFIFO() []uint32 { return sm.rx.contents() }
+
+// HasTxStalled returns true if the state machine stalled on an empty TX FIFO since the flag was last cleared.
+func (sm *StateMachine) HasTxStalled() bool { return sm.txStall }
+
+// ClearTxStalled clears the flag returned by [StateMachine.HasTxStalled].
+func (sm *StateMachine) ClearTxStalled() { sm.txStall = false }
+
+// GetRxFIFOAt reads RX FIFO entry fifoIndex written by `mov rxfifo[i], isr`. PIO version 1 only.
+func (sm *StateMachine) GetRxFIFOAt(fifoIndex int) uint32 { return sm.rxRegs[fifoIndex&3] }
+
+// SetRxFIFOAt writes RX FIFO entry fifoIndex read by `mov osr, rxfifo[i]`. PIO version 1 only.
+func (sm *StateMachine) SetRxFIFOAt(data uint32, fifoIndex int) { sm.rxRegs[fifoIndex&3] = data }
+
+// PC returns the program counter.
+func (sm *StateMachine) PC() uint8 { return sm.pc }
+
+// GetX returns the X scratch register.
+func (sm *StateMachine) GetX() uint32 { return sm.x }
+
+// GetY returns the Y scratch register.
+func (sm *StateMachine) GetY() uint32 { return sm.y }
+
+// SetX sets the X scratch register.
+func (sm *StateMachine) SetX(value uint32) { sm.x = value }
+
+// SetY sets the Y scratch register.
+func (sm *StateMachine) SetY(value uint32) { sm.y = value }
+
+// ISR returns the input shift register and the number of bits shifted into it.
+func (sm *StateMachine) ISR() (value uint32, count uint8) { return sm.isr, sm.isrCount }
+
+// OSR returns the output shift register and the number of bits shifted out of it.
+func (sm *StateMachine) OSR() (value uint32, count uint8) { return sm.osr, sm.osrCount }
+
+// IRQ returns the IRQ flags of the state machine's PIO block.
+func (sm *StateMachine) IRQ() uint8 { return sm.block.IRQ() }
+
+// ClearIRQ clears the IRQ flags in irqMask.
+func (sm *StateMachine) ClearIRQ(irqMask uint8) { sm.block.ClearIRQ(irqMask) }
+
+// Stalled returns true if the current instruction is stalled.
+func (sm *StateMachine) Stalled() bool { return sm.stalled }
+
+// Err returns the error that halted the state machine, such as a reserved instruction encoding.
+func (sm *StateMachine) Err() error { return sm.err }
+
+// Exec immediately executes instr in place of the next instruction from memory, even if the
+// state machine is disabled. If instr stalls it is retried on following cycles.
+func (sm *StateMachine) Exec(instr uint16) {
+	sm.exec, sm.execPending = instr, true
+	sm.stalled = false
+	sm.delay = 0
+	sm.levels = sm.block.pins.Levels()
+	sm.execute()
+	sm.block.commit()
+}
+
+// Run steps the emulation by the given number of system clock cycles.
+func (sm *StateMachine) Run(cycles int) {
+	for i := 0; i < cycles; i++ {
+		sm.Step()
+	}
+}
+
+// Step advances the state machine by one system clock cycle. The state machine executes a cycle
+// when enabled and its clock divider allows. Use [Block.Step] to advance all state machines of a
+// block in lockstep.
+func (sm *StateMachine) Step() {
+	sm.levels = sm.block.pins.Levels()
+	sm.step()
+	sm.block.commit()
+}
+
+func (sm *StateMachine) step() {
+	if !sm.enabled || sm.err != nil {
+		return
+	}
+	sm.divAcc += 256
+	if sm.divAcc < sm.c.div {
+		return
+	}
+	sm.divAcc -= sm.c.div
+	sm.tick()
+}
+
+// tick runs one state machine clock cycle.
+func (sm *StateMachine) tick() {
+	sm.autopull()
+	if sm.delay > 0 {
+		sm.delay--
+		return
+	}
+	sm.execute()
+}
+
+// execute runs the pending exec instruction or the one at the PC.
+func (sm *StateMachine) execute() {
+	fromExec := sm.execPending
+	instr := sm.block.mem[sm.pc]
+	if fromExec {
+		instr = sm.exec
+	}
+	sidesetBits, optional := sm.c.sidesetBits()
+	in, err := pio.DecodeInstruction(instr, sidesetBits, optional, sm.version)
+	if err != nil {
+		sm.err = fmt.Errorf("emu: pc %d: %w", sm.pc, err)
+		return
+	}
+	sm.jumped, sm.queued = false, false
+	ok := sm.run(in)
+	// Side-set takes effect even if the instruction stalls and has priority over pin writes by the instruction.
+	if in.SideSetEnabled && sidesetBits > 0 {
+		if sm.c.sidePindir {
+			sm.writeDirs(sm.c.sidesetBase, sidesetBits, uint32(in.SideSet))
+		} else {
+			sm.writePins(sm.c.sidesetBase, sidesetBits, uint32(in.SideSet))
+		}
+	}
+	if !ok {
+		sm.stalled = true
+		return
+	}
+	sm.stalled = false
+	if fromExec && !sm.queued {
+		sm.execPending = false
+	}
+	if sm.queued {
+		sm.delay = 0 // The delay of OUT EXEC and MOV EXEC is ignored.
+	} else {
+		sm.delay = in.Delay
+	}
+	if !sm.jumped && !fromExec {
+		if sm.pc == sm.c.wrapTop {
+			sm.pc = sm.c.wrapBottom
+		} else {
+			sm.pc = (sm.pc + 1) & 31
+		}
+	}
+}
+
+// run executes in, returning false if it stalls.
+func (sm *StateMachine) run(in pio.Instruction) bool {
+	switch in.Kind {
+	case pio.InstrJMP:
+		var take bool
+		switch in.JmpCond {
+		case pio.JmpAlways:
+			take = true
+		case pio.JmpXZero:
+			take = sm.x == 0
+		case pio.JmpXNZeroDec:
+			take = sm.x != 0
+			sm.x--
+		case pio.JmpYZero:
+			take = sm.y == 0
+		case pio.JmpYNZeroDec:
+			take = sm.y != 0
+			sm.y--
+		case pio.JmpXNotEqualY:
+			take = sm.x != sm.y
+		case pio.JmpPinInput:
+			take = sm.gpio(sm.c.jmpPin)
+		case pio.JmpOSRNotEmpty:
+			take = sm.osrCount < sm.c.pullThresh
+		}
+		if take {
+			sm.jump(in.Address)
+		}
+
+	case pio.InstrWAIT:
+		var level bool
+		switch in.WaitSrc {
+		case pio.WaitSrcGPIO:
+			level = sm.gpio(in.Index)
+		case pio.WaitSrcPin:
+			level = sm.inPins()>>(in.Index&31)&1 != 0
+		case pio.WaitSrcJmpPin:
+			level = sm.gpio(sm.c.jmpPin + in.Index)
+		case pio.WaitSrcIRQ:
+			irq, bit := sm.irqFlag(in.Index, in.IRQMode)
+			level = irq.test(bit)
+			if level && in.Polarity {
+				irq.lower(bit) // Waiting for a flag to be set clears it.
+			}
+		}
+		return level == in.Polarity
+
+	case pio.InstrIN:
+		if !sm.stalled { // The shift is not repeated while stalled on autopush.
+			var data uint32
+			switch in.InSrc {
+			case pio.InSrcPins:
+				data = sm.inPins()
+			case pio.InSrcX:
+				data = sm.x
+			case pio.InSrcY:
+				data = sm.y
+			case pio.InSrcISR:
+				data = sm.isr
+			case pio.InSrcOSR:
+				data = sm.osr
+			}
+			sm.shiftIn(data, in.BitCount)
+		}
+		if sm.c.autopush && sm.isrCount >= sm.c.pushThresh {
+			if !sm.rx.push(sm.isr) {
+				return false
+			}
+			sm.isr, sm.isrCount = 0, 0
+		}
+
+	case pio.InstrOUT:
+		if sm.c.autopull && sm.osrCount >= sm.c.pullThresh {
+			sm.txStall = true // Nothing was available for autopull at the start of the cycle.
+			return false
+		}
+		data := sm.shiftOut(in.BitCount)
+		switch in.OutDest {
+		case pio.OutDestPins:
+			if !sm.c.inlineOutEn || data>>sm.c.outEnSel&1 != 0 {
+				sm.writePins(sm.c.outBase, sm.c.outCount, data)
+			}
+		case pio.OutDestX:
+			sm.x = data
+		case pio.OutDestY:
+			sm.y = data
+		case pio.OutDestPindirs:
+			if !sm.c.inlineOutEn || data>>sm.c.outEnSel&1 != 0 {
+				sm.writeDirs(sm.c.outBase, sm.c.outCount, data)
+			}
+		case pio.OutDestPC:
+			sm.jump(uint8(data))
+		case pio.OutDestISR:
+			sm.isr, sm.isrCount = data, in.BitCount
+		case pio.OutDestExec:
+			sm.queue(uint16(data))
+		}
+		sm.autopull()
+
+	case pio.InstrPUSH:
+		if in.IfFullEmpty && sm.isrCount < sm.c.pushThresh {
+			break
+		}
+		if !sm.rx.push(sm.isr) && in.Block {
+			return false
+		}
+		sm.isr, sm.isrCount = 0, 0
+
+	case pio.InstrPULL:
+		if (in.IfFullEmpty || sm.c.autopull) && sm.osrCount < sm.c.pullThresh {
+			break
+		}
+		v, ok := sm.tx.pop()
+		if !ok {
+			if in.Block {
+				sm.txStall = true
+				return false
+			}
+			v = sm.x // A non-blocking pull from an empty FIFO copies X.
+		}
+		sm.osr, sm.osrCount = v, 0
+
+	case pio.InstrMOV:
+		sm.mov(in)
+
+	case pio.InstrIRQ:
+		irq, bit := sm.irqFlag(in.Index, in.IRQMode)
+		if in.IRQClear {
+			irq.lower(bit)
+			break
+		}
+		if !sm.stalled {
+			irq.raise(bit)
+			return !in.IRQWait // The flag is set at the end of the cycle, so wait at least until the next.
+		}
+		if in.IRQWait && irq.test(bit) {
+			return false
+		}
+
+	case pio.InstrSET:
+		data := uint32(in.Data)
+		switch in.SetDest {
+		case pio.SetDestPins:
+			sm.writePins(sm.c.setBase, sm.c.setCount, data)
+		case pio.SetDestX:
+			sm.x = data
+		case pio.SetDestY:
+			sm.y = data
+		case pio.SetDestPindirs:
+			sm.writeDirs(sm.c.setBase, sm.c.setCount, data)
+		}
+	}
+	return true
+}
+
+func (sm *StateMachine) mov(in pio.Instruction) {
+	rxIndex := in.Index
+	if !in.RxFIFOIndexed {
+		rxIndex = uint8(sm.y)
+	}
+	switch in.RxFIFO {
+	case pio.RxFIFOPut:
+		sm.rxRegs[rxIndex&3] = sm.isr
+		return
+	case pio.RxFIFOGet:
+		sm.osr, sm.osrCount = sm.rxRegs[rxIndex&3], 0
+		return
+	}
+
+	var v uint32
+	switch in.MovSrc {
+	case pio.MovSrcPins:
+		v = sm.inPins()
+	case pio.MovSrcX:
+		v = sm.x
+	case pio.MovSrcY:
+		v = sm.y
+	case pio.MovSrcStatus:
+		if sm.status() {
+			v = 0xffffffff
+		}
+	case pio.MovSrcISR:
+		v = sm.isr
+	case pio.MovSrcOSR:
+		v = sm.osr
+	}
+	switch in.MovOp {
+	case pio.MovOpInvert:
+		v = ^v
+	case pio.MovOpReverse:
+		v = bits.Reverse32(v)
+	}
+	switch in.MovDest {
+	case pio.MovDestPins:
+		sm.writePins(sm.c.outBase, sm.c.outCount, v)
+	case pio.MovDestX:
+		sm.x = v
+	case pio.MovDestY:
+		sm.y = v
+	case pio.MovDestPindirs:
+		sm.writeDirs(sm.c.outBase, sm.c.outCount, v)
+	case pio.MovDestExec:
+		sm.queue(uint16(v))
+	case pio.MovDestPC:
+		sm.jump(uint8(v))
+	case pio.MovDestISR:
+		sm.isr, sm.isrCount = v, 0
+	case pio.MovDestOSR:
+		sm.osr, sm.osrCount = v, 0
+	}
+}
+
+// status returns the MOV STATUS condition selected by EXECCTRL.
+func (sm *StateMachine) status() bool {
+	switch sm.c.statusSel {
+	case 0:
+		return sm.tx.level() < sm.c.statusN
+	case 1:
+		return sm.rx.level() < sm.c.statusN
+	default:
+		// STATUS_N bits 4:3 select this block (0), the previous (1) or the next (2).
+		mode := pio.IRQDirect
+		switch sm.c.statusN >> 3 & 3 {
+		case 1:
+			mode = pio.IRQPrev
+		case 2:
+			mode = pio.IRQNext
+		}
+		irq, bit := sm.irqFlag(sm.c.statusN&7, mode)
+		return irq.test(bit)
+	}
+}
+
+func (sm *StateMachine) jump(addr uint8) {
+	sm.pc = addr & 31
+	sm.jumped = true
+}
+
+func (sm *StateMachine) queue(instr uint16) {
+	sm.exec, sm.execPending = instr, true
+	sm.queued = true
+}
+
+// autopull refills an empty OSR from the TX FIFO when autopull is enabled.
+func (sm *StateMachine) autopull() {
+	if sm.c.autopull && sm.osrCount >= sm.c.pullThresh {
+		if v, ok := sm.tx.pop(); ok {
+			sm.osr, sm.osrCount = v, 0
+		}
+	}
+}
+
+func (sm *StateMachine) shiftIn(data uint32, n uint8) {
+	if n < 32 {
+		data &= 1<<n - 1
+	}
+	if sm.c.inShiftRight {
+		sm.isr = sm.isr>>n | data<<(32-n)
+	} else {
+		sm.isr = sm.isr<<n | data
+	}
+	sm.isrCount = min(sm.isrCount+n, 32)
+}
+
+func (sm *StateMachine) shiftOut(n uint8) (data uint32) {
+	if sm.c.outShiftRight {
+		data = sm.osr
+		if n < 32 {
+			data &= 1<<n - 1
+		}
+		sm.osr >>= n
+	} else {
+		data = sm.osr >> (32 - n)
+		sm.osr <<= n
+	}
+	sm.osrCount = min(sm.osrCount+n, 32)
+	return data
+}
+
+// irqFlag returns the IRQ flags and bit selected by an IRQ index and index mode. The flags are nil
+// for a prev or next block that does not exist.
+func (sm *StateMachine) irqFlag(index uint8, mode pio.IRQIndexMode) (irq *irqFlags, bit uint8) {
+	bit = 1 << (index & 7)
+	switch mode {
+	case pio.IRQRel:
+		return &sm.block.irq, 1 << (index&4 | (index+sm.index)&3)
+	case pio.IRQPrev:
+		if b := sm.block.neighbour(-1); b != nil {
+			return &b.irq, bit
+		}
+		return nil, bit
+	case pio.IRQNext:
+		if b := sm.block.neighbour(1); b != nil {
+			return &b.irq, bit
+		}
+		return nil, bit
+	}
+	return &sm.block.irq, bit
+}
+
+// inPins returns the pin levels rotated so bit 0 is the IN base, masked to IN_COUNT pins.
+func (sm *StateMachine) inPins() uint32 {
+	v := bits.RotateLeft32(sm.levels, -int(sm.c.inBase))
+	if sm.c.inCount < 32 {
+		v &= 1<<sm.c.inCount - 1
+	}
+	return v
+}
+
+func (sm *StateMachine) gpio(pin uint8) bool {
+	return sm.levels>>(pin&31)&1 != 0
+}
+
+func (sm *StateMachine) writePins(base, count uint8, data uint32) {
+	mask := pinMask(base, count)
+	pins := sm.block.pins
+	pins.Out = pins.Out&^mask | bits.RotateLeft32(data, int(base))&mask
+}
+
+func (sm *StateMachine) writeDirs(base, count uint8, data uint32) {
+	mask := pinMask(base, count)
+	pins := sm.block.pins
+	pins.OE = pins.OE&^mask | bits.RotateLeft32(data, int(base))&mask
+}
+
+// pinMask returns the mask of count consecutive pins starting at base, wrapping after pin 31.
+func pinMask(base, count uint8) uint32 {
+	if count >= 32 {
+		return 0xffffffff
+	}
+	return bits.RotateLeft32(1<<count-1, int(base))
+}
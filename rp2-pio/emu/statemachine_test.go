@@ -0,0 +1,255 @@
+package emu
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// load runs the first program of src on a new state machine of the given version with the
+// program's default configuration modified by configure.
+func load(t *testing.T, version uint8, src string, configure func(cfg *pio.StateMachineConfig)) *StateMachine {
+	t.Helper()
+	sm := NewStateMachine(version)
+	if err := sm.LoadAndRun(src, 0, 0, configure); err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+// trace steps sm for the given number of system cycles and returns the level of pin after each.
+func trace(sm *StateMachine, pin uint8, cycles int) string {
+	var b strings.Builder
+	for i := 0; i < cycles; i++ {
+		sm.Step()
+		b.WriteByte('0' + byte(sm.Pins().Levels()>>pin&1))
+	}
+	return b.String()
+}
+
+func setPins(base, count uint8) func(cfg *pio.StateMachineConfig) {
+	return func(cfg *pio.StateMachineConfig) {
+		cfg.PinCtrl |= uint32(base)<<pio0_SM0_PINCTRL_SET_BASE_Pos | uint32(count)<<pio0_SM0_PINCTRL_SET_COUNT_Pos
+	}
+}
+
+func TestDelayAndWrap(t *testing.T) {
+	sm := load(t, 0, `
+.program square
+	set pindirs, 1
+.wrap_target
+	set pins, 1 [3]
+	set pins, 0 [1]
+.wrap
+`, setPins(2, 1))
+	got := trace(sm, 2, 13)
+	if want := "0111100111100"; got != want {
+		t.Errorf("got waveform %s, want %s", got, want)
+	}
+}
+
+func TestClockDivider(t *testing.T) {
+	sm := load(t, 0, ".program count\n\tjmp y-- 0", func(cfg *pio.StateMachineConfig) {
+		cfg.SetClkDivIntFrac(2, 128) // 2.5
+	})
+	sm.SetY(1000)
+	sm.Run(100)
+	if got := 1000 - sm.GetY(); got != 40 {
+		t.Errorf("executed %d instructions in 100 cycles at clock divider 2.5, want 40", got)
+	}
+}
+
+func TestAutopull(t *testing.T) {
+	sm := load(t, 0, ".program out\n.out 1 right auto 8\n\tout pins, 1", func(cfg *pio.StateMachineConfig) {
+		cfg.PinCtrl |= 1 << pio0_SM0_PINCTRL_OUT_COUNT_Pos
+	})
+	sm.Pins().OE = 1
+	sm.TxPut(0b1011_0010)
+	got := trace(sm, 0, 10)
+	if want := "0100110111"; got != want {
+		t.Errorf("got waveform %s, want %s", got, want)
+	}
+	if !sm.Stalled() || !sm.HasTxStalled() {
+		t.Error("expected OUT to stall with an empty TX FIFO")
+	}
+	sm.TxPut(0)
+	if got := trace(sm, 0, 2); got != "00" {
+		t.Errorf("got waveform %s after refill, want 00", got)
+	}
+}
+
+func TestAutopush(t *testing.T) {
+	sm := load(t, 0, ".program in\n.in 4 left auto 8\n\tin pins, 4", nil)
+	for _, nibble := range []uint32{0xa, 0x5} {
+		sm.Pins().In = nibble
+		sm.Step()
+	}
+	if got := sm.RxGet(); got != 0xa5 {
+		t.Errorf("got RX word %#x, want 0xa5", got)
+	}
+	sm.Run(8)
+	if !sm.IsRxFIFOFull() {
+		t.Fatalf("expected RX FIFO to be full, level %d", sm.RxFIFOLevel())
+	}
+	sm.Run(2)
+	if _, count := sm.ISR(); !sm.Stalled() || count != 8 {
+		t.Errorf("expected IN to stall on autopush with 8 bits in ISR, got %d", count)
+	}
+	sm.RxGet()
+	sm.Step()
+	if _, count := sm.ISR(); sm.Stalled() || count != 0 {
+		t.Errorf("expected stalled push to complete without shifting again, got %d bits in ISR", count)
+	}
+}
+
+func TestPullAndOSRE(t *testing.T) {
+	sm := load(t, 0, `
+.program osre
+.out 1 left 8
+	pull noblock
+loop:
+	out y, 4
+	jmp !osre loop
+	set x, 3
+`, nil)
+	sm.SetX(0xab000000)
+	sm.Run(6)
+	if x, y := sm.GetX(), sm.GetY(); x != 3 || y != 0xb {
+		t.Errorf("got x=%#x y=%#x, want x=3 y=0xb", x, y)
+	}
+}
+
+func TestWaitAndIRQ(t *testing.T) {
+	sm := load(t, 0, `
+.program sync
+	wait 1 pin 3
+	irq wait 1 rel
+	wait 1 irq 5
+	set x, 5
+`, nil)
+	sm.Run(3)
+	if !sm.Stalled() || sm.PC() != 0 {
+		t.Fatal("expected wait on low pin to stall")
+	}
+	sm.Pins().In = 1 << 3
+	sm.Run(3)
+	if sm.IRQ() != 1<<1 || !sm.Stalled() || sm.PC() != 1 {
+		t.Fatalf("expected irq wait to set flag 1 and stall, flags %#x", sm.IRQ())
+	}
+	sm.ClearIRQ(1 << 1)
+	sm.Run(3)
+	if sm.PC() != 2 || !sm.Stalled() {
+		t.Fatalf("expected wait on IRQ 5, pc %d", sm.PC())
+	}
+	sm.Exec(0xc005) // irq set 5
+	sm.Run(2)
+	if sm.GetX() != 5 || sm.IRQ() != 0 {
+		t.Errorf("expected wait to clear IRQ 5 and continue, x=%d flags %#x", sm.GetX(), sm.IRQ())
+	}
+}
+
+func TestExec(t *testing.T) {
+	asm := pio.AssemblerV0{}
+	sm := load(t, 0, `
+.program exec
+.out 1 right 16
+	pull
+	out exec, 16
+	mov exec, osr
+	set y, 2
+`, nil)
+	sm.TxPut(uint32(asm.Set(pio.SetDestX, 7).Encode()) | uint32(asm.Set(pio.SetDestY, 9).Encode())<<16)
+	sm.Run(3)
+	if sm.GetX() != 7 || sm.PC() != 2 {
+		t.Fatalf("expected OUT EXEC to run `set x, 7` without advancing the PC, x=%d pc=%d", sm.GetX(), sm.PC())
+	}
+	sm.Run(2)
+	if sm.GetY() != 9 || sm.PC() != 3 {
+		t.Fatalf("expected MOV EXEC to run `set y, 9`, y=%d pc=%d", sm.GetY(), sm.PC())
+	}
+	sm.SetEnabled(false)
+	sm.Exec(asm.Jmp(pio.JmpAlways, 1).Encode())
+	if sm.PC() != 1 {
+		t.Errorf("expected Exec to jump while disabled, pc=%d", sm.PC())
+	}
+}
+
+func TestSideset(t *testing.T) {
+	sm := load(t, 0, `
+.program side
+.side_set 1 opt
+	nop side 1 [2]
+	nop
+	nop side 0
+`, func(cfg *pio.StateMachineConfig) {
+		cfg.PinCtrl |= 4 << pio0_SM0_PINCTRL_SIDESET_BASE_Pos
+	})
+	sm.Pins().OE = 1 << 4
+	got := trace(sm, 4, 6)
+	if want := "111101"; got != want {
+		t.Errorf("got waveform %s, want %s", got, want)
+	}
+}
+
+func TestFIFOJoin(t *testing.T) {
+	sm := load(t, 0, ".program idle\n.fifo tx\n\tpull", nil)
+	for i := 0; i < 10; i++ {
+		sm.TxPut(uint32(i))
+	}
+	if sm.TxFIFOLevel() != 8 {
+		t.Errorf("expected joined TX FIFO to hold 8 words, got %d", sm.TxFIFOLevel())
+	}
+	sm.Step()
+	if osr, _ := sm.OSR(); osr != 0 || sm.TxFIFOLevel() != 7 {
+		t.Errorf("got OSR %d and TX level %d after pull", osr, sm.TxFIFOLevel())
+	}
+
+	sm = load(t, 1, ".pio_version 1\n.program putget\n.fifo putget\n\tmov osr, rxfifo[1]\n\tmov rxfifo[2], isr", nil)
+	sm.SetRxFIFOAt(42, 1)
+	sm.Step()
+	if osr, _ := sm.OSR(); osr != 42 {
+		t.Errorf("got OSR %d from RX FIFO entry 1, want 42", osr)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	sm := load(t, 0, ".program status\n\tmov x, status", func(cfg *pio.StateMachineConfig) {
+		cfg.SetMovStatus(pio.MovStatusTxLessthan, 2)
+	})
+	sm.TxPut(1)
+	sm.Step()
+	if sm.GetX() != 0xffffffff {
+		t.Errorf("expected all ones with TX level 1 < 2, got %#x", sm.GetX())
+	}
+	sm.TxPut(2)
+	sm.Step()
+	if sm.GetX() != 0 {
+		t.Errorf("expected zero with TX level 2, got %#x", sm.GetX())
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	asm, err := pio.ParseAssembly([]byte(".pio_version 1\n.program v1\n\tmov pindirs, null\n.program fixed\n.origin 4\n\tnop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewStateMachine(0)
+	if _, err := sm.Load(&asm.Programs[0], 0); err == nil {
+		t.Error("expected error loading version 1 program on version 0")
+	}
+	if _, err := sm.Load(&asm.Programs[1], 0); err == nil {
+		t.Error("expected error loading program at wrong origin")
+	}
+	if err := sm.LoadAndRun("; no program", 0, 0, nil); err == nil {
+		t.Error("expected error running source without a program")
+	}
+
+	sm.Memory()[0] = 0x8010 // Version 1 RX FIFO MOV, reserved on version 0.
+	sm.SetEnabled(true)
+	sm.Step()
+	if !errors.Is(sm.Err(), pio.ErrRequiresV1) {
+		t.Errorf("expected ErrRequiresV1, got %v", sm.Err())
+	}
+}
@@ -0,0 +1,217 @@
+package emu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WriteVCD writes the waveform as a Value Change Dump, as read by GTKWave or PulseView. Each pin in
+// pinMask is written as a gpioN signal holding its level and a gpioN_oe signal holding its output
+// enable. Times are in picoseconds.
+func (w *Waveform) WriteVCD(out io.Writer, pinMask uint32) error {
+	if w.SysClockHz == 0 {
+		return errors.New("emu: waveform has no system clock frequency")
+	}
+	bw := bufio.NewWriter(out)
+	var pins []uint8
+	for pin := uint8(0); pin < 32; pin++ {
+		if pinMask>>pin&1 != 0 {
+			pins = append(pins, pin)
+		}
+	}
+	// Each pin uses two single character identifiers starting at '!'.
+	id := func(pin int, oe bool) byte {
+		if oe {
+			return byte('!' + 2*pin + 1)
+		}
+		return byte('!' + 2*pin)
+	}
+
+	fmt.Fprintf(bw, "$version github.com/tinygo-org/pio/rp2-pio/emu $end\n")
+	fmt.Fprintf(bw, "$comment system clock %d Hz $end\n", w.SysClockHz)
+	fmt.Fprintf(bw, "$timescale 1ps $end\n")
+	fmt.Fprintf(bw, "$scope module pio $end\n")
+	for i, pin := range pins {
+		fmt.Fprintf(bw, "$var wire 1 %c gpio%d $end\n", id(i, false), pin)
+		fmt.Fprintf(bw, "$var wire 1 %c gpio%d_oe $end\n", id(i, true), pin)
+	}
+	fmt.Fprintf(bw, "$upscope $end\n$enddefinitions $end\n")
+
+	var prev Sample
+	for n, s := range w.Samples {
+		fmt.Fprintf(bw, "#%d\n", w.picoseconds(s.Cycle))
+		if n == 0 {
+			fmt.Fprintf(bw, "$dumpvars\n")
+		}
+		levels, prevLevels := s.Levels(), prev.Levels()
+		for i, pin := range pins {
+			if n == 0 || (levels^prevLevels)>>pin&1 != 0 {
+				fmt.Fprintf(bw, "%d%c\n", levels>>pin&1, id(i, false))
+			}
+			if n == 0 || (s.OE^prev.OE)>>pin&1 != 0 {
+				fmt.Fprintf(bw, "%d%c\n", s.OE>>pin&1, id(i, true))
+			}
+		}
+		if n == 0 {
+			fmt.Fprintf(bw, "$end\n")
+		}
+		prev = s
+	}
+	if len(w.Samples) == 0 || w.End > w.Samples[len(w.Samples)-1].Cycle {
+		fmt.Fprintf(bw, "#%d\n", w.picoseconds(w.End))
+	}
+	return bw.Flush()
+}
+
+func (w *Waveform) picoseconds(cycle uint64) uint64 {
+	ps := new(big.Int).SetUint64(cycle)
+	ps.Mul(ps, big.NewInt(1e12))
+	ps.Quo(ps, big.NewInt(int64(w.SysClockHz)))
+	return ps.Uint64()
+}
+
+// vcdPinName matches signal names mapped to pins by ReadVCD.
+var vcdPinName = regexp.MustCompile(`^(?i:gpio|gp|pin|d)?(\d+)$`)
+
+// ReadVCD reads a Value Change Dump into a waveform of input levels for a system clock of
+// sysClockHz, to be replayed with [Waveform.Stimulus]. Signals named gpioN, gpN, pinN, DN (as
+// written by PulseView) or N drive pin N, other signals are ignored. A change at a time between two
+// system clock edges takes effect on the following cycle. Unknown and high impedance values read as low.
+func ReadVCD(r io.Reader, sysClockHz uint32) (*Waveform, error) {
+	if sysClockHz == 0 {
+		return nil, errors.New("emu: zero system clock frequency")
+	}
+	w := &Waveform{SysClockHz: sysClockHz}
+	sc := bufio.NewScanner(r)
+	sc.Split(bufio.ScanWords)
+	next := func() (string, bool) {
+		if !sc.Scan() {
+			return "", false
+		}
+		return sc.Text(), true
+	}
+	// section returns the words up to the next $end.
+	section := func() ([]string, error) {
+		var words []string
+		for {
+			word, ok := next()
+			if !ok {
+				return nil, errors.New("emu: VCD: missing $end")
+			}
+			if word == "$end" {
+				return words, nil
+			}
+			words = append(words, word)
+		}
+	}
+
+	femtoseconds := big.NewInt(1e3) // Default timescale 1ps.
+	pins := map[string]uint32{}     // Identifier code to pin mask.
+	var in uint32
+	var cycle uint64
+	change := func(value byte, id string) {
+		mask, ok := pins[id]
+		if !ok {
+			return
+		}
+		if value == '1' {
+			in |= mask
+		} else {
+			in &^= mask
+		}
+	}
+	for {
+		word, ok := next()
+		if !ok {
+			break
+		}
+		switch {
+		case word == "$timescale":
+			words, err := section()
+			if err != nil {
+				return nil, err
+			}
+			femtoseconds, err = parseTimescale(strings.Join(words, ""))
+			if err != nil {
+				return nil, err
+			}
+		case word == "$var":
+			words, err := section()
+			if err != nil {
+				return nil, err
+			}
+			if len(words) < 4 {
+				return nil, fmt.Errorf("emu: VCD: invalid $var %s", strings.Join(words, " "))
+			}
+			if m := vcdPinName.FindStringSubmatch(words[3]); m != nil && words[1] == "1" {
+				pin, err := strconv.Atoi(m[1])
+				if err == nil && pin < 32 {
+					pins[words[2]] |= 1 << pin
+				}
+			}
+		case word == "$dumpvars" || word == "$dumpon" || word == "$dumpoff" || word == "$dumpall" || word == "$end":
+			// Value changes inside these sections are handled like any other.
+		case strings.HasPrefix(word, "$"):
+			if _, err := section(); err != nil {
+				return nil, err
+			}
+		case word[0] == '#':
+			t, ok := new(big.Int).SetString(word[1:], 10)
+			if !ok {
+				return nil, fmt.Errorf("emu: VCD: invalid time %q", word)
+			}
+			w.add(Sample{Cycle: cycle, In: in})
+			// cycle = ceil(t * femtoseconds * sysClockHz / 1e15)
+			t.Mul(t, femtoseconds)
+			t.Mul(t, big.NewInt(int64(sysClockHz)))
+			t.Add(t, big.NewInt(1e15-1))
+			t.Quo(t, big.NewInt(1e15))
+			if t.Uint64() < cycle {
+				return nil, fmt.Errorf("emu: VCD: time %s goes backwards", word[1:])
+			}
+			cycle = t.Uint64()
+		case strings.ContainsRune("01xXzZ", rune(word[0])):
+			change(word[0], word[1:])
+		case strings.ContainsRune("bBrR", rune(word[0])):
+			id, ok := next()
+			if !ok {
+				return nil, errors.New("emu: VCD: missing identifier after vector value")
+			}
+			if word[0] == 'b' || word[0] == 'B' {
+				change(word[len(word)-1], id) // Single bit signals may be dumped as vectors.
+			}
+		default:
+			return nil, fmt.Errorf("emu: VCD: unexpected %q", word)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	w.add(Sample{Cycle: cycle, In: in})
+	w.End = cycle
+	return w, nil
+}
+
+// parseTimescale returns the length of a VCD timescale such as "10ns" in femtoseconds.
+func parseTimescale(s string) (*big.Int, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i <= 0 {
+		return nil, fmt.Errorf("emu: VCD: invalid timescale %q", s)
+	}
+	n, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return nil, fmt.Errorf("emu: VCD: invalid timescale %q", s)
+	}
+	units := map[string]int64{"s": 1e15, "ms": 1e12, "us": 1e9, "ns": 1e6, "ps": 1e3, "fs": 1}
+	unit, ok := units[s[i:]]
+	if !ok {
+		return nil, fmt.Errorf("emu: VCD: invalid timescale unit %q", s[i:])
+	}
+	return big.NewInt(int64(n) * unit), nil
+}
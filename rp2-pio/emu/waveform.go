@@ -0,0 +1,169 @@
+package emu
+
+import (
+	"sort"
+	"time"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// Target is emulated hardware driving a set of pins: a [StateMachine], [Block] or [System].
+type Target interface {
+	Step()
+	Pins() *Pins
+}
+
+// Stimulus drives the input pins of an emulation. It is called before every system clock cycle
+// with the number of the cycle about to run and may modify pins.In.
+type Stimulus func(cycle uint64, pins *Pins)
+
+// Sample is the state of the pads at a system clock cycle, as read from the DBG_PADOUT and
+// DBG_PADOE registers along with the externally driven input levels.
+type Sample struct {
+	Cycle uint64
+	Out   uint32
+	OE    uint32
+	In    uint32
+}
+
+// Levels returns the pin levels: Out for pins driven by the PIO and In for the rest.
+func (s Sample) Levels() uint32 { return s.Out&s.OE | s.In&^s.OE }
+
+// Waveform is a capture of the pads of an emulation. It only holds samples where a pad changed.
+type Waveform struct {
+	// SysClockHz is the system clock frequency used to turn cycles into time.
+	SysClockHz uint32
+	// Samples holds the pad state from the start of each cycle in which it changed, in increasing
+	// cycle order. The first sample is the state at the start of the capture.
+	Samples []Sample
+	// End is the number of cycles captured.
+	End uint64
+}
+
+// Time returns the time at which the given system clock cycle starts. Since the emulation runs on
+// system clock cycles, the clock divider of each state machine is reflected in the cycle numbers.
+func (w *Waveform) Time(cycle uint64) time.Duration {
+	return pio.CyclesToDuration(int(cycle), 1, 0, w.SysClockHz)
+}
+
+// At returns the pad state during the given cycle.
+func (w *Waveform) At(cycle uint64) Sample {
+	i := sort.Search(len(w.Samples), func(i int) bool { return w.Samples[i].Cycle > cycle })
+	if i == 0 {
+		return Sample{Cycle: cycle}
+	}
+	s := w.Samples[i-1]
+	s.Cycle = cycle
+	return s
+}
+
+// Edge is a change of a pin level.
+type Edge struct {
+	Cycle uint64
+	Level bool
+}
+
+// Edges returns the changes of the level of pin, starting with its initial level at the first sample.
+func (w *Waveform) Edges(pin uint8) []Edge {
+	var edges []Edge
+	for _, s := range w.Samples {
+		level := s.Levels()>>(pin&31)&1 != 0
+		if len(edges) == 0 || edges[len(edges)-1].Level != level {
+			edges = append(edges, Edge{Cycle: s.Cycle, Level: level})
+		}
+	}
+	return edges
+}
+
+// add appends s unless the pads did not change, replacing a previous sample of the same cycle.
+func (w *Waveform) add(s Sample) {
+	n := len(w.Samples)
+	if n > 0 && w.Samples[n-1].Cycle == s.Cycle {
+		n--
+		w.Samples = w.Samples[:n]
+	}
+	if n > 0 {
+		last := w.Samples[n-1]
+		if last.Out == s.Out && last.OE == s.OE && last.In == s.In {
+			return
+		}
+	}
+	w.Samples = append(w.Samples, s)
+}
+
+// Stimulus returns a stimulus replaying the input levels of the waveform, for example one read
+// with [ReadVCD]. Inputs keep their last level after the end of the waveform.
+func (w *Waveform) Stimulus() Stimulus {
+	return func(cycle uint64, pins *Pins) {
+		pins.In = w.At(cycle).In
+	}
+}
+
+// Recorder runs an emulation target cycle by cycle, driving its inputs from a stimulus and
+// capturing its pads into a [Waveform].
+type Recorder struct {
+	target   Target
+	stimulus Stimulus
+	wave     Waveform
+	cycle    uint64
+}
+
+// NewRecorder returns a recorder for target running at a system clock of sysClockHz.
+func NewRecorder(target Target, sysClockHz uint32) *Recorder {
+	return &Recorder{target: target, wave: Waveform{SysClockHz: sysClockHz}}
+}
+
+// SetStimulus sets the function driving the inputs before each cycle. Stimuli are combined by
+// calling them in order.
+func (r *Recorder) SetStimulus(stimuli ...Stimulus) {
+	r.stimulus = func(cycle uint64, pins *Pins) {
+		for _, s := range stimuli {
+			s(cycle, pins)
+		}
+	}
+}
+
+// Cycle returns the number of system clock cycles run.
+func (r *Recorder) Cycle() uint64 { return r.cycle }
+
+// Run steps the target by the given number of system clock cycles.
+func (r *Recorder) Run(cycles int) {
+	for i := 0; i < cycles; i++ {
+		r.Step()
+	}
+}
+
+// RunUntil steps the target until cond returns true or maxCycles have run, returning whether cond was met.
+func (r *Recorder) RunUntil(maxCycles int, cond func() bool) bool {
+	for i := 0; i < maxCycles; i++ {
+		if cond() {
+			return true
+		}
+		r.Step()
+	}
+	return cond()
+}
+
+// Step applies the stimulus, records the pads and steps the target by one system clock cycle.
+// Pad changes made by the target during a cycle are recorded at the start of the next one.
+func (r *Recorder) Step() {
+	pins := r.target.Pins()
+	if r.stimulus != nil {
+		r.stimulus(r.cycle, pins)
+	}
+	r.record(pins)
+	r.target.Step()
+	r.cycle++
+	r.wave.End = r.cycle
+}
+
+func (r *Recorder) record(pins *Pins) {
+	s := Sample{Cycle: r.cycle, Out: pins.Out, OE: pins.OE, In: pins.In}
+	r.wave.add(s)
+}
+
+// Waveform returns the capture so far, including the pad state after the last cycle.
+func (r *Recorder) Waveform() *Waveform {
+	r.record(r.target.Pins())
+	return &r.wave
+}
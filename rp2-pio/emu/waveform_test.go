@@ -0,0 +1,109 @@
+package emu
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+func TestRecorder(t *testing.T) {
+	sm := load(t, 0, `
+.program square
+	set pindirs, 1
+.wrap_target
+	set pins, 1 [1]
+	set pins, 0
+.wrap
+`, func(cfg *pio.StateMachineConfig) {
+		setPins(3, 1)(cfg)
+		cfg.SetClkDivIntFrac(2, 0)
+	})
+	rec := NewRecorder(sm, 125_000_000)
+	rec.Run(14)
+	w := rec.Waveform()
+	want := []Edge{{0, false}, {4, true}, {8, false}, {10, true}, {14, false}}
+	if got := w.Edges(3); !reflect.DeepEqual(got, want) {
+		t.Errorf("got edges %v, want %v", got, want)
+	}
+	if got := w.At(5); got.OE != 1<<3 || got.Out != 1<<3 {
+		t.Errorf("got pads %+v at cycle 5", got)
+	}
+	if got := w.Time(10); got != 80*time.Nanosecond {
+		t.Errorf("got time %v for cycle 10 at 125 MHz, want 80ns", got)
+	}
+}
+
+func TestVCD(t *testing.T) {
+	sm := load(t, 0, ".program copy\n\tmov pins, pins", func(cfg *pio.StateMachineConfig) {
+		cfg.PinCtrl |= 1<<pio0_SM0_PINCTRL_OUT_COUNT_Pos | 1<<pio0_SM0_PINCTRL_OUT_BASE_Pos
+	})
+	sm.Pins().OE = 1 << 1
+
+	// Pin 0 is driven high from 20ns to 40ns, in the middle of a system clock cycle.
+	stimulus, err := ReadVCD(strings.NewReader(`
+$timescale 1 ns $end
+$scope module tb $end
+$var wire 1 ! GPIO0 $end
+$var wire 8 " bus [7:0] $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+0!
+b0 "
+$end
+#20
+1!
+b11 "
+#40
+0!
+#100
+`), 100_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Edge{{0, false}, {2, true}, {4, false}}; !reflect.DeepEqual(stimulus.Edges(0), want) {
+		t.Fatalf("got stimulus edges %v, want %v", stimulus.Edges(0), want)
+	}
+	rec := NewRecorder(sm, 100_000_000)
+	rec.SetStimulus(stimulus.Stimulus())
+	rec.Run(int(stimulus.End))
+	w := rec.Waveform()
+	if want := []Edge{{0, false}, {3, true}, {5, false}}; !reflect.DeepEqual(w.Edges(1), want) {
+		t.Errorf("got output edges %v, want %v", w.Edges(1), want)
+	}
+
+	var buf bytes.Buffer
+	if err := w.WriteVCD(&buf, 0b11); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"$var wire 1 # gpio1 $end", "$var wire 1 $ gpio1_oe $end", "#30000\n1#\n"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("VCD output is missing %q:\n%s", line, buf.String())
+		}
+	}
+	back, err := ReadVCD(&buf, 100_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back.Edges(1), w.Edges(1)) || back.End != w.End {
+		t.Errorf("VCD round trip changed edges to %v, end %d", back.Edges(1), back.End)
+	}
+}
+
+func TestStimulusCallback(t *testing.T) {
+	sm := load(t, 0, ".program count\n\twait 1 pin 0\n\twait 0 pin 0\n\tjmp x-- 0", nil)
+	sm.SetX(100)
+	rec := NewRecorder(sm, 125_000_000)
+	rec.SetStimulus(func(cycle uint64, pins *Pins) {
+		pins.In = uint32(cycle/5) & 1 // 10 cycle period.
+	})
+	rec.Run(100)
+	if got := 100 - sm.GetX(); got != 9 {
+		t.Errorf("counted %d pulses, want 9", got)
+	}
+}
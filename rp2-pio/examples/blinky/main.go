@@ -1,4 +1,4 @@
-//go:generate pioasm -o go blink.pio blink_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go blink.pio blink_pio.go
 
 package main
 
@@ -9,7 +9,7 @@ import (
 	pio "github.com/tinygo-org/pio/rp2-pio"
 )
 
-//go:generate pioasm -o go rxfifoput.pio rxfifoput_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go rxfifoput.pio rxfifoput_pio.go
 
 /*
 RxFIFOPut is a simple example of a PIO counter demonstrating how to use the new
@@ -8,7 +8,7 @@ import (
 	pio "github.com/tinygo-org/pio/rp2-pio"
 )
 
-//go:generate pioasm -o go rxfifoputget.pio rxfifoputget_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go rxfifoputget.pio rxfifoputget_pio.go
 
 /*
 RxFIFOPutGet is a non-functional example purely for documentation purposes.
@@ -0,0 +1,254 @@
+package pio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteAssembly writes the program as pioasm source which can be assembled by the pico-sdk's pioasm or [ParseAssembly].
+// Jump targets without a label in Symbols are given generated labels of the form `L<address>`.
+// Instructions which cannot be decoded for the program's PIO version are written as .word directives.
+//
+// Programs built with [AssemblerV0] and [AssemblerV1] can be exported by wrapping their instructions:
+//
+//	prog := pio.AssembledProgram{Name: "pulsar", Instructions: program[:], Origin: -1, Wrap: 5, SetCount: -1}
+//	err := prog.WriteAssembly(os.Stdout)
+func (p *AssembledProgram) WriteAssembly(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, ".program %s\n", p.Name)
+	if p.PIOVersion > 0 {
+		fmt.Fprintf(bw, ".pio_version %d\n", p.PIOVersion)
+	}
+	if p.Origin >= 0 {
+		fmt.Fprintf(bw, ".origin %d\n", p.Origin)
+	}
+	if p.SidesetBits > 0 {
+		fmt.Fprintf(bw, ".side_set %d", p.SidesetBits)
+		if p.SidesetOptional {
+			bw.WriteString(" opt")
+		}
+		if p.SidesetPindirs {
+			bw.WriteString(" pindirs")
+		}
+		bw.WriteByte('\n')
+	}
+	if p.FifoJoin != FifoJoinNone {
+		fmt.Fprintf(bw, ".fifo %s\n", fifoJoinDirective(p.FifoJoin))
+	}
+	writeShiftDirective(bw, ".in", p.In)
+	writeShiftDirective(bw, ".out", p.Out)
+	if p.SetCount >= 0 {
+		fmt.Fprintf(bw, ".set %d\n", p.SetCount)
+	}
+	if p.MovStatus != nil {
+		fmt.Fprintf(bw, ".mov_status %s\n", movStatusDirective(p.MovStatus))
+	}
+	if p.ClkDiv > 0 {
+		fmt.Fprintf(bw, ".clock_div %s\n", strconv.FormatFloat(float64(p.ClkDiv), 'g', -1, 32))
+	}
+	for _, opt := range p.LangOpts {
+		fmt.Fprintf(bw, ".lang_opt %s %s = %s\n", opt.Lang, opt.Name, opt.Value)
+	}
+	for _, sym := range p.Symbols {
+		if !sym.Label {
+			fmt.Fprintf(bw, ".define %s%s %d\n", publicPrefix(sym.Public), sym.Name, sym.Value)
+		}
+	}
+	bw.WriteByte('\n')
+
+	labels := p.jumpLabels()
+	for i, instr := range p.Instructions {
+		if i == int(p.WrapTarget) {
+			bw.WriteString(".wrap_target\n")
+		}
+		for _, sym := range labels[i] {
+			fmt.Fprintf(bw, "%s%s:\n", publicPrefix(sym.Public), sym.Name)
+		}
+		var in Instruction
+		if err := in.Decode(instr, p.SidesetBits, p.SidesetOptional, p.PIOVersion); err != nil {
+			fmt.Fprintf(bw, "    .word 0x%04x\n", instr)
+		} else if in.Kind == InstrJMP && int(in.Address) < len(labels) && len(labels[in.Address]) > 0 {
+			fmt.Fprintf(bw, "    %s\n", in.format(labels[in.Address][0].Name))
+		} else {
+			fmt.Fprintf(bw, "    %s\n", in.String())
+		}
+		if i == int(p.Wrap) {
+			bw.WriteString(".wrap\n")
+		}
+	}
+	for _, block := range p.CodeBlocks {
+		fmt.Fprintf(bw, "\n%% %s {\n%s%%}\n", block.Lang, block.Code)
+	}
+	return bw.Flush()
+}
+
+// jumpLabels returns the labels at each instruction address, generating labels for jump targets without one.
+func (p *AssembledProgram) jumpLabels() [][]Symbol {
+	labels := make([][]Symbol, len(p.Instructions))
+	names := make(map[string]bool)
+	for _, sym := range p.Symbols {
+		names[sym.Name] = true
+		if sym.Label && sym.Value >= 0 && sym.Value < len(labels) {
+			labels[sym.Value] = append(labels[sym.Value], sym)
+		}
+	}
+	for _, instr := range p.Instructions {
+		var in Instruction
+		if in.Decode(instr, p.SidesetBits, p.SidesetOptional, p.PIOVersion) != nil || in.Kind != InstrJMP ||
+			int(in.Address) >= len(labels) || len(labels[in.Address]) > 0 {
+			continue
+		}
+		name := "L" + strconv.Itoa(int(in.Address))
+		for names[name] {
+			name = "_" + name
+		}
+		names[name] = true
+		labels[in.Address] = append(labels[in.Address], Symbol{Name: name, Value: int(in.Address), Label: true})
+	}
+	return labels
+}
+
+func publicPrefix(public bool) string {
+	if public {
+		return "public "
+	}
+	return ""
+}
+
+func writeShiftDirective(bw *bufio.Writer, name string, sd *ShiftDirective) {
+	if sd == nil {
+		return
+	}
+	dir := "right"
+	if !sd.ShiftRight {
+		dir = "left"
+	}
+	fmt.Fprintf(bw, "%s %d %s", name, sd.PinCount, dir)
+	if sd.Auto {
+		bw.WriteString(" auto")
+	}
+	fmt.Fprintf(bw, " %d\n", sd.Threshold)
+}
+
+func fifoJoinDirective(join FifoJoin) string {
+	switch join {
+	case FifoJoinTx:
+		return "tx"
+	case FifoJoinRx:
+		return "rx"
+	case FifoJoinRxGet:
+		return "txget"
+	case FifoJoinRxPut:
+		return "txput"
+	case FifoJoinRxPutGet:
+		return "putget"
+	}
+	return "txrx"
+}
+
+func movStatusDirective(st *MovStatusDirective) string {
+	switch st.Sel {
+	case MovStatusTxLessthan:
+		return "txfifo < " + strconv.Itoa(int(st.N))
+	case MovStatusRxLessthan:
+		return "rxfifo < " + strconv.Itoa(int(st.N))
+	}
+	mode := ""
+	switch st.N >> 3 {
+	case 0b01:
+		mode = "prev "
+	case 0b10:
+		mode = "next "
+	}
+	return "irq " + mode + "set " + strconv.Itoa(int(st.N&0b111))
+}
+
+// WriteCHeader writes the program as a pico-sdk style C header, in the format `pioasm -o c-sdk` generates
+// for .pio.h files. Code blocks declared for the c-sdk language are included.
+func (p *AssembledProgram) WriteCHeader(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	name := p.Name
+	bw.WriteString("// -------------------------------------------------- //\n")
+	bw.WriteString("// This file is autogenerated by pioasm; do not edit! //\n")
+	bw.WriteString("// -------------------------------------------------- //\n\n")
+	bw.WriteString("#pragma once\n\n")
+	bw.WriteString("#if !PICO_NO_HARDWARE\n#include \"hardware/pio.h\"\n#endif\n\n")
+
+	bar := "// " + strings.Repeat("-", len(name)) + " //\n"
+	fmt.Fprintf(bw, "%s// %s //\n%s\n", bar, name, bar)
+	fmt.Fprintf(bw, "#define %s_wrap_target %d\n", name, p.WrapTarget)
+	fmt.Fprintf(bw, "#define %s_wrap %d\n", name, p.Wrap)
+	fmt.Fprintf(bw, "#define %s_pio_version %d\n", name, p.PIOVersion)
+	for _, sym := range p.Symbols {
+		switch {
+		case sym.Public && sym.Label:
+			fmt.Fprintf(bw, "#define %s_offset_%s %du\n", name, sym.Name, sym.Value)
+		case sym.Public:
+			fmt.Fprintf(bw, "#define %s_%s %d\n", name, sym.Name, sym.Value)
+		}
+	}
+
+	fmt.Fprintf(bw, "\nstatic const uint16_t %s_program_instructions[] = {\n", name)
+	dis := p.Disassembler()
+	for i, instr := range p.Instructions {
+		if i == int(p.WrapTarget) {
+			bw.WriteString("            //     .wrap_target\n")
+		}
+		fmt.Fprintf(bw, "    0x%04x, // %2d: %s\n", instr, i, dis.Disassemble(instr))
+		if i == int(p.Wrap) {
+			bw.WriteString("            //     .wrap\n")
+		}
+	}
+	bw.WriteString("};\n\n")
+
+	bw.WriteString("#if !PICO_NO_HARDWARE\n")
+	fmt.Fprintf(bw, "static const struct pio_program %s_program = {\n", name)
+	fmt.Fprintf(bw, "    .instructions = %s_program_instructions,\n", name)
+	fmt.Fprintf(bw, "    .length = %d,\n", len(p.Instructions))
+	fmt.Fprintf(bw, "    .origin = %d,\n", p.Origin)
+	fmt.Fprintf(bw, "    .pio_version = %s_pio_version,\n", name)
+	bw.WriteString("#if PICO_PIO_VERSION > 0\n    .used_gpio_ranges = 0x0\n#endif\n};\n\n")
+
+	fmt.Fprintf(bw, "static inline pio_sm_config %s_program_get_default_config(uint offset) {\n", name)
+	bw.WriteString("    pio_sm_config c = pio_get_default_sm_config();\n")
+	fmt.Fprintf(bw, "    sm_config_set_wrap(&c, offset + %s_wrap_target, offset + %s_wrap);\n", name, name)
+	if p.SidesetBits > 0 {
+		fmt.Fprintf(bw, "    sm_config_set_sideset(&c, %d, %t, %t);\n", p.SidesetFieldBits(), p.SidesetOptional, p.SidesetPindirs)
+	}
+	if p.In != nil {
+		fmt.Fprintf(bw, "    sm_config_set_in_pin_count(&c, %d);\n", p.In.PinCount)
+		fmt.Fprintf(bw, "    sm_config_set_in_shift(&c, %t, %t, %d);\n", p.In.ShiftRight, p.In.Auto, p.In.Threshold)
+	}
+	if p.Out != nil {
+		fmt.Fprintf(bw, "    sm_config_set_out_pin_count(&c, %d);\n", p.Out.PinCount)
+		fmt.Fprintf(bw, "    sm_config_set_out_shift(&c, %t, %t, %d);\n", p.Out.ShiftRight, p.Out.Auto, p.Out.Threshold)
+	}
+	if p.SetCount >= 0 {
+		fmt.Fprintf(bw, "    sm_config_set_set_pin_count(&c, %d);\n", p.SetCount)
+	}
+	if p.FifoJoin != FifoJoinNone && int(p.FifoJoin) < len(cFifoJoinNames) {
+		fmt.Fprintf(bw, "    sm_config_set_fifo_join(&c, PIO_FIFO_JOIN_%s);\n", cFifoJoinNames[p.FifoJoin])
+	}
+	if p.MovStatus != nil {
+		fmt.Fprintf(bw, "    sm_config_set_mov_status(&c, %s, %d);\n", cMovStatusNames[p.MovStatus.Sel&0b11], p.MovStatus.N)
+	}
+	if p.ClkDiv > 0 {
+		fmt.Fprintf(bw, "    sm_config_set_clkdiv(&c, %s);\n", strconv.FormatFloat(float64(p.ClkDiv), 'g', -1, 32))
+	}
+	bw.WriteString("    return c;\n}\n")
+	for _, block := range p.CodeBlocks {
+		if block.Lang == "c-sdk" {
+			bw.WriteString("\n" + block.Code)
+		}
+	}
+	bw.WriteString("#endif\n")
+	return bw.Flush()
+}
+
+var (
+	cFifoJoinNames  = [...]string{"NONE", "TX", "RX", "TXGET", "TXPUT", "PUTGET"}
+	cMovStatusNames = [4]string{"STATUS_TX_LESSTHAN", "STATUS_RX_LESSTHAN", "STATUS_IRQ_SET", ""}
+)
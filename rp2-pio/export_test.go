@@ -0,0 +1,149 @@
+package pio
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteAssemblyRoundTrip(t *testing.T) {
+	var tests = []struct {
+		name string
+		file string // Read source from file if set.
+		src  string
+	}{
+		{name: "blink", file: "examples/blinky/blink.pio"},
+		{name: "rxfifoput", file: "examples/rxfifoput/rxfifoput.pio"},
+		{name: "directives", src: `
+.program dirs
+.side_set 2 opt pindirs
+.in 3 left auto 8
+.out 2 right 16
+.set 4
+.mov_status rxfifo < 2
+.clock_div 2.5
+.define public BIT 3
+.origin 4
+public start:
+	set pins, 1 side 3 [1]
+	jmp x-- start
+	in pins, 3
+	out pins, 2 side 0
+`},
+		{name: "v1", src: `
+.pio_version 1
+.program irqs
+.fifo putget
+.mov_status irq next set 2
+	irq wait 1 rel
+	wait 0 irq prev 4
+	wait 1 jmppin + 2
+	mov pindirs, null
+	mov rxfifo[y], isr
+	mov osr, rxfifo[1]
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := []byte(test.src)
+			if test.file != "" {
+				var err error
+				src, err = os.ReadFile(test.file)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			asm, err := ParseAssembly(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := asm.Programs[0]
+			var buf bytes.Buffer
+			err = want.WriteAssembly(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			asm, err = ParseAssembly(buf.Bytes())
+			if err != nil {
+				t.Fatalf("%v\n%s", err, buf.String())
+			}
+			got := asm.Programs[0]
+			// Code blocks and symbols are checked separately, labels are exported as written.
+			got.CodeBlocks, want.CodeBlocks = nil, nil
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip mismatch:\n%+v\n%+v\n%s", got, want, buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteAssemblyLabels(t *testing.T) {
+	// Pulsar as built with the fluent API, without labels.
+	asm := AssemblerV0{}
+	prog := AssembledProgram{
+		Name: "pulsar",
+		Instructions: []uint16{
+			asm.Set(SetDestPindirs, 1).Encode(),
+			asm.Pull(false, true).Encode(),
+			asm.Mov(MovDestX, MovSrcOSR).Encode(),
+			asm.Set(SetDestPins, 1).Delay(1).Encode(),
+			asm.Set(SetDestPins, 0).Encode(),
+			asm.Jmp(JmpXNZeroDec, 3).Encode(),
+		},
+		Origin:   -1,
+		Wrap:     5,
+		SetCount: -1,
+	}
+	var buf bytes.Buffer
+	err := prog.WriteAssembly(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `.program pulsar
+
+.wrap_target
+    set    pindirs, 1
+    pull   block
+    mov    x, osr
+L3:
+    set    pins, 1                [1]
+    set    pins, 0
+    jmp    x--, L3
+.wrap
+`
+	if buf.String() != expect {
+		t.Errorf("output mismatch got!=expected:\n%s\n%s", buf.String(), expect)
+	}
+}
+
+func TestWriteCHeader(t *testing.T) {
+	src, err := os.ReadFile("examples/blinky/blink.pio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	asm, err := ParseAssembly(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = asm.Programs[0].WriteCHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"#define blink_wrap_target 2\n",
+		"#define blink_wrap 7\n",
+		"static const uint16_t blink_program_instructions[] = {\n    0x80a0, //  0: pull   block\n",
+		"            //     .wrap_target\n    0xa022, //  2: mov    x, y\n",
+		"    0x0047, //  7: jmp    x--, 7\n            //     .wrap\n};\n",
+		"    .length = 8,\n    .origin = -1,\n",
+		"static inline pio_sm_config blink_program_get_default_config(uint offset) {\n",
+		"    sm_config_set_wrap(&c, offset + blink_wrap_target, offset + blink_wrap);\n    return c;\n}\n",
+	} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("header missing %q:\n%s", expect, buf.String())
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package pio
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// fuzzInput hands out fuzzer bytes as bounded values, zero once exhausted.
+type fuzzInput []byte
+
+func (in *fuzzInput) next(n int) uint8 {
+	if len(*in) == 0 {
+		return 0
+	}
+	b := (*in)[0]
+	*in = (*in)[1:]
+	return uint8(int(b) % n)
+}
+
+func (in *fuzzInput) flag() bool { return in.next(2) == 1 }
+
+// commonAssembler holds the instructions AssemblerV0 and AssemblerV1 encode alike.
+type commonAssembler interface {
+	Jmp(cond JmpCond, addr uint8) instructionV0
+	WaitGPIO(polarity bool, pin uint8) instructionV0
+	WaitPin(polarity bool, pin uint8) instructionV0
+	In(src InSrc, value uint8) instructionV0
+	Out(dest OutDest, value uint8) instructionV0
+	Push(ifFull, block bool) instructionV0
+	Pull(ifEmpty, block bool) instructionV0
+	Mov(dest MovDest, src MovSrc) instructionV0
+	MovInvert(dest MovDest, src MovSrc) instructionV0
+	MovReverse(dest MovDest, src MovSrc) instructionV0
+	Set(dest SetDest, value uint8) instructionV0
+	Nop() instructionV0
+	Disassembler() Disassembler
+}
+
+var (
+	fuzzInSrcs   = []InSrc{InSrcPins, InSrcX, InSrcY, InSrcNull, InSrcISR, InSrcOSR}
+	fuzzMovSrcs  = []MovSrc{MovSrcPins, MovSrcX, MovSrcY, MovSrcNull, MovSrcStatus, MovSrcISR, MovSrcOSR}
+	fuzzSetDests = []SetDest{SetDestPins, SetDestX, SetDestY, SetDestPindirs}
+)
+
+// fuzzProgram builds a program from fuzzer input with AssemblerV0 or AssemblerV1, choosing every
+// operand within range so that each instruction must encode without error. It returns the
+// program along with the assembler's disassembler.
+func fuzzProgram(t *testing.T, in fuzzInput) (program []uint16, dis Disassembler) {
+	version := in.next(2)
+	asm0 := AssemblerV0{SidesetBits: in.next(6)}
+	asm0.SidesetOptional = asm0.SidesetBits < 5 && in.flag()
+	asm1 := AssemblerV1(asm0)
+	var asm commonAssembler = asm0
+	if version == 1 {
+		asm = asm1
+	}
+	delayMax := 1 << (5 - asm0.sidesetFieldBits())
+
+	for len(in) > 0 && len(program) < 32 {
+		var instr instructionV0
+		switch in.next(10) {
+		case 0:
+			instr = asm.Jmp(JmpCond(in.next(8)), in.next(32))
+		case 1:
+			if in.flag() {
+				instr = asm.WaitGPIO(in.flag(), in.next(32))
+			} else {
+				instr = asm.WaitPin(in.flag(), in.next(32))
+			}
+		case 2:
+			polarity, index := in.flag(), in.next(8)
+			if version == 1 {
+				instr = asm1.WaitIRQMode(polarity, index, IRQIndexMode(in.next(4)))
+			} else {
+				instr = asm0.WaitIRQ(polarity, in.flag(), index)
+			}
+		case 3:
+			instr = asm.In(fuzzInSrcs[in.next(len(fuzzInSrcs))], 1+in.next(32))
+		case 4:
+			instr = asm.Out(OutDest(in.next(8)), 1+in.next(32))
+		case 5:
+			if in.flag() {
+				instr = asm.Pull(in.flag(), in.flag())
+			} else {
+				instr = asm.Push(in.flag(), in.flag())
+			}
+		case 6:
+			dest, src := MovDest(in.next(8)), fuzzMovSrcs[in.next(len(fuzzMovSrcs))]
+			if dest == MovDestPindirs && version == 0 {
+				dest = MovDestY
+			}
+			switch in.next(4) {
+			case 0:
+				instr = asm.Mov(dest, src)
+			case 1:
+				instr = asm.MovInvert(dest, src)
+			case 2:
+				instr = asm.MovReverse(dest, src)
+			default:
+				instr = asm.Nop()
+			}
+		case 7:
+			index, op := in.next(8), in.next(3)
+			if version == 1 {
+				mode := IRQIndexMode(in.next(4))
+				instr = [3]func(uint8, IRQIndexMode) instructionV0{asm1.IRQSet, asm1.IRQClear, asm1.IRQWait}[op](index, mode)
+			} else {
+				instr = [3]func(bool, uint8) instructionV0{asm0.IRQSet, asm0.IRQClear, asm0.IRQWait}[op](in.flag(), index)
+			}
+		case 8:
+			instr = asm.Set(fuzzSetDests[in.next(len(fuzzSetDests))], in.next(32))
+		case 9:
+			if version == 0 {
+				instr = asm.Nop()
+				break
+			}
+			immediate := in.flag()
+			var index uint8
+			if immediate {
+				index = in.next(4)
+			}
+			switch in.next(3) {
+			case 0:
+				instr = asm1.WaitJmpPin(in.flag(), in.next(4))
+			case 1:
+				instr = asm1.MovOSRFromRx(immediate, index)
+			default:
+				instr = asm1.MovISRToRx(immediate, index)
+			}
+		}
+		if asm0.SidesetBits > 0 && (!asm0.SidesetOptional || in.flag()) {
+			instr = instr.Side(in.next(1 << asm0.SidesetBits))
+		}
+		instr = instr.Delay(in.next(delayMax))
+		encoded, err := instr.EncodeChecked()
+		if err != nil {
+			t.Fatalf("instruction %d: %v", len(program), err)
+		}
+		program = append(program, encoded)
+	}
+	return program, asm.Disassembler()
+}
+
+// checkRoundTrip decodes, re-encodes, disassembles and reassembles program, whose side-set
+// configuration and PIO version are those of dis.
+func checkRoundTrip(t *testing.T, program []uint16, dis Disassembler) {
+	t.Helper()
+	var src strings.Builder
+	if dis.PIOVersion > 0 {
+		fmt.Fprintf(&src, ".pio_version %d\n", dis.PIOVersion)
+	}
+	src.WriteString(".program roundtrip\n")
+	if dis.SidesetBits > 0 {
+		fmt.Fprintf(&src, ".side_set %d", dis.SidesetBits)
+		if dis.SidesetOptional {
+			src.WriteString(" opt")
+		}
+		src.WriteString("\n")
+	}
+	for i, instr := range program {
+		in, err := DecodeInstruction(instr, dis.SidesetBits, dis.SidesetOptional, dis.PIOVersion)
+		if err != nil {
+			t.Fatalf("instruction %d %#04x: decode: %v", i, instr, err)
+		}
+		if encoded, err := in.Encode(); err != nil || encoded != instr {
+			t.Errorf("instruction %d %#04x: re-encoded as %#04x, %v", i, instr, encoded, err)
+		}
+		fmt.Fprintf(&src, "\t%s\n", dis.Disassemble(instr))
+	}
+	asm, err := ParseAssembly([]byte(src.String()))
+	if err != nil {
+		t.Fatalf("reassembling:\n%s\n%v", src.String(), err)
+	}
+	got := asm.Programs[0].Instructions
+	if len(got) != len(program) {
+		t.Fatalf("reassembled %d instructions, want %d:\n%s", len(got), len(program), src.String())
+	}
+	for i := range program {
+		if got[i] != program[i] {
+			t.Errorf("instruction %d %q: reassembled as %#04x, want %#04x", i, dis.Disassemble(program[i]), got[i], program[i])
+		}
+	}
+}
+
+func FuzzAssemblerRoundTrip(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 0, 1, 5})
+	f.Add([]byte{1, 2, 1, 2, 1, 3, 1, 9, 0, 1, 1, 1, 1, 6, 3, 1, 2, 0, 1})
+	f.Add([]byte{0, 5, 0, 3, 7, 6, 31, 4, 7, 2, 20, 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		program, dis := fuzzProgram(t, data)
+		if len(program) == 0 {
+			return
+		}
+		checkRoundTrip(t, program, dis)
+	})
+}
+
+// clkdivReference is the exact clock divider for a state machine clock of cpuFreq/div, computed
+// with rationals. ok is false if the divider is out of the range splitClkdiv accepts.
+type clkdivReference struct {
+	whole uint16
+	frac  uint8
+	ok    bool
+	// freqError is the relative error of the achieved state machine frequency from the target.
+	freqError float64
+}
+
+func referenceClkDiv(cpuFreq uint32, div *big.Rat) clkdivReference {
+	// The divider is truncated to 1/256 steps.
+	steps := new(big.Int).Quo(new(big.Int).Mul(div.Num(), big.NewInt(256)), div.Denom())
+	if steps.Cmp(big.NewInt(256)) < 0 || steps.Cmp(big.NewInt(256*65535)) > 0 {
+		return clkdivReference{}
+	}
+	n := steps.Uint64()
+	target := new(big.Rat).Quo(new(big.Rat).SetInt64(int64(cpuFreq)), div)
+	achieved := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(int64(cpuFreq)), big.NewInt(256)), steps)
+	freqError, _ := new(big.Rat).Quo(new(big.Rat).Sub(achieved, target), target).Float64()
+	return clkdivReference{whole: uint16(n / 256), frac: uint8(n % 256), ok: true, freqError: freqError}
+}
+
+// checkClkDiv compares a clock divider computed for cpuFreq/div against the reference. The
+// achieved frequency is never below the target and above it by less than one 1/256 step.
+func checkClkDiv(t *testing.T, cpuFreq uint32, div *big.Rat, whole uint16, frac uint8, err error) {
+	t.Helper()
+	ref := referenceClkDiv(cpuFreq, div)
+	if (err == nil) != ref.ok {
+		t.Fatalf("divider %s of %d Hz: got error %v, want ok %t", div.FloatString(6), cpuFreq, err, ref.ok)
+	} else if !ref.ok {
+		return
+	}
+	if whole != ref.whole || frac != ref.frac {
+		t.Errorf("divider %s of %d Hz: got %d+%d/256, want %d+%d/256", div.FloatString(6), cpuFreq, whole, frac, ref.whole, ref.frac)
+	}
+	if bound := 1 / (256*float64(ref.whole) + float64(ref.frac)); ref.freqError < 0 || ref.freqError >= bound {
+		t.Errorf("divider %s of %d Hz: frequency error %g outside [0, %g)", div.FloatString(6), cpuFreq, ref.freqError, bound)
+	}
+}
+
+func FuzzClkDivFromFrequency(f *testing.F) {
+	f.Add(uint32(7_200_000), uint32(125_000_000))
+	f.Add(uint32(1), uint32(150_000_000))
+	f.Add(uint32(125_000_000), uint32(125_000_000))
+	f.Fuzz(func(t *testing.T, freq, cpuFreq uint32) {
+		whole, frac, err := ClkDivFromFrequency(freq, cpuFreq)
+		if freq == 0 {
+			if err == nil {
+				t.Fatal("expected an error for a zero frequency")
+			}
+			return
+		}
+		checkClkDiv(t, cpuFreq, big.NewRat(int64(cpuFreq), int64(freq)), whole, frac, err)
+	})
+}
+
+func FuzzClkDivFromPeriod(f *testing.F) {
+	f.Add(uint32(1000), uint32(125_000_000))
+	f.Add(uint32(1_000_000_000), uint32(125_000_000))
+	f.Add(uint32(8), uint32(125_000_000))
+	f.Fuzz(func(t *testing.T, period, cpuFreq uint32) {
+		whole, frac, err := ClkDivFromPeriod(period, cpuFreq)
+		div := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(int64(period)), big.NewInt(int64(cpuFreq))), big.NewInt(1e9))
+		checkClkDiv(t, cpuFreq, div, whole, frac, err)
+	})
+}
@@ -0,0 +1,133 @@
+package pio
+
+// ProgramHandle is a program resident in the instruction memory of a PIO block. Handles are
+// shared: adding a program identical to one already resident on the block returns the existing
+// handle with its reference count incremented instead of loading a second copy. Each successful
+// call to [PIO.AddProgramHandle] or [PIO.LoadProgramHandle] must be balanced by one call to
+// [ProgramHandle.Release], which frees the program's instruction memory once the last user
+// releases it.
+type ProgramHandle struct {
+	pio *PIO
+	// instructions is a copy of the program before relocation, to recognise identical programs.
+	instructions []uint16
+	offset       uint8
+	origin       int8
+	wrapTarget   uint8 // Program relative.
+	wrap         uint8 // Program relative.
+	refs         uint16
+	next         *ProgramHandle // Next handle resident on the same PIO block.
+}
+
+// AddProgramHandle loads a program as [PIO.AddProgram] does and returns a handle to it. If an
+// identical program is already resident at an offset satisfying origin, that program is
+// shared instead. The program wraps from its last instruction to its first.
+func (pio *PIO) AddProgramHandle(instructions []uint16, origin int8) (*ProgramHandle, error) {
+	wrap := uint8(0)
+	if len(instructions) > 0 {
+		wrap = uint8(len(instructions) - 1)
+	}
+	return pio.addProgramHandle(instructions, origin, 0, wrap)
+}
+
+func (pio *PIO) addProgramHandle(instructions []uint16, origin int8, wrapTarget, wrap uint8) (*ProgramHandle, error) {
+	state := lockClaims()
+	for h := pio.programs; h != nil; h = h.next {
+		if h.matches(instructions, origin, wrapTarget, wrap) {
+			h.refs++
+			unlockClaims(state)
+			return h, nil
+		}
+	}
+	unlockClaims(state)
+	// Concurrent first users of a program may each load a copy. Both copies are valid handles.
+	offset, err := pio.AddProgram(instructions, origin)
+	if err != nil {
+		return nil, err
+	}
+	h := &ProgramHandle{
+		pio:          pio,
+		instructions: append([]uint16(nil), instructions...),
+		offset:       offset,
+		origin:       origin,
+		wrapTarget:   wrapTarget,
+		wrap:         wrap,
+		refs:         1,
+	}
+	state = lockClaims()
+	h.next = pio.programs
+	pio.programs = h
+	unlockClaims(state)
+	return h, nil
+}
+
+func (h *ProgramHandle) matches(instructions []uint16, origin int8, wrapTarget, wrap uint8) bool {
+	if origin >= 0 && uint8(origin) != h.offset {
+		return false
+	}
+	if h.wrapTarget != wrapTarget || h.wrap != wrap || len(h.instructions) != len(instructions) {
+		return false
+	}
+	for i := range instructions {
+		if h.instructions[i] != instructions[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Offset returns the offset in instruction memory the program is loaded at.
+func (h *ProgramHandle) Offset() uint8 { return h.offset }
+
+// Len returns the number of instructions of the program.
+func (h *ProgramHandle) Len() uint8 { return uint8(len(h.instructions)) }
+
+// Origin returns the origin the program was first added with, or -1 if it is relocatable.
+func (h *ProgramHandle) Origin() int8 { return h.origin }
+
+// Wrap returns the absolute addresses the program wraps to and from, as passed to
+// [StateMachineConfig.SetWrap].
+func (h *ProgramHandle) Wrap() (wrapTarget, wrap uint8) {
+	return h.offset + h.wrapTarget, h.offset + h.wrap
+}
+
+// References returns the number of users holding the handle, 0 once the program has been removed.
+func (h *ProgramHandle) References() int {
+	state := lockClaims()
+	refs := h.refs
+	unlockClaims(state)
+	return int(refs)
+}
+
+// Release drops a reference to the program. Releasing the last reference removes the program,
+// writing trap instructions over it as [PIO.ClearProgramSection] does. Releasing a removed
+// program has no effect. Release does not allocate and is safe from any goroutine, interrupt
+// handler or core, unlike [PIO.AddProgramHandle] which allocates the handle.
+func (h *ProgramHandle) Release() {
+	state := lockClaims()
+	last := h.refs == 1
+	if h.refs > 0 {
+		h.refs--
+	}
+	if last {
+		// Stop sharing the program before its memory is cleared.
+		h.pio.forgetPrograms(h.offset, h.Len())
+	}
+	unlockClaims(state)
+	if last {
+		h.pio.ClearProgramSection(h.offset, h.Len())
+	}
+}
+
+// forgetPrograms drops the handles of programs overlapping a cleared section of instruction
+// memory so that they are not shared again. The claim lock must be held.
+func (pio *PIO) forgetPrograms(offset, n uint8) {
+	for link := &pio.programs; *link != nil; {
+		h := *link
+		if h.offset < offset+n && offset < h.offset+h.Len() {
+			h.refs = 0
+			*link, h.next = h.next, nil
+			continue
+		}
+		link = &h.next
+	}
+}
@@ -2,7 +2,9 @@ package pio
 
 import (
 	"errors"
+	"fmt"
 	"math"
+	"math/bits"
 )
 
 // 5 bits of delay/sideset.
@@ -23,18 +25,42 @@ const delaySidesetbits = 0b1_1111 << 8
 //		asm.Nop().Side(1).Encode(),
 //		asm.Nop().Side(0).Encode(),
 //	}
+//
+// Optional side-set, the equivalent of pioasm's `.side_set <n> opt`, is enabled with SidesetOptional.
+// The side-set field then has an extra enable bit in its most significant position which is set by
+// [instructionV0.Side]. Instructions without a Side call leave side-set pins unchanged.
 type AssemblerV0 struct {
+	// SidesetBits is the number of side-set value bits, not including the optional enable bit.
 	SidesetBits uint8
+	// SidesetOptional makes side-set optional, stealing an extra bit from the delay field as side-set enable.
+	SidesetOptional bool
+	// SidesetPindirs makes side-set drive pin directions instead of pin values.
+	SidesetPindirs bool
 }
 
 type instructionV0 struct {
 	instr uint16
 	asm   AssemblerV0
-}
+	err   error // First encoding error, reported by EncodeChecked.
+}
+
+var (
+	// ErrArgOverflow is returned by EncodeChecked when an instruction argument does not fit its field.
+	ErrArgOverflow = errors.New("pio: instruction argument out of range")
+	// ErrSidesetOverflow is returned by EncodeChecked when a side-set value does not fit in the side-set bits.
+	ErrSidesetOverflow = errors.New("pio: side-set value out of range")
+	// ErrDelayOverflow is returned by EncodeChecked when a delay does not fit in the bits not used by side-set.
+	ErrDelayOverflow = errors.New("pio: delay out of range")
+	// ErrReservedEncoding is returned by EncodeChecked when an instruction uses a reserved source or destination.
+	ErrReservedEncoding = errors.New("pio: reserved instruction encoding")
+	// ErrRequiresV1 is returned by EncodeChecked when an instruction built with [AssemblerV0] uses
+	// functionality only available on PIO version 1 (RP2350).
+	ErrRequiresV1 = errors.New("pio: instruction requires PIO version 1")
+)
 
 // EncodeInstr encodes an arbitrary PIO instruction with the given arguments.
 func (asm AssemblerV0) EncodeInstr(instr InstrKind, delaySideset, arg1_3b, arg2_5b uint8) uint16 {
-	return uint16(instr&0b111)<<13 | uint16(delaySideset&0x1f)<<8 | uint16(arg1_3b&0b111)<<5 | uint16(arg2_5b&0x1f)
+	return EncodeInstr(instr, delaySideset, arg1_3b, arg2_5b)
 }
 
 func (asm AssemblerV0) encodeIRQ(relative bool, irq uint8) uint8 {
@@ -54,10 +80,41 @@ func (asm AssemblerV0) instrSrcDest(instr uint16, srcDest uint8, value uint8) in
 }
 
 // Encode returns the finalized assembled instruction ready to be stored to the PIO program memory and used by a PIO state machine.
+// Arguments that overflow their fields are truncated, see [instructionV0.EncodeChecked].
 func (instr instructionV0) Encode() uint16 {
 	return instr.instr
 }
 
+// EncodeChecked is like Encode but returns an error if any argument, side-set value or delay overflowed its field,
+// a reserved source or destination was used, or the instruction requires a newer PIO version than the assembler's.
+// The returned error wraps one of [ErrArgOverflow], [ErrSidesetOverflow], [ErrDelayOverflow], [ErrReservedEncoding] or [ErrRequiresV1].
+func (instr instructionV0) EncodeChecked() (uint16, error) {
+	return instr.instr, instr.err
+}
+
+func (instr instructionV0) withErr(err error) instructionV0 {
+	if instr.err == nil {
+		instr.err = err
+	}
+	return instr
+}
+
+// checkArg records an argument overflow if value exceeds max.
+func (instr instructionV0) checkArg(name string, value, max uint8) instructionV0 {
+	if value > max {
+		return instr.withErr(fmt.Errorf("%w: %s %d exceeds %d", ErrArgOverflow, name, value, max))
+	}
+	return instr
+}
+
+// checkReserved records a reserved encoding if invalid is true.
+func (instr instructionV0) checkReserved(name string, value uint8, invalid bool) instructionV0 {
+	if invalid {
+		return instr.withErr(fmt.Errorf("%w: %s %d", ErrReservedEncoding, name, value))
+	}
+	return instr
+}
+
 // Side sets the sideset functionality of an instruction.
 //
 // value (see Section 3.3.2) is applied to the side_set pins at the start of the instruction. Note that
@@ -68,8 +125,19 @@ func (instr instructionV0) Encode() uint16 {
 // required. The <side_set_value> must fit within the number of side-set bits specified in the .side_set
 // directive.
 func (instr instructionV0) Side(value uint8) instructionV0 {
+	bits := instr.asm.SidesetBits
+	fieldBits := instr.asm.sidesetFieldBits()
+	if bits == 0 || fieldBits > 5 {
+		instr = instr.withErr(fmt.Errorf("%w: side-set used with %d side-set bits", ErrSidesetOverflow, fieldBits))
+	} else if value >= 1<<bits {
+		instr = instr.withErr(fmt.Errorf("%w: %d does not fit in %d bits", ErrSidesetOverflow, value, bits))
+	}
+	field := uint16(value)
+	if instr.asm.SidesetOptional {
+		field = field&(1<<bits-1) | 1<<bits // Set side-set enable bit.
+	}
 	instr.instr &^= instr.asm.sidesetbits()
-	instr.instr |= uint16(value) << (13 - instr.asm.SidesetBits) // TODO: panic on bit overflow.
+	instr.instr |= field << (13 - fieldBits) & instr.asm.sidesetbits()
 	return instr
 }
 
@@ -80,17 +148,25 @@ func (instr instructionV0) Side(value uint8) instructionV0 {
 // value), however the number of bits is reduced when sideset is enabled via the .side_set (see
 // pioasm_side_set) directive. If the <delay_value> is not present, then the instruction has no delay
 func (instr instructionV0) Delay(cycles uint8) instructionV0 {
+	if delaybits := instr.asm.delaybits(); uint16(cycles)<<8&^delaybits != 0 {
+		instr = instr.withErr(fmt.Errorf("%w: %d exceeds %d", ErrDelayOverflow, cycles, delaybits>>8))
+	}
 	instr.instr &^= instr.asm.delaybits()
-	instr.instr |= uint16(0b11111&cycles) << 8 // TODO: panic on bit overflow due to sideset bits excess.
+	instr.instr |= uint16(cycles) << 8 & instr.asm.delaybits()
 	return instr
 }
 
 func (asm AssemblerV0) sidesetbits() uint16 {
-	return delaySidesetbits & (uint16(0b111) << (13 - asm.SidesetBits))
+	return delaySidesetbits &^ asm.delaybits()
 }
 
 func (asm AssemblerV0) delaybits() uint16 {
-	return delaySidesetbits & (0b11111 << (8 - asm.SidesetBits))
+	return delaySidesetbits & (0b11111 << (8 - asm.sidesetFieldBits()))
+}
+
+// sidesetFieldBits returns the number of bits of the delay/side-set field used by side-set, including the enable bit.
+func (asm AssemblerV0) sidesetFieldBits() uint8 {
+	return asm.SidesetBits + boolAsU8(asm.SidesetOptional)
 }
 
 func (asm AssemblerV0) instr(instr uint16) instructionV0 {
@@ -101,7 +177,8 @@ func (asm AssemblerV0) instr(instr uint16) instructionV0 {
 // Delay cycles on a JMP always take effect, whether Condition is true or false, and they take place after Condition is
 // evaluated and the program counter is updated.
 func (asm AssemblerV0) Jmp(cond JmpCond, addr uint8) instructionV0 {
-	return asm.instrArgs(_INSTR_BITS_JMP, uint8(cond&0b111), addr)
+	return asm.instrArgs(_INSTR_BITS_JMP, uint8(cond&0b111), addr).
+		checkArg("jmp condition", uint8(cond), 7).checkArg("jmp address", addr, 31)
 }
 
 // WaitPin stalls until Input pin selected by Index. This state machine’s input IO mapping is applied first, and then Index
@@ -109,7 +186,7 @@ func (asm AssemblerV0) Jmp(cond JmpCond, addr uint8) instructionV0 {
 // PINCTRL_IN_BASE configuration, modulo 32.
 func (asm AssemblerV0) WaitPin(polarity bool, pin uint8) instructionV0 {
 	flag := boolAsU8(polarity) << 2
-	return asm.instrArgs(_INSTR_BITS_WAIT, 1|flag, pin)
+	return asm.instrArgs(_INSTR_BITS_WAIT, 1|flag, pin).checkArg("wait pin", pin, 31)
 }
 
 // WaitIRQ stalls until PIO IRQ flag selected by irqindex. This IRQ behaves differently to other WAIT sources.
@@ -120,25 +197,27 @@ func (asm AssemblerV0) WaitPin(polarity bool, pin uint8) instructionV0 {
 //     running the same program to synchronise with each other.
 func (asm AssemblerV0) WaitIRQ(polarity, relative bool, irqindex uint8) instructionV0 {
 	flag := boolAsU8(polarity) << 2
-	return asm.instrArgs(_INSTR_BITS_WAIT, 2|flag, asm.encodeIRQ(relative, irqindex))
+	return asm.instrArgs(_INSTR_BITS_WAIT, 2|flag, asm.encodeIRQ(relative, irqindex)).checkArg("wait irq", irqindex, 7)
 }
 
 // WaitGPIO stalls until System GPIO input selected by Index. This is an absolute GPIO index, and is not affected by the state machine’s input IO mapping.
 func (asm AssemblerV0) WaitGPIO(polarity bool, pin uint8) instructionV0 {
 	flag := boolAsU8(polarity) << 2
-	return asm.instrArgs(_INSTR_BITS_WAIT, 0|flag, pin)
+	return asm.instrArgs(_INSTR_BITS_WAIT, 0|flag, pin).checkArg("wait gpio", pin, 31)
 }
 
 // Shift Bit count bits from Source into the Input Shift Register (ISR). Shift direction is configured for each state machine by
 // SHIFTCTRL_IN_SHIFTDIR. Additionally, increase the input shift count by Bit count, saturating at 32.
 func (asm AssemblerV0) In(src InSrc, value uint8) instructionV0 {
-	return asm.instrSrcDest(_INSTR_BITS_IN, uint8(src), value)
+	return asm.instrSrcDest(_INSTR_BITS_IN, uint8(src), value).checkArg("in bit count", value, 32).
+		checkReserved("in source", uint8(src), src > InSrcOSR || src == 0b100 || src == 0b101)
 }
 
 // Shift Bit count bits out of the Output Shift Register (OSR), and write those bits to Destination. Additionally, increase the
 // output shift count by Bit count, saturating at 32.
 func (asm AssemblerV0) Out(dest OutDest, value uint8) instructionV0 {
-	return asm.instrSrcDest(_INSTR_BITS_OUT, uint8(dest), value)
+	return asm.instrSrcDest(_INSTR_BITS_OUT, uint8(dest), value).checkArg("out bit count", value, 32).
+		checkReserved("out destination", uint8(dest), dest > OutDestExec)
 }
 
 // Push the contents of the ISR into the RX FIFO, as a single 32-bit word. Clear ISR to all-zeroes.
@@ -161,32 +240,52 @@ func (asm AssemblerV0) Pull(ifEmpty, block bool) instructionV0 {
 
 // Mov copies data from src to dest.
 func (asm AssemblerV0) Mov(dest MovDest, src MovSrc) instructionV0 {
-	return asm.instrSrcDest(_INSTR_BITS_MOV, uint8(dest), uint8(src)&7)
+	return asm.mov(dest, src, 0).checkMovDestV0(dest)
 }
 
 // MovInvertBits does a Mov but inverting the resulting bits.
 func (asm AssemblerV0) MovInvert(dest MovDest, src MovSrc) instructionV0 {
-	return asm.instrSrcDest(_INSTR_BITS_MOV, uint8(dest), (1<<3)|uint8(src&7))
+	return asm.mov(dest, src, 1).checkMovDestV0(dest)
 }
 
 // MovReverse does a Mov but reversing the order of the resulting bits.
 func (asm AssemblerV0) MovReverse(dest MovDest, src MovSrc) instructionV0 {
-	return asm.instrSrcDest(_INSTR_BITS_MOV, uint8(dest), (2<<3)|uint8(src&7))
+	return asm.mov(dest, src, 2).checkMovDestV0(dest)
+}
+
+func (asm AssemblerV0) mov(dest MovDest, src MovSrc, op uint8) instructionV0 {
+	return asm.instrSrcDest(_INSTR_BITS_MOV, uint8(dest), op<<3|uint8(src&7)).
+		checkReserved("mov destination", uint8(dest), dest > MovDestOSR).
+		checkReserved("mov source", uint8(src), src > MovSrcOSR || src == 0b100)
+}
+
+func (instr instructionV0) checkMovDestV0(dest MovDest) instructionV0 {
+	if dest == MovDestPindirs {
+		return instr.withErr(fmt.Errorf("%w: mov pindirs", ErrRequiresV1))
+	}
+	return instr
 }
 
 // IRQSet sets the IRQ flag selected by irqIndex argument.
 func (asm AssemblerV0) IRQSet(relative bool, irqIndex uint8) instructionV0 {
-	return asm.instrArgs(_INSTR_BITS_IRQ, 0, asm.encodeIRQ(relative, irqIndex))
+	return asm.instrArgs(_INSTR_BITS_IRQ, 0, asm.encodeIRQ(relative, irqIndex)).checkArg("irq index", irqIndex, 7)
 }
 
 // IRQClear clears the IRQ flag selected by irqIndex argument. See [AssemblerV0.IRQSet].
 func (asm AssemblerV0) IRQClear(relative bool, irqIndex uint8) instructionV0 {
-	return asm.instrArgs(_INSTR_BITS_IRQ, 2, asm.encodeIRQ(relative, irqIndex))
+	return asm.instrArgs(_INSTR_BITS_IRQ, 2, asm.encodeIRQ(relative, irqIndex)).checkArg("irq index", irqIndex, 7)
+}
+
+// IRQWait sets the IRQ flag selected by irqIndex and waits for it to be cleared before proceeding.
+// Delay cycles do not begin until after the wait period elapses. See [AssemblerV0.IRQSet].
+func (asm AssemblerV0) IRQWait(relative bool, irqIndex uint8) instructionV0 {
+	return asm.instrArgs(_INSTR_BITS_IRQ, 1, asm.encodeIRQ(relative, irqIndex)).checkArg("irq index", irqIndex, 7)
 }
 
 // Set writes an immediate value Data in range 0..31 to Destination.
 func (asm AssemblerV0) Set(dest SetDest, value uint8) instructionV0 {
-	return asm.instrSrcDest(_INSTR_BITS_SET, uint8(dest), value)
+	return asm.instrSrcDest(_INSTR_BITS_SET, uint8(dest), value).checkArg("set value", value, 31).
+		checkReserved("set destination", uint8(dest), dest > SetDestPindirs || dest == 0b011)
 }
 
 // Nop is pseudo instruction that lasts a single PIO cycle. Usually used for timings.
@@ -330,8 +429,33 @@ const (
 )
 
 // EncodeInstr encodes an arbitrary PIO instruction with the given arguments.
+// For InstrPULL the PULL bit of arg1_3b is always set.
 func EncodeInstr(instr InstrKind, delaySideset, arg1_3b, arg2_5b uint8) uint16 {
-	return uint16(instr&0b111)<<13 | uint16(delaySideset&0x1f)<<8 | uint16(arg1_3b&0b111)<<5 | uint16(arg2_5b&0x1f)
+	return instr.opcode() | uint16(delaySideset&0x1f)<<8 | uint16(arg1_3b&0b111)<<5 | uint16(arg2_5b&0x1f)
+}
+
+// opcode returns the instruction bits identifying the instruction kind.
+func (kind InstrKind) opcode() uint16 {
+	switch kind {
+	case InstrJMP:
+		return _INSTR_BITS_JMP
+	case InstrWAIT:
+		return _INSTR_BITS_WAIT
+	case InstrIN:
+		return _INSTR_BITS_IN
+	case InstrOUT:
+		return _INSTR_BITS_OUT
+	case InstrPUSH:
+		return _INSTR_BITS_PUSH
+	case InstrPULL:
+		return _INSTR_BITS_PULL
+	case InstrMOV:
+		return _INSTR_BITS_MOV
+	case InstrIRQ:
+		return _INSTR_BITS_IRQ
+	default:
+		return _INSTR_BITS_SET
+	}
 }
 
 // ClkDivFromPeriod calculates the CLKDIV register values
@@ -339,23 +463,31 @@ func EncodeInstr(instr InstrKind, delaySideset, arg1_3b, arg2_5b uint8) uint16 {
 // period is expected to be in nanoseconds. freq is expected to be in Hz.
 //
 // Prefer using ClkDivFromFrequency if possible for speed and accuracy.
+// The divider is truncated to 1/256 steps like in ClkDivFromFrequency.
 func ClkDivFromPeriod(period, cpuFreq uint32) (whole uint16, frac uint8, err error) {
 	//  freq = 256*clockfreq / (256*whole + frac)
 	// where period = 1e9/freq => freq = 1e9/period, so:
 	//  1e9/period = 256*clockfreq / (256*whole + frac) =>
 	//  256*whole + frac = 256*clockfreq*period/1e9
-	return splitClkdiv(256 * uint64(period) * uint64(cpuFreq) / uint64(1e9))
+	// The product takes up to 72 bits.
+	hi, lo := bits.Mul64(256*uint64(period), uint64(cpuFreq))
+	clkdiv, _ := bits.Div64(hi, lo, 1e9)
+	return splitClkdiv(clkdiv)
 }
 
 // ClkDivFromFrequency calculates the CLKDIV register values
 // to reach a given StateMachine cycle frequency. freq and cpuFreq are expected to be in Hz.
 //
 // Use powers of two for freq to avoid slow divisions and rounding errors.
+// The divider is truncated to 1/256 steps, so the achieved frequency is at or above freq
+// by less than one part in 256*whole+frac.
 func ClkDivFromFrequency(freq, cpuFreq uint32) (whole uint16, frac uint8, err error) {
+	if freq == 0 {
+		return 0, 0, errors.New("ClkDiv: zero frequency")
+	}
 	//  freq = 256*clockfreq / (256*whole + frac)
 	//  256*whole + frac = 256*clockfreq / freq
 	return splitClkdiv(256 * uint64(cpuFreq) / uint64(freq))
-
 }
 
 func splitClkdiv(clkdiv uint64) (whole uint16, frac uint8, err error) {
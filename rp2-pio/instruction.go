@@ -0,0 +1,495 @@
+package pio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Instruction is the decoded representation of a PIO instruction. It allows inspecting and
+// modifying instructions, i.e: patching a jump address or a delay, and re-encoding them with [Instruction.Encode].
+//
+// Only the operand fields relevant to Kind are used, the rest are ignored by [Instruction.Encode].
+type Instruction struct {
+	Kind InstrKind
+	// Delay is the number of delay cycles after the instruction executes.
+	Delay uint8
+	// SideSet is the side-set value applied when the instruction starts.
+	SideSet uint8
+	// SideSetEnabled is true if the side-set value is applied. Always true for programs with non-optional side-set.
+	SideSetEnabled bool
+
+	// JmpCond is the JMP condition.
+	JmpCond JmpCond
+	// Address is the JMP target address.
+	Address uint8
+
+	// WaitSrc is the WAIT source.
+	WaitSrc WaitSrc
+	// Polarity is the WAIT polarity.
+	Polarity bool
+	// Index is the WAIT GPIO, pin, IRQ or jmppin offset, the IRQ flag index or the RX FIFO entry index.
+	Index uint8
+	// IRQMode is the IRQ index mode of WAIT IRQ and IRQ.
+	IRQMode IRQIndexMode
+
+	// InSrc is the IN source.
+	InSrc InSrc
+	// OutDest is the OUT destination.
+	OutDest OutDest
+	// BitCount is the IN/OUT bit count, 1..32.
+	BitCount uint8
+
+	// IfFullEmpty is the PUSH IfFull or PULL IfEmpty flag.
+	IfFullEmpty bool
+	// Block is the PUSH/PULL Block flag.
+	Block bool
+
+	// MovDest is the MOV destination.
+	MovDest MovDest
+	// MovSrc is the MOV source.
+	MovSrc MovSrc
+	// MovOp is the operation applied to the MOV source.
+	MovOp MovOp
+	// RxFIFO selects the PIO version 1 MOV encodings accessing RX FIFO entries. When set, MovDest,
+	// MovSrc and MovOp are ignored and the FIFO entry is selected by Index or Y.
+	RxFIFO RxFIFOAccess
+	// RxFIFOIndexed is true if the RX FIFO entry is selected by Index instead of the Y register.
+	RxFIFOIndexed bool
+
+	// IRQClear is true if IRQ clears the flag instead of setting it.
+	IRQClear bool
+	// IRQWait is true if IRQ waits for the flag to be cleared after setting it. Has no effect if IRQClear is set.
+	IRQWait bool
+
+	// SetDest is the SET destination.
+	SetDest SetDest
+	// Data is the SET immediate value.
+	Data uint8
+
+	// SidesetBits is the number of side-set value bits, not including the optional enable bit.
+	SidesetBits uint8
+	// SidesetOptional is true if side-set is optional.
+	SidesetOptional bool
+	// PIOVersion is the PIO version the instruction is encoded for. 0 for RP2040, 1 for RP2350.
+	PIOVersion uint8
+}
+
+// WaitSrc encodes Wait instruction source.
+type WaitSrc uint8
+
+const (
+	WaitSrcGPIO   WaitSrc = 0b00 // gpio
+	WaitSrcPin    WaitSrc = 0b01 // pin
+	WaitSrcIRQ    WaitSrc = 0b10 // irq
+	WaitSrcJmpPin WaitSrc = 0b11 // jmppin, PIO version 1 only.
+)
+
+// MovOp encodes the operation applied by Mov to its source.
+type MovOp uint8
+
+const (
+	MovOpNone    MovOp = 0b00 // Copy unchanged.
+	MovOpInvert  MovOp = 0b01 // Bitwise complement (!).
+	MovOpReverse MovOp = 0b10 // Bit reverse (::).
+)
+
+// RxFIFOAccess selects the PIO version 1 MOV encodings which access RX FIFO entries.
+type RxFIFOAccess uint8
+
+const (
+	// RxFIFONone is a regular MOV instruction.
+	RxFIFONone RxFIFOAccess = iota
+	// RxFIFOPut writes the ISR to an RX FIFO entry, see [AssemblerV1.MovISRToRx].
+	RxFIFOPut
+	// RxFIFOGet reads an RX FIFO entry into the OSR, see [AssemblerV1.MovOSRFromRx].
+	RxFIFOGet
+)
+
+// DecodeInstruction decodes an encoded instruction. See [Instruction.Decode].
+func DecodeInstruction(instr uint16, sidesetBits uint8, optional bool, version uint8) (Instruction, error) {
+	var in Instruction
+	err := in.Decode(instr, sidesetBits, optional, version)
+	return in, err
+}
+
+// Decode sets in to the decoded representation of instr. sidesetBits and optional describe the side-set
+// configuration of the program the instruction belongs to, as with [AssemblerV0]. version is the PIO version.
+// The returned error wraps [ErrReservedEncoding] for reserved encodings or [ErrRequiresV1] for
+// version 1 encodings when version is 0.
+func (in *Instruction) Decode(instr uint16, sidesetBits uint8, optional bool, version uint8) error {
+	err := in.decode(instr, sidesetBits, optional, version)
+	if err == ErrReservedEncoding || err == ErrRequiresV1 {
+		// Only failing decodes pay for formatting the instruction.
+		return fmt.Errorf("%w: %#04x", err, instr)
+	}
+	return err
+}
+
+// decode is Decode returning ErrReservedEncoding and ErrRequiresV1 unwrapped, so that checking
+// instructions does not allocate.
+func (in *Instruction) decode(instr uint16, sidesetBits uint8, optional bool, version uint8) error {
+	*in = Instruction{SidesetBits: sidesetBits, SidesetOptional: optional, PIOVersion: version}
+	asm := in.assembler()
+	fieldBits := asm.sidesetFieldBits()
+	if fieldBits > 5 {
+		return fmt.Errorf("%w: %d side-set bits", ErrSidesetOverflow, fieldBits)
+	}
+	delaySideset := uint8(instr>>8) & 0x1f
+	delayBits := 5 - fieldBits
+	in.Delay = delaySideset & (1<<delayBits - 1)
+	if sidesetBits > 0 {
+		side := delaySideset >> delayBits
+		in.SideSetEnabled = !optional || side&(1<<sidesetBits) != 0
+		in.SideSet = side & (1<<sidesetBits - 1)
+	}
+
+	arg1 := uint8(instr>>5) & 0b111
+	arg2 := uint8(instr) & 0x1f
+	switch instr & _INSTR_BITS_Msk {
+	case _INSTR_BITS_JMP:
+		in.Kind = InstrJMP
+		in.JmpCond = JmpCond(arg1)
+		in.Address = arg2
+
+	case _INSTR_BITS_WAIT:
+		in.Kind = InstrWAIT
+		in.Polarity = arg1&0b100 != 0
+		in.WaitSrc = WaitSrc(arg1 & 0b11)
+		in.Index = arg2
+		switch in.WaitSrc {
+		case WaitSrcIRQ:
+			in.Index = arg2 & 0b111
+			in.IRQMode = IRQIndexMode(arg2>>3) & 0b11
+			if version == 0 && (in.IRQMode == IRQPrev || in.IRQMode == IRQNext) {
+				return ErrRequiresV1
+			}
+		case WaitSrcJmpPin:
+			if version == 0 {
+				return ErrRequiresV1
+			} else if arg2 > 3 {
+				return ErrReservedEncoding
+			}
+		}
+
+	case _INSTR_BITS_IN:
+		in.Kind = InstrIN
+		in.InSrc = InSrc(arg1)
+		in.BitCount = arg2
+		if arg2 == 0 {
+			in.BitCount = 32
+		}
+		if in.InSrc == 0b100 || in.InSrc == 0b101 {
+			return ErrReservedEncoding
+		}
+
+	case _INSTR_BITS_OUT:
+		in.Kind = InstrOUT
+		in.OutDest = OutDest(arg1)
+		in.BitCount = arg2
+		if arg2 == 0 {
+			in.BitCount = 32
+		}
+
+	case _INSTR_BITS_PUSH: // Also PULL and version 1 RX FIFO MOVs.
+		isPull := arg1&0b100 != 0
+		if arg2&0x10 != 0 {
+			if version == 0 {
+				return ErrRequiresV1
+			}
+			in.Kind = InstrMOV
+			in.RxFIFO = RxFIFOPut
+			if isPull {
+				in.RxFIFO = RxFIFOGet
+			}
+			in.RxFIFOIndexed = arg2&0b1000 != 0
+			in.Index = arg2 & 0b111
+			if arg1&0b011 != 0 || in.Index > 3 || (!in.RxFIFOIndexed && in.Index != 0) {
+				return ErrReservedEncoding
+			}
+			break
+		} else if arg2 != 0 {
+			return ErrReservedEncoding
+		}
+		in.Kind = InstrPUSH
+		if isPull {
+			in.Kind = InstrPULL
+		}
+		in.IfFullEmpty = arg1&0b010 != 0
+		in.Block = arg1&0b001 != 0
+
+	case _INSTR_BITS_MOV:
+		in.Kind = InstrMOV
+		in.MovDest = MovDest(arg1)
+		in.MovSrc = MovSrc(arg2 & 0b111)
+		in.MovOp = MovOp(arg2 >> 3)
+		if in.MovSrc == 0b100 || in.MovOp > MovOpReverse {
+			return ErrReservedEncoding
+		} else if in.MovDest == MovDestPindirs && version == 0 {
+			return ErrRequiresV1
+		}
+
+	case _INSTR_BITS_IRQ:
+		in.Kind = InstrIRQ
+		in.IRQClear = arg1&0b010 != 0
+		in.IRQWait = arg1&0b001 != 0
+		in.Index = arg2 & 0b111
+		in.IRQMode = IRQIndexMode(arg2>>3) & 0b11
+		if arg1&0b100 != 0 {
+			return ErrReservedEncoding
+		} else if version == 0 && (in.IRQMode == IRQPrev || in.IRQMode == IRQNext) {
+			return ErrRequiresV1
+		}
+
+	case _INSTR_BITS_SET:
+		in.Kind = InstrSET
+		in.SetDest = SetDest(arg1)
+		in.Data = arg2
+		if in.SetDest == 0b011 || in.SetDest > SetDestPindirs {
+			return ErrReservedEncoding
+		}
+	}
+	return nil
+}
+
+func (in Instruction) assembler() AssemblerV0 {
+	return AssemblerV0{SidesetBits: in.SidesetBits, SidesetOptional: in.SidesetOptional}
+}
+
+// Encode returns the encoded instruction. It returns an error under the same conditions as [instructionV0.EncodeChecked],
+// or wrapping [ErrRequiresV1] if the instruction uses PIO version 1 functionality and PIOVersion is 0.
+func (in Instruction) Encode() (uint16, error) {
+	asm := in.assembler()
+	v1 := AssemblerV1(asm)
+	isV1 := in.PIOVersion >= 1
+	requiresV1 := func(what string) (uint16, error) {
+		return 0, fmt.Errorf("%w: %s", ErrRequiresV1, what)
+	}
+	var instr instructionV0
+	switch in.Kind {
+	case InstrJMP:
+		instr = asm.Jmp(in.JmpCond, in.Address)
+
+	case InstrWAIT:
+		switch in.WaitSrc {
+		case WaitSrcGPIO:
+			instr = asm.WaitGPIO(in.Polarity, in.Index)
+		case WaitSrcPin:
+			instr = asm.WaitPin(in.Polarity, in.Index)
+		case WaitSrcIRQ:
+			if in.IRQMode == IRQPrev || in.IRQMode == IRQNext {
+				if !isV1 {
+					return requiresV1("wait irq prev/next")
+				}
+				instr = v1.WaitIRQMode(in.Polarity, in.Index, in.IRQMode)
+			} else {
+				instr = asm.WaitIRQ(in.Polarity, in.IRQMode == IRQRel, in.Index)
+			}
+		case WaitSrcJmpPin:
+			if !isV1 {
+				return requiresV1("wait jmppin")
+			}
+			instr = v1.WaitJmpPin(in.Polarity, in.Index)
+		default:
+			return 0, fmt.Errorf("%w: wait source %d", ErrReservedEncoding, in.WaitSrc)
+		}
+
+	case InstrIN:
+		instr = asm.In(in.InSrc, in.BitCount)
+
+	case InstrOUT:
+		instr = asm.Out(in.OutDest, in.BitCount)
+
+	case InstrPUSH:
+		instr = asm.Push(in.IfFullEmpty, in.Block)
+
+	case InstrPULL:
+		instr = asm.Pull(in.IfFullEmpty, in.Block)
+
+	case InstrMOV:
+		switch {
+		case in.RxFIFO == RxFIFOPut && isV1:
+			instr = v1.MovISRToRx(in.RxFIFOIndexed, in.Index)
+		case in.RxFIFO == RxFIFOGet && isV1:
+			instr = v1.MovOSRFromRx(in.RxFIFOIndexed, in.Index)
+		case in.RxFIFO != RxFIFONone:
+			return requiresV1("mov rxfifo")
+		case in.MovOp > MovOpReverse:
+			return 0, fmt.Errorf("%w: mov operation %d", ErrReservedEncoding, in.MovOp)
+		case isV1:
+			instr = v1.v0().mov(in.MovDest, in.MovSrc, uint8(in.MovOp))
+		default:
+			instr = asm.mov(in.MovDest, in.MovSrc, uint8(in.MovOp)).checkMovDestV0(in.MovDest)
+		}
+
+	case InstrIRQ:
+		switch {
+		case isV1 && in.IRQClear:
+			instr = v1.IRQClear(in.Index, in.IRQMode)
+		case isV1 && in.IRQWait:
+			instr = v1.IRQWait(in.Index, in.IRQMode)
+		case isV1:
+			instr = v1.IRQSet(in.Index, in.IRQMode)
+		case in.IRQMode == IRQPrev || in.IRQMode == IRQNext:
+			return requiresV1("irq prev/next")
+		case in.IRQClear:
+			instr = asm.IRQClear(in.IRQMode == IRQRel, in.Index)
+		case in.IRQWait:
+			instr = asm.IRQWait(in.IRQMode == IRQRel, in.Index)
+		default:
+			instr = asm.IRQSet(in.IRQMode == IRQRel, in.Index)
+		}
+
+	case InstrSET:
+		instr = asm.Set(in.SetDest, in.Data)
+
+	default:
+		return 0, fmt.Errorf("%w: instruction kind %d", ErrReservedEncoding, in.Kind)
+	}
+	if in.SideSetEnabled || (in.SidesetBits > 0 && !in.SidesetOptional) {
+		instr = instr.Side(in.SideSet)
+	}
+	return instr.Delay(in.Delay).EncodeChecked()
+}
+
+var (
+	disasmJmpConds = [8]string{"", "!x, ", "x--, ", "!y, ", "y--, ", "x != y, ", "pin, ", "!osre, "}
+	disasmInSrcs   = [8]string{"pins", "x", "y", "null", "", "", "isr", "osr"}
+	disasmOutDests = [8]string{"pins", "x", "y", "null", "pindirs", "pc", "isr", "exec"}
+	disasmMovDests = [8]string{"pins", "x", "y", "pindirs", "exec", "pc", "isr", "osr"}
+	disasmMovSrcs  = [8]string{"pins", "x", "y", "null", "", "status", "isr", "osr"}
+	disasmMovOps   = [4]string{"", "!", "::", ""}
+	disasmSetDests = [8]string{"pins", "x", "y", "", "pindirs", "", "", ""}
+	disasmIRQModes = [4]string{"", "prev ", "", "next "}
+)
+
+// String returns the instruction in pioasm syntax, formatted like the listings pioasm emits in generated code.
+// Operands out of range of their fields are not checked.
+func (in Instruction) String() string {
+	return in.format("")
+}
+
+// format formats the instruction like String, using jmpTarget as jump target if not empty.
+func (in Instruction) format(jmpTarget string) string {
+	var op, args string
+	itoa := func(v uint8) string { return strconv.Itoa(int(v)) }
+	switch in.Kind {
+	case InstrJMP:
+		op = "jmp"
+		if jmpTarget == "" {
+			jmpTarget = itoa(in.Address)
+		}
+		args = disasmJmpConds[in.JmpCond&0b111] + jmpTarget
+
+	case InstrWAIT:
+		op = "wait"
+		args = itoa(boolAsU8(in.Polarity)) + " "
+		switch in.WaitSrc {
+		case WaitSrcGPIO:
+			args += "gpio, " + itoa(in.Index)
+		case WaitSrcPin:
+			args += "pin, " + itoa(in.Index)
+		case WaitSrcIRQ:
+			args += "irq, " + disasmIRQModes[in.IRQMode&0b11] + itoa(in.Index)
+			if in.IRQMode == IRQRel {
+				args += " rel"
+			}
+		case WaitSrcJmpPin:
+			args += "jmppin"
+			if in.Index != 0 {
+				args += " + " + itoa(in.Index)
+			}
+		}
+
+	case InstrIN:
+		op = "in"
+		args = disasmInSrcs[in.InSrc&0b111] + ", " + itoa(in.BitCount)
+
+	case InstrOUT:
+		op = "out"
+		args = disasmOutDests[in.OutDest&0b111] + ", " + itoa(in.BitCount)
+
+	case InstrPUSH, InstrPULL:
+		op = "push"
+		if in.Kind == InstrPULL {
+			op = "pull"
+		}
+		if in.IfFullEmpty && in.Kind == InstrPULL {
+			args = "ifempty "
+		} else if in.IfFullEmpty {
+			args = "iffull "
+		}
+		if in.Block {
+			args += "block"
+		} else {
+			args += "noblock"
+		}
+
+	case InstrMOV:
+		fifo := "rxfifo[y]"
+		if in.RxFIFOIndexed {
+			fifo = "rxfifo[" + itoa(in.Index) + "]"
+		}
+		switch {
+		case in.RxFIFO == RxFIFOPut:
+			op, args = "mov", fifo+", isr"
+		case in.RxFIFO == RxFIFOGet:
+			op, args = "mov", "osr, "+fifo
+		case in.MovDest == MovDestY && in.MovSrc == MovSrcY && in.MovOp == MovOpNone:
+			op = "nop"
+		default:
+			op = "mov"
+			args = disasmMovDests[in.MovDest&0b111] + ", " + disasmMovOps[in.MovOp&0b11] + disasmMovSrcs[in.MovSrc&0b111]
+		}
+
+	case InstrIRQ:
+		op = "irq"
+		args = disasmIRQModes[in.IRQMode&0b11]
+		switch {
+		case in.IRQClear:
+			args += "clear "
+		case in.IRQWait:
+			args += "wait "
+		default:
+			args += "nowait "
+		}
+		args += itoa(in.Index)
+		if in.IRQMode == IRQRel {
+			args += " rel"
+		}
+
+	case InstrSET:
+		op = "set"
+		args = disasmSetDests[in.SetDest&0b111] + ", " + itoa(in.Data)
+	}
+
+	// Pad like pioasm listings: opcode, arguments, side-set and delay columns.
+	var b strings.Builder
+	b.WriteString(disasmPad(op, 7))
+	b.WriteString(disasmPad(args, 16))
+	side := ""
+	if in.SidesetBits > 0 && in.SideSetEnabled {
+		side = "side " + itoa(in.SideSet)
+	}
+	b.WriteString(disasmPad(side, 7))
+	if in.Delay != 0 {
+		b.WriteString("[" + itoa(in.Delay) + "]")
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+func disasmPad(s string, width int) string {
+	if len(s) >= width {
+		return s + " "
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
+
+// relocateInstr patches a jump instruction's address for a program loaded at offset.
+// Only the 5 bit address field changes, so side-set configuration is not needed.
+func relocateInstr(instr uint16, offset uint8) uint16 {
+	if instr&_INSTR_BITS_Msk != _INSTR_BITS_JMP {
+		return instr
+	}
+	return instr&^0x1f | (instr+uint16(offset))&0x1f
+}
@@ -0,0 +1,155 @@
+package pio
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInstructionRoundTrip(t *testing.T) {
+	var tests = []struct {
+		name     string
+		instr    uint16
+		sideset  uint8
+		optional bool
+		version  uint8
+		expect   Instruction
+	}{
+		{name: "jmp", instr: 0x0642, expect: Instruction{Kind: InstrJMP, JmpCond: JmpXNZeroDec, Address: 2, Delay: 6}},
+		{name: "pull side", instr: 0x9fa0, sideset: 1, optional: true,
+			expect: Instruction{Kind: InstrPULL, Block: true, SideSet: 1, SideSetEnabled: true, Delay: 7}},
+		{name: "set no side", instr: 0xe127, sideset: 1, optional: true, expect: Instruction{Kind: InstrSET, SetDest: SetDestX, Data: 7, Delay: 1}},
+		{name: "out mandatory side", instr: 0x7001, sideset: 1,
+			expect: Instruction{Kind: InstrOUT, OutDest: OutDestPins, BitCount: 1, SideSet: 1, SideSetEnabled: true}},
+		{name: "in 32", instr: 0x4040, expect: Instruction{Kind: InstrIN, InSrc: InSrcY, BitCount: 32}},
+		{name: "push iffull", instr: 0x8040, expect: Instruction{Kind: InstrPUSH, IfFullEmpty: true}},
+		{name: "mov invert", instr: 0xa0c9, expect: Instruction{Kind: InstrMOV, MovDest: MovDestISR, MovSrc: MovSrcX, MovOp: MovOpInvert}},
+		{name: "wait irq rel", instr: 0x20d2, expect: Instruction{Kind: InstrWAIT, Polarity: true, WaitSrc: WaitSrcIRQ, Index: 2, IRQMode: IRQRel}},
+		{name: "irq clear", instr: 0xc042, expect: Instruction{Kind: InstrIRQ, IRQClear: true, Index: 2}},
+		{name: "irq next", instr: 0xc01b, version: 1, expect: Instruction{Kind: InstrIRQ, Index: 3, IRQMode: IRQNext}},
+		{name: "wait jmppin", instr: 0x20e2, version: 1, expect: Instruction{Kind: InstrWAIT, Polarity: true, WaitSrc: WaitSrcJmpPin, Index: 2}},
+		{name: "mov pindirs", instr: 0xa063, version: 1, expect: Instruction{Kind: InstrMOV, MovDest: MovDestPindirs, MovSrc: MovSrcNull}},
+		{name: "mov rxfifo put", instr: 0x8018, version: 1, expect: Instruction{Kind: InstrMOV, RxFIFO: RxFIFOPut, RxFIFOIndexed: true}},
+		{name: "mov rxfifo get", instr: 0x8090, version: 1, expect: Instruction{Kind: InstrMOV, RxFIFO: RxFIFOGet}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DecodeInstruction(test.instr, test.sideset, test.optional, test.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.expect.SidesetBits = test.sideset
+			test.expect.SidesetOptional = test.optional
+			test.expect.PIOVersion = test.version
+			if got != test.expect {
+				t.Errorf("decode mismatch got!=expected:\n%+v\n%+v", got, test.expect)
+			}
+			encoded, err := got.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encoded != test.instr {
+				t.Errorf("encode mismatch got!=expected: %#x != %#x", encoded, test.instr)
+			}
+		})
+	}
+}
+
+func TestInstructionErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		instr   uint16
+		version uint8
+		expect  error
+	}{
+		{name: "in reserved source", instr: 0x4080, expect: ErrReservedEncoding},
+		{name: "set reserved destination", instr: 0xe060, expect: ErrReservedEncoding},
+		{name: "mov reserved operation", instr: 0xa03a, expect: ErrReservedEncoding},
+		{name: "irq reserved bit", instr: 0xc080, expect: ErrReservedEncoding},
+		{name: "push reserved index", instr: 0x8001, expect: ErrReservedEncoding},
+		{name: "mov rxfifo index by y", instr: 0x8011, version: 1, expect: ErrReservedEncoding},
+		{name: "mov rxfifo v0", instr: 0x8018, expect: ErrRequiresV1},
+		{name: "mov pindirs v0", instr: 0xa063, expect: ErrRequiresV1},
+		{name: "irq next v0", instr: 0xc01b, expect: ErrRequiresV1},
+		{name: "wait jmppin v0", instr: 0x20e2, expect: ErrRequiresV1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeInstruction(test.instr, 0, false, test.version)
+			if !errors.Is(err, test.expect) {
+				t.Errorf("error mismatch got!=expected: %v != %v", err, test.expect)
+			}
+		})
+	}
+
+	// Encoding checks operand ranges and version.
+	in := Instruction{Kind: InstrSET, SetDest: SetDestX, Data: 32}
+	if _, err := in.Encode(); !errors.Is(err, ErrArgOverflow) {
+		t.Errorf("expected ErrArgOverflow, got %v", err)
+	}
+	in = Instruction{Kind: InstrJMP, Delay: 8, SidesetBits: 2}
+	if _, err := in.Encode(); !errors.Is(err, ErrDelayOverflow) {
+		t.Errorf("expected ErrDelayOverflow, got %v", err)
+	}
+	in = Instruction{Kind: InstrIRQ, IRQMode: IRQPrev}
+	if _, err := in.Encode(); !errors.Is(err, ErrRequiresV1) {
+		t.Errorf("expected ErrRequiresV1, got %v", err)
+	}
+}
+
+func TestDecodeAllocs(t *testing.T) {
+	var in Instruction
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, instr := range []uint16{0x1040, 0x4080, 0x8018, 0xa063, 0xe081} {
+			in.decode(instr, 1, false, 0)
+		}
+		in.Decode(0xe081, 0, false, 0)
+	})
+	if allocs != 0 {
+		t.Errorf("decoding allocated %v times", allocs)
+	}
+}
+
+func TestRelocateInstr(t *testing.T) {
+	var tests = []struct {
+		instr  uint16
+		offset uint8
+		expect uint16
+	}{
+		{instr: 0x1040, offset: 4, expect: 0x1044}, // jmp x--, 0 side 1
+		{instr: 0x0067, offset: 20, expect: 0x007b},
+		{instr: 0x001f, offset: 1, expect: 0x0000}, // Wraps around instruction memory.
+		{instr: 0x6001, offset: 4, expect: 0x6001},
+		{instr: 0xe081, offset: 4, expect: 0xe081},
+	}
+	for _, test := range tests {
+		got := relocateInstr(test.instr, test.offset)
+		if got != test.expect {
+			t.Errorf("relocate %#x+%d mismatch got!=expected: %#x != %#x", test.instr, test.offset, got, test.expect)
+		}
+	}
+}
+
+func TestEncodeInstr(t *testing.T) {
+	var tests = []struct {
+		kind   InstrKind
+		arg1   uint8
+		arg2   uint8
+		expect uint16
+	}{
+		{InstrJMP, 2, 3, 0x0043},
+		{InstrWAIT, 0b101, 0, 0x20a0},
+		{InstrIN, 0, 1, 0x4001},
+		{InstrOUT, 0, 1, 0x6001},
+		{InstrPUSH, 0b001, 0, 0x8020},
+		{InstrPULL, 0b001, 0, 0x80a0},
+		{InstrMOV, 1, 7, 0xa027},
+		{InstrIRQ, 2, 2, 0xc042},
+		{InstrSET, 4, 1, 0xe081},
+	}
+	for _, test := range tests {
+		got := EncodeInstr(test.kind, 0, test.arg1, test.arg2)
+		if got != test.expect {
+			t.Errorf("kind %d mismatch got!=expected: %#x != %#x", test.kind, got, test.expect)
+		}
+	}
+}
@@ -4,7 +4,12 @@ package pio
 // within the Go language for PIO version 1 (RP2350).
 // Most logic is shared with [AssemblerV0].
 type AssemblerV1 struct {
+	// SidesetBits is the number of side-set value bits, not including the optional enable bit.
 	SidesetBits uint8
+	// SidesetOptional makes side-set optional. See [AssemblerV0].
+	SidesetOptional bool
+	// SidesetPindirs makes side-set drive pin directions instead of pin values.
+	SidesetPindirs bool
 }
 
 func (asm AssemblerV1) v0() AssemblerV0 {
@@ -24,6 +29,14 @@ func (asm AssemblerV1) WaitIRQ(polarity bool, relative bool, irqindex uint8) ins
 	return asm.v0().WaitIRQ(polarity, relative, irqindex)
 }
 
+// WaitIRQMode waits on the IRQ flag selected by irqindex like [AssemblerV0.WaitIRQ], with the flag index
+// decoded according to idxMode. This allows waiting on IRQ flags of neighbouring PIO blocks with [IRQPrev] and [IRQNext].
+func (asm AssemblerV1) WaitIRQMode(polarity bool, irqindex uint8, idxMode IRQIndexMode) instructionV0 {
+	flag := boolAsU8(polarity) << 2
+	return asm.v0().instrArgs(_INSTR_BITS_WAIT, 2|flag, uint8(idxMode&0b11)<<3|irqindex&0b111).
+		checkArg("wait irq", irqindex, 7).checkArg("irq index mode", uint8(idxMode), 3)
+}
+
 // WaitPin instruction unchanged from [AssemblerV0.WaitPin].
 func (asm AssemblerV1) WaitPin(polarity bool, pin uint8) instructionV0 {
 	return asm.v0().WaitPin(polarity, pin)
@@ -33,7 +46,7 @@ func (asm AssemblerV1) WaitPin(polarity bool, pin uint8) instructionV0 {
 // modulo 32. Other values of Index are reserved.
 func (asm AssemblerV1) WaitJmpPin(polarity bool, pin uint8) instructionV0 {
 	flag := boolAsU8(polarity) << 2
-	return asm.v0().instrArgs(_INSTR_BITS_WAIT, 0b11|flag, pin)
+	return asm.v0().instrArgs(_INSTR_BITS_WAIT, 0b11|flag, pin).checkArg("wait jmppin offset", pin, 3)
 }
 
 // In instruction unchanged from [AssemblerV0.In].
@@ -63,17 +76,17 @@ func (asm AssemblerV1) Pull(ifEmpty bool, block bool) instructionV0 {
 //   - Adds the FJOIN_RX_GET FIFO mode. A new MOV encoding reads any of the four RX FIFO storage registers into OSR.
 //   - New FJOIN_RX_PUT FIFO mode. A new MOV encoding writes the ISR into any of the four RX FIFO storage registers.
 func (asm AssemblerV1) Mov(dest MovDest, src MovSrc) instructionV0 {
-	return asm.v0().Mov(dest, src)
+	return asm.v0().mov(dest, src, 0)
 }
 
 // MovInvert is [AssemblerV0.MovInvert] unchanged but with available [AssemblerV1.Mov] functionality.
 func (asm AssemblerV1) MovInvert(dest MovDest, src MovSrc) instructionV0 {
-	return asm.v0().MovInvert(dest, src)
+	return asm.v0().mov(dest, src, 1)
 }
 
 // MovReverse is [AssemblerV0.MovReverse] unchanged but with available [AssemblerV1.Mov] functionality.
 func (asm AssemblerV1) MovReverse(dest MovDest, src MovSrc) instructionV0 {
-	return asm.v0().MovReverse(dest, src)
+	return asm.v0().mov(dest, src, 2)
 }
 
 // MovOSRFromRx reads the selected RX FIFO entry into the OSR. The PIO state machine can read the FIFO entries in any order, indexed
@@ -84,7 +97,7 @@ func (asm AssemblerV1) MovReverse(dest MovDest, src MovSrc) instructionV0 {
 //     values of Index are reserved encodings, and their operation is undefined.
 func (asm AssemblerV1) MovOSRFromRx(idxByImmediate bool, RxFifoIndex uint8) instructionV0 {
 	instr := _INSTR_BITS_MOVFIFO | (0b1001 << 4) | (uint16(boolAsU8(idxByImmediate) << 3)) | uint16(RxFifoIndex)&0b111
-	return asm.v0().instr(instr)
+	return asm.v0().instr(instr).checkRxFifoIndex(idxByImmediate, RxFifoIndex)
 }
 
 // MovISRToRx writes the ISR to a selected RX FIFO entry. The state machine can write the RX FIFO entries in any order, indexed either
@@ -95,8 +108,12 @@ func (asm AssemblerV1) MovOSRFromRx(idxByImmediate bool, RxFifoIndex uint8) inst
 //     operand. Otherwise, they are indexed by the two least-significant bits of the Y register. When IdxI is clear, all non-zero
 //     values of Index are reserved encodings, and their operation is undefined.
 func (asm AssemblerV1) MovISRToRx(idxByImmediate bool, RxFifoIndex uint8) instructionV0 {
-	instr := _INSTR_BITS_MOVFIFO | (0b1000 << 4) | (uint16(boolAsU8(idxByImmediate) << 3)) | uint16(RxFifoIndex)&0b111
-	return asm.v0().instr(instr)
+	instr := _INSTR_BITS_MOVFIFO | (0b0001 << 4) | (uint16(boolAsU8(idxByImmediate) << 3)) | uint16(RxFifoIndex)&0b111
+	return asm.v0().instr(instr).checkRxFifoIndex(idxByImmediate, RxFifoIndex)
+}
+
+func (instr instructionV0) checkRxFifoIndex(idxByImmediate bool, idx uint8) instructionV0 {
+	return instr.checkArg("rxfifo index", idx, 3).checkReserved("rxfifo index with Y indexing", idx, !idxByImmediate && idx != 0)
 }
 
 // Set instruction unchanged from [AssemblerV0.Set].
@@ -122,7 +139,7 @@ func (asm AssemblerV1) IRQWait(irqIndex uint8, idxMode IRQIndexMode) instruction
 
 func (asm AssemblerV1) irq(clear, wait bool, irqIndex uint8, idxMode IRQIndexMode) instructionV0 {
 	instr := _INSTR_BITS_IRQ | uint16(boolAsU8(clear))<<6 | uint16(boolAsU8(wait))<<5 | uint16(idxMode&0b11)<<3 | uint16(irqIndex&0b111)
-	return asm.v0().instr(instr)
+	return asm.v0().instr(instr).checkArg("irq index", irqIndex, 7).checkArg("irq index mode", uint8(idxMode), 3)
 }
 
 // Nop instruction unchanged from [AssemblerV0.Nop].
@@ -0,0 +1,207 @@
+package pio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintSeverity classifies problems reported by [AssembledProgram.Lint].
+type LintSeverity uint8
+
+const (
+	// LintWarning is a likely mistake that may be intended, i.e: using GPIO0 as jmp pin.
+	LintWarning LintSeverity = iota
+	// LintError is a configuration that will not work as the program expects.
+	LintError
+)
+
+func (s LintSeverity) String() string {
+	if s == LintError {
+		return "error"
+	}
+	return "warning"
+}
+
+// LintIssue is a problem found by [AssembledProgram.Lint].
+type LintIssue struct {
+	Severity LintSeverity
+	// Instr is the index of the offending instruction, or -1 for problems with the configuration as a whole.
+	Instr   int
+	Message string
+}
+
+func (issue LintIssue) String() string {
+	if issue.Instr < 0 {
+		return issue.Severity.String() + ": " + issue.Message
+	}
+	return fmt.Sprintf("%s: instruction %d: %s", issue.Severity, issue.Instr, issue.Message)
+}
+
+// Lint checks the program against the state machine configuration it will run with and reports common mistakes,
+// such as using `set pins` with no SET pins configured or mixing up [StateMachineConfig.SetOutPins] and
+// [StateMachineConfig.SetSetPins]. offset is the offset the program is loaded at, which cfg's wrap is relative to.
+//
+// Configuration fields which are valid at their zero value, like GPIO0 as side-set or jmp pin, are reported as warnings.
+func (p *AssembledProgram) Lint(cfg StateMachineConfig, offset uint8) []LintIssue {
+	var l linter
+	instrs, err := p.decode()
+	if err != nil {
+		l.errorf(-1, "%s", strings.TrimPrefix(err.Error(), "pio: "))
+		return l.issues
+	}
+	l.lintWrap(p, cfg, offset, instrs)
+	l.lintPins(p, cfg, instrs)
+	l.lintShift(cfg, instrs)
+	l.lintFIFO(cfg, instrs)
+	return l.issues
+}
+
+type linter struct {
+	issues []LintIssue
+}
+
+func (l *linter) errorf(instr int, format string, args ...any) {
+	l.issues = append(l.issues, LintIssue{Severity: LintError, Instr: instr, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) warnf(instr int, format string, args ...any) {
+	l.issues = append(l.issues, LintIssue{Severity: LintWarning, Instr: instr, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) lintWrap(p *AssembledProgram, cfg StateMachineConfig, offset uint8, instrs []Instruction) {
+	n := len(instrs)
+	wrapTarget := int(cfg.ExecCtrl&pio0_SM0_EXECCTRL_WRAP_BOTTOM_Msk>>pio0_SM0_EXECCTRL_WRAP_BOTTOM_Pos) - int(offset)
+	wrap := int(cfg.ExecCtrl&pio0_SM0_EXECCTRL_WRAP_TOP_Msk>>pio0_SM0_EXECCTRL_WRAP_TOP_Pos) - int(offset)
+	if wrapTarget < 0 || wrapTarget >= n || wrap < 0 || wrap >= n {
+		l.errorf(-1, "wrap %d..%d outside of program loaded at offset %d", wrapTarget+int(offset), wrap+int(offset), offset)
+		return
+	} else if uint8(wrapTarget) != p.WrapTarget || uint8(wrap) != p.Wrap {
+		l.warnf(-1, "configured wrap %d..%d differs from program wrap %d..%d", wrapTarget, wrap, p.WrapTarget, p.Wrap)
+	}
+
+	// Walk control flow from the first instruction, which is where state machines are usually started.
+	reachable := make([]bool, n)
+	dataPC := false
+	stack := []uint8{0}
+	for len(stack) > 0 {
+		pc := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[pc] {
+			continue
+		}
+		reachable[pc] = true
+		dataPC = dataPC || instrs[pc].modifiesPC()
+		stack = append(stack, successors(instrs, pc, uint8(wrapTarget), uint8(wrap))...)
+	}
+	if dataPC {
+		return // Any instruction may be jumped to.
+	}
+	for i, ok := range reachable {
+		if !ok {
+			l.warnf(i, "unreachable instruction")
+		}
+	}
+}
+
+func (l *linter) lintPins(p *AssembledProgram, cfg StateMachineConfig, instrs []Instruction) {
+	setCount := cfg.PinCtrl & pio0_SM0_PINCTRL_SET_COUNT_Msk >> pio0_SM0_PINCTRL_SET_COUNT_Pos
+	outCount := cfg.PinCtrl & pio0_SM0_PINCTRL_OUT_COUNT_Msk >> pio0_SM0_PINCTRL_OUT_COUNT_Pos
+	sidesetCount := cfg.PinCtrl & pio0_SM0_PINCTRL_SIDESET_COUNT_Msk >> pio0_SM0_PINCTRL_SIDESET_COUNT_Pos
+	sidesetBase := cfg.PinCtrl & pio0_SM0_PINCTRL_SIDESET_BASE_Msk >> pio0_SM0_PINCTRL_SIDESET_BASE_Pos
+	jmpPin := cfg.ExecCtrl & pio0_SM0_EXECCTRL_JMP_PIN_Msk >> pio0_SM0_EXECCTRL_JMP_PIN_Pos
+	sideEn := cfg.ExecCtrl&pio0_SM0_EXECCTRL_SIDE_EN_Msk != 0
+
+	if uint8(sidesetCount) != p.SidesetFieldBits() || sideEn != p.SidesetOptional {
+		l.errorf(-1, "side-set configured with %d bits (optional=%v), program uses %d bits (optional=%v)",
+			sidesetCount, sideEn, p.SidesetFieldBits(), p.SidesetOptional)
+	}
+	usesSideset := false
+	for i := range instrs {
+		in := &instrs[i]
+		usesSideset = usesSideset || (in.SidesetBits > 0 && in.SideSetEnabled)
+		switch {
+		case in.Kind == InstrSET && in.SetDest == SetDestPins && setCount == 0:
+			l.errorf(i, "set pins with no SET pins configured, see SetSetPins")
+		case in.Kind == InstrSET && in.SetDest == SetDestPindirs && setCount == 0:
+			l.errorf(i, "set pindirs with no SET pins configured, see SetSetPins")
+		case in.Kind == InstrOUT && in.OutDest == OutDestPins && outCount == 0:
+			l.errorf(i, "out pins with no OUT pins configured, see SetOutPins")
+		case in.Kind == InstrMOV && in.RxFIFO == RxFIFONone && in.MovDest == MovDestPins && outCount == 0:
+			l.errorf(i, "mov pins with no OUT pins configured, see SetOutPins")
+		case in.Kind == InstrJMP && in.JmpCond == JmpPinInput && jmpPin == 0:
+			l.warnf(i, "jmp pin tests GPIO0, SetJmpPin may be missing")
+		}
+	}
+	if usesSideset && sidesetBase == 0 {
+		l.warnf(-1, "side-set pins start at GPIO0, SetSidesetPins may be missing")
+	}
+	if inCount := cfg.ShiftCtrl & pio0_SM0_SHIFTCTRL_IN_COUNT_Msk; inCount != 0 && p.PIOVersion == 0 {
+		l.warnf(-1, "IN pin count %d has no effect on PIO version 0, which reads all 32 IN pins", inCount)
+	}
+}
+
+func (l *linter) lintShift(cfg StateMachineConfig, instrs []Instruction) {
+	autopull := cfg.ShiftCtrl&pio0_SM0_SHIFTCTRL_AUTOPULL_Msk != 0
+	autopush := cfg.ShiftCtrl&pio0_SM0_SHIFTCTRL_AUTOPUSH_Msk != 0
+	pullThresh := threshold(cfg.ShiftCtrl & pio0_SM0_SHIFTCTRL_PULL_THRESH_Msk >> pio0_SM0_SHIFTCTRL_PULL_THRESH_Pos)
+	pushThresh := threshold(cfg.ShiftCtrl & pio0_SM0_SHIFTCTRL_PUSH_THRESH_Msk >> pio0_SM0_SHIFTCTRL_PUSH_THRESH_Pos)
+	for i := range instrs {
+		in := &instrs[i]
+		switch {
+		case autopull && in.Kind == InstrOUT && pullThresh%in.BitCount != 0:
+			l.warnf(i, "out %d bits never exactly reaches the autopull threshold of %d bits", in.BitCount, pullThresh)
+		case autopush && in.Kind == InstrIN && pushThresh%in.BitCount != 0:
+			l.warnf(i, "in %d bits never exactly reaches the autopush threshold of %d bits", in.BitCount, pushThresh)
+		}
+	}
+}
+
+// threshold returns the shift threshold of a SHIFTCTRL field, where 0 means 32.
+func threshold(field uint32) uint8 {
+	if field == 0 {
+		return 32
+	}
+	return uint8(field)
+}
+
+func (l *linter) lintFIFO(cfg StateMachineConfig, instrs []Instruction) {
+	join := cfg.fifoJoin()
+	autopull := cfg.ShiftCtrl&pio0_SM0_SHIFTCTRL_AUTOPULL_Msk != 0
+	autopush := cfg.ShiftCtrl&pio0_SM0_SHIFTCTRL_AUTOPUSH_Msk != 0
+	rxDisabled := join == FifoJoinTx || join == FifoJoinRxGet || join == FifoJoinRxPut || join == FifoJoinRxPutGet
+	rxGet := join == FifoJoinRxGet || join == FifoJoinRxPutGet
+	rxPut := join == FifoJoinRxPut || join == FifoJoinRxPutGet
+	if join == FifoJoinRx && autopull {
+		l.errorf(-1, "autopull enabled with the TX FIFO joined into the RX FIFO")
+	} else if rxDisabled && autopush {
+		l.errorf(-1, "autopush enabled with RX FIFO disabled by the FIFO join")
+	}
+	for i := range instrs {
+		in := &instrs[i]
+		switch {
+		case in.Kind == InstrPUSH && rxDisabled:
+			l.errorf(i, "push with RX FIFO disabled by the FIFO join")
+		case in.Kind == InstrPULL && join == FifoJoinRx:
+			l.errorf(i, "pull with the TX FIFO joined into the RX FIFO")
+		case in.Kind == InstrMOV && in.RxFIFO == RxFIFOPut && !rxPut:
+			l.errorf(i, "mov rxfifo[], isr requires FifoJoinRxPut or FifoJoinRxPutGet")
+		case in.Kind == InstrMOV && in.RxFIFO == RxFIFOGet && !rxGet:
+			l.errorf(i, "mov osr, rxfifo[] requires FifoJoinRxGet or FifoJoinRxPutGet")
+		}
+	}
+}
+
+// fifoJoin returns the FIFO join configured by [StateMachineConfig.SetFIFOJoin].
+func (cfg *StateMachineConfig) fifoJoin() FifoJoin {
+	switch {
+	case cfg.ShiftCtrl&pio0_SM0_SHIFTCTRL_FJOIN_TX_Msk != 0:
+		return FifoJoinTx
+	case cfg.ShiftCtrl&pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk != 0:
+		return FifoJoinRx
+	}
+	// RX_GET is the low bit, RX_PUT the high bit.
+	if bits := cfg.ShiftCtrl & (pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Msk | pio0_SM0_SHIFTCTRL_FJOIN_RX_PUT_Msk); bits != 0 {
+		return FifoJoinRx + FifoJoin(bits>>pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Pos)
+	}
+	return FifoJoinNone
+}
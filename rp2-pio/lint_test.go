@@ -0,0 +1,132 @@
+package pio
+
+import (
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	setPins := func(cfg *StateMachineConfig) { cfg.SetSetPins(2, 1) }
+	sidesetPins := func(cfg *StateMachineConfig) { cfg.SetSidesetPins(2) }
+	var tests = []struct {
+		name      string
+		src       string
+		configure func(cfg *StateMachineConfig)
+		offset    uint8
+		expect    []string
+	}{
+		{
+			name: "ws2812b",
+			src: `
+.program ws2812b
+	pull ifempty block
+bitloop:
+	set pins, 1
+	out y, 1
+	jmp !y lolo
+	jmp hilo [2]
+lolo:
+	set pins, 0 [2]
+hilo:
+	set pins, 0
+	jmp !osre bitloop [1]
+`,
+			configure: func(cfg *StateMachineConfig) {
+				setPins(cfg)
+				cfg.SetFIFOJoin(FifoJoinTx)
+				cfg.SetOutShift(false, true, 24)
+			},
+			offset: 4,
+		},
+		{
+			name:   "set pins unconfigured",
+			src:    ".program p\nset pins, 1\nset pindirs, 1",
+			expect: []string{"error: instruction 0: set pins with no SET pins configured, see SetSetPins", "error: instruction 1: set pindirs with no SET pins configured, see SetSetPins"},
+		},
+		{
+			name:      "out pins unconfigured",
+			src:       ".program p\nout pins, 8\nmov pins, x",
+			configure: setPins,
+			expect:    []string{"error: instruction 0: out pins with no OUT pins configured, see SetOutPins", "error: instruction 1: mov pins with no OUT pins configured, see SetOutPins"},
+		},
+		{
+			name:      "jmp pin",
+			src:       ".program p\nloop:\njmp pin loop",
+			configure: setPins,
+			expect:    []string{"warning: instruction 0: jmp pin tests GPIO0, SetJmpPin may be missing"},
+		},
+		{
+			name:   "side-set pins",
+			src:    ".program p\n.side_set 1\nnop side 1\nnop side 0",
+			expect: []string{"warning: side-set pins start at GPIO0, SetSidesetPins may be missing"},
+		},
+		{
+			name:      "side-set params",
+			src:       ".program p\n.side_set 1 opt\nnop side 1\nnop",
+			configure: func(cfg *StateMachineConfig) { sidesetPins(cfg); cfg.SetSidesetParams(1, false, false) },
+			expect:    []string{"error: side-set configured with 1 bits (optional=false), program uses 2 bits (optional=true)"},
+		},
+		{
+			name:      "in pin count v0",
+			src:       ".program p\nin pins, 2",
+			configure: func(cfg *StateMachineConfig) { cfg.SetInPins(2, 2) },
+			expect:    []string{"warning: IN pin count 2 has no effect on PIO version 0, which reads all 32 IN pins"},
+		},
+		{
+			name:      "autopull threshold",
+			src:       ".program p\nout x, 3\nout y, 8",
+			configure: func(cfg *StateMachineConfig) { cfg.SetOutShift(true, true, 32) },
+			expect:    []string{"warning: instruction 0: out 3 bits never exactly reaches the autopull threshold of 32 bits"},
+		},
+		{
+			name:   "unreachable",
+			src:    ".program p\nloop:\njmp loop\nnop\n.wrap_target\nnop",
+			expect: []string{"warning: instruction 1: unreachable instruction", "warning: instruction 2: unreachable instruction"},
+		},
+		{
+			name:      "wrap outside program",
+			src:       ".program p\nnop",
+			configure: func(cfg *StateMachineConfig) { cfg.SetWrap(0, 31) },
+			expect:    []string{"error: wrap 0..31 outside of program loaded at offset 0"},
+		},
+		{
+			name:      "push with tx join",
+			src:       ".program p\npush\npull",
+			configure: func(cfg *StateMachineConfig) { cfg.SetFIFOJoin(FifoJoinTx) },
+			expect:    []string{"error: instruction 0: push with RX FIFO disabled by the FIFO join"},
+		},
+		{
+			name:      "pull with rx join",
+			src:       ".program p\nin x, 32\npull",
+			configure: func(cfg *StateMachineConfig) { cfg.SetFIFOJoin(FifoJoinRx) },
+			expect:    []string{"error: instruction 1: pull with the TX FIFO joined into the RX FIFO"},
+		},
+		{
+			name:      "rxfifo put without join",
+			src:       ".pio_version 1\n.program p\nmov rxfifo[0], isr\nmov osr, rxfifo[0]",
+			configure: func(cfg *StateMachineConfig) { cfg.SetFIFOJoin(FifoJoinRxPut) },
+			expect:    []string{"error: instruction 1: mov osr, rxfifo[] requires FifoJoinRxGet or FifoJoinRxPutGet"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			asm, err := ParseAssembly([]byte(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			prog := &asm.Programs[0]
+			cfg := prog.DefaultStateMachineConfig(test.offset)
+			if test.configure != nil {
+				test.configure(&cfg)
+			}
+			issues := prog.Lint(cfg, test.offset)
+			if len(issues) != len(test.expect) {
+				t.Fatalf("expected %d issues, got %d: %v", len(test.expect), len(issues), issues)
+			}
+			for i, issue := range issues {
+				if issue.String() != test.expect[i] {
+					t.Errorf("issue %d mismatch got!=expected:\n%s\n%s", i, issue, test.expect[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package pio
+
+// LoadProgram validates prog, adds it to PIO instruction memory and returns the offset it was
+// loaded at along with its default state machine configuration. Pin mappings are left to the caller.
+// Programs targeting or using features of a newer PIO version than the hardware's are rejected.
+// It is intended for programs decoded from a container with [DecodeProgram].
+func (pio *PIO) LoadProgram(prog *AssembledProgram) (offset uint8, cfg StateMachineConfig, err error) {
+	err = prog.Validate()
+	if err != nil {
+		return 0, cfg, err
+	}
+	err = prog.checkVersion(pio.Version())
+	if err != nil {
+		return 0, cfg, err
+	}
+	offset, err = pio.AddProgram(prog.Instructions, prog.Origin)
+	if err != nil {
+		return 0, cfg, err
+	}
+	return offset, prog.DefaultStateMachineConfig(offset), nil
+}
+
+// LoadProgramHandle validates prog as [PIO.LoadProgram] does and adds it with
+// [PIO.AddProgramHandle], sharing an identical program already resident with the same wrap.
+// The default state machine configuration is prog.DefaultStateMachineConfig(h.Offset()).
+func (pio *PIO) LoadProgramHandle(prog *AssembledProgram) (h *ProgramHandle, err error) {
+	err = prog.Validate()
+	if err != nil {
+		return nil, err
+	}
+	err = prog.checkVersion(pio.Version())
+	if err != nil {
+		return nil, err
+	}
+	return pio.addProgramHandle(prog.Instructions, prog.Origin, prog.WrapTarget, prog.Wrap)
+}
+
+// LoadProgramData decodes a binary or JSON program container and loads it with [PIO.LoadProgram].
+func (pio *PIO) LoadProgramData(data []byte) (prog *AssembledProgram, offset uint8, cfg StateMachineConfig, err error) {
+	prog, err = DecodeProgram(data)
+	if err != nil {
+		return nil, 0, cfg, err
+	}
+	offset, cfg, err = pio.LoadProgram(prog)
+	return prog, offset, cfg, err
+}
@@ -0,0 +1,189 @@
+package pio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Macros expand common PIO idioms into minimal instruction sequences on a [Program].
+// They return the number of instruction slots added.
+//
+// With optional side-set macro instructions do not side-set. With non-optional side-set they repeat
+// the side-set value of the previous instruction, or 0 if the macro starts the program, so pins
+// hold their state. Use [Program.Side] after a macro to change the side-set of its last instruction.
+
+// DelayCycles adds instructions which take exactly cycles cycles to execute, without side effects
+// other than clobbering the scratch registers given, which may be [SetDestX] and [SetDestY].
+// Scratch registers allow long delays to be built from counted loops using fewer instructions.
+func (p *Program) DelayCycles(cycles int, scratch ...SetDest) (slots int) {
+	if cycles < 0 {
+		p.setErr(fmt.Errorf("pio: negative delay of %d cycles", cycles))
+		return 0
+	}
+	for _, reg := range scratch {
+		if reg != SetDestX && reg != SetDestY {
+			p.setErr(fmt.Errorf("pio: delay scratch register must be X or Y, got %d", reg))
+			return 0
+		}
+	}
+	plan, ok := planDelay(cycles, p.maxDelay(), len(scratch))
+	if !ok {
+		p.setErr(fmt.Errorf("pio: delay of %d cycles too long", cycles))
+		return 0
+	}
+	start := len(p.instrs)
+	switch plan.loops {
+	case 1:
+		p.delayLoop(scratch[0], plan.n, plan.preDelay, plan.loopDelay)
+	case 2:
+		// set y, M [a]; outer: set x, N; inner: jmp x-- inner [c]; jmp y-- outer [b]
+		outer, inner := scratch[0], scratch[1]
+		p.add(p.asm.Set(outer, plan.m).Delay(plan.preDelay))
+		outerStart := len(p.instrs)
+		p.delayLoop(inner, plan.n, 0, plan.loopDelay)
+		p.add(p.asm.Jmp(jmpDecCond(outer), uint8(outerStart)).Delay(plan.outerDelay))
+	}
+	p.addNops(plan.padding)
+	return len(p.instrs) - start
+}
+
+// delayLoop adds `set reg, n [pre]` followed by a `jmp reg-- self [loop]` which together last
+// 1+pre+(n+1)*(1+loop) cycles.
+func (p *Program) delayLoop(reg SetDest, n, pre, loop uint8) {
+	p.add(p.asm.Set(reg, n).Delay(pre))
+	p.add(p.asm.Jmp(jmpDecCond(reg), uint8(len(p.instrs))).Delay(loop))
+}
+
+// addNops adds the fewest nops lasting cycles cycles.
+func (p *Program) addNops(cycles int) {
+	maxDelay := int(p.maxDelay())
+	for cycles > 0 {
+		delay := min(cycles-1, maxDelay)
+		p.add(p.asm.Nop().Delay(uint8(delay)))
+		cycles -= delay + 1
+	}
+}
+
+// Loop adds a counted loop executing body n times, 1..32, using reg ([SetDestX] or [SetDestY]) as counter.
+// The loop adds a `set` before and a `jmp` after the body, each taking one cycle.
+func (p *Program) Loop(n int, reg SetDest, body func(p *Program)) (slots int) {
+	if n < 1 || n > 32 {
+		p.setErr(fmt.Errorf("pio: loop count %d out of range 1..32", n))
+		return 0
+	} else if reg != SetDestX && reg != SetDestY {
+		p.setErr(fmt.Errorf("pio: loop register must be X or Y, got %d", reg))
+		return 0
+	}
+	start := len(p.instrs)
+	p.add(p.asm.Set(reg, uint8(n-1)))
+	bodyStart := len(p.instrs)
+	body(p)
+	if len(p.instrs) == bodyStart {
+		p.setErr(errors.New("pio: empty loop body"))
+	}
+	p.add(p.asm.Jmp(jmpDecCond(reg), uint8(bodyStart)))
+	return len(p.instrs) - start
+}
+
+// WaitEdge waits for a rising or falling edge on pin, relative to the state machine's IN pin base.
+// A pin already at the final level must first transition to the opposite level.
+func (p *Program) WaitEdge(pin uint8, rising bool) (slots int) {
+	p.add(p.asm.WaitPin(!rising, pin))
+	p.add(p.asm.WaitPin(rising, pin))
+	return 2
+}
+
+// SetPinsAndDelay sets the SET pins to value and holds them for cycles cycles, the first of which
+// is the `set` instruction itself. Delays exceeding the delay field are built with [Program.DelayCycles]
+// using the scratch registers given.
+func (p *Program) SetPinsAndDelay(value uint8, cycles int, scratch ...SetDest) (slots int) {
+	if cycles < 1 {
+		p.setErr(fmt.Errorf("pio: set pins must last at least one cycle, got %d", cycles))
+		return 0
+	}
+	delay := min(cycles-1, int(p.maxDelay()))
+	p.add(p.asm.Set(SetDestPins, value).Delay(uint8(delay)))
+	return 1 + p.DelayCycles(cycles-1-delay, scratch...)
+}
+
+// add appends an instruction applying the side-set policy of macros.
+func (p *Program) add(instr instructionV0) {
+	if p.asm.SidesetBits > 0 && !p.asm.SidesetOptional {
+		var side uint8
+		if len(p.instrs) > 0 {
+			side = uint8((p.instrs[len(p.instrs)-1].instr & p.asm.sidesetbits()) >> (13 - p.asm.sidesetFieldBits()))
+		}
+		instr = instr.Side(side)
+	}
+	p.instrs = append(p.instrs, instr)
+}
+
+// maxDelay returns the largest delay that fits in the program's delay field.
+func (p *Program) maxDelay() uint8 {
+	return uint8(p.asm.delaybits() >> 8)
+}
+
+func jmpDecCond(reg SetDest) JmpCond {
+	if reg == SetDestY {
+		return JmpYNZeroDec
+	}
+	return JmpXNZeroDec
+}
+
+// delayPlan describes the instructions generating a delay. See planDelay.
+type delayPlan struct {
+	loops      int   // Number of nested loops, 0..2.
+	m, n       uint8 // Outer and inner loop counters.
+	preDelay   uint8 // Delay of the first set instruction.
+	loopDelay  uint8 // Delay of the innermost jmp.
+	outerDelay uint8 // Delay of the outer jmp.
+	padding    int   // Cycles added with nops after the loops.
+	slots      int
+}
+
+// planDelay returns the delay plan using the fewest instructions for cycles cycles,
+// given the largest delay field value and the number of scratch registers available.
+func planDelay(cycles int, maxDelay uint8, scratch int) (best delayPlan, ok bool) {
+	nopCycles := int(maxDelay) + 1
+	nops := func(c int) int { return (c + nopCycles - 1) / nopCycles }
+	best = delayPlan{padding: cycles, slots: nops(cycles)}
+	consider := func(plan delayPlan, rest int) {
+		// The rest of the cycles are the set's delay followed by nops.
+		if rest < 1 {
+			return
+		}
+		plan.preDelay = uint8(min(rest-1, int(maxDelay)))
+		plan.padding = rest - 1 - int(plan.preDelay)
+		plan.slots += nops(plan.padding)
+		if plan.slots < best.slots {
+			best = plan
+		}
+	}
+	if scratch >= 1 && best.slots > 2 {
+		for n := 0; n < 32; n++ {
+			for loop := 0; loop <= int(maxDelay); loop++ {
+				plan := delayPlan{loops: 1, n: uint8(n), loopDelay: uint8(loop), slots: 2}
+				consider(plan, cycles-(n+1)*(loop+1))
+			}
+		}
+	}
+	if scratch >= 2 && best.slots > 4 {
+		for m := 0; m < 32; m++ {
+			for n := 0; n < 32; n++ {
+				for loop := 0; loop <= int(maxDelay); loop++ {
+					for outer := 0; outer <= int(maxDelay); outer++ {
+						// Inner set, inner loop and outer jmp.
+						inner := 1 + (n+1)*(loop+1) + 1 + outer
+						plan := delayPlan{loops: 2, m: uint8(m), n: uint8(n), loopDelay: uint8(loop), outerDelay: uint8(outer), slots: 4}
+						consider(plan, cycles-(m+1)*inner)
+						if best.slots == 4 && best.padding == 0 {
+							return best, true
+						}
+					}
+				}
+			}
+		}
+	}
+	// Reject plans needing an unreasonable number of nops.
+	return best, best.slots <= 32
+}
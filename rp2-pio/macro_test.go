@@ -0,0 +1,149 @@
+package pio
+
+import (
+	"testing"
+)
+
+func TestDelayCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		asm     AssemblerV0
+		cycles  int
+		scratch []SetDest
+		slots   int
+	}{
+		{name: "zero", cycles: 0, slots: 0},
+		{name: "single nop", cycles: 32, slots: 1},
+		{name: "nops", cycles: 40, slots: 2},
+		{name: "no scratch", cycles: 32 * 20, slots: 20},
+		{name: "loop", cycles: 100, scratch: []SetDest{SetDestX}, slots: 2},
+		{name: "loop exact", cycles: 1024 + 1, scratch: []SetDest{SetDestY}, slots: 2},
+		{name: "loop padded", cycles: 1024 + 40, scratch: []SetDest{SetDestX}, slots: 3},
+		{name: "nested", cycles: 20000, scratch: []SetDest{SetDestY, SetDestX}, slots: 4},
+		{name: "nested odd", cycles: 30011, scratch: []SetDest{SetDestY, SetDestX}, slots: 4},
+		{name: "sideset", asm: AssemblerV0{SidesetBits: 2}, cycles: 200, scratch: []SetDest{SetDestX}, slots: 2},
+		{name: "sideset opt", asm: AssemblerV0{SidesetBits: 4, SidesetOptional: true}, cycles: 10, slots: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProgram("delay", tt.asm)
+			p.Add(tt.asm.Set(SetDestPins, 1))
+			if tt.asm.SidesetBits > 0 && !tt.asm.SidesetOptional {
+				p.Side(2)
+			}
+			slots := p.DelayCycles(tt.cycles, tt.scratch...)
+			p.Add(tt.asm.Set(SetDestPins, 0))
+			if slots != tt.slots {
+				t.Errorf("got %d slots, want %d", slots, tt.slots)
+			}
+			if len(p.instrs) != slots+2 {
+				t.Fatalf("added %d instructions, reported %d", len(p.instrs)-2, slots)
+			}
+			prog, err := p.Assemble()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := runDelay(t, prog, 1, 1+slots)
+			if got != tt.cycles {
+				t.Errorf("delay lasts %d cycles, want %d", got, tt.cycles)
+			}
+			if tt.asm.SidesetBits > 0 && !tt.asm.SidesetOptional {
+				for _, instr := range prog.Instructions[1 : 1+slots] {
+					in, _ := DecodeInstruction(instr, tt.asm.SidesetBits, false, 0)
+					if in.SideSet != 2 {
+						t.Errorf("%s: side-set not held", in)
+					}
+				}
+			}
+		})
+	}
+}
+
+// runDelay executes the delay instructions prog.Instructions[start:end] and returns the cycles taken.
+func runDelay(t *testing.T, prog *AssembledProgram, start, end int) (cycles int) {
+	t.Helper()
+	var x, y uint32
+	pc := start
+	for pc != end {
+		if cycles > 1e6 || pc < start || pc > end {
+			t.Fatalf("delay did not terminate, pc=%d", pc)
+		}
+		in, err := DecodeInstruction(prog.Instructions[pc], prog.SidesetBits, prog.SidesetOptional, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cycles += 1 + int(in.Delay)
+		pc++
+		switch {
+		case in.Kind == InstrSET && in.SetDest == SetDestX:
+			x = uint32(in.Data)
+		case in.Kind == InstrSET && in.SetDest == SetDestY:
+			y = uint32(in.Data)
+		case in.Kind == InstrJMP && in.JmpCond == JmpXNZeroDec:
+			if x != 0 {
+				pc = int(in.Address)
+			}
+			x--
+		case in.Kind == InstrJMP && in.JmpCond == JmpYNZeroDec:
+			if y != 0 {
+				pc = int(in.Address)
+			}
+			y--
+		case in.Kind == InstrMOV && in.MovDest == MovDestY && in.MovSrc == MovSrcY:
+		default:
+			t.Fatalf("unexpected instruction in delay: %s", in)
+		}
+	}
+	return cycles
+}
+
+func TestMacros(t *testing.T) {
+	asm := AssemblerV0{}
+	p := NewProgram("macros", asm)
+	if n := p.WaitEdge(3, true); n != 2 {
+		t.Errorf("WaitEdge: got %d slots", n)
+	}
+	if n := p.Loop(8, SetDestX, func(p *Program) {
+		p.Add(asm.In(InSrcPins, 1))
+	}); n != 3 {
+		t.Errorf("Loop: got %d slots", n)
+	}
+	if n := p.SetPinsAndDelay(1, 100, SetDestY); n != 3 {
+		t.Errorf("SetPinsAndDelay: got %d slots", n)
+	}
+	prog, err := p.Assemble()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{
+		asm.WaitPin(false, 3).Encode(),
+		asm.WaitPin(true, 3).Encode(),
+		asm.Set(SetDestX, 7).Encode(),
+		asm.In(InSrcPins, 1).Encode(),
+		asm.Jmp(JmpXNZeroDec, 3).Encode(),
+	}
+	for i, instr := range want {
+		if prog.Instructions[i] != instr {
+			t.Errorf("instruction %d: got %s, want %s", i, asm.Disassembler().Disassemble(prog.Instructions[i]), asm.Disassembler().Disassemble(instr))
+		}
+	}
+	if got := 1 + int(prog.Instructions[5]&delaySidesetbits>>8) + runDelay(t, prog, 6, 8); got != 100 {
+		t.Errorf("SetPinsAndDelay: pins held for %d cycles, want 100", got)
+	}
+
+	for name, build := range map[string]func(p *Program){
+		"negative delay":  func(p *Program) { p.DelayCycles(-1) },
+		"delay too long":  func(p *Program) { p.DelayCycles(5000) },
+		"bad scratch":     func(p *Program) { p.DelayCycles(5000, SetDestPins) },
+		"loop count":      func(p *Program) { p.Loop(33, SetDestX, func(p *Program) { p.Add(asm.Nop()) }) },
+		"empty loop":      func(p *Program) { p.Loop(2, SetDestY, func(p *Program) {}) },
+		"zero set cycles": func(p *Program) { p.SetPinsAndDelay(1, 0) },
+	} {
+		p := NewProgram(name, asm)
+		p.Add(asm.Nop())
+		build(p)
+		if _, err := p.Assemble(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,1419 @@
+package pio
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// AssemblySource is the result of parsing a file of PIO assembly.
+type AssemblySource struct {
+	// Programs holds the assembled programs in order of declaration.
+	Programs []AssembledProgram
+	// Symbols holds the values defined before the first .program directive.
+	Symbols []Symbol
+	// CodeBlocks holds the code blocks declared before the first .program directive.
+	CodeBlocks []CodeBlock
+}
+
+// Program returns the program with the given name or nil if not found.
+func (src *AssemblySource) Program(name string) *AssembledProgram {
+	for i := range src.Programs {
+		if src.Programs[i].Name == name {
+			return &src.Programs[i]
+		}
+	}
+	return nil
+}
+
+// ParseAssembly parses PIO assembly source in the format accepted by the pico-sdk's
+// pioasm tool and assembles every program in it. Programs are assembled with
+// [AssemblerV0] unless a `.pio_version 1` directive enables [AssemblerV1] instructions.
+//
+// Supported directives are .program, .define, .origin, .side_set, .wrap_target, .wrap,
+// .word, .pio_version, .fifo, .mov_status, .in, .out, .set, .clock_div and .lang_opt,
+// as well as `% lang {` ... `%}` code blocks.
+//
+// Parsing continues past errors so that all of them are reported at once. If the source
+// contains errors the returned error is an [AssemblyErrors] listing each one.
+func ParseAssembly(src []byte) (*AssemblySource, error) {
+	p := asmParser{
+		globals: make(map[string]*asmDefine),
+		instr:   -1,
+	}
+	return p.parse(string(src))
+}
+
+// AssemblyError describes an error at a position in PIO assembly source.
+type AssemblyError struct {
+	// Program is the name of the program containing the error, empty outside of a program.
+	Program string
+	// Line is the 1-based line number of the error.
+	Line int
+	// Column is the 1-based column of the error, or 0 if it applies to the whole line.
+	Column int
+	// Instr is the index of the instruction within its program, or -1 if the error is not in an instruction.
+	Instr int
+	// Msg describes the error.
+	Msg string
+	// Err is the underlying error, if any, such as [ErrArgOverflow] for out-of-range immediates
+	// or [ErrRequiresV1] for instructions not available in the program's PIO version.
+	Err error
+}
+
+func (e *AssemblyError) Error() string {
+	pos := strconv.Itoa(e.Line)
+	if e.Column > 0 {
+		pos += ":" + strconv.Itoa(e.Column)
+	}
+	return "pio: line " + pos + ": " + e.Msg
+}
+
+func (e *AssemblyError) Unwrap() error { return e.Err }
+
+// AssemblyErrors is the list of errors found by [ParseAssembly], in source order
+// except for errors found while resolving symbols at the end of a program.
+type AssemblyErrors []*AssemblyError
+
+func (e AssemblyErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e AssemblyErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+type asmParser struct {
+	src     AssemblySource
+	line    int
+	instr   int // Index of the instruction being assembled, -1 outside of the second pass.
+	errs    AssemblyErrors
+	version uint8 // Default PIO version for programs, set by .pio_version outside of a program.
+	globals map[string]*asmDefine
+	order   []string // Declaration order of globals.
+	prog    *asmProgram
+}
+
+type asmProgram struct {
+	AssembledProgram
+	defines    map[string]*asmDefine
+	labels     map[string]int
+	order      []string // Declaration order of symbols.
+	public     map[string]bool
+	instrs     []asmPendingInstr
+	wrapTarget int
+	wrap       int
+	sideset    bool // .side_set directive present.
+}
+
+// asmPendingInstr is an instruction awaiting the second pass, when all labels are known.
+type asmPendingInstr struct {
+	line int
+	toks []asmToken
+}
+
+type asmDefine struct {
+	expr   asmExpr
+	line   int
+	col    int
+	public bool
+	value  int
+	state  uint8 // 0: not evaluated, 1: being evaluated, 2: evaluated.
+}
+
+func (p *asmParser) parse(src string) (*AssemblySource, error) {
+	lines := strings.Split(src, "\n")
+	var (
+		inComment bool
+		block     *CodeBlock
+	)
+	for i, line := range lines {
+		p.line = i + 1
+		trimmed := strings.TrimSpace(line)
+		if block != nil {
+			if strings.HasPrefix(trimmed, "%}") {
+				p.addCodeBlock(*block)
+				block = nil
+			} else {
+				block.Code += line + "\n"
+			}
+			continue
+		}
+		if !inComment && strings.HasPrefix(trimmed, "%") {
+			lang, ok := strings.CutSuffix(strings.TrimSpace(trimmed[1:]), "{")
+			lang = strings.TrimSpace(lang)
+			if !ok || lang == "" {
+				p.report(p.errorf(strings.Index(line, "%")+1, "malformed code block, expected `%% lang {`"))
+				continue
+			}
+			block = &CodeBlock{Lang: lang}
+			continue
+		}
+		toks, err := lexAsmLine(line, &inComment)
+		if err != nil {
+			p.report(err)
+			continue
+		}
+		if len(toks) == 0 {
+			continue
+		}
+		p.report(p.parseLine(toks))
+	}
+	if block != nil {
+		p.report(p.errorf(0, "unterminated code block"))
+	}
+	p.finishProgram()
+	for _, name := range p.order {
+		d := p.globals[name]
+		v, err := p.evalDefine(nil, d)
+		p.report(err)
+		p.src.Symbols = append(p.src.Symbols, Symbol{Name: name, Value: v, Public: d.public})
+	}
+	if len(p.errs) > 0 {
+		return nil, p.errs
+	}
+	return &p.src, nil
+}
+
+func (p *asmParser) addCodeBlock(block CodeBlock) {
+	if p.prog != nil {
+		p.prog.CodeBlocks = append(p.prog.CodeBlocks, block)
+	} else {
+		p.src.CodeBlocks = append(p.src.CodeBlocks, block)
+	}
+}
+
+func (p *asmParser) errorf(col int, format string, args ...any) error {
+	return p.newError(col, nil, fmt.Sprintf(format, args...))
+}
+
+// wrapErr returns err positioned at col of the current line, unless it is already an [AssemblyError].
+func (p *asmParser) wrapErr(col int, err error) *AssemblyError {
+	var asmErr *AssemblyError
+	if errors.As(err, &asmErr) {
+		return asmErr
+	}
+	return p.newError(col, err, strings.TrimPrefix(err.Error(), "pio: "))
+}
+
+func (p *asmParser) newError(col int, err error, msg string) *AssemblyError {
+	e := &AssemblyError{Line: p.line, Column: col, Instr: p.instr, Msg: msg, Err: err}
+	if p.prog != nil {
+		e.Program = p.prog.Name
+	}
+	return e
+}
+
+// report records a non-nil error and lets parsing continue.
+func (p *asmParser) report(err error) {
+	if err != nil {
+		p.errs = append(p.errs, p.wrapErr(0, err))
+	}
+}
+
+func (p *asmParser) parseLine(toks []asmToken) error {
+	c := &asmCursor{toks: toks}
+	// Leading label, possibly public.
+	t := c.peek()
+	public := t.kind == asmTokIdent && strings.EqualFold(t.text, "public") && c.peekAt(2).is(":")
+	if public {
+		c.next()
+		t = c.peek()
+	}
+	if t.kind == asmTokIdent && c.peekAt(1).is(":") {
+		c.pos += 2
+		err := p.defineLabel(t, public)
+		if err != nil {
+			return err
+		}
+	}
+	t = c.peek()
+	switch t.kind {
+	case asmTokEOF:
+		return nil
+	case asmTokDirective:
+		return p.parseDirective(c)
+	case asmTokIdent:
+		if p.prog == nil {
+			return p.errorf(t.col, "instruction outside of a .program")
+		}
+		p.prog.instrs = append(p.prog.instrs, asmPendingInstr{line: p.line, toks: c.toks[c.pos:]})
+		return nil
+	}
+	return p.errorf(t.col, "unexpected %q", t.text)
+}
+
+func (p *asmParser) defineLabel(t asmToken, public bool) error {
+	prog := p.prog
+	if prog == nil {
+		return p.errorf(t.col, "label %q outside of a .program", t.text)
+	}
+	if prog.isDefined(t.text) {
+		return p.errorf(t.col, "duplicate symbol %q", t.text)
+	}
+	prog.labels[t.text] = len(prog.instrs)
+	prog.public[t.text] = public
+	prog.order = append(prog.order, t.text)
+	return nil
+}
+
+func (prog *asmProgram) isDefined(name string) bool {
+	_, isDef := prog.defines[name]
+	_, isLabel := prog.labels[name]
+	return isDef || isLabel
+}
+
+func (p *asmParser) parseDirective(c *asmCursor) error {
+	t := c.next()
+	name := strings.ToLower(t.text)
+	prog := p.prog
+	if prog == nil {
+		switch name {
+		case ".program", ".define", ".pio_version":
+		default:
+			return p.errorf(t.col, "directive %s outside of a .program", t.text)
+		}
+	}
+	var err error
+	switch name {
+	case ".program":
+		id := c.next()
+		if id.kind != asmTokIdent {
+			return p.errorf(id.col, "expected program name")
+		}
+		p.finishProgram()
+		if p.src.Program(id.text) != nil {
+			return p.errorf(id.col, "duplicate program %q", id.text)
+		}
+		p.prog = &asmProgram{
+			AssembledProgram: AssembledProgram{
+				Name:       id.text,
+				Origin:     -1,
+				PIOVersion: p.version,
+				SetCount:   -1,
+			},
+			defines:    make(map[string]*asmDefine),
+			labels:     make(map[string]int),
+			public:     make(map[string]bool),
+			wrapTarget: -1,
+			wrap:       -1,
+		}
+
+	case ".define":
+		public := c.acceptKeyword("public")
+		id := c.next()
+		if id.kind != asmTokIdent {
+			return p.errorf(id.col, "expected symbol name")
+		}
+		start := c.peek()
+		e, err := parseAsmExpr(c)
+		if err != nil {
+			return p.wrapErr(start.col, err)
+		}
+		d := &asmDefine{expr: e, line: p.line, col: start.col, public: public}
+		if prog == nil {
+			if _, ok := p.globals[id.text]; ok {
+				return p.errorf(id.col, "duplicate symbol %q", id.text)
+			}
+			p.globals[id.text] = d
+			p.order = append(p.order, id.text)
+		} else {
+			if prog.isDefined(id.text) {
+				return p.errorf(id.col, "duplicate symbol %q", id.text)
+			}
+			prog.defines[id.text] = d
+			prog.public[id.text] = public
+			prog.order = append(prog.order, id.text)
+		}
+
+	case ".origin":
+		v, err := p.evalOperand(c, 0, 31, "origin")
+		if err != nil {
+			return err
+		}
+		prog.Origin = int8(v)
+
+	case ".side_set":
+		if len(prog.instrs) > 0 {
+			return p.errorf(t.col, ".side_set must be specified before the first instruction")
+		} else if prog.sideset {
+			return p.errorf(t.col, "duplicate .side_set")
+		}
+		v, err := p.evalOperand(c, 0, 5, "side-set bit count")
+		if err != nil {
+			return err
+		}
+		prog.SidesetBits = uint8(v)
+		prog.SidesetOptional = c.acceptKeyword("opt")
+		prog.SidesetPindirs = c.acceptKeyword("pindirs")
+		if prog.SidesetFieldBits() > 5 {
+			return p.errorf(t.col, "optional side-set supports at most 4 bits")
+		}
+		prog.sideset = true
+
+	case ".wrap_target":
+		if prog.wrapTarget >= 0 {
+			return p.errorf(t.col, "duplicate .wrap_target")
+		}
+		prog.wrapTarget = len(prog.instrs)
+
+	case ".wrap":
+		if prog.wrap >= 0 {
+			return p.errorf(t.col, "duplicate .wrap")
+		} else if len(prog.instrs) == 0 {
+			return p.errorf(t.col, ".wrap cannot be placed before the first instruction")
+		}
+		prog.wrap = len(prog.instrs) - 1
+
+	case ".word":
+		prog.instrs = append(prog.instrs, asmPendingInstr{line: p.line, toks: c.toks[c.pos-1:]})
+		return nil // Operand evaluated on second pass.
+
+	case ".pio_version":
+		var v int
+		if id := c.peek(); id.kind == asmTokIdent && (strings.EqualFold(id.text, "rp2040") || strings.EqualFold(id.text, "rp2350")) {
+			c.next()
+			if strings.EqualFold(id.text, "rp2350") {
+				v = 1
+			}
+		} else {
+			v, err = p.evalOperand(c, 0, 1, "PIO version")
+			if err != nil {
+				return err
+			}
+		}
+		if prog == nil {
+			p.version = uint8(v)
+		} else if len(prog.instrs) > 0 {
+			return p.errorf(t.col, ".pio_version must be specified before the first instruction")
+		} else {
+			prog.PIOVersion = uint8(v)
+		}
+
+	case ".fifo":
+		mode := c.next()
+		switch strings.ToLower(mode.text) {
+		case "txrx":
+			prog.FifoJoin = FifoJoinNone
+		case "tx":
+			prog.FifoJoin = FifoJoinTx
+		case "rx":
+			prog.FifoJoin = FifoJoinRx
+		case "txget":
+			prog.FifoJoin = FifoJoinRxGet
+		case "txput":
+			prog.FifoJoin = FifoJoinRxPut
+		case "putget":
+			prog.FifoJoin = FifoJoinRxPutGet
+		default:
+			return p.errorf(mode.col, "expected one of txrx, tx, rx, txput, txget or putget")
+		}
+		if prog.FifoJoin >= FifoJoinRxGet {
+			err = p.requireV1(mode.col, ".fifo "+mode.text)
+		}
+
+	case ".mov_status":
+		var st MovStatusDirective
+		kw := c.next()
+		switch strings.ToLower(kw.text) {
+		case "txfifo", "rxfifo":
+			st.Sel = MovStatusTxLessthan
+			if strings.EqualFold(kw.text, "rxfifo") {
+				st.Sel = MovStatusRxLessthan
+			}
+			if !c.accept("<") {
+				return p.errorf(c.peek().col, "expected '<'")
+			}
+			v, err := p.evalOperand(c, 0, 31, "FIFO level")
+			if err != nil {
+				return err
+			}
+			st.N = uint8(v)
+		case "irq":
+			err = p.requireV1(kw.col, ".mov_status irq")
+			if err != nil {
+				return err
+			}
+			st.Sel = MovStatusIRQ
+			if c.acceptKeyword("prev") {
+				st.N = 0b01 << 3
+			} else if c.acceptKeyword("next") {
+				st.N = 0b10 << 3
+			}
+			if !c.acceptKeyword("set") {
+				return p.errorf(c.peek().col, "expected 'set'")
+			}
+			v, err := p.evalOperand(c, 0, 7, "IRQ index")
+			if err != nil {
+				return err
+			}
+			st.N |= uint8(v)
+		default:
+			return p.errorf(kw.col, "expected txfifo, rxfifo or irq")
+		}
+		prog.MovStatus = &st
+
+	case ".in", ".out":
+		v, err := p.evalOperand(c, 1, 32, "pin count")
+		if err != nil {
+			return err
+		}
+		sd := &ShiftDirective{PinCount: uint8(v), ShiftRight: true, Threshold: 32}
+		if c.acceptKeyword("left") {
+			sd.ShiftRight = false
+		} else {
+			c.acceptKeyword("right")
+		}
+		sd.Auto = c.acceptKeyword("auto")
+		if c.peek().kind != asmTokEOF {
+			v, err = p.evalOperand(c, 1, 32, "threshold")
+			if err != nil {
+				return err
+			}
+			sd.Threshold = uint8(v)
+		}
+		if name == ".in" {
+			prog.In = sd
+		} else {
+			prog.Out = sd
+		}
+
+	case ".set":
+		v, err := p.evalOperand(c, 0, 5, "pin count")
+		if err != nil {
+			return err
+		}
+		prog.SetCount = int8(v)
+
+	case ".clock_div":
+		num := c.next()
+		div, err := strconv.ParseFloat(num.text, 32)
+		if num.kind != asmTokNumber || err != nil || div < 1 || div > 65536 {
+			return p.errorf(num.col, "invalid clock divider %q", num.text)
+		}
+		prog.ClkDiv = float32(div)
+
+	case ".lang_opt":
+		lang, opt := c.next(), c.next()
+		if lang.kind != asmTokIdent || opt.kind != asmTokIdent || !c.accept("=") || c.peek().kind == asmTokEOF {
+			return p.errorf(t.col, "expected .lang_opt <lang> <name> = <value>")
+		}
+		val := c.toks[c.pos:]
+		c.pos = len(c.toks)
+		var value []string
+		for _, v := range val {
+			value = append(value, strings.Trim(v.text, `"`))
+		}
+		prog.LangOpts = append(prog.LangOpts, LangOpt{Lang: lang.text, Name: opt.text, Value: strings.Join(value, " ")})
+
+	default:
+		return p.errorf(t.col, "unknown directive %s", t.text)
+	}
+	if err != nil {
+		return err
+	}
+	if extra := c.peek(); extra.kind != asmTokEOF {
+		return p.errorf(extra.col, "unexpected %q after %s", extra.text, t.text)
+	}
+	return nil
+}
+
+func (p *asmParser) requireV1(col int, what string) error {
+	if p.prog != nil && p.prog.PIOVersion >= 1 {
+		return nil
+	}
+	return p.newError(col, ErrRequiresV1, what+" requires .pio_version 1")
+}
+
+// finishProgram runs the second pass over the current program and appends it to the result.
+// Errors are reported for every instruction rather than stopping at the first.
+func (p *asmParser) finishProgram() {
+	prog := p.prog
+	if prog == nil {
+		return
+	}
+	// p.prog stays set during the second pass for symbol lookup and version checks.
+	defer func() { p.prog = nil }()
+	n := len(prog.instrs)
+	switch {
+	case n == 0:
+		p.report(p.errorf(0, "program %q has no instructions", prog.Name))
+		return
+	case n > 32:
+		p.report(p.errorf(0, "program %q has %d instructions, exceeding the 32 available", prog.Name, n))
+	case prog.Origin >= 0 && int(prog.Origin)+n > 32:
+		p.report(p.errorf(0, "program %q does not fit in instruction memory at origin %d", prog.Name, prog.Origin))
+	case prog.wrapTarget == n:
+		p.report(p.errorf(0, ".wrap_target cannot be placed after the last instruction"))
+		prog.wrapTarget = 0
+	}
+	if prog.wrapTarget < 0 {
+		prog.wrapTarget = 0
+	}
+	if prog.wrap < 0 {
+		prog.wrap = n - 1
+	}
+	prog.WrapTarget = uint8(prog.wrapTarget)
+	prog.Wrap = uint8(prog.wrap)
+
+	prog.Instructions = make([]uint16, n)
+	for i, pending := range prog.instrs {
+		p.line, p.instr = pending.line, i
+		instr, err := p.assembleInstr(&asmCursor{toks: pending.toks})
+		p.report(err)
+		prog.Instructions[i] = instr
+	}
+	p.instr = -1
+	for _, name := range prog.order {
+		sym := Symbol{Name: name, Public: prog.public[name]}
+		if d, ok := prog.defines[name]; ok {
+			v, err := p.evalDefine(prog, d)
+			p.report(err)
+			sym.Value = v
+		} else {
+			sym.Value = prog.labels[name]
+			sym.Label = true
+		}
+		prog.Symbols = append(prog.Symbols, sym)
+	}
+	p.src.Programs = append(p.src.Programs, prog.AssembledProgram)
+}
+
+func (p *asmParser) lookup(name string) (int, error) {
+	if prog := p.prog; prog != nil {
+		if d, ok := prog.defines[name]; ok {
+			return p.evalDefine(prog, d)
+		}
+		if addr, ok := prog.labels[name]; ok {
+			return addr, nil
+		}
+	}
+	if d, ok := p.globals[name]; ok {
+		return p.evalDefine(nil, d)
+	}
+	return 0, fmt.Errorf("undefined symbol %q", name)
+}
+
+func (p *asmParser) evalDefine(prog *asmProgram, d *asmDefine) (int, error) {
+	switch d.state {
+	case 1:
+		return 0, errors.New("recursive symbol definition")
+	case 2:
+		return d.value, nil
+	}
+	d.state = 1
+	line, instr := p.line, p.instr
+	p.line, p.instr = d.line, -1
+	v, err := d.expr.eval(p.lookup)
+	if err != nil {
+		err = p.wrapErr(d.col, err)
+	}
+	p.line, p.instr = line, instr
+	d.value = v
+	d.state = 2
+	return v, err
+}
+
+// evalOperand parses and evaluates an expression, checking it is within [min, max].
+func (p *asmParser) evalOperand(c *asmCursor, min, max int, what string) (int, error) {
+	start := c.peek()
+	if start.kind == asmTokEOF {
+		return 0, p.errorf(start.col, "missing %s", what)
+	}
+	e, err := parseAsmExpr(c)
+	if err != nil {
+		return 0, p.wrapErr(start.col, err)
+	}
+	v, err := e.eval(p.lookup)
+	if err != nil {
+		return 0, p.wrapErr(start.col, err)
+	}
+	if v < min || v > max {
+		return 0, p.newError(start.col, ErrArgOverflow, fmt.Sprintf("%s %d out of range %d..%d", what, v, min, max))
+	}
+	return v, nil
+}
+
+// assembleInstr encodes a single instruction, including side-set and delay.
+func (p *asmParser) assembleInstr(c *asmCursor) (uint16, error) {
+	prog := p.prog
+	asm0 := prog.assembler()
+	asm1 := AssemblerV1(asm0)
+	mn := c.next()
+	if mn.kind == asmTokDirective { // .word
+		v, err := p.evalOperand(c, 0, 0xffff, ".word value")
+		if err != nil {
+			return 0, err
+		} else if extra := c.peek(); extra.kind != asmTokEOF {
+			return 0, p.errorf(extra.col, "unexpected %q after .word", extra.text)
+		}
+		return uint16(v), nil
+	}
+
+	var instr instructionV0
+	switch strings.ToLower(mn.text) {
+	case "nop":
+		instr = asm0.Nop()
+
+	case "jmp":
+		cond := JmpAlways
+		t := c.peek()
+		next := c.peekAt(1)
+		switch {
+		case t.is("!"):
+			c.next()
+			kw := c.next()
+			switch strings.ToLower(kw.text) {
+			case "x":
+				cond = JmpXZero
+			case "y":
+				cond = JmpYZero
+			case "osre":
+				cond = JmpOSRNotEmpty
+			default:
+				return 0, p.errorf(kw.col, "expected !x, !y or !osre")
+			}
+		case t.isKeyword("x") && next.is("--"):
+			cond = JmpXNZeroDec
+			c.pos += 2
+		case t.isKeyword("y") && next.is("--"):
+			cond = JmpYNZeroDec
+			c.pos += 2
+		case t.isKeyword("x") && next.is("!="):
+			c.pos += 2
+			if !c.acceptKeyword("y") {
+				return 0, p.errorf(c.peek().col, "expected x!=y")
+			}
+			cond = JmpXNotEqualY
+		case t.isKeyword("pin"):
+			c.next()
+			cond = JmpPinInput
+		}
+		if cond != JmpAlways {
+			c.accept(",")
+		}
+		addr, err := p.evalOperand(c, 0, 31, "jump target")
+		if err != nil {
+			return 0, err
+		}
+		instr = asm0.Jmp(cond, uint8(addr))
+
+	case "wait":
+		polarity := 1
+		if t := c.peek(); !t.isKeyword("gpio", "pin", "irq", "jmppin") {
+			v, err := p.evalOperand(c, 0, 1, "wait polarity")
+			if err != nil {
+				return 0, err
+			}
+			polarity = v
+		}
+		pol := polarity == 1
+		src := c.next()
+		switch strings.ToLower(src.text) {
+		case "gpio", "pin":
+			c.accept(",")
+			idx, err := p.evalOperand(c, 0, 31, src.text+" index")
+			if err != nil {
+				return 0, err
+			}
+			if src.isKeyword("gpio") {
+				instr = asm0.WaitGPIO(pol, uint8(idx))
+			} else {
+				instr = asm0.WaitPin(pol, uint8(idx))
+			}
+		case "irq":
+			c.accept(",")
+			mode, err := p.parseIRQPrevNext(c)
+			if err != nil {
+				return 0, err
+			}
+			idx, err := p.evalOperand(c, 0, 7, "IRQ index")
+			if err != nil {
+				return 0, err
+			}
+			rel := c.peek()
+			if c.acceptKeyword("rel") {
+				if mode != IRQDirect {
+					return 0, p.errorf(rel.col, "rel cannot be combined with prev or next")
+				}
+				mode = IRQRel
+			}
+			if mode == IRQPrev || mode == IRQNext {
+				instr = asm1.WaitIRQMode(pol, uint8(idx), mode)
+			} else {
+				instr = asm0.WaitIRQ(pol, mode == IRQRel, uint8(idx))
+			}
+		case "jmppin":
+			err := p.requireV1(src.col, "wait jmppin")
+			if err != nil {
+				return 0, err
+			}
+			var offset int
+			if c.accept("+") {
+				offset, err = p.evalOperand(c, 0, 3, "jmppin offset")
+				if err != nil {
+					return 0, err
+				}
+			}
+			instr = asm1.WaitJmpPin(pol, uint8(offset))
+		default:
+			return 0, p.errorf(src.col, "expected gpio, pin, irq or jmppin")
+		}
+
+	case "in":
+		src := c.next()
+		var s InSrc
+		switch strings.ToLower(src.text) {
+		case "pins":
+			s = InSrcPins
+		case "x":
+			s = InSrcX
+		case "y":
+			s = InSrcY
+		case "null":
+			s = InSrcNull
+		case "isr":
+			s = InSrcISR
+		case "osr":
+			s = InSrcOSR
+		default:
+			return 0, p.errorf(src.col, "invalid in source %q", src.text)
+		}
+		count, err := p.expectCommaOperand(c, 1, 32, "bit count")
+		if err != nil {
+			return 0, err
+		}
+		instr = asm0.In(s, uint8(count))
+
+	case "out":
+		dst := c.next()
+		var d OutDest
+		switch strings.ToLower(dst.text) {
+		case "pins":
+			d = OutDestPins
+		case "x":
+			d = OutDestX
+		case "y":
+			d = OutDestY
+		case "null":
+			d = OutDestNull
+		case "pindirs":
+			d = OutDestPindirs
+		case "pc":
+			d = OutDestPC
+		case "isr":
+			d = OutDestISR
+		case "exec":
+			d = OutDestExec
+		default:
+			return 0, p.errorf(dst.col, "invalid out destination %q", dst.text)
+		}
+		count, err := p.expectCommaOperand(c, 1, 32, "bit count")
+		if err != nil {
+			return 0, err
+		}
+		instr = asm0.Out(d, uint8(count))
+
+	case "push", "pull":
+		isPush := strings.EqualFold(mn.text, "push")
+		cond, block := false, true
+		if isPush {
+			cond = c.acceptKeyword("iffull")
+		} else {
+			cond = c.acceptKeyword("ifempty")
+		}
+		if c.acceptKeyword("noblock") {
+			block = false
+		} else {
+			c.acceptKeyword("block")
+		}
+		if isPush {
+			instr = asm0.Push(cond, block)
+		} else {
+			instr = asm0.Pull(cond, block)
+		}
+
+	case "mov":
+		var err error
+		instr, err = p.parseMov(c, asm1)
+		if err != nil {
+			return 0, err
+		}
+
+	case "irq":
+		var clear, wait bool
+		mode := IRQDirect
+	modifiers:
+		for {
+			t := c.peek()
+			switch {
+			case t.isKeyword("set", "nowait"):
+			case t.isKeyword("wait"):
+				wait = true
+			case t.isKeyword("clear"):
+				clear = true
+			case t.isKeyword("prev", "next"):
+				var err error
+				mode, err = p.parseIRQPrevNext(c)
+				if err != nil {
+					return 0, err
+				}
+				continue
+			default:
+				break modifiers
+			}
+			c.next()
+		}
+		if clear && wait {
+			return 0, p.errorf(mn.col, "irq cannot both clear and wait")
+		}
+		idx, err := p.evalOperand(c, 0, 7, "IRQ index")
+		if err != nil {
+			return 0, err
+		}
+		rel := c.peek()
+		if c.acceptKeyword("rel") {
+			if mode != IRQDirect {
+				return 0, p.errorf(rel.col, "rel cannot be combined with prev or next")
+			}
+			mode = IRQRel
+		}
+		switch {
+		case prog.PIOVersion >= 1 && clear:
+			instr = asm1.IRQClear(uint8(idx), mode)
+		case prog.PIOVersion >= 1 && wait:
+			instr = asm1.IRQWait(uint8(idx), mode)
+		case prog.PIOVersion >= 1:
+			instr = asm1.IRQSet(uint8(idx), mode)
+		case clear:
+			instr = asm0.IRQClear(mode == IRQRel, uint8(idx))
+		case wait:
+			instr = asm0.IRQWait(mode == IRQRel, uint8(idx))
+		default:
+			instr = asm0.IRQSet(mode == IRQRel, uint8(idx))
+		}
+
+	case "set":
+		dst := c.next()
+		var d SetDest
+		switch strings.ToLower(dst.text) {
+		case "pins":
+			d = SetDestPins
+		case "x":
+			d = SetDestX
+		case "y":
+			d = SetDestY
+		case "pindirs":
+			d = SetDestPindirs
+		default:
+			return 0, p.errorf(dst.col, "invalid set destination %q", dst.text)
+		}
+		v, err := p.expectCommaOperand(c, 0, 31, "set value")
+		if err != nil {
+			return 0, err
+		}
+		instr = asm0.Set(d, uint8(v))
+
+	default:
+		return 0, p.errorf(mn.col, "unknown instruction %q", mn.text)
+	}
+	return p.assembleSideDelay(c, instr)
+}
+
+// parseIRQPrevNext parses the optional prev/next IRQ index mode, available on PIO version 1.
+func (p *asmParser) parseIRQPrevNext(c *asmCursor) (IRQIndexMode, error) {
+	t := c.peek()
+	mode := IRQDirect
+	switch {
+	case t.isKeyword("prev"):
+		mode = IRQPrev
+	case t.isKeyword("next"):
+		mode = IRQNext
+	default:
+		return mode, nil
+	}
+	c.next()
+	return mode, p.requireV1(t.col, "irq "+t.text)
+}
+
+func (p *asmParser) expectCommaOperand(c *asmCursor, min, max int, what string) (int, error) {
+	if !c.accept(",") {
+		return 0, p.errorf(c.peek().col, "expected ','")
+	}
+	return p.evalOperand(c, min, max, what)
+}
+
+func (p *asmParser) parseMov(c *asmCursor, asm1 AssemblerV1) (instructionV0, error) {
+	dst := c.peek()
+	if dst.isKeyword("rxfifo") {
+		if err := p.requireV1(dst.col, "mov rxfifo"); err != nil {
+			return instructionV0{}, err
+		}
+		byImm, idx, err := p.parseRxFIFOIndex(c)
+		if err != nil {
+			return instructionV0{}, err
+		}
+		if !c.accept(",") {
+			return instructionV0{}, p.errorf(c.peek().col, "expected ','")
+		}
+		if src := c.next(); !src.isKeyword("isr") {
+			return instructionV0{}, p.errorf(src.col, "mov rxfifo source must be isr")
+		}
+		return asm1.MovISRToRx(byImm, idx), nil
+	}
+	c.next()
+	var d MovDest
+	switch strings.ToLower(dst.text) {
+	case "pins":
+		d = MovDestPins
+	case "x":
+		d = MovDestX
+	case "y":
+		d = MovDestY
+	case "pindirs":
+		if err := p.requireV1(dst.col, "mov pindirs"); err != nil {
+			return instructionV0{}, err
+		}
+		d = MovDestPindirs
+	case "exec":
+		d = MovDestExec
+	case "pc":
+		d = MovDestPC
+	case "isr":
+		d = MovDestISR
+	case "osr":
+		d = MovDestOSR
+	default:
+		return instructionV0{}, p.errorf(dst.col, "invalid mov destination %q", dst.text)
+	}
+	if !c.accept(",") {
+		return instructionV0{}, p.errorf(c.peek().col, "expected ','")
+	}
+	var invert, reverse bool
+	if c.accept("!") || c.accept("~") {
+		invert = true
+	} else if c.accept("::") {
+		reverse = true
+	}
+	src := c.peek()
+	if src.isKeyword("rxfifo") {
+		if err := p.requireV1(src.col, "mov rxfifo"); err != nil {
+			return instructionV0{}, err
+		} else if d != MovDestOSR || invert || reverse {
+			return instructionV0{}, p.errorf(src.col, "rxfifo can only be moved to osr")
+		}
+		byImm, idx, err := p.parseRxFIFOIndex(c)
+		if err != nil {
+			return instructionV0{}, err
+		}
+		return asm1.MovOSRFromRx(byImm, idx), nil
+	}
+	c.next()
+	var s MovSrc
+	switch strings.ToLower(src.text) {
+	case "pins":
+		s = MovSrcPins
+	case "x":
+		s = MovSrcX
+	case "y":
+		s = MovSrcY
+	case "null":
+		s = MovSrcNull
+	case "status":
+		s = MovSrcStatus
+	case "isr":
+		s = MovSrcISR
+	case "osr":
+		s = MovSrcOSR
+	default:
+		return instructionV0{}, p.errorf(src.col, "invalid mov source %q", src.text)
+	}
+	// Version was checked above for V1 destinations.
+	switch {
+	case invert:
+		return asm1.MovInvert(d, s), nil
+	case reverse:
+		return asm1.MovReverse(d, s), nil
+	}
+	return asm1.Mov(d, s), nil
+}
+
+// parseRxFIFOIndex parses rxfifo[y] or rxfifo[<index>].
+func (p *asmParser) parseRxFIFOIndex(c *asmCursor) (byImmediate bool, idx uint8, err error) {
+	c.next() // rxfifo
+	if !c.accept("[") {
+		return false, 0, p.errorf(c.peek().col, "expected '['")
+	}
+	if !c.acceptKeyword("y") {
+		v, err := p.evalOperand(c, 0, 3, "rxfifo index")
+		if err != nil {
+			return false, 0, err
+		}
+		byImmediate = true
+		idx = uint8(v)
+	}
+	if !c.accept("]") {
+		return false, 0, p.errorf(c.peek().col, "expected ']'")
+	}
+	return byImmediate, idx, nil
+}
+
+// assembleSideDelay parses the optional side-set and delay suffixes of an instruction.
+func (p *asmParser) assembleSideDelay(c *asmCursor, instr instructionV0) (uint16, error) {
+	prog := p.prog
+	hasSide, hasDelay := false, false
+	for {
+		t := c.peek()
+		switch {
+		case t.kind == asmTokEOF:
+			if prog.SidesetBits > 0 && !prog.SidesetOptional && !hasSide {
+				return 0, p.errorf(0, "instruction requires a side-set value since .side_set is not optional")
+			}
+			encoded, err := instr.EncodeChecked()
+			if err != nil {
+				return 0, p.wrapErr(0, err)
+			}
+			return encoded, nil
+
+		case t.isKeyword("side", "sideset", "side_set"):
+			c.next()
+			if hasSide {
+				return 0, p.errorf(t.col, "duplicate side-set")
+			} else if prog.SidesetBits == 0 {
+				return 0, p.errorf(t.col, "side-set used without a .side_set directive")
+			}
+			v, err := p.evalOperand(c, 0, 1<<prog.SidesetBits-1, "side-set value")
+			if err != nil {
+				return 0, err
+			}
+			instr = instr.Side(uint8(v))
+			hasSide = true
+
+		case t.is("["):
+			c.next()
+			if hasDelay {
+				return 0, p.errorf(t.col, "duplicate delay")
+			}
+			maxDelay := 1<<(5-prog.SidesetFieldBits()) - 1
+			v, err := p.evalOperand(c, 0, maxDelay, "delay")
+			if err != nil {
+				return 0, err
+			}
+			if !c.accept("]") {
+				return 0, p.errorf(c.peek().col, "expected ']'")
+			}
+			instr = instr.Delay(uint8(v))
+			hasDelay = true
+
+		default:
+			return 0, p.errorf(t.col, "unexpected %q", t.text)
+		}
+	}
+}
+
+//
+// Lexer.
+//
+
+type asmTokKind uint8
+
+const (
+	asmTokEOF asmTokKind = iota
+	asmTokIdent
+	asmTokNumber
+	asmTokDirective
+	asmTokString
+	asmTokPunct
+)
+
+type asmToken struct {
+	kind asmTokKind
+	text string
+	col  int // 1-based column.
+}
+
+func (t asmToken) is(punct string) bool { return t.kind == asmTokPunct && t.text == punct }
+
+func (t asmToken) isKeyword(keywords ...string) bool {
+	if t.kind != asmTokIdent {
+		return false
+	}
+	for _, kw := range keywords {
+		if strings.EqualFold(t.text, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// Multi-character punctuation must come first.
+var asmPuncts = []string{"--", "!=", "::", "<<", ">>", ",", ":", "[", "]", "(", ")", "+", "-", "*", "/", "|", "&", "^", "!", "~", "<", "="}
+
+func lexAsmLine(line string, inComment *bool) (toks []asmToken, err error) {
+	i := 0
+	for i < len(line) {
+		if *inComment {
+			end := strings.Index(line[i:], "*/")
+			if end < 0 {
+				return toks, nil
+			}
+			i += end + 2
+			*inComment = false
+			continue
+		}
+		c := line[i]
+		rest := line[i:]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == ';' || strings.HasPrefix(rest, "//"):
+			return toks, nil
+		case strings.HasPrefix(rest, "/*"):
+			*inComment = true
+			i += 2
+		case isAsmIdentStart(c) || (c == '.' && len(rest) > 1 && isAsmIdentStart(rest[1])):
+			start := i
+			i++
+			for i < len(line) && isAsmIdentChar(line[i]) {
+				i++
+			}
+			kind := asmTokIdent
+			if c == '.' {
+				kind = asmTokDirective
+			}
+			toks = append(toks, asmToken{kind: kind, text: line[start:i], col: start + 1})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(line) && (isAsmIdentChar(line[i]) || line[i] == '.') {
+				i++
+			}
+			toks = append(toks, asmToken{kind: asmTokNumber, text: line[start:i], col: start + 1})
+		case c == '"':
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			toks = append(toks, asmToken{kind: asmTokString, text: rest[:end+2], col: i + 1})
+			i += end + 2
+		default:
+			found := false
+			for _, punct := range asmPuncts {
+				if strings.HasPrefix(rest, punct) {
+					toks = append(toks, asmToken{kind: asmTokPunct, text: punct, col: i + 1})
+					i += len(punct)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return toks, nil
+}
+
+func isAsmIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAsmIdentChar(c byte) bool {
+	return isAsmIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+type asmCursor struct {
+	toks []asmToken
+	pos  int
+}
+
+func (c *asmCursor) peekAt(n int) asmToken {
+	if c.pos+n >= len(c.toks) {
+		col := 0
+		if len(c.toks) > 0 {
+			last := c.toks[len(c.toks)-1]
+			col = last.col + len(last.text)
+		}
+		return asmToken{kind: asmTokEOF, col: col}
+	}
+	return c.toks[c.pos+n]
+}
+
+func (c *asmCursor) peek() asmToken { return c.peekAt(0) }
+
+func (c *asmCursor) next() asmToken {
+	t := c.peek()
+	if t.kind != asmTokEOF {
+		c.pos++
+	}
+	return t
+}
+
+func (c *asmCursor) accept(punct string) bool {
+	if c.peek().is(punct) {
+		c.pos++
+		return true
+	}
+	return false
+}
+
+func (c *asmCursor) acceptKeyword(kw string) bool {
+	if c.peek().isKeyword(kw) {
+		c.pos++
+		return true
+	}
+	return false
+}
+
+//
+// Expressions.
+//
+
+type asmExpr interface {
+	eval(lookup func(name string) (int, error)) (int, error)
+}
+
+type asmNumber int
+
+type asmSymbol string
+
+type asmUnary struct {
+	op string
+	x  asmExpr
+}
+
+type asmBinary struct {
+	op   string
+	x, y asmExpr
+}
+
+func (n asmNumber) eval(func(string) (int, error)) (int, error) { return int(n), nil }
+
+func (s asmSymbol) eval(lookup func(string) (int, error)) (int, error) { return lookup(string(s)) }
+
+func (u asmUnary) eval(lookup func(string) (int, error)) (int, error) {
+	x, err := u.x.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	if u.op == "::" {
+		return int(bits.Reverse32(uint32(x))), nil
+	}
+	return -x, nil
+}
+
+func (b asmBinary) eval(lookup func(string) (int, error)) (int, error) {
+	x, err := b.x.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	y, err := b.y.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return x / y, nil
+	case "|":
+		return x | y, nil
+	case "&":
+		return x & y, nil
+	case "^":
+		return x ^ y, nil
+	case "<<":
+		return x << uint(y), nil
+	case ">>":
+		return x >> uint(y), nil
+	}
+	panic("unreachable")
+}
+
+var asmBinaryPrecedence = map[string]int{
+	"|": 1, "^": 2, "&": 3, "<<": 4, ">>": 4, "+": 5, "-": 5, "*": 6, "/": 6,
+}
+
+func parseAsmExpr(c *asmCursor) (asmExpr, error) { return parseAsmBinary(c, 1) }
+
+func parseAsmBinary(c *asmCursor, minPrec int) (asmExpr, error) {
+	x, err := parseAsmUnary(c)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := c.peek()
+		prec, ok := asmBinaryPrecedence[t.text]
+		if t.kind != asmTokPunct || !ok || prec < minPrec {
+			return x, nil
+		}
+		c.next()
+		y, err := parseAsmBinary(c, prec+1)
+		if err != nil {
+			return nil, err
+		}
+		x = asmBinary{op: t.text, x: x, y: y}
+	}
+}
+
+func parseAsmUnary(c *asmCursor) (asmExpr, error) {
+	t := c.next()
+	switch {
+	case t.is("-"), t.is("::"):
+		x, err := parseAsmUnary(c)
+		if err != nil {
+			return nil, err
+		}
+		return asmUnary{op: t.text, x: x}, nil
+	case t.is("("):
+		x, err := parseAsmExpr(c)
+		if err != nil {
+			return nil, err
+		}
+		if !c.accept(")") {
+			return nil, errors.New("expected ')'")
+		}
+		return x, nil
+	case t.kind == asmTokNumber:
+		return parseAsmNumber(t.text)
+	case t.kind == asmTokIdent:
+		return asmSymbol(t.text), nil
+	case t.kind == asmTokEOF:
+		return nil, errors.New("expected expression")
+	}
+	return nil, fmt.Errorf("unexpected %q in expression", t.text)
+}
+
+func parseAsmNumber(s string) (asmNumber, error) {
+	base := 10
+	digits := s
+	if len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			base, digits = 16, s[2:]
+		case 'b', 'B':
+			base, digits = 2, s[2:]
+		}
+	}
+	v, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return asmNumber(v), nil
+}
@@ -0,0 +1,313 @@
+package pio
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseAssembly(t *testing.T) {
+	var tests = []struct {
+		name       string
+		file       string // Read source from file if set.
+		src        string
+		program    string
+		expectprog []uint16
+		wrapTarget uint8
+		wrap       uint8
+		version    uint8
+		fifo       FifoJoin
+	}{
+		{
+			name:    "blink",
+			file:    "examples/blinky/blink.pio",
+			program: "blink",
+			expectprog: []uint16{
+				0x80a0, //  0: pull   block
+				0x6040, //  1: out    y, 32
+				//     .wrap_target
+				0xa022, //  2: mov    x, y
+				0xe001, //  3: set    pins, 1
+				0x0044, //  4: jmp    x--, 4
+				0xa022, //  5: mov    x, y
+				0xe000, //  6: set    pins, 0
+				0x0047, //  7: jmp    x--, 7
+				//     .wrap
+			},
+			wrapTarget: 2,
+			wrap:       7,
+		},
+		{
+			name:    "rxfifoput",
+			file:    "examples/rxfifoput/rxfifoput.pio",
+			program: "rxfifoput",
+			expectprog: []uint16{
+				0xa0c3, //  0: mov    isr, null
+				0xe043, //  1: set    y, 3
+				0x8010, //  2: mov    rxfifo[y], isr
+				0x0082, //  3: jmp    y--, 2
+				//     .wrap_target
+				0xa02b, //  4: mov    x, ~null
+				0xa0c9, //  5: mov    isr, ~x
+				0x8018, //  6: mov    rxfifo[0], isr
+				0x0045, //  7: jmp    x--, 5
+				//     .wrap
+			},
+			wrapTarget: 4,
+			wrap:       7,
+			version:    1,
+			fifo:       FifoJoinRxPut,
+		},
+		{
+			name:    "rxfifoputget",
+			file:    "examples/rxfifoputget/rxfifoputget.pio",
+			program: "rxfifoputget",
+			expectprog: []uint16{
+				0x8018, //  0: mov    rxfifo[0], isr
+				0x8098, //  1: mov    osr, rxfifo[0]
+			},
+			wrap:    1,
+			version: 1,
+			fifo:    FifoJoinRxPutGet,
+		},
+		{
+			name: "pulsar",
+			src: `
+.program pulsar
+	set pindirs, 1
+	pull block
+	mov x, osr
+loop:
+	set pins, 1 [1]
+	set pins, 0
+	jmp x-- loop
+`,
+			program: "pulsar",
+			expectprog: []uint16{
+				0xe081, //  0: set    pindirs, 1
+				0x80a0, //  1: pull   block
+				0xa027, //  2: mov    x, osr
+				0xe101, //  3: set    pins, 1                [1]
+				0xe000, //  4: set    pins, 0
+				0x0043, //  5: jmp    x--, 3
+			},
+			wrap: 5,
+		},
+		{
+			name: "spi3w",
+			src: `
+.program spi3w
+.side_set 1
+.define PUBLIC_IRQ 0
+.wrap_target
+wloop:
+	out pins, 1  side 0
+	jmp x--, wloop side 1
+	jmp !y end   side 0
+	set pindirs, 0 side 0
+	nop side 0
+rloop:
+	in pins, 1   side 1
+	jmp y-- rloop side 0
+end:
+	wait 1 pin 0 side 0
+	irq nowait PUBLIC_IRQ side 0
+`,
+			program: "spi3w",
+			expectprog: []uint16{
+				0x6001, //  0: out    pins, 1         side 0
+				0x1040, //  1: jmp    x--, 0          side 1
+				0x0067, //  2: jmp    !y, 7           side 0
+				0xe080, //  3: set    pindirs, 0      side 0
+				0xa042, //  4: nop                    side 0
+				0x5001, //  5: in     pins, 1         side 1
+				0x0085, //  6: jmp    y--, 5          side 0
+				0x20a0, //  7: wait   1 pin, 0        side 0
+				0xc000, //  8: irq    nowait 0        side 0
+			},
+			wrap: 8,
+		},
+		{
+			name: "optional sideset and expressions",
+			src: `
+.define public N 3
+.program opt
+.side_set 1 opt
+	set x, (N + 1) * 2 - 1 side 1 [3]
+	nop [7]
+	mov y, ::x
+	jmp 0 side 0
+	.word 0xa042
+`,
+			program: "opt",
+			expectprog: []uint16{
+				0xfb27, //  0: set    x, 7            side 1 [3]
+				0xa742, //  1: nop                           [7]
+				0xa051, //  2: mov    y, ::x
+				0x1000, //  3: jmp    0               side 0
+				0xa042, //  4: nop
+			},
+			wrap: 4,
+		},
+		{
+			name: "irq and wait modes",
+			src: `
+.pio_version 1
+.program irqs
+	irq wait 1 rel
+	irq clear 2
+	irq next set 3
+	wait 0 irq prev 4
+	wait 1 jmppin + 2
+	mov pindirs, null
+`,
+			program: "irqs",
+			expectprog: []uint16{
+				0xc031, //  0: irq    wait 1 rel
+				0xc042, //  1: irq    clear 2
+				0xc01b, //  2: irq    next nowait 3
+				0x204c, //  3: wait   0 irq, prev 4
+				0x20e2, //  4: wait   1 jmppin + 2
+				0xa063, //  5: mov    pindirs, null
+			},
+			wrap:    5,
+			version: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := []byte(test.src)
+			if test.file != "" {
+				var err error
+				src, err = os.ReadFile(test.file)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			asm, err := ParseAssembly(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prog := asm.Program(test.program)
+			if prog == nil {
+				t.Fatalf("program %q not found", test.program)
+			}
+			if len(prog.Instructions) != len(test.expectprog) {
+				t.Fatalf("expected %d instructions, got %d", len(test.expectprog), len(prog.Instructions))
+			}
+			for i, instr := range prog.Instructions {
+				if instr != test.expectprog[i] {
+					t.Errorf("instr %d mismatch got!=expected: %#x != %#x", i, instr, test.expectprog[i])
+				}
+			}
+			if prog.WrapTarget != test.wrapTarget || prog.Wrap != test.wrap {
+				t.Errorf("wrap mismatch got!=expected: %d..%d != %d..%d", prog.WrapTarget, prog.Wrap, test.wrapTarget, test.wrap)
+			}
+			if prog.PIOVersion != test.version {
+				t.Errorf("version mismatch got!=expected: %d != %d", prog.PIOVersion, test.version)
+			}
+			if prog.FifoJoin != test.fifo {
+				t.Errorf("fifo mismatch got!=expected: %d != %d", prog.FifoJoin, test.fifo)
+			}
+		})
+	}
+}
+
+func TestParseAssemblyErrors(t *testing.T) {
+	var tests = []struct {
+		name   string
+		src    string
+		expect string
+	}{
+		{name: "undefined label", src: ".program p\njmp nowhere", expect: `line 2:5: undefined symbol "nowhere"`},
+		{name: "duplicate label", src: ".program p\na:\nnop\na:\nnop", expect: `line 4:1: duplicate symbol "a"`},
+		{name: "missing sideset", src: ".program p\n.side_set 1\nnop", expect: "line 3: instruction requires a side-set value"},
+		{name: "delay overflow", src: ".program p\n.side_set 2\nnop side 0 [8]", expect: "line 3:13: delay 8 out of range 0..7"},
+		{name: "v1 instruction", src: ".program p\nmov rxfifo[0], isr", expect: "line 2:5: mov rxfifo requires .pio_version 1"},
+		{name: "wrap before instruction", src: ".program p\n.wrap", expect: "line 2:1: .wrap cannot be placed before the first instruction"},
+		{name: "unknown instruction", src: ".program p\nfoo x", expect: `line 2:1: unknown instruction "foo"`},
+		{name: "no program", src: "nop", expect: "line 1:1: instruction outside of a .program"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseAssembly([]byte(test.src))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), test.expect) {
+				t.Errorf("error mismatch got!=expected: %q != %q", err.Error(), test.expect)
+			}
+		})
+	}
+}
+
+func TestParseAssemblyErrorPositions(t *testing.T) {
+	src := `.program first
+	nop
+	foo x
+	set x, 32
+.program second
+	mov pindirs, null
+	irq next 1
+	jmp nowhere
+`
+	_, err := ParseAssembly([]byte(src))
+	var errs AssemblyErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected AssemblyErrors, got %v", err)
+	}
+	want := []AssemblyError{
+		{Program: "first", Line: 3, Column: 2, Instr: 1, Msg: `unknown instruction "foo"`},
+		{Program: "first", Line: 4, Column: 9, Instr: 2, Msg: "set value 32 out of range 0..31", Err: ErrArgOverflow},
+		{Program: "second", Line: 6, Column: 6, Instr: 0, Msg: "mov pindirs requires .pio_version 1", Err: ErrRequiresV1},
+		{Program: "second", Line: 7, Column: 6, Instr: 1, Msg: "irq next requires .pio_version 1", Err: ErrRequiresV1},
+		{Program: "second", Line: 8, Column: 6, Instr: 2, Msg: `undefined symbol "nowhere"`},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d:\n%v", len(want), len(errs), err)
+	}
+	for i, e := range errs {
+		got := *e
+		if want[i].Err == nil {
+			got.Err = nil
+		}
+		if got != want[i] {
+			t.Errorf("error %d mismatch got!=expected:\n%+v\n%+v", i, got, want[i])
+		}
+	}
+	if !errors.Is(err, ErrRequiresV1) || !errors.Is(err, ErrArgOverflow) {
+		t.Error("expected errors to wrap ErrRequiresV1 and ErrArgOverflow")
+	}
+}
+
+func TestParseAssemblyPinCounts(t *testing.T) {
+	asm, err := ParseAssembly([]byte(".pio_version 1\n.program counts\n.in 3\n.out 2 right\n.set 2\n\tnop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := asm.Programs[0].DefaultStateMachineConfig(0)
+	want := DefaultStateMachineConfig()
+	want.SetWrap(0, 0)
+	want.SetInPinCount(3)
+	want.SetInShift(true, false, 32)
+	want.SetOutPinCount(2)
+	want.SetOutShift(true, false, 32)
+	want.SetSetPinCount(2)
+	if cfg != want {
+		t.Errorf("config mismatch got!=expected: %+v != %+v", cfg, want)
+	}
+	if got := cfg.ShiftCtrl & pio0_SM0_SHIFTCTRL_IN_COUNT_Msk; got != 3 {
+		t.Errorf("got IN_COUNT %d, want 3", got)
+	}
+	if got := cfg.PinCtrl & pio0_SM0_PINCTRL_SET_COUNT_Msk >> pio0_SM0_PINCTRL_SET_COUNT_Pos; got != 2 {
+		t.Errorf("got SET_COUNT %d, want 2", got)
+	}
+
+	// Version 0 hardware has no IN pin count.
+	asm.Programs[0].PIOVersion = 0
+	cfg = asm.Programs[0].DefaultStateMachineConfig(0)
+	if got := cfg.ShiftCtrl & pio0_SM0_SHIFTCTRL_IN_COUNT_Msk; got != 0 {
+		t.Errorf("version 0: got IN_COUNT %d, want 0", got)
+	}
+}
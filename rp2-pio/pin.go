@@ -0,0 +1,8 @@
+//go:build rp2040 || rp2350
+
+package pio
+
+import "machine"
+
+// Pin is a GPIO pin number as used by the pin setters of [StateMachineConfig].
+type Pin = machine.Pin
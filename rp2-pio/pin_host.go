@@ -0,0 +1,8 @@
+//go:build !rp2040 && !rp2350
+
+package pio
+
+// Pin is a GPIO pin number as used by the pin setters of [StateMachineConfig].
+// Off-target builds define it in place of machine.Pin so configurations can be built
+// and tested on the host.
+type Pin uint8
@@ -1,24 +1,8 @@
-//go:build rp2040 || rp2350
-
 package pio
 
 import (
-	"device/rp"
 	"errors"
-	"machine"
-	"runtime/interrupt"
-	"runtime/volatile"
-	"unsafe"
-)
-
-// RP2040 PIO peripheral handles.
-var (
-	PIO0 = &PIO{
-		hw: rp.PIO0,
-	}
-	PIO1 = &PIO{
-		hw: rp.PIO1,
-	}
+	"fmt"
 )
 
 // PIO errors.
@@ -36,13 +20,16 @@ const (
 
 // PIO represents one of the two PIO peripherals in the RP2040
 type PIO struct {
-	// hw points to the PIO hardware registers.
-	hw *rp.PIO0_Type
+	// hw points to the PIO hardware registers, or to in-memory registers off-target.
+	hw *pioHW
 	// Bitmask of used instruction space. Each PIO has 32 slots for instructions.
 	usedSpaceMask uint32
 	// Bitmask of used state machines. Each PIO has 4 state machines.
 	claimedSMMask uint8
-	nc            noCopy
+	// Programs added with handles, shared between identical programs. Linked through
+	// ProgramHandle.next so that adding one does not allocate while the claim lock is held.
+	programs *ProgramHandle
+	nc       noCopy
 }
 
 // BlockIndex returns 0, 1, or 2 depending on whether the underlying device is PIO0, PIO1, or PIO2.
@@ -80,38 +67,45 @@ func (pio *PIO) ClaimStateMachine() (sm StateMachine, err error) {
 // The instructions argument holds program binary code in 16-bit words.
 // origin indicates where in the PIO execution memory the program must be loaded,
 // or -1 if the code is position independent.
+//
+// Programs using instructions not supported by the PIO hardware version are rejected with [ErrRequiresV1].
+// Program space is claimed atomically and AddProgram does not allocate, so programs may be added
+// from any goroutine, interrupt handler or core.
 func (pio *PIO) AddProgram(instructions []uint16, origin int8) (offset uint8, _ error) {
+	if err := pio.checkInstructions(instructions); err != nil {
+		return 0, err
+	}
+	state := lockClaims()
 	maybeOffset := pio.findOffsetForProgram(instructions, origin)
+	if maybeOffset >= 0 {
+		pio.claimProgramSpace(uint8(maybeOffset), uint8(len(instructions)))
+	}
+	unlockClaims(state)
 	if maybeOffset < 0 {
 		return 0, ErrOutOfProgramSpace
 	}
 	offset = uint8(maybeOffset)
-	pio.AddProgramAtOffset(instructions, origin, offset)
+	pio.writeProgram(instructions, offset)
 	return offset, nil
 }
 
 // AddProgramAtOffset loads a PIO program into PIO memory at a specific offset
-// and returns a non-nil error if there is not enough space.
+// and returns a non-nil error if there is not enough space or the program
+// uses instructions not supported by the PIO hardware version.
 func (pio *PIO) AddProgramAtOffset(instructions []uint16, origin int8, offset uint8) error {
-	if !pio.CanAddProgramAtOffset(instructions, origin, offset) {
-		return ErrNoSpaceAtOffset
+	if err := pio.checkInstructions(instructions); err != nil {
+		return err
 	}
-
-	programLen := uint8(len(instructions))
-	for i := uint8(0); i < programLen; i++ {
-		instr := instructions[i]
-
-		// Patch jump instructions with relative offset
-		if _INSTR_BITS_JMP == instr&_INSTR_BITS_Msk {
-			pio.writeInstructionMemory(offset+i, instr+uint16(offset))
-		} else {
-			pio.writeInstructionMemory(offset+i, instr)
-		}
+	state := lockClaims()
+	ok := pio.CanAddProgramAtOffset(instructions, origin, offset)
+	if ok {
+		pio.claimProgramSpace(offset, uint8(len(instructions)))
 	}
-
-	// Mark the instruction space as in-use
-	programMask := uint32((1 << programLen) - 1)
-	pio.usedSpaceMask |= programMask << uint32(offset)
+	unlockClaims(state)
+	if !ok {
+		return ErrNoSpaceAtOffset
+	}
+	pio.writeProgram(instructions, offset)
 	return nil
 }
 
@@ -126,14 +120,33 @@ func (pio *PIO) CanAddProgramAtOffset(instructions []uint16, origin int8, offset
 	return pio.usedSpaceMask&(programMask<<offset) == 0
 }
 
-func (pio *PIO) writeInstructionMemory(offset uint8, value uint16) {
-	// Instead of using MEM0, MEM1, etc, calculate the offset of the
-	// disired register starting at MEM0
-	start := unsafe.Pointer(&pio.hw.INSTR_MEM0)
+// claimProgramSpace marks the instruction space as in-use. The claim lock must be held.
+func (pio *PIO) claimProgramSpace(offset, programLen uint8) {
+	programMask := uint32((1 << programLen) - 1)
+	pio.usedSpaceMask |= programMask << uint32(offset)
+}
+
+// writeProgram writes instructions relocated to offset into claimed instruction space.
+func (pio *PIO) writeProgram(instructions []uint16, offset uint8) {
+	for i, instr := range instructions {
+		pio.writeInstructionMemory(offset+uint8(i), relocateInstr(instr, offset))
+	}
+}
+
+// errRequiresV1OnV0 is made once so that rejecting a program does not allocate.
+var errRequiresV1OnV0 = fmt.Errorf("%w, hardware is version 0", ErrRequiresV1)
+
+// checkInstructions rejects instructions the hardware cannot execute without allocating.
+func (pio *PIO) checkInstructions(instructions []uint16) error {
+	if RequiredPIOVersion(instructions) > pio.Version() {
+		return errRequiresV1OnV0 // Only version 1 instructions exist beyond version 0.
+	}
+	return nil
+}
 
+func (pio *PIO) writeInstructionMemory(offset uint8, value uint16) {
 	// Instruction Memory registers are 32-bit, with only lower 16 used
-	reg := (*volatile.Register32)(unsafe.Pointer(uintptr(start) + uintptr(offset)*4))
-	reg.Set(uint32(value))
+	pio.hw.INSTR_MEM[offset].Set(uint32(value))
 }
 
 func (pio *PIO) findOffsetForProgram(instructions []uint16, origin int8) int8 {
@@ -165,6 +178,7 @@ func (pio *PIO) findOffsetForProgram(instructions []uint16, origin int8) int8 {
 
 // ClearProgramSection clears a contiguous section of the PIO's program memory.
 // To clear all program memory use ClearProgramSection(0, 32).
+// Handles to programs overlapping the section are removed, see [ProgramHandle.Release].
 func (pio *PIO) ClearProgramSection(offset, len uint8) {
 	if offset+len > 32 { // 32 instructions max
 		panic(badProgramBounds)
@@ -175,35 +189,26 @@ func (pio *PIO) ClearProgramSection(offset, len uint8) {
 		// a state machine is currently using the program memory.
 		hw.INSTR_MEM[i].Set(uint32(AssemblerV0{}.Jmp(JmpAlways, offset).Encode()))
 	}
+	state := lockClaims()
 	pio.usedSpaceMask &^= uint32((1<<len)-1) << offset
+	pio.forgetPrograms(offset, len)
+	unlockClaims(state)
 }
 
 type statemachineHW struct {
-	CLKDIV    volatile.Register32 // 0xC8 for SM0
-	EXECCTRL  volatile.Register32 // 0xCC for SM0
-	SHIFTCTRL volatile.Register32 // 0xD0 for SM0
-	ADDR      volatile.Register32 // 0xD4 for SM0
-	INSTR     volatile.Register32 // 0xD8 for SM0
-	PINCTRL   volatile.Register32 // 0xDC for SM0
+	CLKDIV    register32 // 0xC8 for SM0
+	EXECCTRL  register32 // 0xCC for SM0
+	SHIFTCTRL register32 // 0xD0 for SM0
+	ADDR      register32 // 0xD4 for SM0
+	INSTR     register32 // 0xD8 for SM0
+	PINCTRL   register32 // 0xDC for SM0
 }
 
 func (pio *PIO) smHW(index uint8) *statemachineHW {
 	if index > 3 {
 		panic(badStateMachineIndex)
 	}
-	// 24 bytes (6 registers) per state machine
-	const size = unsafe.Sizeof(statemachineHW{})
-
-	ptrBase := unsafe.Pointer(&pio.hw.SM0_CLKDIV) // 0xC8
-	ptr := uintptr(ptrBase) + uintptr(index)*size
-
-	return (*statemachineHW)(unsafe.Pointer(uintptr(ptr)))
-}
-
-// PinMode returns the PinMode for a PIO state machine, one of
-// PIO0, PIO1, or PIO2.
-func (pio *PIO) PinMode() machine.PinMode {
-	return machine.PinPIO0 + machine.PinMode(pio.BlockIndex())
+	return &pio.hw.SM[index]
 }
 
 // GetIRQ returns the 8 PIO IRQ flags from the IRQ register.
@@ -221,12 +226,12 @@ func (pio *PIO) PinMode() machine.PinMode {
 //
 // See SetInterrupt() for registering interrupt handlers.
 func (pio *PIO) GetIRQ() uint8 {
-	return uint8(pio.hw.GetIRQ())
+	return uint8(pio.hw.IRQ.Get())
 }
 
 // ClearIRQ clears IRQ flags when 1 is written to bit flag.
 func (pio *PIO) ClearIRQ(irqMask uint8) {
-	pio.hw.SetIRQ(uint32(irqMask))
+	pio.hw.IRQ.Set(uint32(irqMask))
 }
 
 // SetInputSyncBypassMasked sets the pinMask bits of the INPUT_SYNC_BYPASS register
@@ -267,7 +272,7 @@ func (pio *PIO) Version() uint8 {
 }
 
 // HW returns a pointer to the PIO's hardware registers.
-func (pio *PIO) HW() *pioHW { return (*pioHW)(unsafe.Pointer(pio.hw)) }
+func (pio *PIO) HW() *pioHW { return pio.hw }
 
 type irqhandler = func(pioblock, irqZeroOrOne uint8, source IRQSource)
 
@@ -291,7 +296,6 @@ var (
 // Returns machine.ErrNoPinChangeChannel if a handler is already registered
 // on the specified interrupt line.
 func (pio *PIO) SetInterrupt(irqnumZeroOrOne uint8, sourceMask IRQSource, callback irqhandler) error {
-	const a = rp.IRQ_PIO0_IRQ_0
 	nblock := pio.blockIndex()
 	switch {
 	case callback == nil:
@@ -300,7 +304,7 @@ func (pio *PIO) SetInterrupt(irqnumZeroOrOne uint8, sourceMask IRQSource, callba
 		irqhandlers[nblock][irqnumZeroOrOne] = nil
 		return nil
 	case irqhandlers[nblock][irqnumZeroOrOne] != nil:
-		return machine.ErrNoPinChangeChannel
+		return errInterruptInUse
 	}
 
 	pio.setIRQSourceMask(irqnumZeroOrOne, sourceMask, true)
@@ -332,11 +336,15 @@ func (pio *PIO) clearIRQFlag(irqFlagNumber uint8) {
 	pio.HW().IRQ.Set(1 << irqFlagNumber)
 }
 
-// this is the global interrupt handler for PIO interrupts.
-func handleInterrupt(intr interrupt.Interrupt) {
+// dispatchInterrupts calls the handlers of all PIO interrupt lines with a pending
+// status. It is the body of the global interrupt handler for PIO interrupts.
+func dispatchInterrupts() {
 	var block, irq uint8
 	for block = 0; block < numPIO; block++ {
 		p := getPIO(block)
+		if p == nil {
+			continue // Off-target blocks not created with NewHostPIO.
+		}
 		hw := p.HW()
 		for irq = 0; irq < 2; irq++ {
 			stat := hw.IRQ_INT[irq].S.Get()
@@ -386,36 +394,32 @@ const (
 
 // Programmable IO block
 type pioHW struct {
-	CTRL              volatile.Register32 // 0x0
-	FSTAT             volatile.Register32 // 0x4
-	FDEBUG            volatile.Register32 // 0x8
-	FLEVEL            volatile.Register32 // 0xC
-	TXF               [4]volatile.Register32
-	RXF               [4]volatile.Register32
-	IRQ               volatile.Register32                       // 0x30
-	IRQ_FORCE         volatile.Register32                       // 0x34
-	INPUT_SYNC_BYPASS volatile.Register32                       // 0x38
-	DBG_PADOUT        volatile.Register32                       // 0x3C
-	DBG_PADOE         volatile.Register32                       // 0x40
-	DBG_CFGINFO       volatile.Register32                       // 0x44
-	INSTR_MEM         [32]volatile.Register32                   // 0x48..0xC4
-	SM                [4]statemachineHW                         // SM0=[0xC8..0xDC], .. 0x124
-	RXF_PUTGET        [rp2350ExtraReg][4][4]volatile.Register32 // ----- | 0x128
-	GPIOBASE          [rp2350ExtraReg]volatile.Register32       // ----- | 0x168
-	INTR              volatile.Register32                       // 0x128 | 0x16C
-	IRQ_INT           [2]irqINTHW                               // 0x12C..0x140 | 0x170..0x184
+	CTRL              register32 // 0x0
+	FSTAT             register32 // 0x4
+	FDEBUG            register32 // 0x8
+	FLEVEL            register32 // 0xC
+	TXF               [4]register32
+	RXF               [4]register32
+	IRQ               register32                       // 0x30
+	IRQ_FORCE         register32                       // 0x34
+	INPUT_SYNC_BYPASS register32                       // 0x38
+	DBG_PADOUT        register32                       // 0x3C
+	DBG_PADOE         register32                       // 0x40
+	DBG_CFGINFO       register32                       // 0x44
+	INSTR_MEM         [32]register32                   // 0x48..0xC4
+	SM                [4]statemachineHW                // SM0=[0xC8..0xDC], .. 0x124
+	RXF_PUTGET        [rp2350ExtraReg][4][4]register32 // ----- | 0x128
+	GPIOBASE          [rp2350ExtraReg]register32       // ----- | 0x168
+	INTR              register32                       // 0x128 | 0x16C
+	IRQ_INT           [2]irqINTHW                      // 0x12C..0x140 | 0x170..0x184
 }
 
 type irqINTHW struct {
-	E volatile.Register32 // Interrupt enable.
-	F volatile.Register32 // Interrupt force.
-	S volatile.Register32 // Interrupt status after masking.
+	E register32 // Interrupt enable.
+	F register32 // Interrupt force.
+	S register32 // Interrupt status after masking.
 }
 
-const (
-	sizeOK = unsafe.Sizeof(rp.PIO0_Type{}) == unsafe.Sizeof(pioHW{})
-)
-
 // noCopy may be embedded into structs which must not be copied
 // after the first use.
 //
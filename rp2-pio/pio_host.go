@@ -0,0 +1,217 @@
+//go:build !rp2040 && !rp2350
+
+package pio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Off-target builds use the RP2350 register layout with three PIO blocks.
+const (
+	rp2350ExtraReg = 1
+	numPIO         = 3
+
+	validINTEBits IRQSource = 0xFFFF
+
+	// NVIC interrupt number of PIO0_IRQ_0 on RP2350. The other PIO interrupt lines follow it.
+	irqPIO0IRQ0 = 15
+)
+
+// errInterruptInUse is returned by SetInterrupt when a handler is already registered.
+var errInterruptInUse = errors.New("pio: interrupt handler already registered")
+
+// hostPIOs holds the blocks created with NewHostPIO, by block index.
+var hostPIOs [numPIO]*PIO
+
+// hostPIO is the in-memory register file of a PIO block created with NewHostPIO.
+type hostPIO struct {
+	hw    pioHW
+	index uint8
+	// mu guards writes, which goroutines writing distinct registers append to concurrently.
+	mu     sync.Mutex
+	writes []RegisterWrite
+}
+
+// RegisterWrite is a write to an in-memory PIO register, recorded off-target.
+type RegisterWrite struct {
+	// Register is the datasheet name of the register, such as CTRL, SM0_PINCTRL or INSTR_MEM3.
+	// Interrupt lines enabled by SetInterrupt are recorded as writes to NVIC_ISER0.
+	Register string
+	// Value is the value written, or the bits toggled for writes through the XOR alias.
+	Value uint32
+	// XOR is true for writes through the atomic XOR alias of the register.
+	XOR bool
+}
+
+func (w RegisterWrite) String() string {
+	if w.XOR {
+		return fmt.Sprintf("%s ^= %#x", w.Register, w.Value)
+	}
+	return fmt.Sprintf("%s = %#x", w.Register, w.Value)
+}
+
+// NewHostPIO returns a PIO block backed by in-memory registers so that the logic of PIO and
+// StateMachine runs off-target, for example under go test. version is the value reported by
+// [PIO.Version], 0 for RP2040 and 1 for RP2350. Registers follow the RP2350 layout and start
+// at their reset values. The block becomes the one interrupts for blockIndex are dispatched to.
+//
+// Register writes are recorded, see [PIO.RegisterWrites]. Writes only affect the register
+// contents: the IRQ and FDEBUG registers are write-1-to-clear and the restart bits of CTRL
+// read as zero, but no program runs and the FIFOs stay empty. The emu package emulates the
+// state machines themselves.
+func NewHostPIO(blockIndex, version uint8) *PIO {
+	if blockIndex >= numPIO {
+		panic(badPIO)
+	}
+	dev := &hostPIO{index: blockIndex}
+	dev.init()
+	hw := &dev.hw
+	hw.FSTAT.Reg = 0xf<<pio0_FSTAT_TXEMPTY_Pos | 0xf<<pio0_FSTAT_RXEMPTY_Pos
+	// IMEM_SIZE, SM_COUNT and FIFO_DEPTH along with the version.
+	hw.DBG_CFGINFO.Reg = uint32(version)<<pio0_SM0_DBG_CFGINFO_VERSION_Pos | 32<<16 | 4<<8 | 4
+	for i := range hw.SM {
+		sm := &hw.SM[i]
+		sm.CLKDIV.Reg = 1 << pio0_SM0_CLKDIV_INT_Pos
+		sm.EXECCTRL.Reg = 0x1f << pio0_SM0_EXECCTRL_WRAP_TOP_Pos
+		sm.SHIFTCTRL.Reg = pio0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Msk | pio0_SM0_SHIFTCTRL_IN_SHIFTDIR_Msk
+		sm.PINCTRL.Reg = 5 << pio0_SM0_PINCTRL_SET_COUNT_Pos
+	}
+	pio := &PIO{hw: hw}
+	hostPIOs[blockIndex] = pio
+	return pio
+}
+
+// init names the registers and sets their write semantics.
+func (dev *hostPIO) init() {
+	hw := &dev.hw
+	reg := func(r *register32, name string, args ...any) {
+		r.dev = dev
+		r.name = fmt.Sprintf(name, args...)
+	}
+	reg(&hw.CTRL, "CTRL")
+	hw.CTRL.strobe = 0xff<<pio0_CTRL_SM_RESTART_Pos | 0x7<<24 // SM_RESTART, CLKDIV_RESTART and NEXTPREV bits.
+	reg(&hw.FSTAT, "FSTAT")
+	reg(&hw.FDEBUG, "FDEBUG")
+	hw.FDEBUG.w1c = true
+	reg(&hw.FLEVEL, "FLEVEL")
+	for i := range hw.TXF {
+		reg(&hw.TXF[i], "TXF%d", i)
+		reg(&hw.RXF[i], "RXF%d", i)
+	}
+	reg(&hw.IRQ, "IRQ")
+	hw.IRQ.w1c = true
+	reg(&hw.IRQ_FORCE, "IRQ_FORCE")
+	reg(&hw.INPUT_SYNC_BYPASS, "INPUT_SYNC_BYPASS")
+	reg(&hw.DBG_PADOUT, "DBG_PADOUT")
+	reg(&hw.DBG_PADOE, "DBG_PADOE")
+	reg(&hw.DBG_CFGINFO, "DBG_CFGINFO")
+	for i := range hw.INSTR_MEM {
+		reg(&hw.INSTR_MEM[i], "INSTR_MEM%d", i)
+	}
+	for i := range hw.SM {
+		sm := &hw.SM[i]
+		reg(&sm.CLKDIV, "SM%d_CLKDIV", i)
+		reg(&sm.EXECCTRL, "SM%d_EXECCTRL", i)
+		reg(&sm.SHIFTCTRL, "SM%d_SHIFTCTRL", i)
+		reg(&sm.ADDR, "SM%d_ADDR", i)
+		reg(&sm.INSTR, "SM%d_INSTR", i)
+		reg(&sm.PINCTRL, "SM%d_PINCTRL", i)
+		for j := range hw.RXF_PUTGET[0][i] {
+			reg(&hw.RXF_PUTGET[0][i][j], "RXF%d_PUTGET%d", i, j)
+		}
+	}
+	reg(&hw.GPIOBASE[0], "GPIOBASE")
+	reg(&hw.INTR, "INTR")
+	for i := range hw.IRQ_INT {
+		reg(&hw.IRQ_INT[i].E, "IRQ%d_INTE", i)
+		reg(&hw.IRQ_INT[i].F, "IRQ%d_INTF", i)
+		reg(&hw.IRQ_INT[i].S, "IRQ%d_INTS", i)
+	}
+}
+
+func (dev *hostPIO) record(w RegisterWrite) {
+	dev.mu.Lock()
+	dev.writes = append(dev.writes, w)
+	dev.mu.Unlock()
+}
+
+// RegisterWrites returns the register writes made since the block was created with
+// [NewHostPIO] or the writes were last cleared. Off-target only.
+func (pio *PIO) RegisterWrites() []RegisterWrite {
+	dev := pio.hw.CTRL.dev
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	return dev.writes
+}
+
+// ClearRegisterWrites discards the recorded register writes. Off-target only.
+func (pio *PIO) ClearRegisterWrites() {
+	dev := pio.hw.CTRL.dev
+	dev.mu.Lock()
+	dev.writes = nil
+	dev.mu.Unlock()
+}
+
+// register32 is an in-memory register recording the writes made to it.
+type register32 struct {
+	Reg  uint32
+	dev  *hostPIO
+	name string
+	// w1c registers clear the bits written as 1. strobe bits always read as 0.
+	w1c    bool
+	strobe uint32
+}
+
+func (r *register32) Get() uint32 { return r.Reg }
+
+func (r *register32) Set(value uint32) {
+	if r.dev != nil {
+		r.dev.record(RegisterWrite{Register: r.name, Value: value})
+	}
+	if r.w1c {
+		r.Reg &^= value
+	} else {
+		r.Reg = value &^ r.strobe
+	}
+}
+
+func (r *register32) SetBits(value uint32) { r.Set(r.Reg | value) }
+
+func (r *register32) ClearBits(value uint32) { r.Set(r.Reg &^ value) }
+
+func (r *register32) HasBits(value uint32) bool { return r.Reg&value != 0 }
+
+func (r *register32) ReplaceBits(value, mask uint32, pos uint8) {
+	r.Set(r.Reg&^(mask<<pos) | value<<pos)
+}
+
+// xorBits writes bits through the atomic XOR alias of reg.
+func xorBits(reg *register32, bits uint32) {
+	if reg.dev != nil {
+		reg.dev.record(RegisterWrite{Register: reg.name, Value: bits, XOR: true})
+	}
+	reg.Reg ^= bits &^ reg.strobe
+}
+
+// getPIO returns the block created with NewHostPIO for the block index, or nil if there is none.
+func getPIO(block uint8) (pio *PIO) {
+	if block >= numPIO {
+		panic("invalid block")
+	}
+	return hostPIOs[block]
+}
+
+func (pio *PIO) blockIndex() uint8 {
+	if pio.hw == nil || pio.hw.CTRL.dev == nil {
+		panic(badPIO)
+	}
+	return pio.hw.CTRL.dev.index
+}
+
+// interruptSet records the NVIC write enabling the interrupt line in the block's register writes.
+func interruptSet(nblock, irq uint8) {
+	dev := getPIO(nblock).hw.CTRL.dev
+	dev.record(RegisterWrite{Register: "NVIC_ISER0", Value: 1 << (irqPIO0IRQ0 + 2*nblock + irq)})
+}
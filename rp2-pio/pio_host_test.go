@@ -0,0 +1,322 @@
+//go:build !rp2040 && !rp2350
+
+package pio
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHostAddProgram(t *testing.T) {
+	pio := NewHostPIO(0, 0)
+	asm := AssemblerV0{}
+	program := []uint16{
+		asm.Set(SetDestPindirs, 1).Encode(),
+		asm.Jmp(JmpXNZeroDec, 1).Encode(),
+	}
+	offset, err := pio.AddProgram(program, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 30 {
+		t.Fatalf("loaded at %d, want 30", offset)
+	}
+	want := []RegisterWrite{
+		{Register: "INSTR_MEM30", Value: uint32(program[0])},
+		{Register: "INSTR_MEM31", Value: uint32(asm.Jmp(JmpXNZeroDec, 31).Encode())},
+	}
+	if got := pio.RegisterWrites(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes %v, want %v", got, want)
+	}
+
+	pio.ClearRegisterWrites()
+	v1 := []uint16{AssemblerV1{}.MovISRToRx(true, 0).Encode()}
+	if _, err := pio.AddProgram(v1, -1); !errors.Is(err, ErrRequiresV1) {
+		t.Errorf("got error %v adding a version 1 program to version 0 hardware, want ErrRequiresV1", err)
+	}
+	if _, err := pio.AddProgram(make([]uint16, 31), -1); err != ErrOutOfProgramSpace {
+		t.Errorf("got error %v adding a program too large for the free space, want ErrOutOfProgramSpace", err)
+	}
+	if err := pio.AddProgramAtOffset(program, -1, 29); err != ErrNoSpaceAtOffset {
+		t.Errorf("got error %v adding a program over another, want ErrNoSpaceAtOffset", err)
+	}
+	if got := pio.RegisterWrites(); len(got) != 0 {
+		t.Errorf("rejected programs wrote %v", got)
+	}
+}
+
+// TestHostAddProgramAllocs checks that the on-target work of adding and clearing programs, checking
+// and relocating instructions and encoding traps, does not allocate, so it is usable from interrupt
+// handlers. Recording register writes is off-target only and excluded.
+func TestHostAddProgramAllocs(t *testing.T) {
+	pio := NewHostPIO(0, 0)
+	asm := AssemblerV0{SidesetBits: 1}
+	program := []uint16{
+		asm.Set(SetDestPindirs, 1).Side(1).Encode(),
+		asm.Mov(MovDestX, MovSrcY).Encode(),
+		asm.Jmp(JmpXNZeroDec, 1).Side(1).Delay(3).Encode(),
+	}
+	v1 := []uint16{AssemblerV1{}.MovISRToRx(true, 0).Encode()}
+	var err error
+	allocs := testing.AllocsPerRun(100, func() {
+		if pio.checkInstructions(program) != nil {
+			panic("program rejected")
+		}
+		err = pio.checkInstructions(v1)
+		for _, instr := range program {
+			relocateInstr(instr, 30)
+		}
+		AssemblerV0{}.Jmp(JmpAlways, 30).Encode()
+	})
+	if allocs != 0 {
+		t.Errorf("adding and clearing programs allocated %v times", allocs)
+	}
+	if !errors.Is(err, ErrRequiresV1) {
+		t.Errorf("got error %v checking a version 1 program on version 0 hardware, want ErrRequiresV1", err)
+	}
+}
+
+func TestHostProgramHandle(t *testing.T) {
+	pio := NewHostPIO(0, 0)
+	asm := AssemblerV0{}
+	program := []uint16{
+		asm.Set(SetDestPindirs, 1).Encode(),
+		asm.Jmp(JmpXNZeroDec, 1).Encode(),
+	}
+	h, err := pio.AddProgramHandle(program, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pio.ClearRegisterWrites()
+	shared, err := pio.AddProgramHandle(program, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared != h || h.References() != 2 || len(pio.RegisterWrites()) != 0 {
+		t.Fatalf("got handle %p with %d references and writes %v, want the resident program shared", shared, h.References(), pio.RegisterWrites())
+	}
+	if target, wrap := h.Wrap(); h.Offset() != 30 || h.Len() != 2 || h.Origin() != -1 || target != 30 || wrap != 31 {
+		t.Errorf("got offset %d len %d origin %d wrap %d..%d", h.Offset(), h.Len(), h.Origin(), target, wrap)
+	}
+
+	// A different origin or wrap needs its own copy.
+	var copies []*ProgramHandle
+	for _, add := range []func() (*ProgramHandle, error){
+		func() (*ProgramHandle, error) { return pio.AddProgramHandle(program, 0) },
+		func() (*ProgramHandle, error) {
+			return pio.LoadProgramHandle(&AssembledProgram{Instructions: program, Origin: -1, Wrap: 1, WrapTarget: 1, SetCount: -1})
+		},
+	} {
+		other, err := add()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other == h || other.References() != 1 {
+			t.Errorf("got handle at %d with %d references, want a new copy", other.Offset(), other.References())
+		}
+		copies = append(copies, other)
+	}
+
+	pio.ClearRegisterWrites()
+	h.Release()
+	if h.References() != 1 || len(pio.RegisterWrites()) != 0 {
+		t.Fatalf("got %d references and writes %v after the first release", h.References(), pio.RegisterWrites())
+	}
+	h.Release()
+	trap := uint32(asm.Jmp(JmpAlways, 30).Encode())
+	want := []RegisterWrite{{Register: "INSTR_MEM30", Value: trap}, {Register: "INSTR_MEM31", Value: trap}}
+	if got := pio.RegisterWrites(); h.References() != 0 || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d references and writes %v after the last release, want %v", h.References(), got, want)
+	}
+	pio.ClearRegisterWrites()
+	h.Release()
+	if got := pio.RegisterWrites(); len(got) != 0 {
+		t.Errorf("releasing a removed program wrote %v", got)
+	}
+
+	// The freed slots are reused and a cleared program is no longer shared.
+	for _, other := range copies {
+		other.Release()
+	}
+	h, err = pio.AddProgramHandle(program, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Offset() != 30 {
+		t.Errorf("loaded at %d, want the freed offset 30", h.Offset())
+	}
+	pio.ClearProgramSection(31, 1)
+	if h.References() != 0 {
+		t.Errorf("got %d references after clearing the program's memory, want 0", h.References())
+	}
+	if again, err := pio.AddProgramHandle(program, -1); err != nil || again == h {
+		t.Errorf("got error %v, want a new copy of a cleared program", err)
+	}
+}
+
+func TestHostConcurrentClaims(t *testing.T) {
+	pio := NewHostPIO(0, 0)
+	program := []uint16{AssemblerV0{}.Nop().Encode()}
+	var wg sync.WaitGroup
+	var claims [4]atomic.Int32
+	offsets := make(chan uint8, 40)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sm := pio.StateMachine(uint8(i % 4)); sm.TryClaim() {
+				claims[i%4].Add(1)
+			}
+			if offset, err := pio.AddProgram(program, -1); err == nil {
+				offsets <- offset
+			}
+		}()
+	}
+	wg.Wait()
+	close(offsets)
+	for i := range claims {
+		if n := claims[i].Load(); n != 1 {
+			t.Errorf("state machine %d claimed %d times, want once", i, n)
+		}
+	}
+	var used uint32
+	for offset := range offsets {
+		if used&(1<<offset) != 0 {
+			t.Errorf("offset %d handed out twice", offset)
+		}
+		used |= 1 << offset
+	}
+	if used != 0xffffffff {
+		t.Errorf("got used offsets %#x, want all 32", used)
+	}
+}
+
+func TestHostStateMachineInit(t *testing.T) {
+	pio := NewHostPIO(1, 1)
+	sm := pio.StateMachine(2)
+	cfg := DefaultStateMachineConfig()
+	cfg.SetSetPins(4, 2)
+	cfg.SetClkDivIntFrac(3, 0)
+	sm.SetEnabled(true)
+	pio.ClearRegisterWrites()
+
+	sm.Init(7, cfg)
+	want := []RegisterWrite{
+		{Register: "CTRL", Value: 0},
+		{Register: "SM2_CLKDIV", Value: cfg.ClkDiv},
+		{Register: "SM2_EXECCTRL", Value: cfg.ExecCtrl},
+		{Register: "SM2_SHIFTCTRL", Value: cfg.ShiftCtrl},
+		{Register: "SM2_PINCTRL", Value: cfg.PinCtrl},
+		{Register: "SM2_SHIFTCTRL", Value: pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk, XOR: true},
+		{Register: "SM2_SHIFTCTRL", Value: pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk, XOR: true},
+		{Register: "FDEBUG", Value: 0x01010101 << 2},
+		{Register: "CTRL", Value: 1 << (pio0_CTRL_SM_RESTART_Pos + 2)},
+		{Register: "CTRL", Value: 1 << (pio0_CTRL_CLKDIV_RESTART_Pos + 2)},
+		{Register: "SM2_INSTR", Value: uint32(AssemblerV0{}.Jmp(JmpAlways, 7).Encode())},
+	}
+	if got := pio.RegisterWrites(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes\n%v\nwant\n%v", got, want)
+	}
+	if sm.IsEnabled() {
+		t.Error("state machine still enabled after Init")
+	}
+	if got := pio.HW().CTRL.Get(); got != 0 {
+		t.Errorf("got CTRL %#x, want restart bits to self-clear", got)
+	}
+	if got := sm.HW().SHIFTCTRL.Get(); got != cfg.ShiftCtrl {
+		t.Errorf("ClearFIFOs changed SHIFTCTRL to %#x, want %#x", got, cfg.ShiftCtrl)
+	}
+	if got := pio.BlockIndex(); got != 1 {
+		t.Errorf("got block index %d, want 1", got)
+	}
+	if err := NewHostPIO(0, 0).StateMachine(0).InitChecked(0, cfg); err != nil {
+		t.Errorf("InitChecked rejected a version 0 config: %v", err)
+	}
+
+	// Version 0 hardware cannot limit the IN pin count.
+	cfg.SetInPins(4, 3)
+	if err := NewHostPIO(0, 0).StateMachine(0).InitChecked(0, cfg); err == nil {
+		t.Error("InitChecked accepted an IN pin count on version 0")
+	}
+	sm = NewHostPIO(0, 1).StateMachine(0)
+	if err := sm.InitChecked(0, cfg); err != nil {
+		t.Errorf("InitChecked rejected an IN pin count on version 1: %v", err)
+	}
+	if got := sm.HW().SHIFTCTRL.Get() & pio0_SM0_SHIFTCTRL_IN_COUNT_Msk; got != 3 {
+		t.Errorf("got IN_COUNT %d, want 3", got)
+	}
+}
+
+func TestHostSetPinsMasked(t *testing.T) {
+	pio := NewHostPIO(0, 0)
+	sm := pio.StateMachine(1)
+	hw := sm.HW()
+	hw.EXECCTRL.Set(pio0_SM0_EXECCTRL_OUT_STICKY_Msk | 0x1f<<pio0_SM0_EXECCTRL_WRAP_TOP_Pos)
+	pinctrl := hw.PINCTRL.Get()
+	pio.ClearRegisterWrites()
+
+	sm.SetPinsMasked(0b01<<3, 0b11<<3)
+	asm := AssemblerV0{}
+	want := []RegisterWrite{
+		{Register: "SM1_EXECCTRL", Value: 0x1f << pio0_SM0_EXECCTRL_WRAP_TOP_Pos},
+		{Register: "SM1_PINCTRL", Value: 1<<pio0_SM0_PINCTRL_SET_COUNT_Pos | 3<<pio0_SM0_PINCTRL_SET_BASE_Pos},
+		{Register: "SM1_INSTR", Value: uint32(asm.Set(SetDestPins, 1).Encode())},
+		{Register: "SM1_PINCTRL", Value: 1<<pio0_SM0_PINCTRL_SET_COUNT_Pos | 4<<pio0_SM0_PINCTRL_SET_BASE_Pos},
+		{Register: "SM1_INSTR", Value: uint32(asm.Set(SetDestPins, 0).Encode())},
+		{Register: "SM1_PINCTRL", Value: pinctrl},
+		{Register: "SM1_EXECCTRL", Value: pio0_SM0_EXECCTRL_OUT_STICKY_Msk | 0x1f<<pio0_SM0_EXECCTRL_WRAP_TOP_Pos},
+	}
+	if got := pio.RegisterWrites(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestHostSetInterrupt(t *testing.T) {
+	pio := NewHostPIO(2, 1)
+	type call struct {
+		block, irq uint8
+		source     IRQSource
+	}
+	var calls []call
+	handler := func(block, irq uint8, source IRQSource) {
+		calls = append(calls, call{block, irq, source})
+	}
+	err := pio.SetInterrupt(1, IRQS5|IRQSRxFIFONotEmpty0, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pio.SetInterrupt(1, IRQS5|IRQSRxFIFONotEmpty0, nil)
+	want := []RegisterWrite{
+		{Register: "IRQ1_INTE", Value: uint32(IRQS5 | IRQSRxFIFONotEmpty0)},
+		{Register: "NVIC_ISER0", Value: 1 << 20}, // PIO2_IRQ_1.
+	}
+	if got := pio.RegisterWrites(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes %v, want %v", got, want)
+	}
+	if err := pio.SetInterrupt(1, IRQS0, handler); err != errInterruptInUse {
+		t.Errorf("got error %v registering a second handler, want errInterruptInUse", err)
+	}
+
+	// Flag 5 raised by a state machine: the dispatcher clears it and calls the handler.
+	hw := pio.HW()
+	hw.IRQ.Reg = 1 << 5
+	hw.IRQ_INT[1].S.Reg = uint32(IRQS5)
+	pio.ClearRegisterWrites()
+	dispatchInterrupts()
+	if want := []call{{2, 1, IRQS5}}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("got handler calls %v, want %v", calls, want)
+	}
+	if got := pio.GetIRQ(); got != 0 {
+		t.Errorf("got IRQ flags %#x after dispatch, want 0", got)
+	}
+
+	if err := pio.SetInterrupt(1, IRQS5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := hw.IRQ_INT[1].E.Get(); got != uint32(IRQSRxFIFONotEmpty0) {
+		t.Errorf("got IRQ1_INTE %#x after removing the handler, want only RX not empty", got)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build rp2040 || rp2350
+
+package pio
+
+import (
+	"device/rp"
+	"machine"
+	"runtime/interrupt"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// RP2040 PIO peripheral handles.
+var (
+	PIO0 = &PIO{
+		hw: (*pioHW)(unsafe.Pointer(rp.PIO0)),
+	}
+	PIO1 = &PIO{
+		hw: (*pioHW)(unsafe.Pointer(rp.PIO1)),
+	}
+)
+
+// register32 is a memory mapped hardware register.
+type register32 = volatile.Register32
+
+const (
+	sizeOK = unsafe.Sizeof(rp.PIO0_Type{}) == unsafe.Sizeof(pioHW{})
+)
+
+// errInterruptInUse is returned by SetInterrupt when a handler is already registered.
+var errInterruptInUse = machine.ErrNoPinChangeChannel
+
+// PinMode returns the PinMode for a PIO state machine, one of
+// PIO0, PIO1, or PIO2.
+func (pio *PIO) PinMode() machine.PinMode {
+	return machine.PinPIO0 + machine.PinMode(pio.BlockIndex())
+}
+
+// this is the global interrupt handler for PIO interrupts.
+func handleInterrupt(intr interrupt.Interrupt) {
+	dispatchInterrupts()
+}
+
+const (
+	// regAliasRW  = 0x0 << 12
+	regAliasXOR = 0x1 << 12
+	regAliasSET = 0x2 << 12
+	regAliasCLR = 0x3 << 12
+)
+
+// Gets the 'XOR' alias for a register
+//
+// Registers have 'ALIAS' registers with special semantics, see
+// 2.1.2. Atomic Register Access in the RP2040 Datasheet
+//
+// Each peripheral register block is allocated 4kB of address space, with registers accessed using one of 4 methods,
+// selected by address decode.
+//   - Addr + 0x0000 : normal read write access
+//   - Addr + 0x1000 : atomic XOR on write
+//   - Addr + 0x2000 : atomic bitmask set on write
+//   - Addr + 0x3000 : atomic bitmask clear on write
+//
+//go:inline
+func aliasReg(alias uintptr, reg *volatile.Register32) *volatile.Register32 {
+	alias = uintptr(unsafe.Pointer(reg)) | alias
+	return (*volatile.Register32)(unsafe.Pointer(alias))
+}
+
+func xorBits(reg *volatile.Register32, bits uint32) {
+	aliasReg(regAliasXOR, reg).Set(bits)
+}
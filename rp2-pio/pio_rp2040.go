@@ -30,9 +30,9 @@ func getPIO(block uint8) (pio *PIO) {
 
 func (pio *PIO) blockIndex() uint8 {
 	switch pio.hw {
-	case rp.PIO0:
+	case PIO0.hw:
 		return 0
-	case rp.PIO1:
+	case PIO1.hw:
 		return 1
 	}
 	panic(badPIO)
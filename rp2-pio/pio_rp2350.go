@@ -6,6 +6,7 @@ import (
 	"device/rp"
 	"machine"
 	"runtime/interrupt"
+	"unsafe"
 )
 
 const (
@@ -21,7 +22,7 @@ const (
 // RP2350 PIO peripheral handles.
 var (
 	PIO2 = &PIO{
-		hw: rp.PIO2,
+		hw: (*pioHW)(unsafe.Pointer(rp.PIO2)),
 	}
 )
 
@@ -39,11 +40,11 @@ func getPIO(block uint8) (pio *PIO) {
 
 func (pio *PIO) blockIndex() uint8 {
 	switch pio.hw {
-	case rp.PIO0:
+	case PIO0.hw:
 		return 0
-	case rp.PIO1:
+	case PIO1.hw:
 		return 1
-	case rp.PIO2:
+	case PIO2.hw:
 		return 2
 	}
 	panic(badPIO)
@@ -55,7 +56,7 @@ func (pio *PIO) blockIndex() uint8 {
 func (pio *PIO) SetGPIOBase(base uint32) {
 	switch base {
 	case 0, 16:
-		pio.hw.GPIOBASE.Set(base)
+		pio.hw.GPIOBASE[0].Set(base)
 	default:
 		panic("pio:invalid gpiobase")
 	}
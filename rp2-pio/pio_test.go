@@ -1,6 +1,8 @@
 package pio
 
 import (
+	"errors"
+	"math/big"
 	"testing"
 )
 
@@ -8,11 +10,29 @@ func TestAssemblerV0(t *testing.T) {
 	asm0 := AssemblerV0{SidesetBits: 0}
 	asm1 := AssemblerV0{SidesetBits: 1}
 	asm2 := AssemblerV0{SidesetBits: 2}
+	asmOpt := AssemblerV0{SidesetBits: 1, SidesetOptional: true}
 	var tests = []struct {
 		name       string
 		program    []uint16
 		expectprog []uint16
 	}{
+		{
+			name: "uart_tx",
+			program: []uint16{
+				0: asmOpt.Pull(false, true).Side(1).Delay(7).Encode(), //  0: pull   block           side 1 [7]
+				1: asmOpt.Set(SetDestX, 7).Side(0).Delay(7).Encode(),  //  1: set    x, 7            side 0 [7]
+				2: asmOpt.Out(OutDestPins, 1).Encode(),                //  2: out    pins, 1
+				3: asmOpt.Jmp(JmpXNZeroDec, 2).Delay(6).Encode(),      //  3: jmp    x--, 2                 [6]
+			},
+			expectprog: []uint16{
+				//     .wrap_target
+				0x9fa0, //  0: pull   block           side 1 [7]
+				0xf727, //  1: set    x, 7            side 0 [7]
+				0x6001, //  2: out    pins, 1
+				0x0642, //  3: jmp    x--, 2                 [6]
+				//     .wrap
+			},
+		},
 		{
 			name: "pulsar",
 			program: []uint16{
@@ -150,6 +170,25 @@ func TestAssemblerV0(t *testing.T) {
 				//     .wrap
 			},
 		},
+		{
+			// EncodeInstr must not shift the InstrKind value into the opcode bits, which only
+			// holds for JMP through OUT: PULL would come out as MOV, MOV as IRQ and SET as JMP.
+			name: "encode_instr",
+			program: []uint16{
+				0: asm0.EncodeInstr(InstrPUSH, 0, 0b001, 0),
+				1: asm0.EncodeInstr(InstrPULL, 0, 0b001, 0),
+				2: asm0.EncodeInstr(InstrMOV, 0, 1, 7),
+				3: asm0.EncodeInstr(InstrIRQ, 0, 2, 2),
+				4: asm0.EncodeInstr(InstrSET, 7, 4, 1),
+			},
+			expectprog: []uint16{
+				0x8020, //  0: push   block
+				0x80a0, //  1: pull   block
+				0xa027, //  2: mov    x, osr
+				0xc042, //  3: irq    clear 2
+				0xe781, //  4: set    pindirs, 1             [7]
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -202,6 +241,22 @@ func TestAssemblerV1(t *testing.T) {
 				//     .wrap
 			},
 		},
+		{
+			// mov rxfifo[], isr has bit 7 clear; with bit 7 set it is the encoding of pull.
+			name: "rxfifo put get",
+			program: []uint16{
+				0: asm1.MovISRToRx(false, 0).Side(0).Encode(),   // 0: mov    rxfifo[y], isr  side 0
+				1: asm1.MovISRToRx(true, 3).Side(0).Encode(),    // 1: mov    rxfifo[3], isr  side 0
+				2: asm1.MovOSRFromRx(false, 0).Side(0).Encode(), // 2: mov    osr, rxfifo[y]  side 0
+				3: asm1.MovOSRFromRx(true, 2).Side(0).Encode(),  // 3: mov    osr, rxfifo[2]  side 0
+			},
+			expectprog: []uint16{
+				0x8010, //  0: mov    rxfifo[y], isr  side 0
+				0x801b, //  1: mov    rxfifo[3], isr  side 0
+				0x8090, //  2: mov    osr, rxfifo[y]  side 0
+				0x809a, //  3: mov    osr, rxfifo[2]  side 0
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -217,3 +272,176 @@ func TestAssemblerV1(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeChecked(t *testing.T) {
+	asm0 := AssemblerV0{SidesetBits: 0}
+	asm2 := AssemblerV0{SidesetBits: 2}
+	asm4 := AssemblerV0{SidesetBits: 4}
+	v1 := AssemblerV1{SidesetBits: 0}
+	var tests = []struct {
+		name   string
+		instr  instructionV0
+		expect uint16
+		err    error
+	}{
+		{name: "ok", instr: asm2.Set(SetDestX, 14).Side(3).Delay(7), expect: 0xff2e},
+		{name: "ok 4 sideset bits", instr: asm4.Nop().Side(15).Delay(1), expect: 0xbf42},
+		{name: "ok in 32", instr: asm0.In(InSrcISR, 32), expect: 0x40c0},
+		{name: "ok v1 mov pindirs", instr: v1.Mov(MovDestPindirs, MovSrcNull), expect: 0xa063},
+		{name: "delay overflow", instr: asm2.Nop().Delay(15), expect: 0xa742, err: ErrDelayOverflow},
+		{name: "sideset overflow", instr: asm2.Nop().Side(4), expect: 0xa042, err: ErrSidesetOverflow},
+		{name: "sideset without bits", instr: asm0.Nop().Side(1), expect: 0xa042, err: ErrSidesetOverflow},
+		{name: "set overflow", instr: asm0.Set(SetDestX, 32), err: ErrArgOverflow, expect: 0xe020},
+		{name: "jmp overflow", instr: asm0.Jmp(JmpAlways, 33), err: ErrArgOverflow, expect: 0x0001},
+		{name: "out overflow", instr: asm0.Out(OutDestX, 33), err: ErrArgOverflow, expect: 0x6021},
+		{name: "irq overflow", instr: asm0.IRQSet(false, 8), err: ErrArgOverflow, expect: 0xc000},
+		{name: "reserved in source", instr: asm0.In(0b101, 1), err: ErrReservedEncoding, expect: 0x40a1},
+		{name: "reserved mov source", instr: asm0.Mov(MovDestX, 0b100), err: ErrReservedEncoding, expect: 0xa024},
+		{name: "reserved set dest", instr: asm0.Set(0b011, 1), err: ErrReservedEncoding, expect: 0xe061},
+		{name: "reserved rxfifo index", instr: v1.MovOSRFromRx(false, 1), err: ErrReservedEncoding, expect: 0x8091},
+		{name: "v1 on v0", instr: asm0.MovInvert(MovDestPindirs, MovSrcNull), err: ErrRequiresV1, expect: 0xa06b},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.instr.EncodeChecked()
+			if !errors.Is(err, test.err) {
+				t.Errorf("error mismatch got!=expected: %v != %v", err, test.err)
+			}
+			if got != test.expect || got != test.instr.Encode() {
+				t.Errorf("mismatched instruction want %02x, got %02x", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestDefaultStateMachineConfigSideset(t *testing.T) {
+	var tests = []struct {
+		name     string
+		asm      AssemblerV0
+		count    uint8
+		optional bool
+		pindirs  bool
+	}{
+		{name: "none", asm: AssemblerV0{}},
+		{name: "mandatory", asm: AssemblerV0{SidesetBits: 2}, count: 2},
+		{name: "optional", asm: AssemblerV0{SidesetBits: 1, SidesetOptional: true}, count: 2, optional: true},
+		{name: "pindirs", asm: AssemblerV0{SidesetBits: 1, SidesetPindirs: true}, count: 1, pindirs: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := test.asm.DefaultStateMachineConfig(0, []uint16{0})
+			count := uint8((cfg.PinCtrl & pio0_SM0_PINCTRL_SIDESET_COUNT_Msk) >> pio0_SM0_PINCTRL_SIDESET_COUNT_Pos)
+			optional := cfg.ExecCtrl&pio0_SM0_EXECCTRL_SIDE_EN_Msk != 0
+			pindirs := cfg.ExecCtrl&pio0_SM0_EXECCTRL_SIDE_PINDIR_Msk != 0
+			if count != test.count || optional != test.optional || pindirs != test.pindirs {
+				t.Errorf("sideset config got!=expected: (%d,%v,%v) != (%d,%v,%v)", count, optional, pindirs, test.count, test.optional, test.pindirs)
+			}
+			v1cfg := AssemblerV1(test.asm).DefaultStateMachineConfig(0, []uint16{0})
+			if v1cfg != cfg {
+				t.Errorf("V1 config mismatch got!=expected: %+v != %+v", v1cfg, cfg)
+			}
+		})
+	}
+}
+
+func TestAssemblerDisassemblerRoundTrip(t *testing.T) {
+	v0 := AssemblerV0{SidesetBits: 5}
+	opt := AssemblerV1{SidesetBits: 4, SidesetOptional: true}
+	v1 := AssemblerV1{SidesetBits: 1}
+	var tests = []struct {
+		name    string
+		dis     Disassembler
+		program []uint16
+	}{
+		{
+			name: "five side-set bits leave no delay",
+			dis:  v0.Disassembler(),
+			program: []uint16{
+				v0.Jmp(JmpPinInput, 31).Side(31).Encode(),
+				v0.WaitIRQ(true, true, 7).Side(0).Encode(),
+				v0.IRQWait(true, 3).Side(16).Encode(),
+			},
+		},
+		{
+			name: "optional side-set fills the delay field",
+			dis:  opt.Disassembler(),
+			program: []uint16{
+				opt.Nop().Side(15).Encode(),
+				opt.Nop().Encode(),
+				opt.Out(OutDestExec, 32).Side(0).Encode(),
+				opt.In(InSrcNull, 32).Encode(),
+			},
+		},
+		{
+			name: "v1 instructions",
+			dis:  v1.Disassembler(),
+			program: []uint16{
+				v1.WaitIRQMode(true, 7, IRQNext).Side(1).Encode(),
+				v1.IRQWait(3, IRQPrev).Side(0).Encode(),
+				v1.IRQClear(0, IRQRel).Side(0).Delay(15).Encode(),
+				v1.MovISRToRx(true, 3).Side(1).Encode(),
+				v1.MovOSRFromRx(false, 0).Side(0).Encode(),
+				v1.WaitJmpPin(false, 3).Side(0).Encode(),
+				v1.MovInvert(MovDestPindirs, MovSrcNull).Side(1).Encode(),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkRoundTrip(t, test.program, test.dis)
+		})
+	}
+}
+
+func TestClkDiv(t *testing.T) {
+	var tests = []struct {
+		name     string
+		period   uint32 // Nanoseconds, passed to ClkDivFromPeriod unless fromFreq.
+		freq     uint32
+		cpuFreq  uint32
+		whole    uint16
+		frac     uint8
+		wantErr  bool
+		fromFreq bool
+	}{
+		{name: "ws2812b", freq: 7_200_000, cpuFreq: 125_000_000, whole: 17, frac: 92, fromFreq: true},
+		{name: "cpu frequency", freq: 150_000_000, cpuFreq: 150_000_000, whole: 1, fromFreq: true},
+		{name: "above cpu frequency", freq: 150_000_001, cpuFreq: 150_000_000, wantErr: true, fromFreq: true},
+		{name: "slowest", freq: 1908, cpuFreq: 125_000_000, whole: 65513, frac: 160, fromFreq: true},
+		{name: "too slow", freq: 1, cpuFreq: 150_000_000, wantErr: true, fromFreq: true},
+		// Found by FuzzClkDivFromFrequency: a zero frequency divided by zero.
+		{name: "zero frequency", freq: 0, cpuFreq: 125_000_000, wantErr: true, fromFreq: true},
+		{name: "1us period", period: 1000, cpuFreq: 125_000_000, whole: 125},
+		{name: "one cycle period", period: 8, cpuFreq: 125_000_000, whole: 1},
+		{name: "period below one cycle", period: 7, cpuFreq: 125_000_000, wantErr: true},
+		{name: "truncated period", period: 1001, cpuFreq: 133_000_000, whole: 133, frac: 34},
+		// Found by FuzzClkDivFromPeriod: 256*period*cpuFreq overflowed 64 bits and wrapped into range.
+		{name: "overflowing period", period: 480383968, cpuFreq: 150_000_000, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var whole uint16
+			var frac uint8
+			var err error
+			var div *big.Rat
+			if test.fromFreq {
+				whole, frac, err = ClkDivFromFrequency(test.freq, test.cpuFreq)
+			} else {
+				whole, frac, err = ClkDivFromPeriod(test.period, test.cpuFreq)
+				div = new(big.Rat).SetFrac64(int64(test.period)*int64(test.cpuFreq), 1e9)
+			}
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if err == nil && (whole != test.whole || frac != test.frac) {
+				t.Errorf("got %d+%d/256, want %d+%d/256", whole, frac, test.whole, test.frac)
+			}
+			if test.fromFreq && test.freq != 0 {
+				div = big.NewRat(int64(test.cpuFreq), int64(test.freq))
+			}
+			if div != nil {
+				checkClkDiv(t, test.cpuFreq, div, whole, frac, err)
+			}
+		})
+	}
+}
@@ -3,11 +3,7 @@ package piolib
 import (
 	"errors"
 	"math"
-	"runtime"
 	"time"
-	"unsafe"
-
-	pio "github.com/tinygo-org/pio/rp2-pio"
 )
 
 const timeoutRetries = math.MaxUint16 * 8
@@ -20,17 +16,13 @@ var (
 	errDMAUnavail = errors.New("piolib:DMA channel unavailable")
 )
 
-//go:generate pioasm -o go parallel8.pio         parallel8_pio.go
-//go:generate pioasm -o go pulsar.pio            pulsar_pio.go
-//go:generate pioasm -o go spi.pio               spi_pio.go
-//go:generate pioasm -o go ws2812b.pio           ws2812b_pio.go
-//go:generate pioasm -o go i2s.pio               i2s_pio.go
-//go:generate pioasm -o go spi3w.pio             spi3w_pio.go
-//go:generate pioasm -o go ws2812bfourpixels.pio ws2812bfourpixels_pio.go
-
-func gosched() {
-	runtime.Gosched()
-}
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go parallel8.pio         parallel8_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go pulsar.pio            pulsar_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go spi.pio               spi_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go ws2812b.pio           ws2812b_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go i2s.pio               i2s_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go spi3w.pio             spi3w_pio.go
+//go:generate go run github.com/tinygo-org/pio/cmd/piogen -o go ws2812bfourpixels.pio ws2812bfourpixels_pio.go
 
 type deadline struct {
 	t time.Time
@@ -70,30 +62,3 @@ func (ch *deadliner) setTimeout(timeout time.Duration) {
 		}
 	}
 }
-
-// helperPushUntilStall pushes buf data elements into TxReg through DMA if enabled or via [pio.StateMachine.TxPut] if dma disabled.
-// It blocks until TxStall flag is set in state machine FDEBUG register. TxStall flag cleared immediately on this function call.
-func helperPushUntilStall[T uint8 | uint16 | uint32](sm pio.StateMachine, dma dmaChannel, buf []T) (err error) {
-	sm.ClearTxStalled()
-	if dma.helperIsEnabled() {
-		dreq := dmaPIO_TxDREQ(sm)
-		err = dmaPush(dma, (*T)(unsafe.Pointer(sm.TxReg())), buf, dreq)
-	} else {
-		i := 0
-		for i < len(buf) {
-			if sm.IsTxFIFOFull() {
-				gosched()
-				continue
-			}
-			sm.TxPut(uint32(buf[i]))
-			i++
-		}
-	}
-	if err != nil {
-		return err
-	}
-	for !sm.HasTxStalled() {
-		gosched() // Block until empty.
-	}
-	return nil
-}
@@ -1,10 +1,6 @@
-//go:build rp2040 || rp2350
-
 package piolib
 
 import (
-	"device/rp"
-	"runtime/volatile"
 	"unsafe"
 
 	pio "github.com/tinygo-org/pio/rp2-pio"
@@ -31,10 +27,8 @@ func (arb *dmaArbiter) Channel(channel uint8) dmaChannel {
 	if channel > 11 {
 		panic("invalid DMA channel")
 	}
-	// DMA channels usable on the RP2040. 12 in total.
-	var dmaChannels = (*[12]dmaChannelHW)(unsafe.Pointer(rp.DMA))
 	return dmaChannel{
-		hw:  &dmaChannels[channel],
+		hw:  dmaChannelRegs(channel),
 		arb: arb,
 		idx: channel,
 	}
@@ -62,6 +56,33 @@ func (dma *dmaChannel) helperEnableDMA(enabled bool) error {
 	return nil
 }
 
+// helperPushUntilStall pushes buf data elements into TxReg through DMA if enabled or via [pio.StateMachine.TxPut] if dma disabled.
+// It blocks until TxStall flag is set in state machine FDEBUG register. TxStall flag cleared immediately on this function call.
+func helperPushUntilStall[T uint8 | uint16 | uint32](sm pio.StateMachine, dma dmaChannel, buf []T) (err error) {
+	sm.ClearTxStalled()
+	if dma.helperIsEnabled() {
+		dreq := dmaPIO_TxDREQ(sm)
+		err = dmaPush(dma, (*T)(unsafe.Pointer(sm.TxReg())), buf, dreq)
+	} else {
+		i := 0
+		for i < len(buf) {
+			if sm.IsTxFIFOFull() {
+				gosched()
+				continue
+			}
+			sm.TxPut(uint32(buf[i]))
+			i++
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for !sm.HasTxStalled() {
+		gosched() // Block until empty.
+	}
+	return nil
+}
+
 type dmaChannel struct {
 	hw  *dmaChannelHW
 	arb *dmaArbiter
@@ -70,20 +91,23 @@ type dmaChannel struct {
 }
 
 // TryClaim claims the DMA channel for use by a peripheral and returns if it succeeded in claiming the channel.
+// Claiming is atomic, safe from any goroutine, interrupt handler or core.
 func (ch dmaChannel) TryClaim() bool {
 	ch.mustValid()
-	if ch.IsClaimed() {
-		return false
-	}
+	state := lockDMAClaims()
+	claimed := !ch.IsClaimed()
 	ch.arb.claimedChannels |= 1 << ch.idx
-	return true
+	unlockDMAClaims(state)
+	return claimed
 }
 
 // Unclaim releases the DMA channel so it can be used by other peripherals.
 // It does not check if the channel is currently claimed; it force-unclaims the channel.
 func (ch dmaChannel) Unclaim() {
 	ch.mustValid()
+	state := lockDMAClaims()
 	ch.arb.claimedChannels &^= 1 << ch.idx
+	unlockDMAClaims(state)
 }
 
 // IsClaimed returns true if the DMA channel is currently claimed through software.
@@ -122,11 +146,11 @@ func (ch dmaChannel) mustValid() {
 
 // Single DMA channel. See rp.DMA_Type.
 type dmaChannelHW struct {
-	READ_ADDR   volatile.Register32
-	WRITE_ADDR  volatile.Register32
-	TRANS_COUNT volatile.Register32
-	CTRL_TRIG   volatile.Register32
-	_           [12]volatile.Register32 // aliases
+	READ_ADDR   dmaRegister
+	WRITE_ADDR  dmaRegister
+	TRANS_COUNT dmaRegister
+	CTRL_TRIG   dmaRegister
+	_           [12]dmaRegister // aliases
 }
 
 // Static assignment of DMA channels to peripherals.
@@ -218,9 +242,9 @@ func dmaPush[T uint8 | uint16 | uint32](ch dmaChannel, dst *T, src []T, dreq uin
 	}
 
 	hw := ch.HW()
-	hw.CTRL_TRIG.ClearBits(rp.DMA_CH0_CTRL_TRIG_EN_Msk)
-	srcPtr := uint32(uintptr(unsafe.Pointer(&src[0])))
-	dstPtr := uint32(uintptr(unsafe.Pointer(dst)))
+	hw.CTRL_TRIG.ClearBits(dma_CH0_CTRL_TRIG_EN_Msk)
+	srcPtr := dmaAddress(unsafe.Pointer(&src[0]), uintptr(len(src))*unsafe.Sizeof(src[0]))
+	dstPtr := dmaAddress(unsafe.Pointer(dst), unsafe.Sizeof(*dst))
 	hw.READ_ADDR.Set(srcPtr)
 	hw.WRITE_ADDR.Set(dstPtr)
 	hw.TRANS_COUNT.Set(uint32(len(src)))
@@ -246,7 +270,7 @@ func dmaPush[T uint8 | uint16 | uint32](ch dmaChannel, dst *T, src []T, dreq uin
 		}
 		gosched()
 	}
-	hw.CTRL_TRIG.ClearBits(rp.DMA_CH0_CTRL_TRIG_EN_Msk)
+	hw.CTRL_TRIG.ClearBits(dma_CH0_CTRL_TRIG_EN_Msk)
 	return nil
 }
 
@@ -277,9 +301,9 @@ func dmaPull[T uint8 | uint16 | uint32](ch dmaChannel, dst []T, src *T, dreq uin
 	}
 
 	hw := ch.HW()
-	hw.CTRL_TRIG.ClearBits(rp.DMA_CH0_CTRL_TRIG_EN_Msk)
-	srcPtr := uint32(uintptr(unsafe.Pointer(src)))
-	dstPtr := uint32(uintptr(unsafe.Pointer(&dst[0])))
+	hw.CTRL_TRIG.ClearBits(dma_CH0_CTRL_TRIG_EN_Msk)
+	srcPtr := dmaAddress(unsafe.Pointer(src), unsafe.Sizeof(*src))
+	dstPtr := dmaAddress(unsafe.Pointer(&dst[0]), uintptr(len(dst))*unsafe.Sizeof(dst[0]))
 	hw.READ_ADDR.Set(srcPtr)
 	hw.WRITE_ADDR.Set(dstPtr)
 	hw.TRANS_COUNT.Set(uint32(len(dst)))
@@ -332,10 +356,10 @@ func (ch dmaChannel) abort() {
 	// After writing, this register must be polled until it returns all-zero.
 	// Until this point, it is unsafe to restart the channel.
 	chMask := uint32(1 << ch.idx)
-	rp.DMA.CHAN_ABORT.Set(chMask)
+	dmaChanAbort().Set(chMask)
 
 	deadline := ch.dl.newDeadline()
-	for rp.DMA.CHAN_ABORT.Get()&chMask != 0 {
+	for dmaChanAbort().Get()&chMask != 0 {
 		if deadline.expired() {
 			println("DMA abort timeout")
 			break
@@ -346,7 +370,7 @@ func (ch dmaChannel) abort() {
 
 func (ch dmaChannel) busy() bool {
 	hw := ch.HW()
-	return hw.CTRL_TRIG.Get()&rp.DMA_CH0_CTRL_TRIG_BUSY != 0
+	return hw.CTRL_TRIG.Get()&dma_CH0_CTRL_TRIG_BUSY != 0
 }
 
 type dmaTxSize uint32
@@ -370,7 +394,7 @@ func dmaDefaultConfig(channel uint8) (cc dmaChannelConfig) {
 	cc.setHighPriority(false)
 
 	cc.setChainTo(channel)
-	cc.setTREQ_SEL(rp.DMA_CH0_CTRL_TRIG_TREQ_SEL_PERMANENT)
+	cc.setTREQ_SEL(dma_CH0_CTRL_TRIG_TREQ_SEL_PERMANENT)
 	cc.setReadIncrement(true)
 	cc.setTransferDataSize(dmaTxSize32)
 	// cc.setEnable(true)
@@ -381,15 +405,15 @@ func dmaDefaultConfig(channel uint8) (cc dmaChannelConfig) {
 // to pace its data transfer rate. Sources for TREQ signals are internal (TIMERS)
 // or external (DREQ, a Data Request from the system). 0x0 to 0x3a -> select DREQ n as TREQ
 func (cc *dmaChannelConfig) setTREQ_SEL(dreq uint32) {
-	cc.CTRL = (cc.CTRL & ^uint32(rp.DMA_CH0_CTRL_TRIG_TREQ_SEL_Msk)) | (uint32(dreq) << rp.DMA_CH0_CTRL_TRIG_TREQ_SEL_Pos)
+	cc.CTRL = (cc.CTRL & ^uint32(dma_CH0_CTRL_TRIG_TREQ_SEL_Msk)) | (uint32(dreq) << dma_CH0_CTRL_TRIG_TREQ_SEL_Pos)
 }
 
 func (cc *dmaChannelConfig) setChainTo(chainTo uint8) {
-	cc.CTRL = (cc.CTRL & ^uint32(rp.DMA_CH0_CTRL_TRIG_CHAIN_TO_Msk)) | (uint32(chainTo) << rp.DMA_CH0_CTRL_TRIG_CHAIN_TO_Pos)
+	cc.CTRL = (cc.CTRL & ^uint32(dma_CH0_CTRL_TRIG_CHAIN_TO_Msk)) | (uint32(chainTo) << dma_CH0_CTRL_TRIG_CHAIN_TO_Pos)
 }
 
 func (cc *dmaChannelConfig) setTransferDataSize(size dmaTxSize) {
-	cc.CTRL = (cc.CTRL & ^uint32(rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_Msk)) | (uint32(size) << rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_Pos)
+	cc.CTRL = (cc.CTRL & ^uint32(dma_CH0_CTRL_TRIG_DATA_SIZE_Msk)) | (uint32(size) << dma_CH0_CTRL_TRIG_DATA_SIZE_Pos)
 }
 
 func (cc *dmaChannelConfig) setRing(write bool, sizeBits uint32) {
@@ -401,37 +425,37 @@ func (cc *dmaChannelConfig) setRing(write bool, sizeBits uint32) {
 		              (write ? DMA_CH0_CTRL_TRIG_RING_SEL_BITS : 0);
 		}
 	*/
-	cc.CTRL = (cc.CTRL & ^uint32(rp.DMA_CH0_CTRL_TRIG_RING_SIZE_Msk)) |
-		(sizeBits << rp.DMA_CH0_CTRL_TRIG_RING_SIZE_Pos)
-	setBitPos(&cc.CTRL, rp.DMA_CH0_CTRL_TRIG_RING_SEL_Pos, write)
+	cc.CTRL = (cc.CTRL & ^uint32(dma_CH0_CTRL_TRIG_RING_SIZE_Msk)) |
+		(sizeBits << dma_CH0_CTRL_TRIG_RING_SIZE_Pos)
+	setBitPos(&cc.CTRL, dma_CH0_CTRL_TRIG_RING_SEL_Pos, write)
 }
 
 func (cc *dmaChannelConfig) setReadIncrement(incr bool) {
-	setBitPos(&cc.CTRL, rp.DMA_CH0_CTRL_TRIG_INCR_READ_Pos, incr)
+	setBitPos(&cc.CTRL, dma_CH0_CTRL_TRIG_INCR_READ_Pos, incr)
 }
 
 func (cc *dmaChannelConfig) setWriteIncrement(incr bool) {
-	setBitPos(&cc.CTRL, rp.DMA_CH0_CTRL_TRIG_INCR_WRITE_Pos, incr)
+	setBitPos(&cc.CTRL, dma_CH0_CTRL_TRIG_INCR_WRITE_Pos, incr)
 }
 
 func (cc *dmaChannelConfig) setBSwap(bswap bool) {
-	setBitPos(&cc.CTRL, rp.DMA_CH0_CTRL_TRIG_BSWAP_Pos, bswap)
+	setBitPos(&cc.CTRL, dma_CH0_CTRL_TRIG_BSWAP_Pos, bswap)
 }
 
 func (cc *dmaChannelConfig) setIRQQuiet(irqQuiet bool) {
-	setBitPos(&cc.CTRL, rp.DMA_CH0_CTRL_TRIG_IRQ_QUIET_Pos, irqQuiet)
+	setBitPos(&cc.CTRL, dma_CH0_CTRL_TRIG_IRQ_QUIET_Pos, irqQuiet)
 }
 
 func (cc *dmaChannelConfig) setHighPriority(highPriority bool) {
-	setBitPos(&cc.CTRL, rp.DMA_CH0_CTRL_TRIG_HIGH_PRIORITY_Pos, highPriority)
+	setBitPos(&cc.CTRL, dma_CH0_CTRL_TRIG_HIGH_PRIORITY_Pos, highPriority)
 }
 
 func (cc *dmaChannelConfig) setEnable(enable bool) {
-	setBitPos(&cc.CTRL, rp.DMA_CH0_CTRL_TRIG_EN_Pos, enable)
+	setBitPos(&cc.CTRL, dma_CH0_CTRL_TRIG_EN_Pos, enable)
 }
 
 func (cc *dmaChannelConfig) setSniffEnable(sniffEnable bool) {
-	setBitPos(&cc.CTRL, rp.DMA_CH0_CTRL_TRIG_SNIFF_EN_Pos, sniffEnable)
+	setBitPos(&cc.CTRL, dma_CH0_CTRL_TRIG_SNIFF_EN_Pos, sniffEnable)
 }
 
 func setBitPos(cc *uint32, pos uint32, bit bool) {
@@ -0,0 +1,223 @@
+//go:build !rp2040 && !rp2350
+
+package piolib
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// Off-target the DMA channels are those of an emulated RP2350 DMA controller, the layout the
+// host PIO blocks use. See hostDMA.
+const (
+	dma_CH0_CTRL_TRIG_BSWAP_Pos          = 24
+	dma_CH0_CTRL_TRIG_BUSY               = 0x4000000
+	dma_CH0_CTRL_TRIG_CHAIN_TO_Msk       = 0x1e000
+	dma_CH0_CTRL_TRIG_CHAIN_TO_Pos       = 13
+	dma_CH0_CTRL_TRIG_DATA_SIZE_Msk      = 0xc
+	dma_CH0_CTRL_TRIG_DATA_SIZE_Pos      = 2
+	dma_CH0_CTRL_TRIG_EN_Msk             = 0x1
+	dma_CH0_CTRL_TRIG_EN_Pos             = 0
+	dma_CH0_CTRL_TRIG_HIGH_PRIORITY_Pos  = 1
+	dma_CH0_CTRL_TRIG_INCR_READ_Pos      = 4
+	dma_CH0_CTRL_TRIG_INCR_WRITE_Pos     = 6
+	dma_CH0_CTRL_TRIG_IRQ_QUIET_Pos      = 23
+	dma_CH0_CTRL_TRIG_RING_SEL_Pos       = 12
+	dma_CH0_CTRL_TRIG_RING_SIZE_Msk      = 0xf00
+	dma_CH0_CTRL_TRIG_RING_SIZE_Pos      = 8
+	dma_CH0_CTRL_TRIG_SNIFF_EN_Pos       = 25
+	dma_CH0_CTRL_TRIG_TREQ_SEL_Msk       = 0x7e0000
+	dma_CH0_CTRL_TRIG_TREQ_SEL_PERMANENT = 0x3f
+	dma_CH0_CTRL_TRIG_TREQ_SEL_Pos       = 17
+)
+
+// Bus addresses of the host memory handed to DMA transfers and of the PIO FIFO registers.
+const (
+	hostSRAMBase      = 0x20000000
+	hostRegionSpacing = 1 << 20
+	hostRegions       = 16 // Regions mapped at once, reused oldest first.
+	hostPIO0TXF0      = 0x50200010
+	hostPIOSpacing    = 0x100000
+)
+
+// hostDMA is the emulated DMA controller off-target channels program. Nothing steps it on its
+// own: tests advance it, along with the emulated PIO blocks it feeds, from onGosched so that the
+// wait loops of the drivers drive the emulation.
+var hostDMA = newHostDMAController()
+
+type hostDMAController struct {
+	*emu.DMA
+	bus      hostBus
+	channels [12]dmaChannelHW
+	abort    dmaRegister
+}
+
+func newHostDMAController() *hostDMAController {
+	c := &hostDMAController{bus: hostBus{fifos: map[unsafe.Pointer]uint32{}}}
+	c.DMA = emu.NewDMA(1, &c.bus)
+	for i := range c.channels {
+		ch, hw := c.DMA.Channel(uint8(i)), &c.channels[i]
+		hw.READ_ADDR = dmaRegister{ch: ch, off: 0x0}
+		hw.WRITE_ADDR = dmaRegister{ch: ch, off: 0x4}
+		hw.TRANS_COUNT = dmaRegister{ch: ch, off: 0x8}
+		hw.CTRL_TRIG = dmaRegister{ch: ch, off: 0xc}
+	}
+	c.abort = dmaRegister{dma: c.DMA}
+	return c
+}
+
+// connectPIO routes transfers to and from the TXF and RXF registers of the host block p to the
+// FIFOs of the emulated block b, whose DREQs pace the channels.
+func (c *hostDMAController) connectPIO(p *pio.PIO, b *emu.Block) {
+	if p.BlockIndex() != b.BlockIndex() {
+		panic("piolib: host and emulated PIO block indices differ")
+	}
+	c.DMA.ConnectPIO(b)
+	base := hostPIO0TXF0 + hostPIOSpacing*uint32(p.BlockIndex())
+	for i := uint8(0); i < 4; i++ {
+		sm := p.StateMachine(i)
+		c.bus.fifos[unsafe.Pointer(sm.TxReg())] = base + 4*uint32(i)
+		c.bus.fifos[unsafe.Pointer(sm.RxReg())] = base + 0x10 + 4*uint32(i)
+	}
+}
+
+// dmaClaimMu serialises DMA channel claims between goroutines off-target.
+var dmaClaimMu sync.Mutex
+
+type dmaClaimState struct{}
+
+func lockDMAClaims() dmaClaimState {
+	dmaClaimMu.Lock()
+	return dmaClaimState{}
+}
+
+func unlockDMAClaims(dmaClaimState) { dmaClaimMu.Unlock() }
+
+func dmaChannelRegs(channel uint8) *dmaChannelHW { return &hostDMA.channels[channel] }
+
+func dmaChanAbort() *dmaRegister { return &hostDMA.abort }
+
+// dmaAddress returns the bus address the emulated DMA controller reaches the n bytes at p through.
+func dmaAddress(p unsafe.Pointer, n uintptr) uint32 {
+	return hostDMA.bus.address(p, n)
+}
+
+// dmaRegister is a register of a channel of the emulated DMA controller, or its CHAN_ABORT
+// register if dma is set.
+type dmaRegister struct {
+	ch  *emu.DMAChannel
+	off uint8
+	dma *emu.DMA
+}
+
+func (r *dmaRegister) Get() uint32 {
+	switch {
+	case r.dma != nil:
+		return 0 // Aborts complete immediately.
+	case r.off == 0x0:
+		return r.ch.ReadAddr()
+	case r.off == 0x4:
+		return r.ch.WriteAddr()
+	case r.off == 0x8:
+		return r.ch.TransCount()
+	}
+	return r.ch.CTRL()
+}
+
+func (r *dmaRegister) Set(value uint32) {
+	switch {
+	case r.dma != nil:
+		r.dma.Abort(value)
+	case r.off == 0x0:
+		r.ch.SetReadAddr(value)
+	case r.off == 0x4:
+		r.ch.SetWriteAddr(value)
+	case r.off == 0x8:
+		r.ch.SetTransCount(value)
+	default:
+		r.ch.SetCTRLTrig(value)
+	}
+}
+
+func (r *dmaRegister) ClearBits(value uint32) { r.Set(r.Get() &^ value) }
+
+// hostBus is the bus of the emulated DMA controller. It maps the Go memory of transfers to
+// addresses 1MiB apart from the base of SRAM, keeping their alignment, and the FIFO registers of
+// connected host PIO blocks to those of the emulated blocks.
+type hostBus struct {
+	regions []hostRegion
+	next    int
+	fifos   map[unsafe.Pointer]uint32
+}
+
+type hostRegion struct {
+	addr uint32
+	p    unsafe.Pointer
+	n    uintptr
+}
+
+func (bus *hostBus) address(p unsafe.Pointer, n uintptr) uint32 {
+	if addr, ok := bus.fifos[p]; ok {
+		return addr
+	}
+	for _, r := range bus.regions {
+		if r.p == p && r.n >= n {
+			return r.addr
+		}
+	}
+	if n > hostRegionSpacing-4 {
+		panic("piolib: host DMA transfer too large")
+	}
+	slot := bus.next % hostRegions
+	bus.next++
+	r := hostRegion{addr: hostSRAMBase + uint32(slot)*hostRegionSpacing + uint32(uintptr(p)&3), p: p, n: n}
+	if slot == len(bus.regions) {
+		bus.regions = append(bus.regions, r)
+	} else {
+		bus.regions[slot] = r
+	}
+	return r.addr
+}
+
+func (bus *hostBus) mem(addr uint32, size uint8) (unsafe.Pointer, error) {
+	for _, r := range bus.regions {
+		if addr >= r.addr && uintptr(addr-r.addr)+uintptr(size) <= r.n {
+			return unsafe.Add(r.p, addr-r.addr), nil
+		}
+	}
+	return nil, fmt.Errorf("piolib: host DMA access to unmapped address %#x", addr)
+}
+
+func (bus *hostBus) Read(addr uint32, size uint8) (uint32, error) {
+	p, err := bus.mem(addr, size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint32(*(*uint8)(p)), nil
+	case 2:
+		return uint32(*(*uint16)(p)), nil
+	}
+	return *(*uint32)(p), nil
+}
+
+func (bus *hostBus) Write(addr uint32, size uint8, value uint32) error {
+	p, err := bus.mem(addr, size)
+	if err != nil {
+		return err
+	}
+	switch size {
+	case 1:
+		*(*uint8)(p) = uint8(value)
+	case 2:
+		*(*uint16)(p) = uint16(value)
+	default:
+		*(*uint32)(p) = value
+	}
+	return nil
+}
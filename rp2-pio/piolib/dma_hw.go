@@ -0,0 +1,63 @@
+//go:build rp2040 || rp2350
+
+package piolib
+
+import (
+	"device/rp"
+	"runtime/interrupt"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// dmaRegister is a DMA controller register.
+type dmaRegister = volatile.Register32
+
+// CTRL_TRIG fields of the target. Several of them moved between the RP2040 and the RP2350.
+const (
+	dma_CH0_CTRL_TRIG_BSWAP_Pos          = rp.DMA_CH0_CTRL_TRIG_BSWAP_Pos
+	dma_CH0_CTRL_TRIG_BUSY               = rp.DMA_CH0_CTRL_TRIG_BUSY
+	dma_CH0_CTRL_TRIG_CHAIN_TO_Msk       = rp.DMA_CH0_CTRL_TRIG_CHAIN_TO_Msk
+	dma_CH0_CTRL_TRIG_CHAIN_TO_Pos       = rp.DMA_CH0_CTRL_TRIG_CHAIN_TO_Pos
+	dma_CH0_CTRL_TRIG_DATA_SIZE_Msk      = rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_Msk
+	dma_CH0_CTRL_TRIG_DATA_SIZE_Pos      = rp.DMA_CH0_CTRL_TRIG_DATA_SIZE_Pos
+	dma_CH0_CTRL_TRIG_EN_Msk             = rp.DMA_CH0_CTRL_TRIG_EN_Msk
+	dma_CH0_CTRL_TRIG_EN_Pos             = rp.DMA_CH0_CTRL_TRIG_EN_Pos
+	dma_CH0_CTRL_TRIG_HIGH_PRIORITY_Pos  = rp.DMA_CH0_CTRL_TRIG_HIGH_PRIORITY_Pos
+	dma_CH0_CTRL_TRIG_INCR_READ_Pos      = rp.DMA_CH0_CTRL_TRIG_INCR_READ_Pos
+	dma_CH0_CTRL_TRIG_INCR_WRITE_Pos     = rp.DMA_CH0_CTRL_TRIG_INCR_WRITE_Pos
+	dma_CH0_CTRL_TRIG_IRQ_QUIET_Pos      = rp.DMA_CH0_CTRL_TRIG_IRQ_QUIET_Pos
+	dma_CH0_CTRL_TRIG_RING_SEL_Pos       = rp.DMA_CH0_CTRL_TRIG_RING_SEL_Pos
+	dma_CH0_CTRL_TRIG_RING_SIZE_Msk      = rp.DMA_CH0_CTRL_TRIG_RING_SIZE_Msk
+	dma_CH0_CTRL_TRIG_RING_SIZE_Pos      = rp.DMA_CH0_CTRL_TRIG_RING_SIZE_Pos
+	dma_CH0_CTRL_TRIG_SNIFF_EN_Pos       = rp.DMA_CH0_CTRL_TRIG_SNIFF_EN_Pos
+	dma_CH0_CTRL_TRIG_TREQ_SEL_Msk       = rp.DMA_CH0_CTRL_TRIG_TREQ_SEL_Msk
+	dma_CH0_CTRL_TRIG_TREQ_SEL_PERMANENT = rp.DMA_CH0_CTRL_TRIG_TREQ_SEL_PERMANENT
+	dma_CH0_CTRL_TRIG_TREQ_SEL_Pos       = rp.DMA_CH0_CTRL_TRIG_TREQ_SEL_Pos
+)
+
+func dmaChannelRegs(channel uint8) *dmaChannelHW {
+	// DMA channels usable on the RP2040. 12 in total.
+	var dmaChannels = (*[12]dmaChannelHW)(unsafe.Pointer(rp.DMA))
+	return &dmaChannels[channel]
+}
+
+func dmaChanAbort() *dmaRegister { return &rp.DMA.CHAN_ABORT }
+
+// dmaAddress returns the bus address of the n bytes at p.
+func dmaAddress(p unsafe.Pointer, n uintptr) uint32 {
+	return uint32(uintptr(p))
+}
+
+type dmaClaimState = interrupt.State
+
+// lockDMAClaims disables interrupts on the calling core and takes the DMA claim lock.
+func lockDMAClaims() dmaClaimState {
+	state := interrupt.Disable()
+	acquireDMAClaimLock()
+	return state
+}
+
+func unlockDMAClaims(state dmaClaimState) {
+	releaseDMAClaimLock()
+	interrupt.Restore(state)
+}
@@ -0,0 +1,18 @@
+//go:build rp2040
+
+package piolib
+
+import "device/rp"
+
+// dmaClaimSpinlock serialises DMA channel claims between the two cores. It is spinlock 11, the
+// claim lock of the pio package and the pico-sdk; neither package holds it while calling the other.
+var dmaClaimSpinlock = &rp.SIO.SPINLOCK11
+
+func acquireDMAClaimLock() {
+	for dmaClaimSpinlock.Get() == 0 {
+	}
+}
+
+func releaseDMAClaimLock() {
+	dmaClaimSpinlock.Set(0)
+}
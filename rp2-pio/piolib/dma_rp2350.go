@@ -0,0 +1,18 @@
+//go:build rp2350
+
+package piolib
+
+import "sync/atomic"
+
+// dmaClaimLock serialises DMA channel claims between the two cores. As for the claim lock of the
+// pio package, RP2350 erratum E2 rules out the SIO spinlocks.
+var dmaClaimLock atomic.Uint32
+
+func acquireDMAClaimLock() {
+	for !dmaClaimLock.CompareAndSwap(0, 1) {
+	}
+}
+
+func releaseDMAClaimLock() {
+	dmaClaimLock.Store(0)
+}
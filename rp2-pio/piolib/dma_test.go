@@ -0,0 +1,273 @@
+//go:build !rp2040 && !rp2350
+
+package piolib
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/decode"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// cyclesPerYield is the number of system clock cycles emulated each time a driver waits.
+const cyclesPerYield = 16
+
+// dmaTest is a host PIO block whose state machine 0 runs on an emulated block, with a claimed
+// channel of a fresh emulated DMA controller transferring to and from its FIFOs.
+type dmaTest struct {
+	sm  pio.StateMachine
+	esm *emu.StateMachine
+	rec *emu.Recorder
+	ch  dmaChannel
+}
+
+// emulateDMA loads program into an emulated block as emulate does and connects it to host PIO
+// block 0 through hostDMA. Each time a driver waits the emulation advances by cyclesPerYield
+// cycles, recording its pads, and a TX stall of the emulated state machine is mirrored into the
+// FDEBUG register of the host block.
+func emulateDMA(t *testing.T, program []uint16, pinMask uint32, config func(offset uint8) pio.StateMachineConfig, stimuli ...emu.Stimulus) *dmaTest {
+	t.Helper()
+	b := emu.NewBlock(0)
+	esm, _ := emulateIn(t, b, program, pinMask, config)
+	hp := pio.NewHostPIO(0, 0)
+	hostDMA = newHostDMAController()
+	hostDMA.connectPIO(hp, b)
+	rec := emu.NewRecorder(b, testCPUFreq)
+	rec.SetStimulus(append([]emu.Stimulus{hostDMA.Stimulus()}, stimuli...)...)
+	onGosched = func() {
+		rec.Run(cyclesPerYield)
+		if esm.Stalled() && esm.IsTxFIFOEmpty() {
+			hp.HW().FDEBUG.Reg |= 1 << 24 // TXSTALL of state machine 0.
+		}
+	}
+	d := &dmaTest{sm: hp.StateMachine(0), esm: esm, rec: rec}
+	if err := d.ch.helperEnableDMA(true); err != nil {
+		t.Fatal(err)
+	}
+	d.ch.dl.setTimeout(time.Second)
+	t.Cleanup(func() {
+		onGosched = nil
+		d.ch.helperEnableDMA(false)
+	})
+	return d
+}
+
+// TestWS2812BClose loads the program of two strips as NewWS2812B does and checks that they share
+// it until both are closed, and that Close unclaims each strip's state machine once.
+func TestWS2812BClose(t *testing.T) {
+	program, err := ws2812bProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hp := pio.NewHostPIO(0, 0)
+	var strips [2]*WS2812B
+	for i := range strips {
+		h, err := hp.LoadProgramHandle(program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sm := hp.StateMachine(uint8(i))
+		sm.TryClaim()
+		strips[i] = &WS2812B{sm: sm, program: h, offset: h.Offset()}
+	}
+	h := strips[0].program
+	if strips[1].program != h || h.References() != 2 {
+		t.Fatalf("got %d references, want both strips to share one copy", h.References())
+	}
+	if err := strips[0].EnableDMA(true); err != nil {
+		t.Fatal(err)
+	}
+	ch := strips[0].dma
+
+	// A program filling instruction memory only fits once the strips' program is removed.
+	full := make([]uint16, 32)
+	strips[0].Close()
+	if h.References() != 1 || ch.IsClaimed() || strips[0].IsDMAEnabled() || hp.StateMachine(0).IsClaimed() {
+		t.Fatalf("got %d references, DMA channel claimed %t and state machine claimed %t after closing the first strip",
+			h.References(), ch.IsClaimed(), hp.StateMachine(0).IsClaimed())
+	}
+	if _, err := hp.AddProgram(full, 0); err == nil {
+		t.Fatal("expected the program to stay resident while the second strip uses it")
+	}
+	strips[1].Close()
+	hp.StateMachine(1).TryClaim() // Claimed by another driver.
+	strips[1].Close()             // Closing twice must not release the program or state machine again.
+	if h.References() != 0 || !hp.StateMachine(1).IsClaimed() {
+		t.Fatalf("got %d references after closing both strips, state machine claimed %t", h.References(), hp.StateMachine(1).IsClaimed())
+	}
+	if _, err := hp.AddProgram(full, 0); err != nil {
+		t.Errorf("expected the program slots to be free after closing both strips: %v", err)
+	}
+}
+
+func TestWS2812BWriteDMA(t *testing.T) {
+	const pin = 4
+	program, err := ws2812bProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, frac, err := pio.ClkDivFromFrequency(ws2812bFrequency, testCPUFreq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := emulateDMA(t, program.Instructions, 1<<pin, func(offset uint8) pio.StateMachineConfig {
+		return ws2812bConfig(program, offset, pin, whole, frac)
+	})
+	ws := &WS2812B{sm: d.sm, dma: d.ch}
+	grb := []uint32{0xff0000 << 8, 0x00a5c3 << 8, 0x123456 << 8, 0x0f0f0f << 8, 0x808080 << 8, 0x000001 << 8}
+	if err := ws.WriteRaw(grb); err != nil {
+		t.Fatal(err)
+	}
+	if d.ch.busy() {
+		t.Fatal("expected the DMA channel to be done after WriteRaw")
+	}
+	// The last pixels are still in the FIFO and OSR when the transfer completes.
+	if !d.rec.RunUntil(100_000, func() bool { return d.esm.Stalled() && d.esm.IsTxFIFOEmpty() }) {
+		t.Fatal("state machine did not drain the TX FIFO")
+	}
+	pixels, err := decode.WS2812(d.rec.Waveform(), decode.WS2812Config{Pin: pin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pixels) != len(grb) {
+		t.Fatalf("decoded %d pixels, want %d: %v", len(pixels), len(grb), pixels)
+	}
+	for i, p := range pixels {
+		if p.GRB != grb[i]>>8 {
+			t.Errorf("pixel %d: got GRB %#06x, want %#06x", i, p.GRB, grb[i]>>8)
+		}
+	}
+}
+
+func TestSPI3wReadDMA(t *testing.T) {
+	const dio, clk = 2, 3
+	want := []uint32{0xdeadbeef, 0x0123abcd, 0x80000001}
+	program, err := spi3wProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d *dmaTest
+	// The device shifts out the word the DMA channel is reading, most significant bit first,
+	// ahead of each IN instruction sampling it.
+	device := func(cycle uint64, pins *emu.Pins) {
+		word := len(want) - int(d.ch.HW().TRANS_COUNT.Get())
+		_, bits := d.esm.ISR()
+		pins.In &^= 1 << dio
+		if word < len(want) && bits < 32 {
+			pins.In |= want[word] >> (31 - bits) & 1 << dio
+		}
+	}
+	d = emulateDMA(t, program.Instructions, 1<<clk, func(offset uint8) pio.StateMachineConfig {
+		return spi3wConfig(program, offset, dio, clk, 1, 0)
+	}, device)
+	// Write a single bit, then read the words, as prepTx sets up.
+	d.esm.SetX(0)
+	d.esm.SetY(uint32(len(want)*32 - 1))
+	d.esm.TxPut(0)
+
+	spi := &SPI3w{sm: d.sm, dma: d.ch}
+	got := make([]uint32, len(want))
+	if err := spi.readDMA(got); err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("word %d: got %#08x, want %#08x", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHelperPushUntilStall(t *testing.T) {
+	asm, err := pio.ParseAssembly([]byte(".program bytes\n\tout pins, 8 [3]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := &asm.Programs[0]
+	d := emulateDMA(t, program.Instructions, 0xff, func(offset uint8) pio.StateMachineConfig {
+		cfg := program.DefaultStateMachineConfig(offset)
+		cfg.SetOutPins(0, 8)
+		cfg.SetOutShift(true, true, 8)
+		return cfg
+	})
+	buf := []uint8{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99}
+	if err := helperPushUntilStall(d.sm, d.ch, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !d.esm.Stalled() || !d.esm.IsTxFIFOEmpty() {
+		t.Fatal("expected helperPushUntilStall to return once the state machine stalled")
+	}
+	// Each byte is replicated across the FIFO word and shifted out from its low bits.
+	var got []uint8
+	w := d.rec.Waveform()
+	for cycle := uint64(0); cycle < w.End; cycle++ {
+		if b := uint8(w.At(cycle).Levels()); b != 0 && (len(got) == 0 || got[len(got)-1] != b) {
+			got = append(got, b)
+		}
+	}
+	if string(got) != string(buf) {
+		t.Errorf("got pin levels %#x, want %#x", got, buf)
+	}
+}
+
+func TestDMATimeoutAndAbort(t *testing.T) {
+	asm, err := pio.ParseAssembly([]byte(".program idle\n\tnop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := &asm.Programs[0]
+	d := emulateDMA(t, program.Instructions, 0, program.DefaultStateMachineConfig)
+	d.ch.dl.setTimeout(time.Millisecond)
+
+	// The state machine never pulls, so the transfer stops once the TX FIFO is full.
+	words := make([]uint32, 16)
+	err = d.ch.Push32(&d.sm.TxReg().Reg, words, dmaPIO_TxDREQ(d.sm))
+	if err != errTimeout {
+		t.Fatalf("got error %v, want %v", err, errTimeout)
+	}
+	if d.ch.busy() {
+		t.Error("expected the channel to be aborted after the timeout")
+	}
+	if left := d.ch.HW().TRANS_COUNT.Get(); left != uint32(len(words)-4) {
+		t.Errorf("got %d transfers left, want %d with the 4 word FIFO full", left, len(words)-4)
+	}
+
+	// A channel left waiting on a DREQ nothing asserts holds off the next transfer.
+	cc := dmaDefaultConfig(d.ch.ChannelIndex())
+	cc.setTREQ_SEL(_DREQ_ADC)
+	cc.setEnable(true)
+	d.ch.HW().TRANS_COUNT.Set(1)
+	d.ch.Init(cc)
+	err = d.ch.Pull32(words, &d.sm.RxReg().Reg, dmaPIO_RxDREQ(d.sm))
+	if err != errContentionTimeout {
+		t.Fatalf("got error %v, want %v", err, errContentionTimeout)
+	}
+	d.ch.abort()
+	if d.ch.busy() {
+		t.Error("expected abort to stop the channel")
+	}
+}
+
+func TestDMAConcurrentClaims(t *testing.T) {
+	var wg sync.WaitGroup
+	var claims [12]atomic.Int32
+	for i := 0; i < 36; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ch, ok := _DMA.ClaimChannel(); ok {
+				claims[ch.ChannelIndex()].Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range claims {
+		if n := claims[i].Load(); n != 1 {
+			t.Errorf("channel %d claimed %d times, want once", i, n)
+		}
+		_DMA.Channel(uint8(i)).Unclaim()
+	}
+}
@@ -0,0 +1,54 @@
+package piolib
+
+import (
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+// testCPUFreq is the system clock the drivers' programs are emulated at.
+const testCPUFreq = 125_000_000
+
+// emulate loads program into a new emulated PIO block the way the drivers do, initializes state
+// machine 0 with the configuration returned by config for the offset it was loaded at, sets the
+// pins in pinMask as outputs and enables the state machine.
+func emulate(t *testing.T, program []uint16, pinMask uint32, config func(offset uint8) pio.StateMachineConfig) (sm *emu.StateMachine, offset uint8) {
+	t.Helper()
+	return emulateIn(t, emu.NewBlock(0), program, pinMask, config)
+}
+
+// emulateIn is emulate on state machine 0 of block b.
+func emulateIn(t *testing.T, b *emu.Block, program []uint16, pinMask uint32, config func(offset uint8) pio.StateMachineConfig) (sm *emu.StateMachine, offset uint8) {
+	t.Helper()
+	offset, err := b.AddProgram(program, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm = b.StateMachine(0)
+	sm.Start(offset, config(offset), pinMask)
+	return sm, offset
+}
+
+// latched returns the pad levels seen by a receiver latching on the rising or falling edges of
+// clk, that is the levels just before each edge.
+func latched(w *emu.Waveform, clk uint8, rising bool) []uint32 {
+	var levels []uint32
+	edges := w.Edges(clk)
+	for _, e := range edges[1:] { // The first edge is the initial level.
+		if e.Level == rising {
+			levels = append(levels, w.At(e.Cycle-1).Levels())
+		}
+	}
+	return levels
+}
+
+// word packs the level of pin in each of levels into a word, the first level being the most
+// significant bit.
+func word(levels []uint32, pin uint8) uint32 {
+	var w uint32
+	for _, l := range levels {
+		w = w<<1 | l>>pin&1
+	}
+	return w
+}
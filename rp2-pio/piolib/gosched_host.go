@@ -0,0 +1,17 @@
+//go:build !rp2040 && !rp2350
+
+package piolib
+
+import "runtime"
+
+// onGosched, if set, runs each time a wait loop yields. Off-target tests use it to advance the
+// emulated DMA controller and PIO blocks the drivers wait on.
+var onGosched func()
+
+// gosched yields in wait loops, running onGosched first.
+func gosched() {
+	if onGosched != nil {
+		onGosched()
+	}
+	runtime.Gosched()
+}
@@ -0,0 +1,10 @@
+//go:build rp2040 || rp2350
+
+package piolib
+
+import "runtime"
+
+// gosched yields in wait loops.
+func gosched() {
+	runtime.Gosched()
+}
@@ -0,0 +1,52 @@
+package piolib
+
+import pio "github.com/tinygo-org/pio/rp2-pio"
+
+// i2sEntryPoint is the instruction of the I2S program the state machine starts at.
+const i2sEntryPoint = 7
+
+// i2sProgram returns the I2S output program.
+func i2sProgram() []uint16 {
+	// Program positions.
+	const (
+		bitloop1 = 0
+		bitloop0 = 4
+	)
+	// Sideset pin mapping: bit0=BCLK (bit clock), bit1=LRCLK (left/right channel select)
+	// LRCLK=1 for left channel, LRCLK=0 for right channel (I2S standard)
+	// Each loop outputs 16 bits per channel (1 initial + 15 in loop), 32 bits total per stereo sample
+	asm := pio.AssemblerV0{SidesetBits: 2}
+	return []uint16{
+		//     .wrap_target
+		bitloop1:// Left channel (LRCLK=1): output 16 bits with BCLK toggling
+		asm.Out(pio.OutDestPins, 1).Side(0b10).Encode(), // 0: out  pins, 1  BCLK=0, LRCLK=1
+		asm.Jmp(pio.JmpXNZeroDec, bitloop1).Side(0b11).Encode(), // 1: jmp  x--, 0   BCLK=1, LRCLK=1
+		asm.Out(pio.OutDestPins, 1).Side(0b00).Encode(),         // 2: out  pins, 1  BCLK=0, LRCLK=0 (transition to right)
+		asm.Set(pio.SetDestX, 14).Side(0b01).Encode(),           // 3: set  x, 14    BCLK=1, LRCLK=0
+
+		bitloop0:// Right channel (LRCLK=0): output 16 bits with BCLK toggling
+		asm.Out(pio.OutDestPins, 1).Side(0b00).Encode(), // 4: out  pins, 1  BCLK=0, LRCLK=0
+		asm.Jmp(pio.JmpXNZeroDec, bitloop0).Side(0b01).Encode(), // 5: jmp  x--, 4   BCLK=1, LRCLK=0
+		asm.Out(pio.OutDestPins, 1).Side(0b10).Encode(),         // 6: out  pins, 1  BCLK=0, LRCLK=1 (transition to left)
+		asm.Set(pio.SetDestX, 14).Side(0b11).Encode(),           // 7: set  x, 14    BCLK=1, LRCLK=1
+		//     .wrap
+	}
+}
+
+// i2sClkDiv returns the clock divider for a stereo sample rate of sampleFreq: each of the 32 bits
+// of a stereo sample takes two state machine cycles, one per BCLK phase.
+func i2sClkDiv(sampleFreq, cpuFreq uint32) (whole uint16, frac uint8, err error) {
+	return pio.ClkDivFromFrequency(sampleFreq*64, cpuFreq)
+}
+
+// i2sConfig returns the configuration of the I2S program loaded at offset, with BCLK on
+// clockAndNext and LRCLK on the pin after it.
+func i2sConfig(program []uint16, offset uint8, data, clockAndNext pio.Pin) pio.StateMachineConfig {
+	asm := pio.AssemblerV0{SidesetBits: 2}
+	cfg := asm.DefaultStateMachineConfig(offset, program)
+	// https://github.com/raspberrypi/pico-extras/blob/09c64d509f1d7a49ceabde699ed6c74c77e195a1/src/rp2_common/pico_audio_i2s/audio_i2s.pio#L48C4-L60C81
+	cfg.SetOutPins(data, 1)
+	cfg.SetSidesetPins(clockAndNext)
+	cfg.SetOutShift(false, true, 32)
+	return cfg
+}
@@ -0,0 +1,69 @@
+package piolib
+
+import (
+	"testing"
+	"time"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+func TestI2SWaveform(t *testing.T) {
+	const data, bclk, lrclk = 5, 6, 7
+	const sampleFreq = 48_000
+	program := i2sProgram()
+	whole, frac, err := i2sClkDiv(sampleFreq, testCPUFreq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, offset := emulate(t, program, 1<<data|0b11<<bclk, func(offset uint8) pio.StateMachineConfig {
+		cfg := i2sConfig(program, offset, data, bclk)
+		cfg.SetClkDivIntFrac(whole, frac)
+		return cfg
+	})
+	sm.Exec(pio.AssemblerV0{}.Jmp(pio.JmpAlways, offset+i2sEntryPoint).Encode()) // As sm.Jmp does.
+	samples := []uint32{0xabcd_1234, 0x8001_7ffe}
+	for _, s := range samples {
+		sm.TxPut(s)
+	}
+	rec := emu.NewRecorder(sm, testCPUFreq)
+	rec.Run((len(samples)*64 + 2) * (int(whole) + 1))
+	w := rec.Waveform()
+
+	bits := latched(w, bclk, true)[1:] // The first BCLK pulse is the entry point, before any data.
+	if len(bits) < 32*len(samples) {
+		t.Fatalf("got %d BCLK pulses, want at least %d", len(bits), 32*len(samples))
+	}
+	for i, s := range samples {
+		frame := bits[32*i : 32*i+32]
+		if got := word(frame, data); got != s {
+			t.Errorf("sample %d: got %#08x, want %#08x", i, got, s)
+		}
+		// LRCLK changes one BCLK before the MSB of each channel.
+		for j, l := range frame {
+			want := uint32(0)
+			if j < 15 || j == 31 {
+				want = 1
+			}
+			if got := l >> lrclk & 1; got != want {
+				t.Errorf("sample %d bit %d: LRCLK is %d, want %d", i, j, got, want)
+			}
+		}
+	}
+
+	// Each LRCLK period is one stereo sample. The first rising edge is the entry point.
+	lr := w.Edges(lrclk)
+	var rises []emu.Edge
+	for _, e := range lr[1:] {
+		if e.Level {
+			rises = append(rises, e)
+		}
+	}
+	if len(rises) < 3 {
+		t.Fatalf("got LRCLK edges %v, want at least 3 rising edges", lr)
+	}
+	period := w.Time(rises[2].Cycle) - w.Time(rises[1].Cycle)
+	if want := time.Second / sampleFreq; period < want-want/100 || period > want+want/100 {
+		t.Errorf("got LRCLK period %v, want %v for %d Hz", period, want, sampleFreq)
+	}
+}
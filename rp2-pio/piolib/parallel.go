@@ -1,3 +1,5 @@
+//go:build rp2040 || rp2350
+
 package piolib
 
 import (
@@ -11,6 +13,7 @@ import (
 // Parallel implements a parallel bus of arbitrary number of data lines (up to 32).
 type Parallel struct {
 	sm      pio.StateMachine
+	program *pio.ProgramHandle
 	progOff uint8
 	dma     dmaChannel
 }
@@ -32,16 +35,8 @@ type ParallelConfig struct {
 }
 
 func NewParallel(sm pio.StateMachine, cfg ParallelConfig) (*Parallel, error) {
-	const sideSetBitCount = 1
 	const programOrigin = -1
-	asm := pio.AssemblerV0{
-		SidesetBits: sideSetBitCount,
-	}
-	var program = [3]uint16{
-		asm.Out(pio.OutDestPins, cfg.BusWidth).Side(0).Encode(), //  0: out    pins, <npins>   side 0
-		asm.Nop().Side(1).Encode(),                              //  1: nop                    side 1
-		asm.Nop().Side(0).Encode(),                              //  2: nop                    side 0
-	}
+	program := parallelProgram(cfg.BusWidth)
 	maxBaud := math.MaxUint32 / uint32(len(program))
 	if cfg.Baud > maxBaud {
 		return nil, errors.New("max baud for parallel exceeded")
@@ -60,10 +55,11 @@ func NewParallel(sm pio.StateMachine, cfg ParallelConfig) (*Parallel, error) {
 
 	sm.TryClaim()
 	Pio := sm.PIO()
-	progOffset, err := Pio.AddProgram(program[:], programOrigin)
+	handle, err := Pio.AddProgramHandle(program, programOrigin)
 	if err != nil {
 		return nil, err
 	}
+	progOffset := handle.Offset()
 
 	clkMask := uint32(1) << cfg.Clock
 	pinMask := clkMask
@@ -75,14 +71,7 @@ func NewParallel(sm pio.StateMachine, cfg ParallelConfig) (*Parallel, error) {
 	}
 	cfg.Clock.Configure(pinCfg)
 
-	scfg := asm.DefaultStateMachineConfig(progOffset, program[:])
-
-	scfg.SetOutPins(cfg.DataBase, cfg.BusWidth)
-	scfg.SetOutShift(true, true, uint16(cfg.BitsPerPull))
-	scfg.SetSidesetPins(cfg.Clock)
-
-	scfg.SetClkDivIntFrac(whole, frac)
-	scfg.SetFIFOJoin(pio.FifoJoinTx)
+	scfg := parallelConfig(program, progOffset, cfg.Clock, cfg.DataBase, cfg.BusWidth, cfg.BitsPerPull, whole, frac)
 
 	sm.SetPinsMasked(0, pinMask)
 	sm.SetPindirsMasked(pinMask, pinMask)
@@ -90,10 +79,25 @@ func NewParallel(sm pio.StateMachine, cfg ParallelConfig) (*Parallel, error) {
 	sm.SetEnabled(true)
 	return &Parallel{
 		sm:      sm,
+		program: handle,
 		progOff: progOffset,
 	}, nil
 }
 
+// Close stops the bus and hands back everything NewParallel and [Parallel.EnableDMA] took:
+// the DMA channel, the state machine claim and the program, which is only removed once no other
+// bus of the same width shares it. Closing a closed Parallel has no effect.
+func (p6 *Parallel) Close() {
+	if p6.program == nil {
+		return
+	}
+	p6.sm.SetEnabled(false)
+	p6.dma.helperEnableDMA(false)
+	p6.program.Release()
+	p6.program = nil
+	p6.sm.Unclaim()
+}
+
 // IsEnabled returns true if the state machine on the Parallel6 is enabled and ready to transmit.
 func (p6 *Parallel) IsEnabled() bool {
 	return p6.sm.IsEnabled()
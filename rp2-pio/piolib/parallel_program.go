@@ -0,0 +1,31 @@
+package piolib
+
+import pio "github.com/tinygo-org/pio/rp2-pio"
+
+// parallelProgram returns the parallel bus program writing busWidth bits per clock pulse.
+// It takes 3 instructions per bus transfer.
+func parallelProgram(busWidth uint8) []uint16 {
+	const sideSetBitCount = 1
+	asm := pio.AssemblerV0{
+		SidesetBits: sideSetBitCount,
+	}
+	return []uint16{
+		asm.Out(pio.OutDestPins, busWidth).Side(0).Encode(), //  0: out    pins, <npins>   side 0
+		asm.Nop().Side(1).Encode(),                          //  1: nop                    side 1
+		asm.Nop().Side(0).Encode(),                          //  2: nop                    side 0
+	}
+}
+
+// parallelConfig returns the configuration of the parallel bus program loaded at offset.
+func parallelConfig(program []uint16, offset uint8, clock, dataBase pio.Pin, busWidth, bitsPerPull uint8, whole uint16, frac uint8) pio.StateMachineConfig {
+	asm := pio.AssemblerV0{SidesetBits: 1}
+	scfg := asm.DefaultStateMachineConfig(offset, program)
+
+	scfg.SetOutPins(dataBase, busWidth)
+	scfg.SetOutShift(true, true, uint16(bitsPerPull))
+	scfg.SetSidesetPins(clock)
+
+	scfg.SetClkDivIntFrac(whole, frac)
+	scfg.SetFIFOJoin(pio.FifoJoinTx)
+	return scfg
+}
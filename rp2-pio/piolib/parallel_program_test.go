@@ -0,0 +1,43 @@
+package piolib
+
+import (
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+func TestParallelWaveform(t *testing.T) {
+	const dataBase, clock = 0, 8
+	for _, tc := range []struct {
+		busWidth, bitsPerPull uint8
+		tx                    []uint32
+		want                  []uint32
+	}{
+		{busWidth: 8, bitsPerPull: 16, tx: []uint32{0xbeef, 0xcafe}, want: []uint32{0xef, 0xbe, 0xfe, 0xca}},
+		{busWidth: 4, bitsPerPull: 8, tx: []uint32{0x5a}, want: []uint32{0xa, 0x5}},
+	} {
+		program := parallelProgram(tc.busWidth)
+		dataMask := uint32(1)<<tc.busWidth - 1<<dataBase
+		sm, _ := emulate(t, program, dataMask|1<<clock, func(offset uint8) pio.StateMachineConfig {
+			return parallelConfig(program, offset, clock, dataBase, tc.busWidth, tc.bitsPerPull, 1, 0)
+		})
+		for _, v := range tc.tx {
+			sm.TxPut(v)
+		}
+		rec := emu.NewRecorder(sm, testCPUFreq)
+		rec.Run(3*len(tc.want) + 6)
+		w := rec.Waveform()
+
+		levels := latched(w, clock, true)
+		if len(levels) != len(tc.want) {
+			t.Errorf("%d bit bus: got %d clock pulses, want %d", tc.busWidth, len(levels), len(tc.want))
+			continue
+		}
+		for i, l := range levels {
+			if got := l & dataMask >> dataBase; got != tc.want[i] {
+				t.Errorf("%d bit bus: transfer %d latched %#x, want %#x", tc.busWidth, i, got, tc.want[i])
+			}
+		}
+	}
+}
@@ -15,6 +15,7 @@ var errQueueFull = errors.New("Pulsar:queue full")
 // Pulsar implements a square-wave generator that pulses a determined amount of pulses.
 type Pulsar struct {
 	sm            pio.StateMachine
+	program       *pio.ProgramHandle
 	offsetPlusOne uint8
 }
 
@@ -23,35 +24,30 @@ func NewPulsar(sm pio.StateMachine, pin machine.Pin) (*Pulsar, error) {
 	sm.TryClaim() // SM should be claimed beforehand, we just guarantee it's claimed.
 	Pio := sm.PIO()
 
-	// Program positions.
-	const (
-		origin = -1
-		loop   = 3
-	)
-	asm := pio.AssemblerV0{SidesetBits: 0}
-	var program = [...]uint16{
-		//     .wrap_target
-		asm.Set(pio.SetDestPindirs, 1).Encode(),       // 0: set    pindirs, 1
-		asm.Pull(false, true).Encode(),                // 1: pull   block
-		asm.Mov(pio.MovDestX, pio.MovSrcOSR).Encode(), // 2: mov    x, osr
-		loop:// loop
-		asm.Set(pio.SetDestPins, 1).Delay(1).Encode(), // 3: set    pins, 1    [1]
-		asm.Set(pio.SetDestPins, 0).Encode(),          // 4: set    pins, 0
-		asm.Jmp(pio.JmpXNZeroDec, 3).Encode(),         // 5: jmp    x--, 3
-		//     .wrap
-	}
+	const origin = -1
+	program := pulsarProgram()
 
-	offset, err := Pio.AddProgram(program[:], origin)
+	handle, err := Pio.AddProgramHandle(program, origin)
 	if err != nil {
 		return nil, err
 	}
+	offset := handle.Offset()
 	pin.Configure(machine.PinConfig{Mode: Pio.PinMode()})
 	sm.SetPindirsConsecutive(pin, 1, true)
-	cfg := asm.DefaultStateMachineConfig(offset, program[:])
-	cfg.SetSetPins(pin, 1)
+	cfg := pulsarConfig(program, offset, pin)
 	sm.Init(offset, cfg)
 	sm.SetEnabled(true)
-	return &Pulsar{sm: sm, offsetPlusOne: offset + 1}, nil
+	return &Pulsar{sm: sm, program: handle, offsetPlusOne: offset + 1}, nil
+}
+
+// Close stops pulsing, dropping queued pulses, and gives the state machine and the program
+// back to the PIO block. Like every other method, Close panics on a closed Pulsar.
+func (p *Pulsar) Close() {
+	p.mustValid()
+	p.sm.SetEnabled(false)
+	p.program.Release()
+	p.sm.Unclaim()
+	*p = Pulsar{}
 }
 
 // IsQueueFull checks if the pulsar's queue is full.
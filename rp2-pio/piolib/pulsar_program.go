@@ -0,0 +1,32 @@
+package piolib
+
+import pio "github.com/tinygo-org/pio/rp2-pio"
+
+// pulsarProgram returns the Pulsar program. Each word pulled from the TX FIFO emits that many
+// pulses plus one, each 4 state machine cycles long.
+func pulsarProgram() []uint16 {
+	// Program positions.
+	const (
+		loop = 3
+	)
+	asm := pio.AssemblerV0{SidesetBits: 0}
+	return []uint16{
+		//     .wrap_target
+		asm.Set(pio.SetDestPindirs, 1).Encode(),       // 0: set    pindirs, 1
+		asm.Pull(false, true).Encode(),                // 1: pull   block
+		asm.Mov(pio.MovDestX, pio.MovSrcOSR).Encode(), // 2: mov    x, osr
+		loop:// loop
+		asm.Set(pio.SetDestPins, 1).Delay(1).Encode(), // 3: set    pins, 1    [1]
+		asm.Set(pio.SetDestPins, 0).Encode(),          // 4: set    pins, 0
+		asm.Jmp(pio.JmpXNZeroDec, 3).Encode(),         // 5: jmp    x--, 3
+		//     .wrap
+	}
+}
+
+// pulsarConfig returns the configuration of the Pulsar program loaded at offset driving pin.
+func pulsarConfig(program []uint16, offset uint8, pin pio.Pin) pio.StateMachineConfig {
+	asm := pio.AssemblerV0{SidesetBits: 0}
+	cfg := asm.DefaultStateMachineConfig(offset, program)
+	cfg.SetSetPins(pin, 1)
+	return cfg
+}
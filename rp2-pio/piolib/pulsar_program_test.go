@@ -0,0 +1,42 @@
+package piolib
+
+import (
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+func TestPulsarWaveform(t *testing.T) {
+	const pin = 9
+	program := pulsarProgram()
+	for _, pulses := range []uint32{1, 2, 17} {
+		// The program sets its own pin direction.
+		sm, _ := emulate(t, program, 0, func(offset uint8) pio.StateMachineConfig {
+			return pulsarConfig(program, offset, pin)
+		})
+		sm.TxPut(pulses - 1) // As Pulsar.TryQueue does.
+		rec := emu.NewRecorder(sm, testCPUFreq)
+		rec.Run(4*int(pulses) + 16)
+		w := rec.Waveform()
+
+		edges := w.Edges(pin)[1:]
+		if got := uint32(len(edges)) / 2; got != pulses || len(edges)%2 != 0 {
+			t.Errorf("queued %d: got %d pulses, edges %v", pulses, got, edges)
+			continue
+		}
+		for i := 0; i+1 < len(edges); i += 2 {
+			if high := edges[i+1].Cycle - edges[i].Cycle; high != 2 {
+				t.Errorf("queued %d: pulse %d high for %d cycles, want 2", pulses, i/2, high)
+			}
+			if i+2 < len(edges) {
+				if period := edges[i+2].Cycle - edges[i].Cycle; period != 4 {
+					t.Errorf("queued %d: pulse %d period of %d cycles, want 4", pulses, i/2, period)
+				}
+			}
+		}
+		if !sm.Stalled() {
+			t.Errorf("queued %d: expected state machine to wait for the next count", pulses)
+		}
+	}
+}
@@ -11,13 +11,13 @@ import (
 
 type SPI struct {
 	sm         pio.StateMachine
+	program    *pio.ProgramHandle
 	progOffset uint8
 	mode       uint8
 }
 
 func NewSPI(sm pio.StateMachine, spicfg machine.SPIConfig) (*SPI, error) {
 	sm.TryClaim() // SM should be claimed beforehand, we just guarantee it's claimed.
-	const nbits = 8
 	// https://github.com/raspberrypi/pico-examples/blob/eca13acf57916a0bd5961028314006983894fc84/pio/spi/spi.pio#L46
 	if !sm.IsValid() {
 		return nil, errors.New("invalid state machine")
@@ -30,50 +30,18 @@ func NewSPI(sm pio.StateMachine, spicfg machine.SPIConfig) (*SPI, error) {
 	Pio := sm.PIO()
 
 	const origin int8 = -1
-	asm := pio.AssemblerV0{SidesetBits: 1}
-	// spi_cpha0: out pins, 1 side 0 [1]; in pins, 1 side 1 [1]
-	var cpha0Program = [...]uint16{
-		asm.Out(pio.OutDestPins, 1).Side(0).Delay(1).Encode(), // 0: out  pins, 1   side 0 [1]
-		asm.In(pio.InSrcPins, 1).Side(1).Delay(1).Encode(),    // 1: in   pins, 1   side 1 [1]
-	}
-	// spi_cpha1: out x, 1 side 0; mov pins, x side 1 [1]; in pins, 1 side 0
-	var cpha1Program = [...]uint16{
-		asm.Out(pio.OutDestX, 1).Side(0).Encode(),                       // 0: out    x, 1     side 0
-		asm.Mov(pio.MovDestPins, pio.MovSrcX).Side(1).Delay(1).Encode(), // 1: mov    pins, x  side 1 [1]
-		asm.In(pio.InSrcPins, 1).Side(0).Encode(),                       // 2: in     pins, 1  side 0
-	}
-
-	var program []uint16
-	switch spicfg.Mode {
-	case 0b00:
-		program = cpha0Program[:]
-	case 0b01:
-		// The pin muxes can be configured to invert the output (among other things
-		// and this is a cheesy way to get CPOL=1
-		// rp.IO_BANK0.GPIO0_CTRL.ReplaceBits(value, ) TODO: https://github.com/raspberrypi/pico-sdk/blob/6a7db34ff63345a7badec79ebea3aaef1712f374/src/rp2_common/hardware_gpio/gpio.c#L80
-		// SPI is synchronous, so bypass input synchroniser to reduce input delay.
-		program = cpha1Program[:]
-	case 0b10, 0b11:
-		return nil, errors.New("unsupported mode")
-	default:
-		panic("invalid mode")
+	program, err := spiProgram(spicfg.Mode)
+	if err != nil {
+		return nil, err
 	}
 
-	offset, err := Pio.AddProgram(program, origin)
+	handle, err := Pio.AddProgramHandle(program, origin)
 	if err != nil {
 		return nil, err
 	}
+	offset := handle.Offset()
 
-	cfg := asm.DefaultStateMachineConfig(offset, program)
-
-	cfg.SetOutPins(spicfg.SDO, 1)
-	cfg.SetInPins(spicfg.SDI, 1)
-	cfg.SetSidesetPins(spicfg.SCK)
-
-	cfg.SetOutShift(false, true, uint16(nbits))
-	cfg.SetInShift(false, true, uint16(nbits))
-
-	cfg.SetClkDivIntFrac(whole, frac)
+	cfg := spiConfig(program, offset, spicfg.SCK, spicfg.SDO, spicfg.SDI, whole, frac)
 
 	// MOSI, SCK output are low, MISO is input.
 	outMask := uint32((1 << spicfg.SCK) | (1 << spicfg.SDO))
@@ -90,10 +58,23 @@ func NewSPI(sm pio.StateMachine, spicfg machine.SPIConfig) (*SPI, error) {
 	sm.Init(offset, cfg)
 	sm.SetEnabled(true)
 
-	spi := &SPI{sm: sm, progOffset: offset, mode: spicfg.Mode}
+	spi := &SPI{sm: sm, program: handle, progOffset: offset, mode: spicfg.Mode}
 	return spi, nil
 }
 
+// Close stops driving SCK, unclaims the state machine and releases the program of the SPI mode
+// in use, shared with other SPI buses of the same mode on the block. The pins keep their PIO
+// function until reconfigured. Closing a closed SPI has no effect.
+func (spi *SPI) Close() {
+	if spi.program == nil {
+		return
+	}
+	spi.sm.SetEnabled(false)
+	spi.program.Release()
+	spi.program = nil
+	spi.sm.Unclaim()
+}
+
 func (spi *SPI) Tx(w, r []byte) error {
 	rxRemain, txRemain := len(r), len(w)
 	if rxRemain != txRemain {
@@ -103,7 +84,7 @@ func (spi *SPI) Tx(w, r []byte) error {
 	for rxRemain != 0 || txRemain != 0 {
 		stall := true
 		if txRemain != 0 && !spi.sm.IsTxFIFOFull() {
-			spi.sm.TxPut(uint32(w[len(w)-txRemain]))
+			spi.sm.TxPut(spiFrame(w[len(w)-txRemain]))
 			txRemain--
 			stall = false
 		}
@@ -129,7 +110,7 @@ func (spi *SPI) Transfer(c byte) (rx byte, _ error) {
 	retries := int8(16)
 	for waitTx || waitRx {
 		if waitTx && !spi.sm.IsTxFIFOFull() {
-			spi.sm.TxPut(uint32(c))
+			spi.sm.TxPut(spiFrame(c))
 			waitTx = false
 		}
 		if waitRx && !spi.sm.IsRxFIFOEmpty() {
@@ -1,11 +1,6 @@
-//go:build rp2040 || rp2350
-
 package piolib
 
 import (
-	"device/rp"
-	"machine"
-	"runtime/volatile"
 	"time"
 	"unsafe"
 
@@ -15,9 +10,10 @@ import (
 // SPI3 is a 3-wire SPI implementation for specialized use cases, such as
 // the Pico W's on-board CYW43439 WiFi module. It uses a shared data input/output pin.
 type SPI3w struct {
-	sm     pio.StateMachine
-	dma    dmaChannel
-	offset uint8
+	sm      pio.StateMachine
+	dma     dmaChannel
+	program *pio.ProgramHandle
+	offset  uint8
 
 	statusEn          bool
 	programWrapTarget uint8
@@ -25,98 +21,18 @@ type SPI3w struct {
 	pinMask           uint32
 }
 
-func NewSPI3w(sm pio.StateMachine, dio, clk machine.Pin, baud uint32) (*SPI3w, error) {
-	baud *= 2 // We have 2 instructions per bit in the hot loop.
-	whole, frac, err := pio.ClkDivFromFrequency(baud, machine.CPUFrequency())
-	if err != nil {
-		return nil, err // Early return on bad clock.
-	}
-
-	// https://github.com/embassy-rs/embassy/blob/c4a8b79dbc927e46fcc71879673ad3410aa3174b/cyw43-pio/src/lib.rs#L90
-	sm.TryClaim() // SM should be claimed beforehand, we just guarantee it's claimed.
-	Pio := sm.PIO()
-	assm := pio.AssemblerV0{
-		SidesetBits: 1,
-	}
-	// Program positions.
-	const (
-		origin   = -1
-		wloopOff = 0
-		rloopOff = 5
-		endOff   = 7
-	)
-	var program = [...]uint16{
-		//     .wrap_target
-		// write out x-1 bits.
-		wloopOff:// Write/Output loop.
-		assm.Out(pio.OutDestPins, 1).Side(0).Encode(), //  0: out    pins, 1         side 0
-		assm.Jmp(pio.JmpXNZeroDec, wloopOff).Side(1).Encode(), //  1: jmp    x--, 0          side 1
-		assm.Jmp(pio.JmpYZero, endOff).Side(0).Encode(),       //  2: jmp    !y, 7           side 0
-		assm.Set(pio.SetDestPindirs, 0).Side(0).Encode(),      //  3: set    pindirs, 0      side 0
-		assm.Nop().Side(0).Encode(),                           //  4: nop                    side 0
-		// read in y-1 bits.
-		rloopOff:// Read/input loop
-		assm.In(pio.InSrcPins, 1).Side(1).Encode(), // 5: in     pins, 1         side 1
-		assm.Jmp(pio.JmpYNZeroDec, rloopOff).Side(0).Encode(), //  6: jmp    y--, 5          side 0
-		// Wait for SPI packet on IRQ.
-		endOff:// Wait on input pin.
-		assm.WaitPin(true, 0).Side(0).Encode(), //  7: wait   1 pin, 0        side 0
-		assm.IRQSet(false, 0).Side(0).Encode(), //  8: irq    nowait 0        side 0
+// Close ends use of the 3-wire bus: the state machine is stopped and unclaimed, a DMA channel
+// claimed by [SPI3w.EnableDMA] is freed and the program is released. A transfer in progress is
+// cut short. Closing a closed SPI3w has no effect.
+func (spi *SPI3w) Close() {
+	if spi.program == nil {
+		return
 	}
-	const a = len(program) - 1
-
-	offset, err := Pio.AddProgram(program[:], origin)
-	if err != nil {
-		return nil, err
-	}
-	cfg := assm.DefaultStateMachineConfig(offset, program[:])
-	// Configure state machine.
-	cfg.SetOutPins(dio, 1)
-	cfg.SetSetPins(dio, 1)
-	cfg.SetInPins(dio, 1)
-	cfg.SetSidesetPins(clk)
-	cfg.SetOutShift(false, true, 32)
-	cfg.SetInShift(false, true, 32)
-	cfg.SetClkDivIntFrac(whole, frac)
-
-	// Configure pins
-	pinCfg := machine.PinConfig{Mode: Pio.PinMode()}
-	dio.Configure(pinCfg)
-	clk.Configure(pinCfg)
-	Pio.SetInputSyncBypassMasked(1<<dio, 1<<dio)
-
-	dioPad := pinPadCtrl(dio)
-	// Disable pull up and pull down.
-	dioPad.ReplaceBits(0, 1, rp.PADS_BANK0_GPIO0_PUE_Pos)
-	dioPad.ReplaceBits(0, 1, rp.PADS_BANK0_GPIO0_PDE_Pos)
-
-	dioPad.ReplaceBits(1, 1, rp.PADS_BANK0_GPIO0_SCHMITT_Pos) // Enable Schmitt trigger.
-
-	// 12mA drive strength for both clock and output.
-	const drive = rp.PADS_BANK0_GPIO0_DRIVE_12mA
-	const driveMsk = rp.PADS_BANK0_GPIO0_DRIVE_Msk >> rp.PADS_BANK0_GPIO0_DRIVE_Pos
-	dioPad.ReplaceBits(drive, driveMsk, rp.PADS_BANK0_GPIO0_DRIVE_Pos)
-
-	dioPad.ReplaceBits(1, 1, rp.PADS_BANK0_GPIO0_SLEWFAST_Pos) // Enable fast slewrate.
-
-	clkPad := pinPadCtrl(clk)
-	clkPad.ReplaceBits(drive, driveMsk, rp.PADS_BANK0_GPIO0_DRIVE_Pos)
-	clkPad.ReplaceBits(1, 1, rp.PADS_BANK0_GPIO0_SLEWFAST_Pos) // Enable fast slewrate.
-
-	// Initialize state machine.
-	sm.Init(offset, cfg)
-	pinMask := uint32(1<<dio | 1<<clk)
-	sm.SetPindirsMasked(pinMask, pinMask)
-	sm.SetPinsMasked(0, pinMask)
-
-	spiw := &SPI3w{
-		sm:      sm,
-		offset:  offset,
-		pinMask: pinMask,
-
-		programWrapTarget: wloopOff,
-	}
-	return spiw, nil
+	spi.sm.SetEnabled(false)
+	spi.dma.helperEnableDMA(false)
+	spi.program.Release()
+	spi.program = nil
+	spi.sm.Unclaim()
 }
 
 // Tx32 first writes the data in w to the bus and waits until the data is fully sent
@@ -322,7 +238,3 @@ func (spi *SPI3w) writeDMA(w []uint32) error {
 func (spi *SPI3w) IsDMAEnabled() bool {
 	return spi.dma.helperIsEnabled()
 }
-
-func pinPadCtrl(pin machine.Pin) *volatile.Register32 {
-	return (*volatile.Register32)(unsafe.Pointer(uintptr(unsafe.Pointer(&rp.PADS_BANK0.GPIO0)) + uintptr(4*pin)))
-}
@@ -0,0 +1,78 @@
+//go:build rp2040 || rp2350
+
+package piolib
+
+import (
+	"device/rp"
+	"machine"
+	"runtime/volatile"
+	"unsafe"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+func NewSPI3w(sm pio.StateMachine, dio, clk machine.Pin, baud uint32) (*SPI3w, error) {
+	baud *= 2 // We have 2 instructions per bit in the hot loop.
+	whole, frac, err := pio.ClkDivFromFrequency(baud, machine.CPUFrequency())
+	if err != nil {
+		return nil, err // Early return on bad clock.
+	}
+
+	sm.TryClaim() // SM should be claimed beforehand, we just guarantee it's claimed.
+	Pio := sm.PIO()
+	program, err := spi3wProgram()
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := Pio.LoadProgramHandle(program)
+	if err != nil {
+		return nil, err
+	}
+	offset := handle.Offset()
+	cfg := spi3wConfig(program, offset, dio, clk, whole, frac)
+
+	// Configure pins
+	pinCfg := machine.PinConfig{Mode: Pio.PinMode()}
+	dio.Configure(pinCfg)
+	clk.Configure(pinCfg)
+	Pio.SetInputSyncBypassMasked(1<<dio, 1<<dio)
+
+	dioPad := pinPadCtrl(dio)
+	// Disable pull up and pull down.
+	dioPad.ReplaceBits(0, 1, rp.PADS_BANK0_GPIO0_PUE_Pos)
+	dioPad.ReplaceBits(0, 1, rp.PADS_BANK0_GPIO0_PDE_Pos)
+
+	dioPad.ReplaceBits(1, 1, rp.PADS_BANK0_GPIO0_SCHMITT_Pos) // Enable Schmitt trigger.
+
+	// 12mA drive strength for both clock and output.
+	const drive = rp.PADS_BANK0_GPIO0_DRIVE_12mA
+	const driveMsk = rp.PADS_BANK0_GPIO0_DRIVE_Msk >> rp.PADS_BANK0_GPIO0_DRIVE_Pos
+	dioPad.ReplaceBits(drive, driveMsk, rp.PADS_BANK0_GPIO0_DRIVE_Pos)
+
+	dioPad.ReplaceBits(1, 1, rp.PADS_BANK0_GPIO0_SLEWFAST_Pos) // Enable fast slewrate.
+
+	clkPad := pinPadCtrl(clk)
+	clkPad.ReplaceBits(drive, driveMsk, rp.PADS_BANK0_GPIO0_DRIVE_Pos)
+	clkPad.ReplaceBits(1, 1, rp.PADS_BANK0_GPIO0_SLEWFAST_Pos) // Enable fast slewrate.
+
+	// Initialize state machine.
+	sm.Init(offset, cfg)
+	pinMask := uint32(1<<dio | 1<<clk)
+	sm.SetPindirsMasked(pinMask, pinMask)
+	sm.SetPinsMasked(0, pinMask)
+
+	spiw := &SPI3w{
+		sm:      sm,
+		program: handle,
+		offset:  offset,
+		pinMask: pinMask,
+
+		programWrapTarget: program.WrapTarget,
+	}
+	return spiw, nil
+}
+
+func pinPadCtrl(pin machine.Pin) *volatile.Register32 {
+	return (*volatile.Register32)(unsafe.Pointer(uintptr(unsafe.Pointer(&rp.PADS_BANK0.GPIO0)) + uintptr(4*pin)))
+}
@@ -0,0 +1,46 @@
+package piolib
+
+import pio "github.com/tinygo-org/pio/rp2-pio"
+
+// spi3wProgram assembles the 3-wire SPI program. X holds the number of bits to write minus one
+// and Y the number of bits to read minus one.
+func spi3wProgram() (*pio.AssembledProgram, error) {
+	// https://github.com/embassy-rs/embassy/blob/c4a8b79dbc927e46fcc71879673ad3410aa3174b/cyw43-pio/src/lib.rs#L90
+	assm := pio.AssemblerV0{
+		SidesetBits: 1,
+	}
+	prog := pio.NewProgram("spi3w", assm)
+	//     .wrap_target
+	// write out x-1 bits.
+	prog.Label("wloop")                               // Write/Output loop.
+	prog.Add(assm.Out(pio.OutDestPins, 1).Side(0))    //  0: out    pins, 1         side 0
+	prog.Jmp(pio.JmpXNZeroDec, "wloop").Side(1)       //  1: jmp    x--, 0          side 1
+	prog.Jmp(pio.JmpYZero, "end").Side(0)             //  2: jmp    !y, 7           side 0
+	prog.Add(assm.Set(pio.SetDestPindirs, 0).Side(0)) //  3: set    pindirs, 0      side 0
+	prog.Add(assm.Nop().Side(0))                      //  4: nop                    side 0
+	// read in y-1 bits.
+	prog.Label("rloop")                         // Read/input loop
+	prog.Add(assm.In(pio.InSrcPins, 1).Side(1)) //  5: in     pins, 1         side 1
+	prog.Jmp(pio.JmpYNZeroDec, "rloop").Side(0) //  6: jmp    y--, 5          side 0
+	// Wait for SPI packet on IRQ.
+	prog.Label("end")                       // Wait on input pin.
+	prog.Add(assm.WaitPin(true, 0).Side(0)) //  7: wait   1 pin, 0        side 0
+	prog.Add(assm.IRQSet(false, 0).Side(0)) //  8: irq    nowait 0        side 0
+	return prog.Assemble()
+}
+
+// spi3wConfig returns the configuration of the 3-wire SPI program loaded at offset, with dio
+// as the shared data pin and clk as the clock. The clock divider must run the state machine at
+// twice the baud rate, the hot loop takes 2 instructions per bit.
+func spi3wConfig(program *pio.AssembledProgram, offset uint8, dio, clk pio.Pin, whole uint16, frac uint8) pio.StateMachineConfig {
+	cfg := program.DefaultStateMachineConfig(offset)
+	// Configure state machine.
+	cfg.SetOutPins(dio, 1)
+	cfg.SetSetPins(dio, 1)
+	cfg.SetInPins(dio, 1)
+	cfg.SetSidesetPins(clk)
+	cfg.SetOutShift(false, true, 32)
+	cfg.SetInShift(false, true, 32)
+	cfg.SetClkDivIntFrac(whole, frac)
+	return cfg
+}
@@ -0,0 +1,80 @@
+package piolib
+
+import (
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+func TestSPI3wWaveform(t *testing.T) {
+	const dio, clk = 10, 11
+	program, err := spi3wProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, offset := emulate(t, program.Instructions, 1<<clk, func(offset uint8) pio.StateMachineConfig {
+		return spi3wConfig(program, offset, dio, clk, 2, 0)
+	})
+	// As SPI3w.prepTx does for a 32 bit write followed by a 32 bit read.
+	sm.SetX(31)
+	sm.SetY(31)
+	sm.Exec(pio.AssemblerV0{}.Set(pio.SetDestPindirs, 1).Encode())
+	sm.Exec(pio.AssemblerV0{}.Jmp(pio.JmpAlways, offset+program.WrapTarget).Encode())
+	const cmd, resp = 0xdead_beef, 0x1234_5678
+	sm.TxPut(cmd)
+
+	// The device drives DIO once the state machine releases it, shifting out a new bit on each
+	// falling edge of the clock, and pulls it high after the response.
+	var started, done bool
+	var prevClk uint32
+	bit := 31
+	rec := emu.NewRecorder(sm, testCPUFreq)
+	rec.SetStimulus(func(cycle uint64, pins *emu.Pins) {
+		clkLevel := pins.Levels() >> clk & 1
+		falling := prevClk == 1 && clkLevel == 0
+		prevClk = clkLevel
+		switch {
+		case pins.OE>>dio&1 != 0 || done:
+			return
+		case !started:
+			started = true
+		case falling && bit == 0:
+			done = true
+			pins.In |= 1 << dio
+			return
+		case falling:
+			bit--
+		default:
+			return
+		}
+		pins.In = pins.In&^(1<<dio) | resp>>bit&1<<dio
+	})
+	if !rec.RunUntil(1000, func() bool { return sm.IRQ()&1 != 0 }) {
+		t.Fatalf("IRQ 0 not raised, PC %d", sm.PC())
+	}
+	w := rec.Waveform()
+
+	var written, read []uint32
+	edges := w.Edges(clk)
+	for _, e := range edges[1:] {
+		if !e.Level {
+			continue
+		}
+		s := w.At(e.Cycle - 1)
+		if s.OE>>dio&1 != 0 {
+			written = append(written, s.Levels())
+		} else {
+			read = append(read, s.Levels())
+		}
+	}
+	if len(written) != 32 || word(written, dio) != cmd {
+		t.Errorf("wrote %d bits %#08x, want 32 bits %#08x", len(written), word(written, dio), uint32(cmd))
+	}
+	if len(read) != 32 || word(read, dio) != resp {
+		t.Errorf("device sent %d bits %#08x on rising edges, want 32 bits %#08x", len(read), word(read, dio), uint32(resp))
+	}
+	if got := sm.RxGet(); got != resp {
+		t.Errorf("received %#08x, want %#08x", got, uint32(resp))
+	}
+}
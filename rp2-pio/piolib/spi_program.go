@@ -0,0 +1,62 @@
+package piolib
+
+import (
+	"errors"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+// spiProgram returns the SPI program for the given SPI mode.
+func spiProgram(mode uint8) ([]uint16, error) {
+	asm := pio.AssemblerV0{SidesetBits: 1}
+	// spi_cpha0: out pins, 1 side 0 [1]; in pins, 1 side 1 [1]
+	var cpha0Program = [...]uint16{
+		asm.Out(pio.OutDestPins, 1).Side(0).Delay(1).Encode(), // 0: out  pins, 1   side 0 [1]
+		asm.In(pio.InSrcPins, 1).Side(1).Delay(1).Encode(),    // 1: in   pins, 1   side 1 [1]
+	}
+	// spi_cpha1: out x, 1 side 0; mov pins, x side 1 [1]; in pins, 1 side 0
+	var cpha1Program = [...]uint16{
+		asm.Out(pio.OutDestX, 1).Side(0).Encode(),                       // 0: out    x, 1     side 0
+		asm.Mov(pio.MovDestPins, pio.MovSrcX).Side(1).Delay(1).Encode(), // 1: mov    pins, x  side 1 [1]
+		asm.In(pio.InSrcPins, 1).Side(0).Encode(),                       // 2: in     pins, 1  side 0
+	}
+
+	switch mode {
+	case 0b00:
+		return cpha0Program[:], nil
+	case 0b01:
+		// The pin muxes can be configured to invert the output (among other things
+		// and this is a cheesy way to get CPOL=1
+		// rp.IO_BANK0.GPIO0_CTRL.ReplaceBits(value, ) TODO: https://github.com/raspberrypi/pico-sdk/blob/6a7db34ff63345a7badec79ebea3aaef1712f374/src/rp2_common/hardware_gpio/gpio.c#L80
+		// SPI is synchronous, so bypass input synchroniser to reduce input delay.
+		return cpha1Program[:], nil
+	case 0b10, 0b11:
+		return nil, errors.New("unsupported mode")
+	default:
+		panic("invalid mode")
+	}
+}
+
+// spiFrame returns the TX FIFO word for b. Frames are shifted out to the left starting at bit 31, so
+// the byte goes in the top bits of the word, as the byte lane replication of an 8 bit FIFO write
+// does in the C SDK.
+func spiFrame(b byte) uint32 {
+	return uint32(b) << 24
+}
+
+// spiConfig returns the configuration of an SPI program loaded at offset for 8 bit frames.
+func spiConfig(program []uint16, offset uint8, sck, sdo, sdi pio.Pin, whole uint16, frac uint8) pio.StateMachineConfig {
+	const nbits = 8
+	asm := pio.AssemblerV0{SidesetBits: 1}
+	cfg := asm.DefaultStateMachineConfig(offset, program)
+
+	cfg.SetOutPins(sdo, 1)
+	cfg.SetInPins(sdi, 1)
+	cfg.SetSidesetPins(sck)
+
+	cfg.SetOutShift(false, true, uint16(nbits))
+	cfg.SetInShift(false, true, uint16(nbits))
+
+	cfg.SetClkDivIntFrac(whole, frac)
+	return cfg
+}
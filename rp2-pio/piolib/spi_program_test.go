@@ -0,0 +1,59 @@
+package piolib
+
+import (
+	"testing"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+func TestSPIWaveform(t *testing.T) {
+	const sck, sdo, sdi = 2, 3, 4
+	for _, tc := range []struct {
+		mode uint8
+		// Data is shifted out on one SCK edge and latched by the receiver on the other.
+		latchRising bool
+	}{
+		{mode: 0, latchRising: true},
+		{mode: 1, latchRising: false},
+	} {
+		program, err := spiProgram(tc.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sm, _ := emulate(t, program, 1<<sck|1<<sdo, func(offset uint8) pio.StateMachineConfig {
+			return spiConfig(program, offset, sck, sdo, sdi, 4, 0)
+		})
+		const tx = 0xa5
+		sm.TxPut(spiFrame(tx))
+		rec := emu.NewRecorder(sm, testCPUFreq)
+		rec.SetStimulus(func(cycle uint64, pins *emu.Pins) {
+			// Loop SDO back into SDI.
+			pins.In = pins.Levels() >> sdo & 1 << sdi
+		})
+		rec.Run(8 * 4 * 5)
+		w := rec.Waveform()
+
+		if got := w.At(0).Levels() >> sck & 1; got != 0 {
+			t.Errorf("mode %d: SCK idles at %d, want 0", tc.mode, got)
+		}
+		bits := latched(w, sck, tc.latchRising)
+		if len(bits) != 8 {
+			t.Fatalf("mode %d: got %d latching SCK edges, want 8", tc.mode, len(bits))
+		}
+		if got := word(bits, sdo); got != tx {
+			t.Errorf("mode %d: latched %#02x on SDO, want %#02x", tc.mode, got, tx)
+		}
+		if sm.IsRxFIFOEmpty() {
+			t.Fatalf("mode %d: nothing received", tc.mode)
+		}
+		if got := sm.RxGet(); got != tx {
+			t.Errorf("mode %d: received %#02x from SDI, want %#02x", tc.mode, got, tx)
+		}
+	}
+	for _, mode := range []uint8{2, 3} {
+		if _, err := spiProgram(mode); err == nil {
+			t.Errorf("mode %d: expected unsupported mode error", mode)
+		}
+	}
+}
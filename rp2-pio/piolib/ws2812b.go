@@ -1,83 +1,31 @@
-//go:build rp2040 || rp2350
-
 package piolib
 
 import (
 	"image/color"
-	"machine"
 
 	pio "github.com/tinygo-org/pio/rp2-pio"
 )
 
 // WS2812B is an RGB LED strip controller implementation, also known as NeoPixel.
 type WS2812B struct {
-	sm     pio.StateMachine
-	dma    dmaChannel
-	offset uint8
+	sm      pio.StateMachine
+	dma     dmaChannel
+	program *pio.ProgramHandle
+	offset  uint8
 }
 
-func NewWS2812B(sm pio.StateMachine, pin machine.Pin) (*WS2812B, error) {
-	// See ws2812b.pio for more information on how the timings are calculated.
-	// WS2812B Datasheet:
-	// https://cdn-shop.adafruit.com/datasheets/WS2812B.pdf
-	const (
-		baseline      = 1250.
-		baselinesplit = baseline / 3
-		cycle         = baselinesplit / 3
-		freq          = uint32(1e9 / cycle)
-	)
-	sm.TryClaim() // SM should be claimed beforehand, we just guarantee it's claimed.
-	cpufreq := machine.CPUFrequency()
-	// whole, frac, err := pio.ClkDivFromPeriod(period, cpufreq)
-	whole, frac, err := pio.ClkDivFromFrequency(freq, cpufreq)
-	if err != nil {
-		return nil, err
-	}
-	// Program positions.
-	const (
-		origin  = -1
-		bitloop = 1
-		lolo    = 5
-		hilo    = 6
-	)
-	asm := pio.AssemblerV0{SidesetBits: 0}
-	var program = [...]uint16{
-		//     .wrap_target
-		asm.Pull(true, true).Encode(), // 0: pull   ifempty block
-
-		bitloop:// 3 instructions high logic level.
-		asm.Set(pio.SetDestPins, 1).Encode(),           // 1: set    pins, 1
-		asm.Out(pio.OutDestY, 1).Encode(),              // 2: out    y, 1
-		asm.Jmp(pio.JmpYZero, lolo).Encode(),           // 3: jmp    !y, 5
-		asm.Jmp(pio.JmpAlways, hilo).Delay(2).Encode(), // 4: jmp    6                      [2]
-
-		lolo:// Create T0L, we need 6 cycles.
-		asm.Set(pio.SetDestPins, 0).Delay(2).Encode(), // 5: set    pins, 0                [2]
-
-		hilo://
-		asm.Set(pio.SetDestPins, 0).Encode(), // 6: set    pins, 0
-		asm.Jmp(pio.JmpOSRNotEmpty, bitloop).Delay(1).Encode(), // 7: jmp    !osre, 1               [1]
-		//     .wrap
-	}
-
-	// We add the program to PIO memory and store it's offset.
-	Pio := sm.PIO()
-	offset, err := Pio.AddProgram(program[:], origin)
-	if err != nil {
-		return nil, err
+// Close stops sending colors to the strip, which keeps showing the last colors it latched. The
+// DMA channel, if enabled, and the state machine are freed for other drivers, and the program
+// is removed from the PIO block once no other strip shares it. Closing a closed strip has no effect.
+func (ws *WS2812B) Close() {
+	if ws.program == nil {
+		return
 	}
-	pin.Configure(machine.PinConfig{Mode: Pio.PinMode()})
-	sm.SetPindirsConsecutive(pin, 1, true)
-	cfg := asm.DefaultStateMachineConfig(offset, program[:])
-	cfg.SetSetPins(pin, 1)
-	// We only use Tx FIFO, so we set the join to Tx.
-	cfg.SetFIFOJoin(pio.FifoJoinTx)
-	cfg.SetClkDivIntFrac(whole, frac)
-	cfg.SetOutShift(false, true, 24)
-	sm.Init(offset, cfg)
-	sm.SetEnabled(true)
-	dev := &WS2812B{sm: sm, offset: offset}
-	return dev, nil
+	ws.sm.SetEnabled(false)
+	ws.dma.helperEnableDMA(false)
+	ws.program.Release()
+	ws.program = nil
+	ws.sm.Unclaim()
 }
 
 // PutRGB puts a RGB color in the transmit queue. If Queue if full will be discarded.
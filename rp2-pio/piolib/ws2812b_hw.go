@@ -0,0 +1,38 @@
+//go:build rp2040 || rp2350
+
+package piolib
+
+import (
+	"machine"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+)
+
+func NewWS2812B(sm pio.StateMachine, pin machine.Pin) (*WS2812B, error) {
+	sm.TryClaim() // SM should be claimed beforehand, we just guarantee it's claimed.
+	cpufreq := machine.CPUFrequency()
+	// whole, frac, err := pio.ClkDivFromPeriod(period, cpufreq)
+	whole, frac, err := pio.ClkDivFromFrequency(ws2812bFrequency, cpufreq)
+	if err != nil {
+		return nil, err
+	}
+	program, err := ws2812bProgram()
+	if err != nil {
+		return nil, err
+	}
+
+	// We add the program to PIO memory, sharing it with other WS2812B drivers on the block.
+	Pio := sm.PIO()
+	handle, err := Pio.LoadProgramHandle(program)
+	if err != nil {
+		return nil, err
+	}
+	offset := handle.Offset()
+	cfg := ws2812bConfig(program, offset, pin, whole, frac)
+	pin.Configure(machine.PinConfig{Mode: Pio.PinMode()})
+	sm.SetPindirsConsecutive(pin, 1, true)
+	sm.Init(offset, cfg)
+	sm.SetEnabled(true)
+	dev := &WS2812B{sm: sm, program: handle, offset: offset}
+	return dev, nil
+}
@@ -0,0 +1,49 @@
+package piolib
+
+import pio "github.com/tinygo-org/pio/rp2-pio"
+
+// See ws2812b.pio for more information on how the timings are calculated.
+// WS2812B Datasheet:
+// https://cdn-shop.adafruit.com/datasheets/WS2812B.pdf
+const (
+	ws2812bBaseline      = 1250.
+	ws2812bBaselinesplit = ws2812bBaseline / 3
+	ws2812bCycle         = ws2812bBaselinesplit / 3
+	// ws2812bFrequency is the state machine frequency of the WS2812B program.
+	ws2812bFrequency = uint32(1e9 / ws2812bCycle)
+)
+
+// ws2812bProgram assembles the WS2812B program.
+func ws2812bProgram() (*pio.AssembledProgram, error) {
+	asm := pio.AssemblerV0{SidesetBits: 0}
+	prog := pio.NewProgram("ws2812b", asm)
+	//     .wrap_target
+	prog.Add(asm.Pull(true, true)) // 0: pull   ifempty block
+
+	prog.Label("bitloop")                    // 3 instructions high logic level.
+	prog.Add(asm.Set(pio.SetDestPins, 1))    // 1: set    pins, 1
+	prog.Add(asm.Out(pio.OutDestY, 1))       // 2: out    y, 1
+	prog.Jmp(pio.JmpYZero, "lolo")           // 3: jmp    !y, 5
+	prog.Jmp(pio.JmpAlways, "hilo").Delay(2) // 4: jmp    6                      [2]
+
+	prog.Label("lolo")                             // Create T0L, we need 6 cycles.
+	prog.Add(asm.Set(pio.SetDestPins, 0)).Delay(2) // 5: set    pins, 0                [2]
+
+	prog.Label("hilo")
+	prog.Add(asm.Set(pio.SetDestPins, 0))            // 6: set    pins, 0
+	prog.Jmp(pio.JmpOSRNotEmpty, "bitloop").Delay(1) // 7: jmp    !osre, 1               [1]
+	//     .wrap
+	return prog.Assemble()
+}
+
+// ws2812bConfig returns the configuration of the WS2812B program loaded at offset driving pin
+// for a clock divider giving ws2812bFrequency.
+func ws2812bConfig(program *pio.AssembledProgram, offset uint8, pin pio.Pin, whole uint16, frac uint8) pio.StateMachineConfig {
+	cfg := program.DefaultStateMachineConfig(offset)
+	cfg.SetSetPins(pin, 1)
+	// We only use Tx FIFO, so we set the join to Tx.
+	cfg.SetFIFOJoin(pio.FifoJoinTx)
+	cfg.SetClkDivIntFrac(whole, frac)
+	cfg.SetOutShift(false, true, 24)
+	return cfg
+}
@@ -0,0 +1,66 @@
+package piolib
+
+import (
+	"testing"
+	"time"
+
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/emu"
+)
+
+func TestWS2812BWaveform(t *testing.T) {
+	const pin = 4
+	program, err := ws2812bProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole, frac, err := pio.ClkDivFromFrequency(ws2812bFrequency, testCPUFreq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, _ := emulate(t, program.Instructions, 1<<pin, func(offset uint8) pio.StateMachineConfig {
+		return ws2812bConfig(program, offset, pin, whole, frac)
+	})
+	const grb = 0xa5_0f_c3 << 8
+	sm.TxPut(grb)
+	rec := emu.NewRecorder(sm, testCPUFreq)
+	rec.Run(24 * 9 * int(whole+1))
+	w := rec.Waveform()
+
+	// Timings from the WS2812B datasheet, each within ±150ns.
+	const tolerance = 150 * time.Nanosecond
+	timings := [2]struct{ high, low time.Duration }{
+		{high: 400 * time.Nanosecond, low: 850 * time.Nanosecond},
+		{high: 800 * time.Nanosecond, low: 450 * time.Nanosecond},
+	}
+	within := func(got, want time.Duration) bool {
+		return got >= want-tolerance && got <= want+tolerance
+	}
+	edges := w.Edges(pin)[1:]
+	if len(edges) != 2*24 {
+		t.Fatalf("got %d edges, want 48: %v", len(edges), edges)
+	}
+	var got uint32
+	for i := 0; i < len(edges); i += 2 {
+		rise, fall := edges[i], edges[i+1]
+		high := w.Time(fall.Cycle) - w.Time(rise.Cycle)
+		bit := 0
+		if high > 600*time.Nanosecond {
+			bit = 1
+		}
+		got = got<<1 | uint32(bit)
+		if !within(high, timings[bit].high) {
+			t.Errorf("bit %d: high for %v, want %v", i/2, high, timings[bit].high)
+		}
+		if i+2 == len(edges) {
+			break // The line stays low after the last bit.
+		}
+		low := w.Time(edges[i+2].Cycle) - w.Time(fall.Cycle)
+		if !within(low, timings[bit].low) {
+			t.Errorf("bit %d: low for %v, want %v", i/2, low, timings[bit].low)
+		}
+	}
+	if got != grb>>8 {
+		t.Errorf("sent GRB %#06x, want %#06x", got, grb>>8)
+	}
+}
@@ -18,10 +18,11 @@ const (
 
 // WS2812bFourPixels is an RGB LED strip controller implementation, also known as NeoPixel.
 type WS2812bFourPixels struct {
-	sm     pio.StateMachine
-	cfg    pio.StateMachineConfig
-	offset uint8
-	mode   WS2812bFourPixelsMode
+	sm      pio.StateMachine
+	cfg     pio.StateMachineConfig
+	program *pio.ProgramHandle
+	offset  uint8
+	mode    WS2812bFourPixelsMode
 }
 
 // WS2812bFourPixels uses the RP2350 PIO's FJOIN_RX_GET mode to control 4 NeoPixels. The
@@ -64,10 +65,11 @@ func newWS2812bFourPixels(sm pio.StateMachine, pin machine.Pin, mode WS2812bFour
 		return nil, err
 	}
 	Pio := sm.PIO()
-	offset, err := Pio.AddProgram(program[:], origin)
+	handle, err := Pio.AddProgramHandle(program[:], origin)
 	if err != nil {
 		return nil, err
 	}
+	offset := handle.Offset()
 
 	pin.Configure(machine.PinConfig{Mode: Pio.PinMode()})
 	sm.SetPindirsConsecutive(pin, 1, true)
@@ -85,10 +87,11 @@ func newWS2812bFourPixels(sm pio.StateMachine, pin machine.Pin, mode WS2812bFour
 	}
 
 	ns := &WS2812bFourPixels{
-		sm:     sm,
-		cfg:    cfg,
-		offset: offset,
-		mode:   mode,
+		sm:      sm,
+		cfg:     cfg,
+		program: handle,
+		offset:  offset,
+		mode:    mode,
 	}
 	ns.sm.Init(ns.offset, ns.cfg)
 	ns.sm.SetEnabled(true)
@@ -101,6 +104,19 @@ func newWS2812bFourPixels(sm pio.StateMachine, pin machine.Pin, mode WS2812bFour
 	return ns, nil
 }
 
+// Close stops refreshing the four pixels, unclaims the state machine and releases the program,
+// which RGB and RGBW instances on the same block share. The pixels hold their last colors.
+// Closing a closed instance has no effect.
+func (ns *WS2812bFourPixels) Close() {
+	if ns.program == nil {
+		return
+	}
+	ns.sm.SetEnabled(false)
+	ns.program.Release()
+	ns.program = nil
+	ns.sm.Unclaim()
+}
+
 // SetEnabled starts or stops the state machine.
 func (ns *WS2812bFourPixels) SetEnabled(enable bool) {
 	ns.sm.SetEnabled(enable)
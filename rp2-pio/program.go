@@ -0,0 +1,150 @@
+package pio
+
+// AssembledProgram is a PIO program ready to be loaded into PIO instruction memory
+// along with the metadata needed to configure a state machine to run it.
+// It is the Go equivalent of the pico-sdk's pio_program_t plus the
+// directives pioasm uses to generate a program's default configuration.
+type AssembledProgram struct {
+	// Name of the program as given by the .program directive.
+	Name string
+	// Instructions holds the encoded program. Jump addresses are relative to the start of the program.
+	Instructions []uint16
+	// Origin is the fixed offset in instruction memory the program must be loaded at,
+	// or -1 if the program is relocatable.
+	Origin int8
+	// PIOVersion is the PIO hardware version required to run the program. 0 for RP2040, 1 for RP2350.
+	PIOVersion uint8
+	// WrapTarget is the program relative address the program wraps to after executing the Wrap instruction.
+	WrapTarget uint8
+	// Wrap is the program relative address of the last instruction before wrapping to WrapTarget.
+	Wrap uint8
+
+	// SidesetBits is the number of side-set value bits, not including the optional enable bit.
+	SidesetBits uint8
+	// SidesetOptional is true if side-set is optional, in which case the side-set
+	// field has an additional enable bit in its most significant position.
+	SidesetOptional bool
+	// SidesetPindirs is true if side-set drives pin directions instead of pin values.
+	SidesetPindirs bool
+
+	// FifoJoin is the FIFO configuration given by the .fifo directive.
+	FifoJoin FifoJoin
+	// In holds the .in directive parameters, or nil if not specified.
+	In *ShiftDirective
+	// Out holds the .out directive parameters, or nil if not specified.
+	Out *ShiftDirective
+	// SetCount is the number of SET pins given by the .set directive, or -1 if not specified.
+	SetCount int8
+	// MovStatus holds the .mov_status directive parameters, or nil if not specified.
+	MovStatus *MovStatusDirective
+	// ClkDiv is the clock divider given by the .clock_div directive, or 0 if not specified.
+	ClkDiv float32
+
+	// Symbols holds labels and defines declared inside the program.
+	Symbols []Symbol
+	// CodeBlocks holds the `% lang {` ... `%}` blocks declared inside the program.
+	CodeBlocks []CodeBlock
+	// LangOpts holds the .lang_opt directives of the program.
+	LangOpts []LangOpt
+}
+
+// SidesetFieldBits returns the number of bits of the delay/side-set field used for side-set,
+// including the optional enable bit. This is the value passed to [StateMachineConfig.SetSidesetParams].
+func (p *AssembledProgram) SidesetFieldBits() uint8 {
+	return p.assembler().sidesetFieldBits()
+}
+
+// assembler returns an assembler matching the program's side-set configuration.
+func (p *AssembledProgram) assembler() AssemblerV0 {
+	return AssemblerV0{SidesetBits: p.SidesetBits, SidesetOptional: p.SidesetOptional, SidesetPindirs: p.SidesetPindirs}
+}
+
+// Symbol returns the label or define with the given name.
+func (p *AssembledProgram) Symbol(name string) (Symbol, bool) {
+	for _, sym := range p.Symbols {
+		if sym.Name == name {
+			return sym, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// DefaultStateMachineConfig returns the state machine configuration for the program loaded at offset,
+// equivalent to the <name>ProgramDefaultConfig function generated by pioasm. It configures wrapping, side-set,
+// FIFO joining, shift directions and thresholds, IN, OUT and SET pin counts, MOV STATUS and clock divider
+// as declared by the program. The IN pin count is only set for version 1 programs, since version 0 hardware
+// has no such limit. Base pins are left to the caller.
+func (p *AssembledProgram) DefaultStateMachineConfig(offset uint8) StateMachineConfig {
+	cfg := DefaultStateMachineConfig()
+	cfg.SetWrap(offset+p.WrapTarget, offset+p.Wrap)
+	if p.SidesetBits > 0 {
+		cfg.SetSidesetParams(p.SidesetFieldBits(), p.SidesetOptional, p.SidesetPindirs)
+	}
+	if p.FifoJoin != FifoJoinNone {
+		cfg.SetFIFOJoin(p.FifoJoin)
+	}
+	if p.In != nil {
+		if p.PIOVersion > 0 {
+			cfg.SetInPinCount(p.In.PinCount)
+		}
+		cfg.SetInShift(p.In.ShiftRight, p.In.Auto, uint16(p.In.Threshold))
+	}
+	if p.Out != nil {
+		cfg.SetOutPinCount(p.Out.PinCount)
+		cfg.SetOutShift(p.Out.ShiftRight, p.Out.Auto, uint16(p.Out.Threshold))
+	}
+	if p.SetCount >= 0 {
+		cfg.SetSetPinCount(uint8(p.SetCount))
+	}
+	if p.MovStatus != nil {
+		cfg.SetMovStatus(p.MovStatus.Sel, uint32(p.MovStatus.N))
+	}
+	if p.ClkDiv >= 1 {
+		whole := uint16(p.ClkDiv) // 65536 wraps to 0, which the hardware interprets as 65536.
+		frac := uint8((p.ClkDiv - float32(uint32(p.ClkDiv))) * 256)
+		cfg.SetClkDivIntFrac(whole, frac)
+	}
+	return cfg
+}
+
+// ShiftDirective holds the arguments of a .in or .out directive.
+type ShiftDirective struct {
+	// PinCount is the number of pins used by IN or OUT.
+	PinCount uint8 `json:"pin_count"`
+	// ShiftRight is true if the shift register shifts to the right.
+	ShiftRight bool `json:"shift_right"`
+	// Auto enables autopush (.in) or autopull (.out).
+	Auto bool `json:"auto"`
+	// Threshold is the autopush or autopull threshold in bits, 1..32.
+	Threshold uint8 `json:"threshold"`
+}
+
+// MovStatusDirective holds the arguments of a .mov_status directive.
+type MovStatusDirective struct {
+	Sel MovStatus `json:"sel"`
+	N   uint8     `json:"n"`
+}
+
+// Symbol is a label or .define'd value.
+type Symbol struct {
+	Name  string
+	Value int
+	// Public symbols are exported by code generators.
+	Public bool
+	// Label is true if the symbol is a program label, in which case Value is its program relative address.
+	Label bool
+}
+
+// CodeBlock is a block of verbatim code for a given language output,
+// declared in PIO assembly between `% lang {` and `%}`.
+type CodeBlock struct {
+	Lang string
+	Code string
+}
+
+// LangOpt is a language specific option declared with the .lang_opt directive.
+type LangOpt struct {
+	Lang  string
+	Name  string
+	Value string
+}
@@ -0,0 +1,92 @@
+package pio
+
+// Block register fields shared by RP2040 and RP2350, redefined from device/rp so
+// that PIO and StateMachine can run against in-memory registers off-target.
+const (
+	pio0_CTRL_SM_ENABLE_Pos      = 0x0
+	pio0_CTRL_SM_RESTART_Pos     = 0x4
+	pio0_CTRL_CLKDIV_RESTART_Pos = 0x8
+
+	pio0_FSTAT_RXFULL_Pos  = 0x0
+	pio0_FSTAT_RXEMPTY_Pos = 0x8
+	pio0_FSTAT_TXFULL_Pos  = 0x10
+	pio0_FSTAT_TXEMPTY_Pos = 0x18
+
+	pio0_FDEBUG_RXSTALL_Pos = 0x0
+	pio0_FDEBUG_RXUNDER_Pos = 0x8
+	pio0_FDEBUG_TXOVER_Pos  = 0x10
+	pio0_FDEBUG_TXSTALL_Pos = 0x18
+
+	pio0_FLEVEL_TX0_Pos = 0x0
+	pio0_FLEVEL_TX0_Msk = 0xf
+	pio0_FLEVEL_RX0_Pos = 0x4
+	pio0_FLEVEL_RX0_Msk = 0xf0
+	pio0_FLEVEL_TX1_Pos = 0x8
+	pio0_FLEVEL_RX1_Pos = 0xc
+)
+
+// State machine register fields shared by RP2040 and RP2350. They are redefined
+// here from device/rp so that StateMachineConfig can be built and tested off-target.
+const (
+	pio0_SM0_CLKDIV_INT_Pos  = 0x10
+	pio0_SM0_CLKDIV_INT_Msk  = 0xffff0000
+	pio0_SM0_CLKDIV_FRAC_Pos = 0x8
+	pio0_SM0_CLKDIV_FRAC_Msk = 0xff00
+
+	pio0_SM0_EXECCTRL_SIDE_EN_Pos       = 0x1e
+	pio0_SM0_EXECCTRL_SIDE_EN_Msk       = 0x40000000
+	pio0_SM0_EXECCTRL_SIDE_PINDIR_Pos   = 0x1d
+	pio0_SM0_EXECCTRL_SIDE_PINDIR_Msk   = 0x20000000
+	pio0_SM0_EXECCTRL_JMP_PIN_Pos       = 0x18
+	pio0_SM0_EXECCTRL_JMP_PIN_Msk       = 0x1f000000
+	pio0_SM0_EXECCTRL_OUT_EN_SEL_Pos    = 0x13
+	pio0_SM0_EXECCTRL_OUT_EN_SEL_Msk    = 0xf80000
+	pio0_SM0_EXECCTRL_INLINE_OUT_EN_Pos = 0x12
+	pio0_SM0_EXECCTRL_INLINE_OUT_EN_Msk = 0x40000
+	pio0_SM0_EXECCTRL_OUT_STICKY_Pos    = 0x11
+	pio0_SM0_EXECCTRL_OUT_STICKY_Msk    = 0x20000
+	pio0_SM0_EXECCTRL_WRAP_TOP_Pos      = 0xc
+	pio0_SM0_EXECCTRL_WRAP_TOP_Msk      = 0x1f000
+	pio0_SM0_EXECCTRL_WRAP_BOTTOM_Pos   = 0x7
+	pio0_SM0_EXECCTRL_WRAP_BOTTOM_Msk   = 0xf80
+
+	pio0_SM0_SHIFTCTRL_FJOIN_RX_Pos     = 0x1f
+	pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk     = 0x80000000
+	pio0_SM0_SHIFTCTRL_FJOIN_TX_Pos     = 0x1e
+	pio0_SM0_SHIFTCTRL_FJOIN_TX_Msk     = 0x40000000
+	pio0_SM0_SHIFTCTRL_PULL_THRESH_Pos  = 0x19
+	pio0_SM0_SHIFTCTRL_PULL_THRESH_Msk  = 0x3e000000
+	pio0_SM0_SHIFTCTRL_PUSH_THRESH_Pos  = 0x14
+	pio0_SM0_SHIFTCTRL_PUSH_THRESH_Msk  = 0x1f00000
+	pio0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Pos = 0x13
+	pio0_SM0_SHIFTCTRL_OUT_SHIFTDIR_Msk = 0x80000
+	pio0_SM0_SHIFTCTRL_IN_SHIFTDIR_Pos  = 0x12
+	pio0_SM0_SHIFTCTRL_IN_SHIFTDIR_Msk  = 0x40000
+	pio0_SM0_SHIFTCTRL_AUTOPULL_Pos     = 0x11
+	pio0_SM0_SHIFTCTRL_AUTOPULL_Msk     = 0x20000
+	pio0_SM0_SHIFTCTRL_AUTOPUSH_Pos     = 0x10
+	pio0_SM0_SHIFTCTRL_AUTOPUSH_Msk     = 0x10000
+
+	pio0_SM0_PINCTRL_SIDESET_COUNT_Pos = 0x1d
+	pio0_SM0_PINCTRL_SIDESET_COUNT_Msk = 0xe0000000
+	pio0_SM0_PINCTRL_SET_COUNT_Pos     = 0x1a
+	pio0_SM0_PINCTRL_SET_COUNT_Msk     = 0x1c000000
+	pio0_SM0_PINCTRL_OUT_COUNT_Pos     = 0x14
+	pio0_SM0_PINCTRL_OUT_COUNT_Msk     = 0x3f00000
+	pio0_SM0_PINCTRL_IN_BASE_Pos       = 0xf
+	pio0_SM0_PINCTRL_IN_BASE_Msk       = 0xf8000
+	pio0_SM0_PINCTRL_SIDESET_BASE_Pos  = 0xa
+	pio0_SM0_PINCTRL_SIDESET_BASE_Msk  = 0x7c00
+	pio0_SM0_PINCTRL_SET_BASE_Pos      = 0x5
+	pio0_SM0_PINCTRL_SET_BASE_Msk      = 0x3e0
+	pio0_SM0_PINCTRL_OUT_BASE_Pos      = 0x0
+	pio0_SM0_PINCTRL_OUT_BASE_Msk      = 0x1f
+)
+
+const (
+	// RP2350-only, redefined here for RP2040 compatibility.
+	pio0_SM0_SHIFTCTRL_IN_COUNT_Msk     uint32 = 0x1f
+	pio0_SM0_SHIFTCTRL_FJOIN_RX_PUT_Msk uint32 = 0x8000
+	pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Msk uint32 = 0x4000
+	pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Pos uint32 = 14 // 0xe
+)
@@ -0,0 +1,11 @@
+//go:build rp2040
+
+package pio
+
+// The MOV STATUS fields were widened on RP2350 to make room for IRQ status.
+const (
+	pio0_SM0_EXECCTRL_STATUS_SEL_Pos = 0x4
+	pio0_SM0_EXECCTRL_STATUS_SEL_Msk = 0x10
+	pio0_SM0_EXECCTRL_STATUS_N_Pos   = 0x0
+	pio0_SM0_EXECCTRL_STATUS_N_Msk   = 0xf
+)
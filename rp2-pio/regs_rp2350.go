@@ -0,0 +1,12 @@
+//go:build !rp2040
+
+package pio
+
+// RP2350 MOV STATUS fields. Off-target builds use this layout since it is a
+// superset of the RP2040 one.
+const (
+	pio0_SM0_EXECCTRL_STATUS_SEL_Pos = 0x5
+	pio0_SM0_EXECCTRL_STATUS_SEL_Msk = 0x60
+	pio0_SM0_EXECCTRL_STATUS_N_Pos   = 0x0
+	pio0_SM0_EXECCTRL_STATUS_N_Msk   = 0x1f
+)
@@ -1,13 +1,8 @@
-//go:build rp2350 || rp2040
-
 package pio
 
 import (
-	"device/rp"
-	"machine"
+	"fmt"
 	"math/bits"
-	"runtime/volatile"
-	"unsafe"
 )
 
 // assm is the default assembler used for state machine manipulation. No sidesetting nor delays.
@@ -26,17 +21,25 @@ type StateMachine struct {
 func (sm StateMachine) IsClaimed() bool { return sm.pio.claimedSMMask&(1<<sm.index) != 0 }
 
 // Unclaim releases the state machine for use by other code.
-func (sm StateMachine) Unclaim() { sm.pio.claimedSMMask &^= (1 << sm.index) }
+// It is safe to call from any goroutine, interrupt handler or core.
+func (sm StateMachine) Unclaim() {
+	state := lockClaims()
+	sm.pio.claimedSMMask &^= (1 << sm.index)
+	unlockClaims(state)
+}
 
 // Claim attempts to claim the state machine for use by the caller and returns
 // true if successful, or false if StateMachine already claimed. Regardless of result
 // the state machine is guaranteed to be claimed after the call ends.
+//
+// Claiming is atomic: of concurrent callers from goroutines, interrupt handlers or
+// either core, exactly one succeeds.
 func (sm StateMachine) TryClaim() bool {
-	if sm.IsClaimed() {
-		return false
-	}
+	state := lockClaims()
+	claimed := !sm.IsClaimed()
 	sm.pio.claimedSMMask |= 1 << sm.index
-	return true
+	unlockClaims(state)
+	return claimed
 }
 
 // HW returns a pointer to the configuration hardware registers for this state machine.
@@ -80,10 +83,10 @@ func (sm StateMachine) Init(initialPC uint8, cfg StateMachineConfig) {
 	sm.ClearFIFOs()
 
 	// Clear FIFO debug flags
-	const fdebugMask = uint32((1 << rp.PIO0_FDEBUG_TXOVER_Pos) |
-		(1 << rp.PIO0_FDEBUG_RXUNDER_Pos) |
-		(1 << rp.PIO0_FDEBUG_TXSTALL_Pos) |
-		(1 << rp.PIO0_FDEBUG_RXSTALL_Pos))
+	const fdebugMask = uint32((1 << pio0_FDEBUG_TXOVER_Pos) |
+		(1 << pio0_FDEBUG_RXUNDER_Pos) |
+		(1 << pio0_FDEBUG_TXSTALL_Pos) |
+		(1 << pio0_FDEBUG_RXSTALL_Pos))
 
 	sm.pio.hw.FDEBUG.Set(fdebugMask << sm.index)
 
@@ -92,6 +95,16 @@ func (sm StateMachine) Init(initialPC uint8, cfg StateMachineConfig) {
 	sm.Exec(assm.Jmp(JmpAlways, initialPC).Encode())
 }
 
+// InitChecked is like [StateMachine.Init] but returns an error instead of configuring the
+// state machine if cfg uses features not supported by the PIO hardware version.
+func (sm StateMachine) InitChecked(initialPC uint8, cfg StateMachineConfig) error {
+	if v := cfg.RequiredVersion(); v > sm.pio.Version() {
+		return fmt.Errorf("pio: state machine config requires PIO version %d", v)
+	}
+	sm.Init(initialPC, cfg)
+	return nil
+}
+
 // SetEnabled controls whether the state machine is running.
 func (sm StateMachine) SetEnabled(enabled bool) {
 	sm.pio.hw.CTRL.ReplaceBits(boolToBit(enabled), 0x1, sm.index)
@@ -99,20 +112,22 @@ func (sm StateMachine) SetEnabled(enabled bool) {
 
 // IsEnabled returns true if the state machine is running.
 func (sm StateMachine) IsEnabled() bool {
-	return sm.pio.hw.CTRL.HasBits(1 << (rp.PIO0_CTRL_SM_ENABLE_Pos + sm.index))
+	return sm.pio.hw.CTRL.HasBits(1 << (pio0_CTRL_SM_ENABLE_Pos + sm.index))
 }
 
 // Restart clears internal StateMachine state which may otherwise be difficult to access, e.g. shift counters.
 func (sm StateMachine) Restart() {
-	sm.pio.hw.CTRL.SetBits(1 << (rp.PIO0_CTRL_SM_RESTART_Pos + sm.index))
+	sm.pio.hw.CTRL.SetBits(1 << (pio0_CTRL_SM_RESTART_Pos + sm.index))
 }
 
 // ClkDivRestart forces clock dividers to restart their count and clear fractional accumulators (phase is zeroed).
 func (sm StateMachine) ClkDivRestart() {
-	sm.pio.hw.CTRL.SetBits(1 << (rp.PIO0_CTRL_CLKDIV_RESTART_Pos + sm.index))
+	sm.pio.hw.CTRL.SetBits(1 << (pio0_CTRL_CLKDIV_RESTART_Pos + sm.index))
 }
 
-// SetConfig applies state machine configuration to a state machine
+// SetConfig applies state machine configuration to a state machine.
+// cfg is not checked against the hardware version, see [StateMachine.InitChecked]:
+// version 0 hardware ignores an IN pin count and always reads all 32 IN pins.
 func (sm StateMachine) SetConfig(cfg StateMachineConfig) {
 	sm.setConfig(cfg)
 }
@@ -143,64 +158,60 @@ func (sm StateMachine) RxGet() uint32 {
 }
 
 // TxReg gets a pointer to the TX FIFO register for this state machine.
-func (sm StateMachine) TxReg() *volatile.Register32 {
-	start := uintptr(unsafe.Pointer(&sm.pio.hw.TXF0)) // 0x10
-	offset := uintptr(sm.index) * 4
-	return (*volatile.Register32)(unsafe.Pointer(start + offset))
+func (sm StateMachine) TxReg() *register32 {
+	return &sm.pio.hw.TXF[sm.index] // 0x10 for SM0
 }
 
 // RxReg gets a pointer to the RX FIFO register for this state machine.
-func (sm StateMachine) RxReg() *volatile.Register32 {
-	start := uintptr(unsafe.Pointer(&sm.pio.hw.RXF0)) // 0x20
-	offset := uintptr(sm.index) * 4
-	return (*volatile.Register32)(unsafe.Pointer(start + offset))
+func (sm StateMachine) RxReg() *register32 {
+	return &sm.pio.hw.RXF[sm.index] // 0x20 for SM0
 }
 
 // RxFIFOLevel returns the number of elements currently in a state machine's RX FIFO.
 // The number of elements returned is in the range 0..15.
 func (sm StateMachine) RxFIFOLevel() uint32 {
-	const mask = rp.PIO0_FLEVEL_RX0_Msk >> rp.PIO0_FLEVEL_RX0_Pos
-	bitoffs := rp.PIO0_FLEVEL_RX0_Pos + sm.index*(rp.PIO0_FLEVEL_RX1_Pos-rp.PIO0_FLEVEL_RX0_Pos)
+	const mask = pio0_FLEVEL_RX0_Msk >> pio0_FLEVEL_RX0_Pos
+	bitoffs := pio0_FLEVEL_RX0_Pos + sm.index*(pio0_FLEVEL_RX1_Pos-pio0_FLEVEL_RX0_Pos)
 	return (sm.pio.hw.FLEVEL.Get() >> uint32(bitoffs)) & mask
 }
 
 // TxFIFOLevel returns the number of elements currently in a state machine's TX FIFO.
 // The number of elements returned is in the range 0..15.
 func (sm StateMachine) TxFIFOLevel() uint32 {
-	const mask = rp.PIO0_FLEVEL_TX0_Msk >> rp.PIO0_FLEVEL_TX0_Pos
-	bitoffs := rp.PIO0_FLEVEL_TX0_Pos + sm.index*(rp.PIO0_FLEVEL_TX1_Pos-rp.PIO0_FLEVEL_TX0_Pos)
+	const mask = pio0_FLEVEL_TX0_Msk >> pio0_FLEVEL_TX0_Pos
+	bitoffs := pio0_FLEVEL_TX0_Pos + sm.index*(pio0_FLEVEL_TX1_Pos-pio0_FLEVEL_TX0_Pos)
 	return (sm.pio.hw.FLEVEL.Get() >> uint32(bitoffs)) & mask
 }
 
 // IsTxFIFOEmpty returns true if state machine's TX FIFO is empty.
 func (sm StateMachine) IsTxFIFOEmpty() bool {
-	return (sm.pio.hw.FSTAT.Get() & (1 << (rp.PIO0_FSTAT_TXEMPTY_Pos + sm.index))) != 0
+	return (sm.pio.hw.FSTAT.Get() & (1 << (pio0_FSTAT_TXEMPTY_Pos + sm.index))) != 0
 }
 
 // IsTxFIFOFull returns true if state machine's TX FIFO is full.
 func (sm StateMachine) IsTxFIFOFull() bool {
-	return (sm.pio.hw.FSTAT.Get() & (1 << (rp.PIO0_FSTAT_TXFULL_Pos + sm.index))) != 0
+	return (sm.pio.hw.FSTAT.Get() & (1 << (pio0_FSTAT_TXFULL_Pos + sm.index))) != 0
 }
 
 // IsRxFIFOEmpty returns true if state machine's RX FIFO is empty.
 func (sm StateMachine) IsRxFIFOEmpty() bool {
-	return (sm.pio.hw.FSTAT.Get() & (1 << (rp.PIO0_FSTAT_RXEMPTY_Pos + sm.index))) != 0
+	return (sm.pio.hw.FSTAT.Get() & (1 << (pio0_FSTAT_RXEMPTY_Pos + sm.index))) != 0
 }
 
 // IsRxFIFOFull returns true if state machine's RX FIFO is full.
 func (sm StateMachine) IsRxFIFOFull() bool {
-	return (sm.pio.hw.FSTAT.Get() & (1 << (rp.PIO0_FSTAT_RXFULL_Pos + sm.index))) != 0
+	return (sm.pio.hw.FSTAT.Get() & (1 << (pio0_FSTAT_RXFULL_Pos + sm.index))) != 0
 }
 
 // IsTxStalled returns true if state machine has stalled.
 // This value is sticky so it must be cleared with [StateMachine.ClearTxStalled] after reading true to be reset.
 func (sm StateMachine) HasTxStalled() bool {
-	return sm.pio.hw.FDEBUG.HasBits(1 << (rp.PIO0_FDEBUG_TXSTALL_Pos + sm.index))
+	return sm.pio.hw.FDEBUG.HasBits(1 << (pio0_FDEBUG_TXSTALL_Pos + sm.index))
 }
 
 // ClearTxStalled clears the value of tx stall. See [StateMachine.HasTxStalled].
 func (sm StateMachine) ClearTxStalled() {
-	sm.pio.hw.FDEBUG.Set(1 << (rp.PIO0_FDEBUG_TXSTALL_Pos + sm.index))
+	sm.pio.hw.FDEBUG.Set(1 << (pio0_FDEBUG_TXSTALL_Pos + sm.index))
 }
 
 // ClearFIFOs clears the TX and RX FIFOs of a state machine.
@@ -208,8 +219,8 @@ func (sm StateMachine) ClearFIFOs() {
 	hw := sm.HW()
 	shiftctl := &hw.SHIFTCTRL
 	// FIFOs are flushed when this bit is changed. Xoring twice returns bit to original state.
-	xorBits(shiftctl, rp.PIO0_SM0_SHIFTCTRL_FJOIN_RX_Msk)
-	xorBits(shiftctl, rp.PIO0_SM0_SHIFTCTRL_FJOIN_RX_Msk)
+	xorBits(shiftctl, pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk)
+	xorBits(shiftctl, pio0_SM0_SHIFTCTRL_FJOIN_RX_Msk)
 }
 
 // GetRxFIFOAt reads data from the RX FIFO at a specific index.
@@ -231,13 +242,13 @@ func (sm StateMachine) Exec(instr uint16) {
 
 // SetPindirsConsecutive sets a range of pins to either 'in' or 'out'. This must be done
 // for all used pins before the state machine is started, including SET, IN, OUT and SIDESET pins.
-func (sm StateMachine) SetPindirsConsecutive(pin machine.Pin, count uint8, isOut bool) {
+func (sm StateMachine) SetPindirsConsecutive(pin Pin, count uint8, isOut bool) {
 	checkPinBaseAndCount(pin, count)
 	sm.SetPindirsMasked(makePinmask(uint8(pin), count, uint8(boolToBit(isOut))))
 }
 
 // SetPinsConsecutive sets a range of pins initial starting values.
-func (sm StateMachine) SetPinsConsecutive(pin machine.Pin, count uint8, level bool) {
+func (sm StateMachine) SetPinsConsecutive(pin Pin, count uint8, level bool) {
 	checkPinBaseAndCount(pin, count)
 	sm.SetPinsMasked(makePinmask(uint8(pin), count, uint8(boolToBit(level))))
 }
@@ -270,7 +281,7 @@ func (sm StateMachine) setPinExec(dest SetDest, valueMask, pinMask uint32) {
 	hw := sm.HW()
 	pinctrlSaved := hw.PINCTRL.Get()
 	execctrlSaved := hw.EXECCTRL.Get()
-	hw.EXECCTRL.ClearBits(1 << rp.PIO0_SM0_EXECCTRL_OUT_STICKY_Pos)
+	hw.EXECCTRL.ClearBits(1 << pio0_SM0_EXECCTRL_OUT_STICKY_Pos)
 	// select the algorithm to use. Naive or the pico-sdk way.
 	const naive = true
 	if naive {
@@ -279,8 +290,8 @@ func (sm StateMachine) setPinExec(dest SetDest, valueMask, pinMask uint32) {
 				continue
 			}
 			hw.PINCTRL.Set(
-				1<<rp.PIO0_SM0_PINCTRL_SET_COUNT_Pos |
-					uint32(i)<<rp.PIO0_SM0_PINCTRL_SET_BASE_Pos,
+				1<<pio0_SM0_PINCTRL_SET_COUNT_Pos |
+					uint32(i)<<pio0_SM0_PINCTRL_SET_BASE_Pos,
 			)
 			value := 0x1 & uint8(valueMask>>i)
 			sm.Exec(assm.Set(dest, value).Encode())
@@ -291,8 +302,8 @@ func (sm StateMachine) setPinExec(dest SetDest, valueMask, pinMask uint32) {
 			base := uint32(bits.TrailingZeros32(pinMask))
 
 			hw.PINCTRL.Set(
-				1<<rp.PIO0_SM0_PINCTRL_SET_COUNT_Pos |
-					base<<rp.PIO0_SM0_PINCTRL_SET_BASE_Pos,
+				1<<pio0_SM0_PINCTRL_SET_COUNT_Pos |
+					base<<pio0_SM0_PINCTRL_SET_BASE_Pos,
 			)
 
 			value := 0x1 & uint8(valueMask>>base)
@@ -311,9 +322,9 @@ func (sm StateMachine) SetWrap(target, wrap uint8) {
 	}
 	hw := sm.HW()
 	hw.EXECCTRL.ReplaceBits(
-		(uint32(target)<<rp.PIO0_SM0_EXECCTRL_WRAP_BOTTOM_Pos)|
-			(uint32(wrap)<<rp.PIO0_SM0_EXECCTRL_WRAP_TOP_Pos),
-		rp.PIO0_SM0_EXECCTRL_WRAP_TOP_Msk|rp.PIO0_SM0_EXECCTRL_WRAP_BOTTOM_Msk,
+		(uint32(target)<<pio0_SM0_EXECCTRL_WRAP_BOTTOM_Pos)|
+			(uint32(wrap)<<pio0_SM0_EXECCTRL_WRAP_TOP_Pos),
+		pio0_SM0_EXECCTRL_WRAP_TOP_Msk|pio0_SM0_EXECCTRL_WRAP_BOTTOM_Msk,
 		0,
 	)
 }
@@ -365,32 +376,3 @@ func (sm StateMachine) getDst(dst InSrc) uint32 {
 func (sm StateMachine) Jmp(cond JmpCond, toAddr uint8) {
 	sm.Exec(assm.Jmp(cond, toAddr).Encode())
 }
-
-const (
-	// regAliasRW  = 0x0 << 12
-	regAliasXOR = 0x1 << 12
-	regAliasSET = 0x2 << 12
-	regAliasCLR = 0x3 << 12
-)
-
-// Gets the 'XOR' alias for a register
-//
-// Registers have 'ALIAS' registers with special semantics, see
-// 2.1.2. Atomic Register Access in the RP2040 Datasheet
-//
-// Each peripheral register block is allocated 4kB of address space, with registers accessed using one of 4 methods,
-// selected by address decode.
-//   - Addr + 0x0000 : normal read write access
-//   - Addr + 0x1000 : atomic XOR on write
-//   - Addr + 0x2000 : atomic bitmask set on write
-//   - Addr + 0x3000 : atomic bitmask clear on write
-//
-//go:inline
-func aliasReg(alias uintptr, reg *volatile.Register32) *volatile.Register32 {
-	alias = uintptr(unsafe.Pointer(reg)) | alias
-	return (*volatile.Register32)(unsafe.Pointer(alias))
-}
-
-func xorBits(reg *volatile.Register32, bits uint32) {
-	aliasReg(regAliasXOR, reg).Set(bits)
-}
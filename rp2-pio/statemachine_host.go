@@ -0,0 +1,29 @@
+//go:build !rp2040 && !rp2350
+
+package pio
+
+func (sm StateMachine) setConfig(cfg StateMachineConfig) {
+	sm.PIO().BlockIndex() // Panic if PIO or state machine not at valid offset.
+	if sm.index > 3 {
+		panic(badStateMachineIndex)
+	}
+	hw := sm.HW()
+	hw.CLKDIV.Set(cfg.ClkDiv)
+	hw.EXECCTRL.Set(cfg.ExecCtrl)
+	hw.SHIFTCTRL.Set(cfg.ShiftCtrl)
+	hw.PINCTRL.Set(cfg.PinCtrl)
+}
+
+func (sm StateMachine) isValid() bool {
+	return sm.pio != nil && sm.index <= 3 && sm.pio.hw != nil && sm.pio.hw.CTRL.dev != nil
+}
+
+func (sm StateMachine) getRxFIFOAt(fifoIndex int) uint32 {
+	pioHW := sm.pio.HW()
+	return pioHW.RXF_PUTGET[0][sm.index][fifoIndex].Get()
+}
+
+func (sm StateMachine) setRxFIFOAt(data uint32, fifoIndex int) {
+	pioHW := sm.pio.HW()
+	pioHW.RXF_PUTGET[0][sm.index][fifoIndex].Set(data)
+}
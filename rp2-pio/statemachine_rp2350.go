@@ -2,10 +2,6 @@
 
 package pio
 
-import (
-	"device/rp"
-)
-
 func (sm StateMachine) setConfig(cfg StateMachineConfig) {
 	sm.PIO().BlockIndex() // Panic if PIO or state machine not at valid offset.
 	if sm.index > 3 {
@@ -20,7 +16,7 @@ func (sm StateMachine) setConfig(cfg StateMachineConfig) {
 
 func (sm StateMachine) isValid() bool {
 	return sm.pio != nil && sm.index <= 3 &&
-		(sm.pio.hw == rp.PIO0 || sm.pio.hw == rp.PIO1 || sm.pio.hw == rp.PIO2)
+		(sm.pio.hw == PIO0.hw || sm.pio.hw == PIO1.hw || sm.pio.hw == PIO2.hw)
 }
 
 func (sm StateMachine) getRxFIFOAt(fifoIndex int) uint32 {
@@ -0,0 +1,337 @@
+package pio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// PinSource selects which pin mapping of a state machine a timing analysis tracks.
+type PinSource uint8
+
+const (
+	// PinSourceSet tracks pins written by `set pins`.
+	PinSourceSet PinSource = iota
+	// PinSourceSideset tracks side-set pins.
+	PinSourceSideset
+	// PinSourceOut tracks pins written by `out pins` and `mov pins`. Their level is data dependent.
+	PinSourceOut
+)
+
+// Pin levels reported in [TimingEdge].
+const (
+	LevelLow     int8 = 0
+	LevelHigh    int8 = 1
+	LevelUnknown int8 = -1 // Level depends on data, i.e: `out pins`.
+)
+
+// maxTimingPeriods bounds the number of paths explored by [AssembledProgram.AnalyzeTiming].
+const maxTimingPeriods = 256
+
+var errTooManyPaths = errors.New("pio: too many execution paths to analyze timing")
+
+// TimingEdge is a write to the tracked pin.
+type TimingEdge struct {
+	Instr uint8 // Index of the instruction writing the pin.
+	Cycle int   // Cycle at which the instruction starts, counted from the start of the period.
+	Level int8  // Level written to the pin. One of LevelLow, LevelHigh or LevelUnknown.
+}
+
+// TimingPeriod is an execution path starting at the analysis start instruction and
+// returning to it, i.e: one bit of a serial protocol.
+type TimingPeriod struct {
+	// Path holds the indices of the executed instructions.
+	Path []uint8
+	// Edges holds the writes to the tracked pin along the path. The first edge is the start instruction.
+	Edges []TimingEdge
+	// Cycles is the length of the period in state machine cycles, including delays.
+	Cycles int
+	// High, Low and Unknown are the number of cycles the tracked pin spends at each level.
+	High, Low, Unknown int
+	// Stalls is true if the path contains instructions which may stall, such as `wait` or a blocking `pull`.
+	// Cycles is then the minimum length of the period.
+	Stalls bool
+	// DataDependent is true if the path contains a loop not passing through the start instruction,
+	// whose iteration count depends on X, Y or OSR state. Cycles then counts a single iteration.
+	DataDependent bool
+}
+
+// TimingReport is the result of a static timing analysis. See [AssembledProgram.AnalyzeTiming].
+type TimingReport struct {
+	// Start is the index of the instruction periods start and end at.
+	Start uint8
+	// Periods holds all execution paths from Start back to Start.
+	Periods []TimingPeriod
+	// Loops holds the indices of the instructions closing loops which do not pass through Start.
+	// The timing of paths through them depends on register values.
+	Loops []uint8
+	// Stalls holds the indices of instructions which may stall.
+	Stalls []uint8
+}
+
+// AnalyzeTiming walks the control flow of the program from instruction start, which must write the pin
+// selected by src and pin, and reports the cycle count and pin levels of every path returning to start.
+// pin is the bit index within the pin group of src, i.e: 0 for the first side-set pin.
+//
+// Every instruction takes a single cycle plus its delay. Conditional jumps are considered both taken and
+// not taken since register values are not known. Instructions which may stall are flagged, as are loops
+// whose iteration count depends on register values, which are analyzed as a single iteration.
+// Instructions modifying the program counter from data (`out pc`, `mov pc`, `out exec`, `mov exec`) are not supported.
+func (p *AssembledProgram) AnalyzeTiming(src PinSource, pin uint8, start uint8) (*TimingReport, error) {
+	n := len(p.Instructions)
+	if int(start) >= n {
+		return nil, fmt.Errorf("pio: timing start %d out of range", start)
+	}
+	instrs, err := p.decode()
+	if err != nil {
+		return nil, err
+	}
+	for i := range instrs {
+		if instrs[i].modifiesPC() {
+			return nil, fmt.Errorf("pio: instruction %d has data dependent control flow", i)
+		}
+	}
+	a := timingAnalyzer{
+		prog:    p,
+		instrs:  instrs,
+		src:     src,
+		pin:     pin,
+		report:  &TimingReport{Start: start},
+		onPath:  make([]bool, n),
+		loops:   make([]bool, n),
+		stalled: make([]bool, n),
+	}
+	if _, ok := a.pinWrite(start); !ok {
+		return nil, fmt.Errorf("pio: timing start instruction %d does not write the tracked pin", start)
+	}
+	if err := a.walk(start, 0, false); err != nil {
+		return nil, err
+	}
+	for i := range instrs {
+		if a.loops[i] {
+			a.report.Loops = append(a.report.Loops, uint8(i))
+		}
+		if a.stalled[i] {
+			a.report.Stalls = append(a.report.Stalls, uint8(i))
+		}
+	}
+	return a.report, nil
+}
+
+type timingAnalyzer struct {
+	prog    *AssembledProgram
+	instrs  []Instruction
+	src     PinSource
+	pin     uint8
+	report  *TimingReport
+	path    []uint8
+	edges   []TimingEdge
+	onPath  []bool
+	loops   []bool
+	stalled []bool
+}
+
+// walk executes instruction pc starting at cycle and follows all its successors.
+func (a *timingAnalyzer) walk(pc uint8, cycle int, looped bool) error {
+	if pc == a.report.Start && len(a.path) > 0 {
+		return a.finishPeriod(cycle, looped)
+	}
+	in := &a.instrs[pc]
+	a.onPath[pc] = true
+	a.path = append(a.path, pc)
+	nedges := len(a.edges)
+	if level, ok := a.pinWrite(pc); ok {
+		a.edges = append(a.edges, TimingEdge{Instr: pc, Cycle: cycle, Level: level})
+	}
+	if in.mayStall() {
+		a.stalled[pc] = true
+	}
+	cycle += 1 + int(in.Delay)
+	for _, next := range a.successors(pc) {
+		if a.onPath[next] && next != a.report.Start {
+			// Loop not passing through start: count a single iteration and continue after it.
+			a.loops[pc] = true
+			continue
+		}
+		if err := a.walk(next, cycle, looped || a.closesLoop(pc)); err != nil {
+			return err
+		}
+	}
+	a.onPath[pc] = false
+	a.path = a.path[:len(a.path)-1]
+	a.edges = a.edges[:nedges]
+	return nil
+}
+
+// closesLoop reports whether one of the successors of pc is already on the current path.
+func (a *timingAnalyzer) closesLoop(pc uint8) bool {
+	for _, next := range a.successors(pc) {
+		if a.onPath[next] && next != a.report.Start {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *timingAnalyzer) finishPeriod(cycles int, looped bool) error {
+	if len(a.report.Periods) >= maxTimingPeriods {
+		return errTooManyPaths
+	}
+	period := TimingPeriod{
+		Path:          append([]uint8(nil), a.path...),
+		Edges:         append([]TimingEdge(nil), a.edges...),
+		Cycles:        cycles,
+		DataDependent: looped,
+	}
+	for i, edge := range period.Edges {
+		end := cycles
+		if i+1 < len(period.Edges) {
+			end = period.Edges[i+1].Cycle
+		}
+		switch edge.Level {
+		case LevelHigh:
+			period.High += end - edge.Cycle
+		case LevelLow:
+			period.Low += end - edge.Cycle
+		default:
+			period.Unknown += end - edge.Cycle
+		}
+	}
+	for _, pc := range period.Path {
+		period.Stalls = period.Stalls || a.instrs[pc].mayStall()
+	}
+	a.report.Periods = append(a.report.Periods, period)
+	return nil
+}
+
+// successors returns the instructions which may execute after instruction pc.
+func (a *timingAnalyzer) successors(pc uint8) []uint8 {
+	return successors(a.instrs, pc, a.prog.WrapTarget, a.prog.Wrap)
+}
+
+// decode decodes the program's instructions, checking jumps stay within the program.
+func (p *AssembledProgram) decode() ([]Instruction, error) {
+	instrs := make([]Instruction, len(p.Instructions))
+	for i, instr := range p.Instructions {
+		if err := instrs[i].Decode(instr, p.SidesetBits, p.SidesetOptional, p.PIOVersion); err != nil {
+			return nil, fmt.Errorf("%w (instruction %d)", err, i)
+		} else if instrs[i].Kind == InstrJMP && int(instrs[i].Address) >= len(instrs) {
+			return nil, fmt.Errorf("pio: instruction %d jumps past the end of the program", i)
+		}
+	}
+	return instrs, nil
+}
+
+// successors returns the instructions which may execute after instruction pc of a program
+// wrapping from wrap to wrapTarget. Program counter writes from data are not followed.
+func successors(instrs []Instruction, pc, wrapTarget, wrap uint8) []uint8 {
+	next := pc + 1
+	if pc == wrap {
+		next = wrapTarget
+	} else if int(next) >= len(instrs) {
+		next = 0
+	}
+	in := &instrs[pc]
+	if in.Kind != InstrJMP {
+		return []uint8{next}
+	} else if in.JmpCond == JmpAlways || in.Address == next {
+		return []uint8{in.Address}
+	}
+	return []uint8{in.Address, next}
+}
+
+// pinWrite returns the level instruction pc writes to the tracked pin, if it writes it.
+func (a *timingAnalyzer) pinWrite(pc uint8) (level int8, ok bool) {
+	in := &a.instrs[pc]
+	switch a.src {
+	case PinSourceSideset:
+		if in.SidesetBits > 0 && in.SideSetEnabled && a.pin < in.SidesetBits {
+			return int8(in.SideSet>>a.pin) & 1, true
+		}
+	case PinSourceSet:
+		if in.Kind == InstrSET && in.SetDest == SetDestPins && a.pin < 5 {
+			return int8(in.Data>>a.pin) & 1, true
+		}
+	case PinSourceOut:
+		if (in.Kind == InstrOUT && in.OutDest == OutDestPins && a.pin < in.BitCount) ||
+			(in.Kind == InstrMOV && in.RxFIFO == RxFIFONone && in.MovDest == MovDestPins) {
+			return LevelUnknown, true
+		}
+	}
+	return 0, false
+}
+
+// mayStall returns true if the instruction may take longer than its cycle count.
+func (in Instruction) mayStall() bool {
+	switch in.Kind {
+	case InstrWAIT:
+		return true
+	case InstrPUSH, InstrPULL:
+		return in.Block
+	case InstrIRQ:
+		return in.IRQWait && !in.IRQClear
+	}
+	return false
+}
+
+// modifiesPC returns true if the instruction jumps to an address, or executes an instruction, taken from data.
+func (in Instruction) modifiesPC() bool {
+	switch in.Kind {
+	case InstrOUT:
+		return in.OutDest == OutDestPC || in.OutDest == OutDestExec
+	case InstrMOV:
+		return in.RxFIFO == RxFIFONone && (in.MovDest == MovDestPC || in.MovDest == MovDestExec)
+	}
+	return false
+}
+
+// CycleRange returns the minimum and maximum period length in cycles.
+func (r *TimingReport) CycleRange() (min, max int) {
+	return r.rangeOf(func(p *TimingPeriod) int { return p.Cycles })
+}
+
+// HighRange returns the minimum and maximum cycles the tracked pin spends high per period.
+func (r *TimingReport) HighRange() (min, max int) {
+	return r.rangeOf(func(p *TimingPeriod) int { return p.High })
+}
+
+// LowRange returns the minimum and maximum cycles the tracked pin spends low per period.
+func (r *TimingReport) LowRange() (min, max int) {
+	return r.rangeOf(func(p *TimingPeriod) int { return p.Low })
+}
+
+func (r *TimingReport) rangeOf(value func(*TimingPeriod) int) (min, max int) {
+	for i := range r.Periods {
+		v := value(&r.Periods[i])
+		if i == 0 || v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return min, max
+}
+
+// CyclesToDuration converts a state machine cycle count to a duration for a clock divider as
+// returned by [ClkDivFromFrequency] and a CPU frequency in Hz. The result is truncated to the
+// nanosecond and saturates at the longest duration. It panics if cycles is negative.
+func CyclesToDuration(cycles int, whole uint16, frac uint8, cpuFreq uint32) time.Duration {
+	if cycles < 0 {
+		panic("pio: negative cycle count")
+	}
+	div := uint64(whole)<<8 | uint64(frac)
+	// cycles*div*1e9 needs up to 117 bits.
+	hi, lo := bits.Mul64(uint64(cycles), div*uint64(time.Second))
+	denom := uint64(cpuFreq) << 8
+	if hi >= denom {
+		return math.MaxInt64
+	}
+	ns, _ := bits.Div64(hi, lo, denom)
+	if ns > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(ns)
+}
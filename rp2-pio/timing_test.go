@@ -0,0 +1,229 @@
+package pio
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeTimingWS2812B(t *testing.T) {
+	asm := AssemblerV0{}
+	prog := NewProgram("ws2812b", asm)
+	prog.Add(asm.Pull(true, true))
+	prog.Label("bitloop")
+	prog.Add(asm.Set(SetDestPins, 1))
+	prog.Add(asm.Out(OutDestY, 1))
+	prog.Jmp(JmpYZero, "lolo")
+	prog.Jmp(JmpAlways, "hilo").Delay(2)
+	prog.Label("lolo")
+	prog.Add(asm.Set(SetDestPins, 0)).Delay(2)
+	prog.Label("hilo")
+	prog.Add(asm.Set(SetDestPins, 0))
+	prog.Jmp(JmpOSRNotEmpty, "bitloop").Delay(1)
+	program, err := prog.Assemble()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := program.AnalyzeTiming(PinSourceSet, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bit loop and the path through the blocking pull at the end of a 24 bit word.
+	if len(report.Periods) != 4 {
+		t.Fatalf("expected 4 periods, got %d", len(report.Periods))
+	}
+	if len(report.Loops) != 0 || len(report.Stalls) != 1 || report.Stalls[0] != 0 {
+		t.Errorf("unexpected loops %v or stalls %v", report.Loops, report.Stalls)
+	}
+	const cpuFreq = 125_000_000
+	whole, frac, err := ClkDivFromFrequency(uint32(1e9/(1250./9)), cpuFreq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// WS2812B datasheet: T0H 0.4us, T1H 0.8us, T0L 0.85us, T1L 0.45us, all ±150ns.
+	window := func(d, nominal time.Duration) bool {
+		return d >= nominal-150*time.Nanosecond && d <= nominal+150*time.Nanosecond
+	}
+	for _, period := range report.Periods {
+		if period.Stalls {
+			continue
+		}
+		if period.Cycles != 9 {
+			t.Errorf("path %v: expected 9 cycle bit period, got %d", period.Path, period.Cycles)
+		}
+		high := CyclesToDuration(period.High, whole, frac, cpuFreq)
+		low := CyclesToDuration(period.Low, whole, frac, cpuFreq)
+		isOne := period.High > period.Low
+		if isOne && !(window(high, 800*time.Nanosecond) && window(low, 450*time.Nanosecond)) {
+			t.Errorf("path %v: one bit out of spec: high %s low %s", period.Path, high, low)
+		} else if !isOne && !(window(high, 400*time.Nanosecond) && window(low, 850*time.Nanosecond)) {
+			t.Errorf("path %v: zero bit out of spec: high %s low %s", period.Path, high, low)
+		}
+	}
+}
+
+func TestAnalyzeTiming(t *testing.T) {
+	var tests = []struct {
+		name          string
+		file          string // Read source from file if set.
+		src           string
+		pins          PinSource
+		start         uint8
+		cycles        [2]int
+		high          [2]int
+		low           [2]int
+		loops         []uint8
+		dataDependent int // Number of periods through data dependent loops.
+	}{
+		{
+			name: "pulsar",
+			src: `
+.program pulsar
+	set pindirs, 1
+	pull block
+	mov x, osr
+loop:
+	set pins, 1 [1]
+	set pins, 0
+	jmp x-- loop
+`,
+			pins:   PinSourceSet,
+			start:  3,
+			cycles: [2]int{4, 7},
+			high:   [2]int{2, 2},
+			low:    [2]int{2, 5},
+		},
+		{
+			name: "spi3w clock",
+			src: `
+.program spi3w
+.side_set 1
+.wrap_target
+wloop:
+	out pins, 1  side 0
+	jmp x--, wloop side 1
+	jmp !y end   side 0
+	set pindirs, 0 side 0
+	nop side 0
+rloop:
+	in pins, 1   side 1
+	jmp y-- rloop side 0
+end:
+	wait 1 pin 0 side 0
+	irq nowait 0 side 0
+`,
+			pins:   PinSourceSideset,
+			start:  0,
+			cycles: [2]int{2, 9},
+			high:   [2]int{1, 2},
+			low:    [2]int{1, 7},
+			loops:  []uint8{6},
+			// Reading loop.
+			dataDependent: 1,
+		},
+		{
+			name:          "blink",
+			file:          "examples/blinky/blink.pio",
+			pins:          PinSourceSet,
+			start:         3,
+			cycles:        [2]int{6, 6},
+			high:          [2]int{3, 3},
+			low:           [2]int{3, 3},
+			loops:         []uint8{4, 7},
+			dataDependent: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := []byte(test.src)
+			if test.file != "" {
+				var err error
+				src, err = os.ReadFile(test.file)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			asm, err := ParseAssembly(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, err := asm.Programs[0].AnalyzeTiming(test.pins, 0, test.start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if min, max := report.CycleRange(); min != test.cycles[0] || max != test.cycles[1] {
+				t.Errorf("cycles mismatch got!=expected: %d..%d != %v", min, max, test.cycles)
+			}
+			if min, max := report.HighRange(); min != test.high[0] || max != test.high[1] {
+				t.Errorf("high mismatch got!=expected: %d..%d != %v", min, max, test.high)
+			}
+			if min, max := report.LowRange(); min != test.low[0] || max != test.low[1] {
+				t.Errorf("low mismatch got!=expected: %d..%d != %v", min, max, test.low)
+			}
+			if string(report.Loops) != string(test.loops) {
+				t.Errorf("loops mismatch got!=expected: %v != %v", report.Loops, test.loops)
+			}
+			dataDependent := 0
+			for _, period := range report.Periods {
+				if period.DataDependent {
+					dataDependent++
+				}
+			}
+			if dataDependent != test.dataDependent {
+				t.Errorf("data dependent periods mismatch got!=expected: %d != %d", dataDependent, test.dataDependent)
+			}
+		})
+	}
+}
+
+func TestAnalyzeTimingErrors(t *testing.T) {
+	asm := AssemblerV0{}
+	program := &AssembledProgram{
+		Instructions: []uint16{asm.Set(SetDestPins, 1).Encode(), asm.Out(OutDestPC, 5).Encode()},
+		Wrap:         1,
+	}
+	if _, err := program.AnalyzeTiming(PinSourceSet, 0, 0); err == nil {
+		t.Error("expected error for out pc")
+	}
+	program.Instructions[1] = asm.Nop().Encode()
+	if _, err := program.AnalyzeTiming(PinSourceSet, 0, 1); err == nil {
+		t.Error("expected error for start not writing pin")
+	}
+	if _, err := program.AnalyzeTiming(PinSourceSideset, 0, 0); err == nil {
+		t.Error("expected error for program without side-set")
+	}
+}
+
+func TestCyclesToDuration(t *testing.T) {
+	var tests = []struct {
+		name    string
+		cycles  int
+		whole   uint16
+		frac    uint8
+		cpuFreq uint32
+		want    time.Duration
+	}{
+		{name: "one cycle", cycles: 1, whole: 1, cpuFreq: 125_000_000, want: 8 * time.Nanosecond},
+		{name: "fractional divider", cycles: 3, whole: 17, frac: 92, cpuFreq: 125_000_000, want: 416 * time.Nanosecond},
+		{name: "zero", cycles: 0, whole: 65535, cpuFreq: 150_000_000, want: 0},
+		// cycles*div*1e9 used to overflow 64 bits past about 1100 cycles at the largest divider.
+		{name: "largest divider", cycles: 2000, whole: 65535, cpuFreq: 150_000_000, want: 873800 * time.Microsecond},
+		{name: "many cycles", cycles: 1_000_000_000, whole: 1, cpuFreq: 125_000_000, want: 8 * time.Second},
+		{name: "saturates", cycles: math.MaxInt64, whole: 65535, frac: 255, cpuFreq: 1, want: math.MaxInt64},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := CyclesToDuration(test.cycles, test.whole, test.frac, test.cpuFreq)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a negative cycle count to panic")
+		}
+	}()
+	CyclesToDuration(-1, 1, 0, 125_000_000)
+}
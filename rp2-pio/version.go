@@ -0,0 +1,50 @@
+package pio
+
+import "fmt"
+
+// RequiredPIOVersion returns the lowest PIO version able to execute instructions:
+// 1 if any instruction uses an encoding only available on RP2350, 0 otherwise.
+// Side-set and delay bits do not affect the result.
+func RequiredPIOVersion(instructions []uint16) uint8 {
+	var in Instruction
+	for _, instr := range instructions {
+		if in.decode(instr, 0, false, 0) != nil && in.decode(instr, 0, false, 1) == nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+// RequiredVersion returns the lowest PIO version implementing the configuration:
+// 1 if it joins the RX FIFO for random access (FJOIN_RX_GET/FJOIN_RX_PUT), limits the
+// IN pin count (IN_COUNT) or selects an IRQ flag as the MOV STATUS source, 0 otherwise.
+func (cfg *StateMachineConfig) RequiredVersion() uint8 {
+	const v1ShiftBits = pio0_SM0_SHIFTCTRL_FJOIN_RX_GET_Msk | pio0_SM0_SHIFTCTRL_FJOIN_RX_PUT_Msk |
+		pio0_SM0_SHIFTCTRL_IN_COUNT_Msk
+	if cfg.ShiftCtrl&v1ShiftBits != 0 ||
+		(cfg.ExecCtrl&pio0_SM0_EXECCTRL_STATUS_SEL_Msk)>>pio0_SM0_EXECCTRL_STATUS_SEL_Pos >= uint32(MovStatusIRQ) {
+		return 1
+	}
+	return 0
+}
+
+// RequiredVersion returns the lowest PIO version able to run the program, taking into
+// account its instructions and the configuration set by its directives.
+// It may be lower than the version the program was assembled for, see [AssembledProgram.PIOVersion].
+func (p *AssembledProgram) RequiredVersion() uint8 {
+	if RequiredPIOVersion(p.Instructions) > 0 || p.FifoJoin >= FifoJoinRxGet ||
+		(p.MovStatus != nil && p.MovStatus.Sel == MovStatusIRQ) {
+		return 1
+	}
+	return 0
+}
+
+// checkVersion returns an error if the program requires a newer PIO version than version.
+func (p *AssembledProgram) checkVersion(version uint8) error {
+	if p.PIOVersion > version {
+		return fmt.Errorf("pio: program %q requires PIO version %d", p.Name, p.PIOVersion)
+	} else if required := p.RequiredVersion(); required > version {
+		return fmt.Errorf("pio: program %q uses features of PIO version %d", p.Name, required)
+	}
+	return nil
+}
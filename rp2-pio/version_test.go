@@ -0,0 +1,80 @@
+package pio
+
+import "testing"
+
+func TestRequiredVersion(t *testing.T) {
+	asm0 := AssemblerV0{SidesetBits: 1}
+	asm1 := AssemblerV1{}
+	tests := []struct {
+		name   string
+		instrs []uint16
+		want   uint8
+	}{
+		{name: "v0", instrs: []uint16{asm0.Nop().Side(1).Delay(7).Encode(), asm0.Jmp(JmpPinInput, 0).Encode()}, want: 0},
+		{name: "mov pindirs", instrs: []uint16{asm0.Nop().Encode(), asm1.Mov(MovDestPindirs, MovSrcNull).Encode()}, want: 1},
+		{name: "wait jmppin", instrs: []uint16{asm1.WaitJmpPin(true, 1).Encode()}, want: 1},
+		{name: "mov rxfifo", instrs: []uint16{asm1.MovOSRFromRx(true, 2).Encode()}, want: 1},
+		{name: "irq next", instrs: []uint16{asm1.IRQSet(1, IRQNext).Encode()}, want: 1},
+		{name: "reserved", instrs: []uint16{asm0.Mov(MovDestISR, MovSrcISR).Encode() | 0b11<<3}, want: 0},
+	}
+	for _, tt := range tests {
+		if got := RequiredPIOVersion(tt.instrs); got != tt.want {
+			t.Errorf("%s: got version %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	cfg := DefaultStateMachineConfig()
+	if v := cfg.RequiredVersion(); v != 0 {
+		t.Errorf("default config: got version %d", v)
+	}
+	for _, join := range []FifoJoin{FifoJoinTx, FifoJoinRx} {
+		cfg := DefaultStateMachineConfig()
+		cfg.SetFIFOJoin(join)
+		if v := cfg.RequiredVersion(); v != 0 {
+			t.Errorf("FIFO join %d: got version %d", join, v)
+		}
+	}
+	for _, join := range []FifoJoin{FifoJoinRxGet, FifoJoinRxPut, FifoJoinRxPutGet} {
+		cfg := DefaultStateMachineConfig()
+		cfg.SetFIFOJoin(join)
+		if v := cfg.RequiredVersion(); v != 1 {
+			t.Errorf("FIFO join %d: got version %d", join, v)
+		}
+	}
+	cfg = DefaultStateMachineConfig()
+	cfg.SetInPins(3, 32)
+	if v := cfg.RequiredVersion(); v != 0 {
+		t.Errorf("IN_COUNT 32: got version %d", v)
+	}
+	cfg.SetInPins(3, 4)
+	if v := cfg.RequiredVersion(); v != 1 {
+		t.Errorf("IN_COUNT: got version %d", v)
+	}
+	cfg = DefaultStateMachineConfig()
+	cfg.SetMovStatus(MovStatusIRQ, 3)
+	if v := cfg.RequiredVersion(); v != 1 {
+		t.Errorf("MOV STATUS IRQ: got version %d", v)
+	}
+
+	prog := &AssembledProgram{Instructions: []uint16{asm0.Nop().Encode()}, SetCount: -1, Origin: -1}
+	if v := prog.RequiredVersion(); v != 0 {
+		t.Errorf("program: got version %d", v)
+	}
+	prog.FifoJoin = FifoJoinRxPutGet
+	if v := prog.RequiredVersion(); v != 1 {
+		t.Errorf("program with FIFO join: got version %d", v)
+	}
+	if err := prog.Validate(); err == nil {
+		t.Error("expected validation error for version 0 program using RX FIFO random access")
+	}
+	if err := prog.checkVersion(0); err == nil {
+		t.Error("expected error loading program on PIO version 0")
+	}
+	prog.PIOVersion = 1
+	if err := prog.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := prog.checkVersion(1); err != nil {
+		t.Error(err)
+	}
+}